@@ -0,0 +1,162 @@
+package observability
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	amdGPUBusyDesc = DescribeMeter(
+		"/gpu/busy",
+		"Percentage of time each GPU was busy running work, averaged by "+
+			"its firmware over a short window.",
+		Units("%"))
+	amdGPUMemoryBusyDesc = DescribeMeter(
+		"/gpu/memory_busy",
+		"Percentage of time the memory controller of each GPU was busy.",
+		Units("%"))
+	amdGPUVRAMUsedDesc = DescribeMeter(
+		"/gpu/vram_used",
+		"Dedicated video memory of each GPU that is in use.",
+		Units("By"))
+	amdGPUVRAMTotalDesc = DescribeMeter(
+		"/gpu/vram_total",
+		"Dedicated video memory of each GPU.",
+		Units("By"))
+	amdGPUGTTUsedDesc = DescribeMeter(
+		"/gpu/gtt_used",
+		"System memory mapped for each GPU through its graphics "+
+			"translation table that is in use, which work spills to when "+
+			"`/gpu/vram_used` nears `/gpu/vram_total`.",
+		Units("By"))
+	amdGPUGTTTotalDesc = DescribeMeter(
+		"/gpu/gtt_total",
+		"System memory that can be mapped for each GPU through its graphics "+
+			"translation table.",
+		Units("By"))
+	amdGPUPowerDesc = DescribeMeter(
+		"/gpu/power",
+		"Power drawn by each GPU, as averaged by its firmware.",
+		Units("uW"))
+	amdGPUPowerCapDesc = DescribeMeter(
+		"/gpu/power_cap",
+		"Power limit of each GPU, above which it is throttled.",
+		Units("uW"))
+	amdGPUTemperatureDesc = DescribeMeter(
+		"/gpu/temperature",
+		"Temperature of each sensor of each GPU: edge, at the die's edge; "+
+			"junction, its hottest spot; and mem, its memory. Negative "+
+			"temperatures are not sampled.",
+		Units("mCel"))
+	amdGPUFanSpeedDesc = DescribeMeter(
+		"/gpu/fan_speed",
+		"Speed of the fan of each GPU.",
+		Units("1/min"))
+)
+
+// amdGPUDeviceFiles are the files of the PCI device of each GPU that are
+// sampled, and the descriptions of their meters.
+var amdGPUDeviceFiles = []struct {
+	name string
+	desc MeterDescription
+}{
+	{"gpu_busy_percent", amdGPUBusyDesc},
+	{"mem_busy_percent", amdGPUMemoryBusyDesc},
+	{"mem_info_vram_used", amdGPUVRAMUsedDesc},
+	{"mem_info_vram_total", amdGPUVRAMTotalDesc},
+	{"mem_info_gtt_used", amdGPUGTTUsedDesc},
+	{"mem_info_gtt_total", amdGPUGTTTotalDesc},
+}
+
+// amdGPUHwmonFiles are the files of the hwmon device of each GPU that are
+// sampled, by their alternative names, of which the first present is used.
+// Newer GPUs report the power as power1_input rather than power1_average.
+var amdGPUHwmonFiles = []struct {
+	names []string
+	desc  MeterDescription
+}{
+	{[]string{"power1_average", "power1_input"}, amdGPUPowerDesc},
+	{[]string{"power1_cap"}, amdGPUPowerCapDesc},
+	{[]string{"fan1_input"}, amdGPUFanSpeedDesc},
+}
+
+// RegisterAMDGPUStats registers meters of the AMD GPUs in /sys/class/drm with
+// o, read from the sysfs files of the amdgpu driver, so that GPU hosts can be
+// monitored without a vendor library: their utilization, the use of their
+// video memory, and their power, temperatures, and fan speed from their hwmon
+// devices. The meters are labeled with the card, such as card0, and those of
+// temperatures also with the sensor. They are those of the GPUs, and their
+// files, present at registration. The files stay open for the life of the
+// Origin.
+func RegisterAMDGPUStats(o *Origin) error {
+	return registerAMDGPUStats(o, "/sys/class/drm")
+}
+
+func registerAMDGPUStats(o *Origin, dir string) error {
+	cards, err := filepath.Glob(filepath.Join(dir, "card*"))
+	if err != nil {
+		return err
+	}
+	// register registers the meter of a file, if it exists.
+	register := func(path string, m Meter) (bool, error) {
+		err := RegisterSysfsMeter(o, path, m)
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	for _, card := range cards {
+		name := filepath.Base(card)
+		// Connectors, such as card0-DP-1, are skipped.
+		if strings.Contains(name, "-") {
+			continue
+		}
+		// So are GPUs of other drivers.
+		device := filepath.Join(card, "device")
+		driver, err := os.Readlink(filepath.Join(device, "driver"))
+		if err != nil || filepath.Base(driver) != "amdgpu" {
+			continue
+		}
+		label := Label{Key: "card", Value: name}
+		for _, f := range amdGPUDeviceFiles {
+			if _, err := register(filepath.Join(device, f.name), DefineGauge(f.desc, label)); err != nil {
+				return err
+			}
+		}
+		hwmons, err := filepath.Glob(filepath.Join(device, "hwmon", "hwmon*"))
+		if err != nil {
+			return err
+		}
+		for _, hwmon := range hwmons {
+			for _, f := range amdGPUHwmonFiles {
+				for _, file := range f.names {
+					ok, err := register(filepath.Join(hwmon, file), DefineGauge(f.desc, label))
+					if err != nil {
+						return err
+					}
+					if ok {
+						break
+					}
+				}
+			}
+			temps, err := filepath.Glob(filepath.Join(hwmon, "temp*_input"))
+			if err != nil {
+				return err
+			}
+			for _, temp := range temps {
+				sensor := strings.TrimSuffix(filepath.Base(temp), "_input")
+				if s, err := readSysfsString(filepath.Join(hwmon, sensor+"_label")); err == nil {
+					sensor = s
+				}
+				m := DefineGauge(amdGPUTemperatureDesc, label, Label{Key: "sensor", Value: sensor})
+				if err := RegisterSysfsMeter(o, temp, m); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
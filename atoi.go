@@ -0,0 +1,160 @@
+package observability
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// These are variants of naiveAtoi for the other integer formats found in /proc
+// and /sys. Like naiveAtoi, they trust their input, and never allocate.
+
+// naiveAtoiSigned converts the text representation of a decimal number, with
+// an optional leading minus sign, to an int64, for the kernel fields that are
+// occasionally negative, such as MaxConn in /proc/net/snmp.
+func naiveAtoiSigned(b []byte) int64 {
+	if len(b) > 0 && b[0] == '-' {
+		return -int64(naiveAtoi(b[1:]))
+	}
+	return int64(naiveAtoi(b))
+}
+
+// hexDigits maps hexadecimal digits to their values.
+var hexDigits = [256]uint8{
+	'0': 0, '1': 1, '2': 2, '3': 3, '4': 4, '5': 5, '6': 6, '7': 7, '8': 8, '9': 9,
+	'a': 10, 'b': 11, 'c': 12, 'd': 13, 'e': 14, 'f': 15,
+	'A': 10, 'B': 11, 'C': 12, 'D': 13, 'E': 14, 'F': 15,
+}
+
+// naiveAtoiHex converts the text representation of a hexadecimal number, with
+// an optional 0x prefix, to a uint64, for sysfs values such as 0x1f.
+func naiveAtoiHex(b []byte) uint64 {
+	if len(b) > 1 && b[0] == '0' && (b[1] == 'x' || b[1] == 'X') {
+		b = b[2:]
+	}
+	rv := uint64(0)
+	for _, c := range b {
+		rv = rv<<4 | uint64(hexDigits[c])
+	}
+	return rv
+}
+
+// pow10 holds the powers of ten that are exactly representable as float64.
+var pow10 = [...]float64{1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10,
+	1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20, 1e21, 1e22}
+
+// naiveDecimal splits the text representation of a decimal number with an
+// optional minus sign and fractional part, such as "0.85" or "-12.5", into its
+// digits as an integer and the number of them after the point.
+func naiveDecimal(b []byte) (neg bool, mantissa uint64, frac int) {
+	if len(b) > 0 && b[0] == '-' {
+		neg = true
+		b = b[1:]
+	}
+	point := -1
+	for i, c := range b {
+		if c == '.' {
+			point = i
+			continue
+		}
+		mantissa = mantissa*10 + uint64(c-'0')
+	}
+	if point >= 0 {
+		frac = len(b) - point - 1
+	}
+	return neg, mantissa, frac
+}
+
+// naiveAtofMicro converts the text representation of a decimal number, such as
+// a load average "0.85" or the PSI value in "avg10=0.12" after the "=", to an
+// integer in millionths, so 0.85 becomes 850000. Digits beyond the sixth after
+// the point are truncated.
+func naiveAtofMicro(b []byte) int64 {
+	neg, m, frac := naiveDecimal(b)
+	for ; frac > 6; frac-- {
+		m /= 10
+	}
+	for ; frac < 6; frac++ {
+		m *= 10
+	}
+	if neg {
+		return -int64(m)
+	}
+	return int64(m)
+}
+
+// naiveAtof converts the text representation of a decimal number to a float64.
+// The result is correctly rounded when there are at most 15 significant digits
+// and 22 after the point, which covers the fixed-precision values in /proc;
+// longer inputs lose precision.
+func naiveAtof(b []byte) float64 {
+	neg, m, frac := naiveDecimal(b)
+	f := float64(m)
+	if frac < len(pow10) {
+		f /= pow10[frac]
+	} else {
+		for ; frac > 0; frac-- {
+			f /= 10
+		}
+	}
+	if neg {
+		return -f
+	}
+	return f
+}
+
+// checkedAtoi is like naiveAtoi, except that it reports whether b is an
+// unsigned decimal integer that fits in a uint64. Non-digits are detected
+// without a branch per byte, by accumulating the sign of 9 minus each digit.
+// Numbers of up to 19 digits can't overflow, so only the rare 20-digit number
+// needs checking.
+func checkedAtoi(b []byte) (uint64, bool) {
+	if len(b) == 0 || len(b) > 20 {
+		return 0, false
+	}
+	rv := uint64(0)
+	bad := 0
+	for _, c := range b {
+		d := c - '0'
+		bad |= 9 - int(d)
+		rv = rv*10 + uint64(d)
+	}
+	if bad < 0 {
+		return 0, false
+	}
+	if len(b) == 20 {
+		// The value wrapped if it is less than its first 19 digits
+		// times ten.
+		hi := naiveAtoi(b[:19])
+		if hi > math.MaxUint64/10 || rv < hi*10 {
+			return 0, false
+		}
+	}
+	return rv, true
+}
+
+// swarDigits converts exactly eight ASCII digits to their value, handling all
+// eight at once within a uint64 (SIMD within a register): each step combines
+// adjacent lanes into lanes of twice the width, pairs of digits, then of
+// pairs, then of quads. The first digit is the low byte, since the load is
+// little-endian.
+func swarDigits(b []byte) uint64 {
+	v := binary.LittleEndian.Uint64(b) - 0x3030303030303030
+	v = (v*10 + v>>8) & 0x00ff00ff00ff00ff
+	v = (v*100 + v>>16) & 0x0000ffff0000ffff
+	return (v*10000 + v>>32) & 0xffffffff
+}
+
+// swarAtoi is naiveAtoi for long numbers. It converts any leading digits
+// naively, and the rest eight at a time with swarDigits. It pays off from
+// about eight digits, which is common for the byte and nanosecond counters of
+// busy machines in files such as /proc/fs/xfs/stat and /proc/vmstat, and is
+// about twice as fast as naiveAtoi from twelve; shorter numbers should use
+// naiveAtoi. See BenchmarkAtoiLength.
+func swarAtoi(b []byte) uint64 {
+	n := len(b) % 8
+	rv := naiveAtoi(b[:n])
+	for b = b[n:]; len(b) >= 8; b = b[8:] {
+		rv = rv*1e8 + swarDigits(b)
+	}
+	return rv
+}
@@ -0,0 +1,9 @@
+//go:build !(goexperiment.simd && amd64)
+
+package observability
+
+// longAtoi converts long numbers with swarAtoi. Build with GOEXPERIMENT=simd
+// on amd64 for a vector implementation.
+func longAtoi(b []byte) uint64 {
+	return swarAtoi(b)
+}
@@ -0,0 +1,36 @@
+//go:build goexperiment.simd && amd64
+
+package observability
+
+import (
+	"simd/archsimd"
+)
+
+// The multipliers of simdDigits. They are loaded where they are used, since
+// loads at init might use instructions the CPU lacks.
+var (
+	simdTens     = [16]int8{10, 1, 10, 1, 10, 1, 10, 1, 10, 1, 10, 1, 10, 1, 10, 1}
+	simdHundreds = [8]int16{100, 1, 100, 1, 100, 1, 100, 1}
+	simdTenK     = [8]int16{10000, 1, 10000, 1, 10000, 1, 10000, 1}
+)
+
+// simdDigits converts exactly sixteen ASCII digits to their value with vector
+// multiply-adds, in the manner of swarDigits, but sixteen lanes at a time.
+func simdDigits(b []byte) uint64 {
+	v := archsimd.LoadUint8x16(b[:16]).Sub(archsimd.BroadcastUint8x16('0'))
+	// Eight lanes of 0-99, then four of 0-9999, then two of 0-99999999.
+	pairs := v.DotProductPairsSaturated(archsimd.LoadInt8x16Array(&simdTens))
+	quads := pairs.DotProductPairs(archsimd.LoadInt16x8Array(&simdHundreds))
+	octs := quads.SaturateToInt16Concat(quads).DotProductPairs(archsimd.LoadInt16x8Array(&simdTenK))
+	return uint64(octs.GetElem(0))*1e8 + uint64(octs.GetElem(1))
+}
+
+// longAtoi converts long numbers sixteen digits at a time if the CPU supports
+// AVX, and otherwise with swarAtoi.
+func longAtoi(b []byte) uint64 {
+	if len(b) < 16 || !archsimd.X86.AVX() {
+		return swarAtoi(b)
+	}
+	n := len(b) - 16
+	return naiveAtoi(b[:n])*1e16 + simdDigits(b[n:])
+}
@@ -0,0 +1,165 @@
+package observability
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	diskQueueRequestsDesc = DescribeMeter(
+		"/disk/queue/requests",
+		"Maximum number of requests that may be queued to each block "+
+			"device, nr_requests.")
+	diskQueueRotationalDesc = DescribeMeter(
+		"/disk/queue/rotational",
+		"Whether each block device is rotational, 1, or solid state, 0.")
+	diskQueueMaxRequestSizeDesc = DescribeMeter(
+		"/disk/queue/max_request_size",
+		"Maximum size of the requests issued to each block device, "+
+			"max_sectors_kb.",
+		Units("By"))
+	diskQueueReadAheadDesc = DescribeMeter(
+		"/disk/queue/read_ahead",
+		"Size of the read-ahead of each block device, read_ahead_kb.",
+		Units("By"))
+	diskQueueSchedulerDesc = DescribeMeter(
+		"/disk/queue/scheduler",
+		"Whether each I/O scheduler available to each block device is the "+
+			"one in use, 1, or not, 0.")
+)
+
+// RegisterBlockQueueStats registers meters of the block devices accepted by
+// the filter, or by DefaultDiskFilter if it is nil, with o: the settings of
+// their request queues, from /sys/block/<device>/queue, and the meters of
+// RegisterDiskStats, from /sys/block/<device>/stat, so that saturation can be
+// correlated with configuration. It is an alternative to RegisterDiskStats,
+// which should not be registered with the same Origin. The meters are labeled
+// with the device name. The devices, and the schedulers available to them, are
+// those present at registration. The files stay open for the life of the
+// Origin.
+func RegisterBlockQueueStats(o *Origin, filter func(device string) bool) error {
+	return registerBlockQueueStats(o, "/sys/block", filter)
+}
+
+func registerBlockQueueStats(o *Origin, dir string, filter func(device string) bool) error {
+	if filter == nil {
+		filter = DefaultDiskFilter
+	}
+	devices, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, d := range devices {
+		if !filter(d.Name()) {
+			continue
+		}
+		if err := registerBlockDevice(o, filepath.Join(dir, d.Name()), d.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func registerBlockDevice(o *Origin, dir, device string) error {
+	var closers []io.Closer
+	fail := func(err error) error {
+		for _, c := range closers {
+			c.Close()
+		}
+		return err
+	}
+	open := func(name string) (*SysfsValue, error) {
+		v, err := OpenSysfsValue(filepath.Join(dir, "queue", name))
+		if err == nil {
+			closers = append(closers, v)
+		}
+		return v, err
+	}
+
+	// The stat file has the fields of /proc/diskstats after the device
+	// name.
+	statPath := filepath.Join(dir, "stat")
+	b, err := os.ReadFile(statPath)
+	if err != nil {
+		return err
+	}
+	disk := defineDiskMeters(device, len(bytes.Fields(b)))
+	var now time.Time
+	stat, err := NewFileScanner(statPath, NewRowScanner(func(fields [][]byte) {
+		sampleDiskMeters(disk, now, fields)
+	}))
+	if err != nil {
+		return err
+	}
+	closers = append(closers, stat)
+
+	label := Label{Key: "device", Value: device}
+	gauges := []struct {
+		name  string
+		m     Meter
+		scale uint64
+	}{
+		{"nr_requests", DefineGauge(diskQueueRequestsDesc, label), 1},
+		{"rotational", DefineGauge(diskQueueRotationalDesc, label), 1},
+		{"max_sectors_kb", DefineGauge(diskQueueMaxRequestSizeDesc, label), 1 << 10},
+		{"read_ahead_kb", DefineGauge(diskQueueReadAheadDesc, label), 1 << 10},
+	}
+	ms := disk
+	files := make([]*SysfsValue, len(gauges))
+	for i, g := range gauges {
+		if files[i], err = open(g.name); err != nil {
+			return fail(err)
+		}
+		ms = append(ms, g.m)
+	}
+
+	// The scheduler file lists the available schedulers, with the one in
+	// use in brackets, as in "none [mq-deadline] kyber bfq".
+	sched, err := open("scheduler")
+	if err != nil {
+		return fail(err)
+	}
+	s, err := sched.String()
+	if err != nil {
+		return fail(err)
+	}
+	var names []string
+	var schedulers []Meter
+	for _, name := range strings.Fields(s) {
+		name = strings.Trim(name, "[]")
+		names = append(names, name)
+		schedulers = append(schedulers, DefineGauge(diskQueueSchedulerDesc, label, Label{Key: "scheduler", Value: name}))
+	}
+	ms = append(ms, schedulers...)
+
+	o.RegisterFunction(func() {
+		now = time.Now()
+		stat.Scan()
+		for i, g := range gauges {
+			if v, err := files[i].Uint(); err == nil {
+				g.m.SampleAt(now, v*g.scale)
+			}
+		}
+		b, err := sched.Bytes()
+		if err != nil {
+			return
+		}
+		var active []byte
+		if i, j := bytes.IndexByte(b, '['), bytes.IndexByte(b, ']'); i >= 0 && j > i {
+			active = b[i+1 : j]
+		}
+		for i, name := range names {
+			var v uint64
+			// The conversion doesn't allocate.
+			if string(active) == name {
+				v = 1
+			}
+			schedulers[i].SampleAt(now, v)
+		}
+	}, ms...)
+	return nil
+}
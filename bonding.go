@@ -0,0 +1,168 @@
+package observability
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	bondUpDesc = DescribeMeter(
+		"/net/bond/up",
+		"Whether each bonding interface has a link, 1, or not, 0, its MII "+
+			"status. A bond stays up while any of its slaves is.")
+	bondSlaveUpDesc = DescribeMeter(
+		"/net/bond/slave/up",
+		"Whether each slave of each bonding interface has a link, 1, or "+
+			"not, 0. A bond with a slave down has lost its redundancy, "+
+			"and maybe bandwidth, while itself staying up.")
+	bondSlaveActiveDesc = DescribeMeter(
+		"/net/bond/slave/active",
+		"Whether each slave of each bonding interface in active-backup mode "+
+			"is the one carrying traffic, 1, or not, 0.")
+	bondSlaveLinkFailuresDesc = DescribeMeter(
+		"/net/bond/slave/link_failures",
+		"Number of times each slave of each bonding interface has lost its "+
+			"link.",
+		Cumulative())
+)
+
+// bondSlave holds the meters of a slave of a bonding interface.
+type bondSlave struct {
+	up, active, linkFailures Meter
+}
+
+// bondingScanner scans the files of /proc/net/bonding, whose lines are keys
+// and values separated by colons, as in "MII Status: up". The lines of the
+// bond come first, followed by a stanza for each slave, which begins with its
+// "Slave Interface" line.
+type bondingScanner struct {
+	// f is called for each line with a key and value, and the name of the
+	// slave whose stanza it is in, or nil for the lines of the bond. Each
+	// points into the input.
+	f func(slave, key, value []byte)
+}
+
+func (s *bondingScanner) Scan(b []byte) {
+	var slave []byte
+	for len(b) > 0 {
+		var line []byte
+		line, b = nextLine(b)
+		key, value, ok := bytes.Cut(line, []byte(":"))
+		if !ok {
+			continue
+		}
+		value = bytes.TrimSpace(value)
+		if string(key) == "Slave Interface" {
+			slave = value
+		}
+		s.f(slave, key, value)
+	}
+}
+
+// RegisterBondingStats registers meters of the bonding interfaces in
+// /proc/net/bonding with o: whether each bond and each of its slaves has a
+// link, which slave is active, and the link failures of each slave, so that
+// bonds that have silently lost redundancy show up. The meters are labeled
+// with the bond, and those of slaves also with the slave. The bonds and slaves
+// are those present at registration. Team interfaces, which are configured by
+// teamd rather than the kernel, aren't included. The files stay open for the
+// life of the Origin.
+func RegisterBondingStats(o *Origin) error {
+	return registerBondingStats(o, "/proc/net/bonding")
+}
+
+func registerBondingStats(o *Origin, dir string) error {
+	bonds, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, bond := range bonds {
+		if err := registerBond(o, filepath.Join(dir, bond.Name()), bond.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func registerBond(o *Origin, path, bond string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	label := Label{Key: "bond", Value: bond}
+	up := DefineGauge(bondUpDesc, label)
+	ms := []Meter{up}
+	// Only active-backup bonds have an active slave.
+	hasActive := false
+	slaves := make(map[string]*bondSlave)
+	var order []*bondSlave
+	(&bondingScanner{f: func(slave, key, _ []byte) {
+		switch {
+		case slave == nil && string(key) == "Currently Active Slave":
+			hasActive = true
+		case string(key) == "Slave Interface":
+			labels := []Label{label, {Key: "slave", Value: string(slave)}}
+			s := &bondSlave{
+				up:           DefineGauge(bondSlaveUpDesc, labels...),
+				active:       DefineGauge(bondSlaveActiveDesc, labels...),
+				linkFailures: DefineCounter(bondSlaveLinkFailuresDesc, labels...),
+			}
+			slaves[string(slave)] = s
+			order = append(order, s)
+			ms = append(ms, s.up, s.linkFailures)
+		}
+	}}).Scan(b)
+	if hasActive {
+		for _, s := range order {
+			ms = append(ms, s.active)
+		}
+	}
+
+	var now time.Time
+	var active []byte
+	fs, err := NewFileScanner(path, &bondingScanner{f: func(slave, key, value []byte) {
+		if slave == nil {
+			switch string(key) {
+			case "MII Status":
+				up.SampleAt(now, boolValue(string(value) == "up"))
+			case "Currently Active Slave":
+				active = value
+			}
+			return
+		}
+		// The conversion doesn't allocate.
+		s, ok := slaves[string(slave)]
+		if !ok {
+			return
+		}
+		switch string(key) {
+		case "Slave Interface":
+			if hasActive {
+				s.active.SampleAt(now, boolValue(bytes.Equal(slave, active)))
+			}
+		case "MII Status":
+			s.up.SampleAt(now, boolValue(string(value) == "up"))
+		case "Link Failure Count":
+			s.linkFailures.SampleAt(now, naiveAtoi(value))
+		}
+	}})
+	if err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		active = nil
+		fs.Scan()
+	}, ms...)
+	return nil
+}
+
+// boolValue returns 1 if b is true, or 0.
+func boolValue(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,129 @@
+package observability
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	kernelBootTimeDesc = DescribeMeter(
+		"/kernel/boot_time",
+		"Time at which the kernel booted, as a Unix time. It changes only "+
+			"when the host reboots, so its changes across a fleet show "+
+			"reboot waves.",
+		Units("s"))
+	kernelInfoDesc = DescribeMeter(
+		"/kernel/info",
+		"Always 1, labeled with the release and version of the running "+
+			"kernel, as printed by uname -r and uname -v. Counting Origins "+
+			"by release shows the progress of a kernel rollout.")
+	kernelRebootsDesc = DescribeMeter(
+		"/kernel/reboots",
+		"Number of times the host has booted since the state file of the "+
+			"collector was created, counted when the collector is first "+
+			"registered after each boot. Boots between which it is never "+
+			"registered count once.",
+		Cumulative())
+)
+
+var errBootStateMalformed = errors.New("observability: malformed boot state file")
+
+// countBoots returns the number of boots recorded in the state file at path,
+// counting the boot with the given ID if it is new, and the time at which the
+// file was created. The file holds the ID of the last boot recorded, the
+// number of boots since the first, and the Unix time at which it was created.
+// It is created if it doesn't exist, without counting the current boot.
+func countBoots(path, bootID string) (uint64, time.Time, error) {
+	last, count, since := bootID, uint64(0), uint64(time.Now().Unix())
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		fields := strings.Fields(string(b))
+		if len(fields) != 3 {
+			return 0, time.Time{}, errBootStateMalformed
+		}
+		last = fields[0]
+		if count, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+			return 0, time.Time{}, errBootStateMalformed
+		}
+		if since, err = strconv.ParseUint(fields[2], 10, 64); err != nil {
+			return 0, time.Time{}, errBootStateMalformed
+		}
+		if last == bootID {
+			return count, time.Unix(int64(since), 0), nil
+		}
+		count++
+	case !errors.Is(err, fs.ErrNotExist):
+		return 0, time.Time{}, err
+	}
+	// The file is replaced, so that it is never seen partly written.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, fmt.Appendf(nil, "%s %d %d\n", bootID, count, since), 0644); err != nil {
+		return 0, time.Time{}, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return 0, time.Time{}, err
+	}
+	return count, time.Unix(int64(since), 0), nil
+}
+
+// RegisterBootStats registers meters of the boot of the host with o: its boot
+// time, from /proc/stat, the release and version of the kernel, from
+// /proc/sys/kernel, and, unless stateFile is empty, the number of times the
+// host has booted. Boots are told apart by /proc/sys/kernel/random/boot_id, and
+// counted in stateFile, which must be on persistent storage, such as under
+// /var/lib, and is created if it doesn't exist. The values are read at
+// registration, and don't change until the next boot.
+func RegisterBootStats(o *Origin, stateFile string) error {
+	return registerBootStats(o, "/proc", stateFile)
+}
+
+func registerBootStats(o *Origin, proc, stateFile string) error {
+	btime, err := bootTime(filepath.Join(proc, "stat"))
+	if err != nil {
+		return err
+	}
+	release, err := readSysfsString(filepath.Join(proc, "sys", "kernel", "osrelease"))
+	if err != nil {
+		return err
+	}
+	version, err := readSysfsString(filepath.Join(proc, "sys", "kernel", "version"))
+	if err != nil {
+		return err
+	}
+	ms := []Meter{
+		DefineGauge(kernelBootTimeDesc),
+		DefineGauge(kernelInfoDesc, Label{Key: "release", Value: release}, Label{Key: "version", Value: version}),
+	}
+	var boots uint64
+	if stateFile != "" {
+		bootID, err := readSysfsString(filepath.Join(proc, "sys", "kernel", "random", "boot_id"))
+		if err != nil {
+			return err
+		}
+		var since time.Time
+		boots, since, err = countBoots(stateFile, bootID)
+		if err != nil {
+			return err
+		}
+		reboots := DefineCounter(kernelRebootsDesc)
+		reboots.ResetAt(since)
+		ms = append(ms, reboots)
+	}
+	o.RegisterFunction(func() {
+		now := time.Now()
+		ms[0].SampleAt(now, btime)
+		ms[1].SampleAt(now, 1)
+		if len(ms) > 2 {
+			ms[2].SampleAt(now, boots)
+		}
+	}, ms...)
+	return nil
+}
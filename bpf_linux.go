@@ -0,0 +1,338 @@
+package observability
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// sysBPF is the number of the bpf system call on each architecture, which the
+// syscall package only defines for some.
+var sysBPF = map[string]uintptr{
+	"386":     357,
+	"amd64":   321,
+	"arm":     386,
+	"arm64":   280,
+	"loong64": 280,
+	"ppc64le": 361,
+	"riscv64": 280,
+	"s390x":   351,
+}[runtime.GOARCH]
+
+// The commands of the bpf system call, and the types of maps with a value per
+// CPU.
+const (
+	bpfMapLookupElem        = 1
+	bpfMapGetNextKey        = 4
+	bpfObjGet               = 7
+	bpfObjGetInfoByFD       = 15
+	bpfMapTypePercpuHash    = 5
+	bpfMapTypePercpuArray   = 6
+	bpfMapTypeLRUPercpuHash = 10
+)
+
+// bpfMapInfo is the beginning of struct bpf_map_info, which only grows.
+type bpfMapInfo struct {
+	typ        uint32
+	id         uint32
+	keySize    uint32
+	valueSize  uint32
+	maxEntries uint32
+	flags      uint32
+	name       [16]byte
+}
+
+// bpf calls the bpf system call with the command and its union bpf_attr.
+func bpf(cmd uintptr, attr unsafe.Pointer, size uintptr) (uintptr, error) {
+	if sysBPF == 0 {
+		return 0, os.NewSyscallError("bpf", syscall.ENOSYS)
+	}
+	r, _, errno := syscall.Syscall(sysBPF, cmd, uintptr(attr), size)
+	runtime.KeepAlive(attr)
+	if errno != 0 {
+		return 0, os.NewSyscallError("bpf", errno)
+	}
+	return r, nil
+}
+
+// BPFMap is a BPF map, such as one pinned in the BPF filesystem by the loader
+// of a program that collects statistics in it, whose entries can be read.
+type BPFMap struct {
+	fd   int
+	info bpfMapInfo
+	// cpus is the number of values of each entry: the number of possible
+	// CPUs for per-CPU maps, or 1.
+	cpus int
+	// stride is the size of each value of an entry, which is padded to 8
+	// bytes for per-CPU maps.
+	stride            int
+	key, next, values []byte
+}
+
+// OpenPinnedBPFMap opens the BPF map pinned at path, such as
+// /sys/fs/bpf/runqlat_hist. Opening it needs CAP_BPF or CAP_SYS_ADMIN,
+// depending on the permissions of the pin.
+func OpenPinnedBPFMap(path string) (*BPFMap, error) {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	attr := struct {
+		pathname uint64
+		fd       uint32
+		flags    uint32
+	}{pathname: uint64(uintptr(unsafe.Pointer(p)))}
+	fd, err := bpf(bpfObjGet, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(p)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	m, err := newBPFMap(int(fd))
+	if err != nil {
+		syscall.Close(int(fd))
+		return nil, err
+	}
+	return m, nil
+}
+
+// newBPFMap returns the BPFMap of a map file descriptor.
+func newBPFMap(fd int) (*BPFMap, error) {
+	m := &BPFMap{fd: fd, cpus: 1}
+	attr := struct {
+		fd   uint32
+		len  uint32
+		info uint64
+	}{fd: uint32(fd), len: uint32(unsafe.Sizeof(m.info)), info: uint64(uintptr(unsafe.Pointer(&m.info)))}
+	if _, err := bpf(bpfObjGetInfoByFD, unsafe.Pointer(&attr), unsafe.Sizeof(attr)); err != nil {
+		return nil, err
+	}
+	m.stride = int(m.info.valueSize)
+	switch m.info.typ {
+	case bpfMapTypePercpuHash, bpfMapTypePercpuArray, bpfMapTypeLRUPercpuHash:
+		n, err := possibleCPUs("/sys/devices/system/cpu/possible")
+		if err != nil {
+			return nil, err
+		}
+		m.cpus = n
+		m.stride = (m.stride + 7) &^ 7
+	}
+	m.key = make([]byte, m.info.keySize)
+	m.next = make([]byte, m.info.keySize)
+	m.values = make([]byte, m.cpus*m.stride)
+	return m, nil
+}
+
+var errBadCPUList = errors.New("observability: malformed CPU list")
+
+// possibleCPUs returns the number of CPUs in the list in the file at path,
+// such as "0-3,8-11".
+func possibleCPUs(path string) (int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, r := range bytes.Split(bytes.TrimSpace(b), []byte(",")) {
+		lo, hi, isRange := bytes.Cut(r, []byte("-"))
+		first, err := strconv.Atoi(string(lo))
+		if err != nil {
+			return 0, errBadCPUList
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(string(hi)); err != nil || last < first {
+				return 0, errBadCPUList
+			}
+		}
+		n += last - first + 1
+	}
+	return n, nil
+}
+
+// mapElem calls a command of the bpf system call on an element of the map.
+func (m *BPFMap) mapElem(cmd uintptr, key, value []byte, flags uint64) error {
+	attr := struct {
+		fd    uint32
+		_     uint32
+		key   uint64
+		value uint64
+		flags uint64
+	}{fd: uint32(m.fd), flags: flags}
+	if len(key) > 0 {
+		attr.key = uint64(uintptr(unsafe.Pointer(&key[0])))
+	}
+	if len(value) > 0 {
+		attr.value = uint64(uintptr(unsafe.Pointer(&value[0])))
+	}
+	_, err := bpf(cmd, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(key)
+	runtime.KeepAlive(value)
+	return err
+}
+
+// Range calls f for each entry of the map with its key and value, until f
+// returns an error, which it returns. The value of an entry of a per-CPU map
+// holds the value of each possible CPU in turn, each padded to a multiple of 8
+// bytes. Both are only valid during the call. Entries that are added or
+// deleted while the map is read may be missed.
+func (m *BPFMap) Range(f func(key, value []byte) error) error {
+	var key []byte // The first key is found with a nil key.
+	for {
+		if err := m.mapElem(bpfMapGetNextKey, key, m.next, 0); err != nil {
+			if errors.Is(err, syscall.ENOENT) {
+				return nil
+			}
+			return err
+		}
+		copy(m.key, m.next)
+		key = m.key
+		if err := m.mapElem(bpfMapLookupElem, key, m.values, 0); err != nil {
+			if errors.Is(err, syscall.ENOENT) {
+				// Deleted since its key was found.
+				continue
+			}
+			return err
+		}
+		if err := f(key, m.values); err != nil {
+			return err
+		}
+	}
+}
+
+// Uint64 returns a value of the map as an integer in host byte order, from
+// its first 8 bytes, or the first 4 if it is smaller, summed over the CPUs of
+// a per-CPU map.
+func (m *BPFMap) Uint64(value []byte) uint64 {
+	var sum uint64
+	for cpu := 0; cpu < m.cpus; cpu++ {
+		v := value[cpu*m.stride:]
+		switch {
+		case m.info.valueSize >= 8:
+			sum += binary.NativeEndian.Uint64(v)
+		case m.info.valueSize >= 4:
+			sum += uint64(binary.NativeEndian.Uint32(v))
+		}
+	}
+	return sum
+}
+
+// Close closes the map.
+func (m *BPFMap) Close() error {
+	return syscall.Close(m.fd)
+}
+
+// RegisterBPFHistogram registers meters of the buckets of a log2 histogram in
+// the BPF map pinned at path with o, in the layout of the tools of BCC and
+// libbpf-tools, such as runqlat and biolatency: an array, which may be per
+// CPU, whose 32-bit keys are slots, and whose values are the 64-bit counts of
+// the observations of up to 2^(slot+1)-1 units, and at least 2^slot. A meter
+// with the given description and labels is registered for each slot, with the
+// label le, for its upper bound; it is a counter if the description is
+// cumulative. The map stays open for the life of the Origin.
+func RegisterBPFHistogram(o *Origin, path string, desc MeterDescription, labels ...Label) error {
+	m, err := OpenPinnedBPFMap(path)
+	if err != nil {
+		return err
+	}
+	registerBPFHistogram(o, m, desc, labels)
+	return nil
+}
+
+func registerBPFHistogram(o *Origin, m *BPFMap, desc MeterDescription, labels []Label) {
+	buckets := make([]Meter, m.info.maxEntries)
+	for slot := range buckets {
+		le := Label{Key: "le", Value: strconv.FormatUint(1<<(slot+1)-1, 10)}
+		ls := append(labels[:len(labels):len(labels)], le)
+		if desc.Cumulative() {
+			buckets[slot] = DefineCounter(desc, ls...)
+		} else {
+			buckets[slot] = DefineGauge(desc, ls...)
+		}
+	}
+	counts := make([]uint64, len(buckets))
+	o.RegisterFunction(func() {
+		clear(counts)
+		err := m.Range(func(key, value []byte) error {
+			if slot := binary.NativeEndian.Uint32(key); int(slot) < len(counts) {
+				counts[slot] = m.Uint64(value)
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+		now := time.Now()
+		for i, b := range buckets {
+			b.SampleAt(now, counts[i])
+		}
+	}, buckets...)
+}
+
+// RegisterBPFMap registers a function with o that reads the BPF map pinned at
+// path, such as a hash of TCP retransmits by destination, whose keys are not
+// known in advance. For each key, labels returns the labels that identify it,
+// or nil to skip it. A child of o is added for each key with them as its
+// identity, with a meter with the given description of its value, from
+// BPFMap.Uint64; it is a counter if the description is cumulative. The
+// children of keys that are deleted from the map are removed. The map stays
+// open for the life of the Origin.
+func RegisterBPFMap(o *Origin, path string, desc MeterDescription, labels func(key []byte) []Label) error {
+	m, err := OpenPinnedBPFMap(path)
+	if err != nil {
+		return err
+	}
+	registerBPFMap(o, m, desc, labels)
+	return nil
+}
+
+// bpfMapEntry is the child of an entry of a map.
+type bpfMapEntry struct {
+	child *Origin
+	// value is written by the function of the parent, and read by that of
+	// the child, which may run concurrently.
+	value atomic.Uint64
+	seen  bool
+}
+
+func registerBPFMap(o *Origin, m *BPFMap, desc MeterDescription, labels func(key []byte) []Label) {
+	entries := make(map[string]*bpfMapEntry)
+	o.RegisterFunction(func() {
+		err := m.Range(func(key, value []byte) error {
+			// The conversion doesn't allocate.
+			e, ok := entries[string(key)]
+			if !ok {
+				ls := labels(key)
+				if ls == nil {
+					return nil
+				}
+				e = &bpfMapEntry{child: o.NewChild(ls...)}
+				meter := DefineGauge(desc)
+				if desc.Cumulative() {
+					meter = DefineCounter(desc)
+				}
+				e.child.RegisterFunction(func() { meter.SampleAt(time.Now(), e.value.Load()) }, meter)
+				entries[string(key)] = e
+			}
+			e.value.Store(m.Uint64(value))
+			e.seen = true
+			return nil
+		})
+		if err != nil {
+			return
+		}
+		for k, e := range entries {
+			if !e.seen {
+				o.RemoveChild(e.child)
+				delete(entries, k)
+			}
+			e.seen = false
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package observability
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// The commands of the bpf system call that create and modify maps, and the
+// type of hash maps, which only the tests use.
+const (
+	bpfMapCreate     = 0
+	bpfMapUpdateElem = 2
+	bpfMapDeleteElem = 3
+	bpfMapTypeHash   = 1
+)
+
+// createBPFMap creates a BPF map for a test, or skips it without the
+// privileges to.
+func createBPFMap(t *testing.T, typ, keySize, valueSize, maxEntries uint32) *BPFMap {
+	t.Helper()
+	attr := struct {
+		typ, keySize, valueSize, maxEntries, flags uint32
+	}{typ, keySize, valueSize, maxEntries, 0}
+	fd, err := bpf(bpfMapCreate, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.ENOSYS) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := newBPFMap(int(fd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func updateBPFMap(t *testing.T, m *BPFMap, key, value []byte) {
+	t.Helper()
+	if err := m.mapElem(bpfMapUpdateElem, key, value, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBPFHistogram(t *testing.T) {
+	m := createBPFMap(t, bpfMapTypePercpuArray, 4, 8, 4)
+	for slot, count := range []uint64{0, 7, 3, 1} {
+		// Each CPU has counted the same.
+		value := make([]byte, m.cpus*m.stride)
+		for cpu := 0; cpu < m.cpus; cpu++ {
+			binary.NativeEndian.PutUint64(value[cpu*m.stride:], count)
+		}
+		updateBPFMap(t, m, binary.NativeEndian.AppendUint32(nil, uint32(slot)), value)
+	}
+	desc := DescribeMeter("/test/runq_latency", "Test histogram.", Cumulative(), Units("us"))
+	o := NewOrigin()
+	registerBPFHistogram(o, m, desc, []Label{{Key: "cpu", Value: "all"}})
+	n := uint64(m.cpus)
+	want := map[string]uint64{
+		"/test/runq_latency{cpu=all,le=1}":  0,
+		"/test/runq_latency{cpu=all,le=3}":  7 * n,
+		"/test/runq_latency{cpu=all,le=7}":  3 * n,
+		"/test/runq_latency{cpu=all,le=15}": 1 * n,
+	}
+	if got := sampleValues(o); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestBPFMap(t *testing.T) {
+	m := createBPFMap(t, bpfMapTypeHash, 4, 4, 16)
+	for _, kv := range [][2]uint32{{80, 12}, {443, 31}, {22, 2}} {
+		updateBPFMap(t, m, binary.NativeEndian.AppendUint32(nil, kv[0]), binary.NativeEndian.AppendUint32(nil, kv[1]))
+	}
+	desc := DescribeMeter("/test/retransmits", "Test counter.", Cumulative())
+	o := NewOrigin()
+	registerBPFMap(o, m, desc, func(key []byte) []Label {
+		port := binary.NativeEndian.Uint32(key)
+		if port == 22 {
+			return nil
+		}
+		return []Label{{Key: "port", Value: strconv.Itoa(int(port))}}
+	})
+	values := func() map[string]uint64 {
+		got := make(map[string]uint64)
+		for _, o := range withChildren([]*Origin{o}) {
+			for k, v := range sampleValues(o) {
+				if id := o.Identity(); len(id) > 0 {
+					k = id[0].Value + ":" + k
+				}
+				got[k] = v
+			}
+		}
+		return got
+	}
+	// The children are added by the first sample, and sampled after it.
+	values()
+	if got, want := values(), map[string]uint64{"80:/test/retransmits": 12, "443:/test/retransmits": 31}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// The child of a deleted key is removed.
+	if err := m.mapElem(bpfMapDeleteElem, binary.NativeEndian.AppendUint32(nil, 80), nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	values()
+	if got := len(o.Children()); got != 1 {
+		t.Errorf("got %d children, want 1", got)
+	}
+}
+
+func TestPossibleCPUs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "possible")
+	for list, want := range map[string]int{"0\n": 1, "0-7\n": 8, "0-3,8-11\n": 8, "0,2,4-5\n": 4} {
+		if err := os.WriteFile(path, []byte(list), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := possibleCPUs(path); err != nil || got != want {
+			t.Errorf("possibleCPUs(%q) = %d, %v, want %d", list, got, err, want)
+		}
+	}
+	os.WriteFile(path, []byte("3-1\n"), 0o644)
+	if _, err := possibleCPUs(path); err == nil {
+		t.Error("reversed range wasn't reported")
+	}
+}
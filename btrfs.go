@@ -0,0 +1,142 @@
+package observability
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	btrfsAllocatedDesc = DescribeMeter(
+		"/btrfs/allocated",
+		"Space allocated to the chunks of each type of block group of each "+
+			"btrfs filesystem: data, metadata, or system. Unlike the free "+
+			"space reported by statfs, it shows when unallocated space runs "+
+			"out while allocated chunks are mostly empty, so that writes "+
+			"fail with free space left.",
+		Units("By"))
+	btrfsUsedDesc = DescribeMeter(
+		"/btrfs/used",
+		"Space used within the chunks of each type of block group of each "+
+			"btrfs filesystem, as `/btrfs/allocated`.",
+		Units("By"))
+	btrfsWriteErrorsDesc = DescribeMeter(
+		"/btrfs/device/write_errors",
+		"Number of writes to each device of each btrfs filesystem that "+
+			"failed. The counts persist across mounts until reset with "+
+			"`btrfs device stats -z`.",
+		Cumulative())
+	btrfsReadErrorsDesc = DescribeMeter(
+		"/btrfs/device/read_errors",
+		"Number of reads from each device of each btrfs filesystem that "+
+			"failed.",
+		Cumulative())
+	btrfsFlushErrorsDesc = DescribeMeter(
+		"/btrfs/device/flush_errors",
+		"Number of cache flushes of each device of each btrfs filesystem "+
+			"that failed.",
+		Cumulative())
+	btrfsCorruptionErrorsDesc = DescribeMeter(
+		"/btrfs/device/corruption_errors",
+		"Number of blocks read from each device of each btrfs filesystem "+
+			"with bad checksums.",
+		Cumulative())
+	btrfsGenerationErrorsDesc = DescribeMeter(
+		"/btrfs/device/generation_errors",
+		"Number of blocks read from each device of each btrfs filesystem "+
+			"that were older than expected, having missed writes.",
+		Cumulative())
+)
+
+// btrfsErrors are the lines of the error_stats file of each device, and the
+// descriptions of their meters.
+var btrfsErrors = []struct {
+	name string
+	desc MeterDescription
+}{
+	{"write_errs", btrfsWriteErrorsDesc},
+	{"read_errs", btrfsReadErrorsDesc},
+	{"flush_errs", btrfsFlushErrorsDesc},
+	{"corruption_errs", btrfsCorruptionErrorsDesc},
+	{"generation_errs", btrfsGenerationErrorsDesc},
+}
+
+// RegisterBtrfsStats registers meters of the space allocation and device
+// errors of each mounted btrfs filesystem with o, sampled from /sys/fs/btrfs.
+// The meters are labeled with the UUID and label of the filesystem, and with
+// the type of block group or the device ID. The filesystems and devices are
+// those present at registration; device errors are only sampled from Linux
+// 5.14, which added them to sysfs. The files stay open for the life of the
+// Origin.
+func RegisterBtrfsStats(o *Origin) error {
+	return registerBtrfsStats(o, "/sys/fs/btrfs")
+}
+
+func registerBtrfsStats(o *Origin, dir string) error {
+	filesystems, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range filesystems {
+		if !f.IsDir() || f.Name() == "features" {
+			continue
+		}
+		uuid := f.Name()
+		label, err := readSysfsString(filepath.Join(dir, uuid, "label"))
+		if err != nil {
+			return err
+		}
+		labels := []Label{{Key: "uuid", Value: uuid}, {Key: "label", Value: label}}
+		for _, group := range []string{"data", "metadata", "system"} {
+			path := filepath.Join(dir, uuid, "allocation", group)
+			groupLabels := append(labels[:len(labels):len(labels)], Label{Key: "type", Value: group})
+			if err := RegisterSysfsMeter(o, filepath.Join(path, "total_bytes"), DefineGauge(btrfsAllocatedDesc, groupLabels...)); err != nil {
+				return err
+			}
+			if err := RegisterSysfsMeter(o, filepath.Join(path, "bytes_used"), DefineGauge(btrfsUsedDesc, groupLabels...)); err != nil {
+				return err
+			}
+		}
+		devices, err := os.ReadDir(filepath.Join(dir, uuid, "devinfo"))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		for _, d := range devices {
+			err := registerBtrfsDeviceErrors(o, filepath.Join(dir, uuid, "devinfo", d.Name(), "error_stats"),
+				append(labels[:len(labels):len(labels)], Label{Key: "device", Value: d.Name()}))
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func registerBtrfsDeviceErrors(o *Origin, path string, labels []Label) error {
+	var now time.Time
+	var ms []Meter
+	var lfs []lineFunc
+	for _, e := range btrfsErrors {
+		m := DefineCounter(e.desc, labels...)
+		lfs = append(lfs, lineFunc{
+			name:    []byte(e.name),
+			nfields: 1,
+			f:       func(fields [][]byte) { m.SampleAt(now, naiveAtoi(fields[0])) },
+		})
+		ms = append(ms, m)
+	}
+	fs, err := NewFileScanner(path, NewUnorderedBufferScanner(nil, lfs))
+	if err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		fs.Scan()
+	}, ms...)
+	return nil
+}
@@ -0,0 +1,66 @@
+package observability
+
+import (
+	"errors"
+	"runtime/debug"
+	"time"
+)
+
+var buildInfoDesc = DescribeMeter(
+	"/build/info",
+	"Always 1, labeled with the identity of the binary of this process: "+
+		"the path and version of its main module, the revision, commit "+
+		"time, and whether the tree was modified, from the version control "+
+		"system it was built from, and the Go release that built it. Labels "+
+		"the binary lacks, such as the revision of one built outside a "+
+		"repository, are absent.")
+
+var errNoBuildInfo = errors.New("observability: the binary has no build information")
+
+// buildInfoSettings are the build settings that are labels of
+// `/build/info`, and the keys of their labels.
+var buildInfoSettings = []struct {
+	name, key string
+}{
+	{"vcs.revision", "revision"},
+	{"vcs.time", "commit_time"},
+	{"vcs.modified", "modified"},
+}
+
+// RegisterBuildInfo registers `/build/info` with o, labeled with the build
+// information embedded in the binary of this process by the Go toolchain, as
+// read by debug.ReadBuildInfo, so that every binary built on this package
+// identifies itself the same way. The toolchain doesn't record when the binary
+// was built, so the commit time stands for it. o should be the Origin of the
+// process. This fails for binaries built without module support.
+func RegisterBuildInfo(o *Origin) error {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return errNoBuildInfo
+	}
+	registerBuildInfo(o, bi)
+	return nil
+}
+
+func registerBuildInfo(o *Origin, bi *debug.BuildInfo) {
+	var labels []Label
+	add := func(key, value string) {
+		if value != "" {
+			labels = append(labels, Label{Key: key, Value: value})
+		}
+	}
+	add("path", bi.Main.Path)
+	add("version", bi.Main.Version)
+	for _, s := range buildInfoSettings {
+		for _, bs := range bi.Settings {
+			if bs.Key == s.name {
+				add(s.key, bs.Value)
+			}
+		}
+	}
+	add("go_version", bi.GoVersion)
+	m := DefineGauge(buildInfoDesc, labels...)
+	o.RegisterFunction(func() {
+		m.SampleAt(time.Now(), 1)
+	}, m)
+}
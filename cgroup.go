@@ -0,0 +1,316 @@
+package observability
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	cgroupCPUUsageDesc = DescribeMeter(
+		"/cgroup/cpu/usage",
+		"CPU time consumed by the tasks of each cgroup and its descendants, "+
+			"cpuacct.usage.",
+		Cumulative(), Units("ns"))
+	cgroupMemoryUsageDesc = DescribeMeter(
+		"/cgroup/memory/usage",
+		"Memory charged to each cgroup and its descendants, including the "+
+			"page cache, memory.usage_in_bytes.",
+		Units("By"))
+	cgroupMemoryCacheDesc = DescribeMeter(
+		"/cgroup/memory/cache",
+		"Page cache charged to each cgroup and its descendants, including "+
+			"shared memory.",
+		Units("By"))
+	cgroupMemoryRSSDesc = DescribeMeter(
+		"/cgroup/memory/rss",
+		"Anonymous memory charged to each cgroup and its descendants, "+
+			"excluding shared memory.",
+		Units("By"))
+	cgroupMemoryRSSHugeDesc = DescribeMeter(
+		"/cgroup/memory/rss_huge",
+		"Anonymous transparent huge pages charged to each cgroup and its "+
+			"descendants.",
+		Units("By"))
+	cgroupMemoryShmemDesc = DescribeMeter(
+		"/cgroup/memory/shmem",
+		"Shared memory and tmpfs charged to each cgroup and its "+
+			"descendants.",
+		Units("By"))
+	cgroupMemoryMappedFileDesc = DescribeMeter(
+		"/cgroup/memory/mapped_file",
+		"Page cache mapped by the tasks of each cgroup and its descendants.",
+		Units("By"))
+	cgroupMemoryDirtyDesc = DescribeMeter(
+		"/cgroup/memory/dirty",
+		"Page cache charged to each cgroup and its descendants waiting to "+
+			"be written back.",
+		Units("By"))
+	cgroupMemoryWritebackDesc = DescribeMeter(
+		"/cgroup/memory/writeback",
+		"Page cache charged to each cgroup and its descendants being "+
+			"written back.",
+		Units("By"))
+	cgroupMemorySwapDesc = DescribeMeter(
+		"/cgroup/memory/swap",
+		"Swap used by each cgroup and its descendants.",
+		Units("By"))
+	cgroupMemoryActiveAnonDesc = DescribeMeter(
+		"/cgroup/memory/active_anon",
+		"Anonymous memory of each cgroup and its descendants on the active "+
+			"LRU list.",
+		Units("By"))
+	cgroupMemoryInactiveAnonDesc = DescribeMeter(
+		"/cgroup/memory/inactive_anon",
+		"Anonymous memory of each cgroup and its descendants on the "+
+			"inactive LRU list.",
+		Units("By"))
+	cgroupMemoryActiveFileDesc = DescribeMeter(
+		"/cgroup/memory/active_file",
+		"Page cache of each cgroup and its descendants on the active LRU "+
+			"list.",
+		Units("By"))
+	cgroupMemoryInactiveFileDesc = DescribeMeter(
+		"/cgroup/memory/inactive_file",
+		"Page cache of each cgroup and its descendants on the inactive LRU "+
+			"list, the first to be reclaimed.",
+		Units("By"))
+	cgroupMemoryUnevictableDesc = DescribeMeter(
+		"/cgroup/memory/unevictable",
+		"Memory of each cgroup and its descendants that can't be "+
+			"reclaimed, such as mlocked memory.",
+		Units("By"))
+	cgroupMemoryPageFaultsDesc = DescribeMeter(
+		"/cgroup/memory/page_faults",
+		"Number of page faults incurred by the tasks of each cgroup and its "+
+			"descendants.",
+		Cumulative())
+	cgroupMemoryMajorPageFaultsDesc = DescribeMeter(
+		"/cgroup/memory/major_page_faults",
+		"Number of page faults incurred by the tasks of each cgroup and its "+
+			"descendants that required I/O.",
+		Cumulative())
+	cgroupBlkioBytesDesc = DescribeMeter(
+		"/cgroup/blkio/bytes",
+		"Bytes transferred to and from each block device by the tasks of "+
+			"each cgroup, by operation, read or write, "+
+			"blkio.throttle.io_service_bytes.",
+		Cumulative(), Units("By"))
+	cgroupPidsDesc = DescribeMeter(
+		"/cgroup/pids/current",
+		"Number of tasks in each cgroup and its descendants.")
+	cgroupPidsMaxDesc = DescribeMeter(
+		"/cgroup/pids/max",
+		"Maximum number of tasks in each cgroup and its descendants, beyond "+
+			"which forks fail. It is not sampled if there is no limit.")
+)
+
+// cgroupMemoryStats are the lines of memory.stat that are sampled, and the
+// descriptions of their meters. The lines with the total_ prefix include the
+// descendants of the cgroup, like memory.usage_in_bytes; those without it
+// don't.
+var cgroupMemoryStats = []struct {
+	name string
+	desc MeterDescription
+}{
+	{"total_cache", cgroupMemoryCacheDesc},
+	{"total_rss", cgroupMemoryRSSDesc},
+	{"total_rss_huge", cgroupMemoryRSSHugeDesc},
+	{"total_shmem", cgroupMemoryShmemDesc},
+	{"total_mapped_file", cgroupMemoryMappedFileDesc},
+	{"total_dirty", cgroupMemoryDirtyDesc},
+	{"total_writeback", cgroupMemoryWritebackDesc},
+	{"total_swap", cgroupMemorySwapDesc},
+	{"total_active_anon", cgroupMemoryActiveAnonDesc},
+	{"total_inactive_anon", cgroupMemoryInactiveAnonDesc},
+	{"total_active_file", cgroupMemoryActiveFileDesc},
+	{"total_inactive_file", cgroupMemoryInactiveFileDesc},
+	{"total_unevictable", cgroupMemoryUnevictableDesc},
+	{"total_pgfault", cgroupMemoryPageFaultsDesc},
+	{"total_pgmajfault", cgroupMemoryMajorPageFaultsDesc},
+}
+
+// cgroupV1Controllers are the cgroup v1 controllers that are sampled.
+var cgroupV1Controllers = []string{"cpuacct", "memory", "blkio", "pids"}
+
+var errNoCgroupV1 = errors.New("observability: no cgroup v1 hierarchy is mounted")
+
+// RegisterCgroupV1Stats registers meters of the cgroups at the given paths in
+// the cgroup v1 hierarchies, such as /system.slice/nginx.service, or of the
+// root cgroup if there are none, with o: CPU usage, from cpuacct; memory usage
+// and its breakdown, from memory; bytes transferred to each block device,
+// from blkio; and task counts, from pids. The hierarchies are found in
+// /proc/mounts, and each controller that isn't mounted, as under the unified
+// cgroup v2 hierarchy, is skipped; it is an error if none are. The meters are
+// labeled with the cgroup path, and those of blkio also with the device
+// number and operation. The memory.stat lines and block devices are those
+// present at registration. The files stay open for the life of the Origin.
+func RegisterCgroupV1Stats(o *Origin, cgroups []string) error {
+	return registerCgroupV1Stats(o, "/proc/mounts", cgroups)
+}
+
+// cgroupV1Mounts returns the mountpoints of the cgroup v1 hierarchies listed
+// in the mounts file at path, by controller. A hierarchy may have several
+// controllers, as in /sys/fs/cgroup/cpu,cpuacct.
+func cgroupV1Mounts(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mounts := make(map[string]string)
+	rs := NewRowScanner(func(fields [][]byte) {
+		for _, opt := range strings.Split(string(fields[3]), ",") {
+			mounts[opt] = unescapeMount(fields[1])
+		}
+	}, minFields(4), fieldIn(2, "cgroup"))
+	rs.Scan(b)
+	return mounts, nil
+}
+
+func registerCgroupV1Stats(o *Origin, mountsPath string, cgroups []string) error {
+	mounts, err := cgroupV1Mounts(mountsPath)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, c := range cgroupV1Controllers {
+		if _, ok := mounts[c]; ok {
+			found = true
+		}
+	}
+	if !found {
+		return errNoCgroupV1
+	}
+	if len(cgroups) == 0 {
+		cgroups = []string{"/"}
+	}
+	for _, cgroup := range cgroups {
+		label := Label{Key: "cgroup", Value: cgroup}
+		if dir, ok := mounts["cpuacct"]; ok {
+			err := RegisterSysfsMeter(o, filepath.Join(dir, cgroup, "cpuacct.usage"), DefineCounter(cgroupCPUUsageDesc, label))
+			if err != nil {
+				return err
+			}
+		}
+		if dir, ok := mounts["memory"]; ok {
+			if err := registerCgroupV1Memory(o, filepath.Join(dir, cgroup), label); err != nil {
+				return err
+			}
+		}
+		if dir, ok := mounts["blkio"]; ok {
+			if err := registerCgroupV1Blkio(o, filepath.Join(dir, cgroup, "blkio.throttle.io_service_bytes"), label); err != nil {
+				return err
+			}
+		}
+		if dir, ok := mounts["pids"]; ok {
+			if err := RegisterSysfsMeter(o, filepath.Join(dir, cgroup, "pids.current"), DefineGauge(cgroupPidsDesc, label)); err != nil {
+				return err
+			}
+			if err := RegisterSysfsMeter(o, filepath.Join(dir, cgroup, "pids.max"), DefineGauge(cgroupPidsMaxDesc, label)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func registerCgroupV1Memory(o *Origin, dir string, label Label) error {
+	if err := RegisterSysfsMeter(o, filepath.Join(dir, "memory.usage_in_bytes"), DefineGauge(cgroupMemoryUsageDesc, label)); err != nil {
+		return err
+	}
+
+	// Find the lines that the kernel has, which vary with its version and
+	// configuration.
+	path := filepath.Join(dir, "memory.stat")
+	var lfs []lineFunc
+	for _, s := range cgroupMemoryStats {
+		lfs = append(lfs, lineFunc{name: []byte(s.name), nfields: 1, f: func([][]byte) {}})
+	}
+	discover := NewUnorderedBufferScanner(nil, lfs)
+	fs, err := NewFileScanner(path, discover)
+	if err == nil {
+		err = fs.Scan()
+		fs.Close()
+	}
+	if err != nil {
+		return err
+	}
+	var now time.Time
+	var ms []Meter
+	lfs = lfs[:0]
+	for i, hit := range discover.Hits() {
+		if !hit {
+			continue
+		}
+		var m Meter
+		if desc := cgroupMemoryStats[i].desc; desc.Cumulative() {
+			m = DefineCounter(desc, label)
+		} else {
+			m = DefineGauge(desc, label)
+		}
+		lfs = append(lfs, lineFunc{
+			name:    []byte(cgroupMemoryStats[i].name),
+			nfields: 1,
+			f:       func(fields [][]byte) { m.SampleAt(now, naiveAtoi(fields[0])) },
+		})
+		ms = append(ms, m)
+	}
+	if fs, err = NewFileScanner(path, NewUnorderedBufferScanner(nil, lfs)); err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		fs.Scan()
+	}, ms...)
+	return nil
+}
+
+func registerCgroupV1Blkio(o *Origin, path string, label Label) error {
+	// The lines are the device number, the operation, and the bytes, as in
+	// "8:0 Read 1234", followed by a line of the sum over devices.
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	type deviceMeters struct{ read, write Meter }
+	devices := make(map[string]*deviceMeters)
+	var ms []Meter
+	filters := []rowFilter{minFields(3), fieldIn(1, "Read", "Write")}
+	NewRowScanner(func(fields [][]byte) {
+		device := string(fields[0])
+		if _, ok := devices[device]; ok {
+			return
+		}
+		dl := Label{Key: "device", Value: device}
+		d := &deviceMeters{
+			read:  DefineCounter(cgroupBlkioBytesDesc, label, dl, Label{Key: "op", Value: "read"}),
+			write: DefineCounter(cgroupBlkioBytesDesc, label, dl, Label{Key: "op", Value: "write"}),
+		}
+		devices[device] = d
+		ms = append(ms, d.read, d.write)
+	}, filters...).Scan(b)
+
+	var now time.Time
+	fs, err := NewFileScanner(path, NewRowScanner(func(fields [][]byte) {
+		// The conversion doesn't allocate.
+		d, ok := devices[string(fields[0])]
+		if !ok {
+			return
+		}
+		if fields[1][0] == 'R' {
+			d.read.SampleAt(now, naiveAtoi(fields[2]))
+		} else {
+			d.write.SampleAt(now, naiveAtoi(fields[2]))
+		}
+	}, filters...))
+	if err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		fs.Scan()
+	}, ms...)
+	return nil
+}
@@ -0,0 +1,117 @@
+package observability
+
+import (
+	"bytes"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+var (
+	clockOffsetDesc = DescribeMeter(
+		"/clock/offset",
+		"Magnitude of the offset of the system clock from its reference, "+
+			"as last measured by the time synchronization daemon, such as "+
+			"chronyd or ntpd, that disciplines it through the kernel. "+
+			"Daemons that step or slew the clock themselves leave it at 0.",
+		Units("ns"))
+	clockFrequencyErrorDesc = DescribeMeter(
+		"/clock/frequency_error",
+		"Magnitude of the frequency correction applied to the system clock, "+
+			"which is the error of its oscillator. Its maximum is 500 ppm, "+
+			"or 500000 ppb.",
+		Units("ppb"))
+	clockEstimatedErrorDesc = DescribeMeter(
+		"/clock/estimated_error",
+		"Error of the system clock estimated by the time synchronization "+
+			"daemon.",
+		Units("us"))
+	clockMaxErrorDesc = DescribeMeter(
+		"/clock/max_error",
+		"Maximum error of the system clock, which the kernel increases by "+
+			"500 us per second until the time synchronization daemon "+
+			"updates it.",
+		Units("us"))
+	clockSynchronizedDesc = DescribeMeter(
+		"/clock/synchronized",
+		"Whether the kernel considers the system clock synchronized, 1, or "+
+			"not, 0.")
+	clockSourceDesc = DescribeMeter(
+		"/clock/source",
+		"Whether each clock source is the current one of the kernel, 1, or "+
+			"not, 0. The kernel switches from tsc to a slower source, such "+
+			"as hpet, when it finds the TSC unstable.")
+)
+
+// The bits of the status of adjtimex(2), and the state it returns when the
+// clock is not synchronized.
+const (
+	timexStatusUnsync = 0x0040
+	timexStatusNano   = 0x2000
+	timexStateError   = 5
+)
+
+// RegisterClockStats registers meters of the synchronization of the system
+// clock with o: its offset, frequency error, estimated and maximum errors,
+// and whether it is synchronized, from adjtimex(2), so that clock skew across
+// a fleet can be measured; and the clock source in use, from
+// /sys/devices/system/clocksource, labeled with the source. The sources are
+// those available at registration. The files stay open for the life of the
+// Origin.
+func RegisterClockStats(o *Origin) error {
+	return registerClockStats(o, "/sys/devices/system/clocksource/clocksource0", syscall.Adjtimex)
+}
+
+func registerClockStats(o *Origin, dir string, adjtimex func(*syscall.Timex) (int, error)) error {
+	available, err := readSysfsString(filepath.Join(dir, "available_clocksource"))
+	if err != nil {
+		return err
+	}
+	current, err := OpenSysfsValue(filepath.Join(dir, "current_clocksource"))
+	if err != nil {
+		return err
+	}
+	var names [][]byte
+	var sources []Meter
+	for _, name := range bytes.Fields([]byte(available)) {
+		names = append(names, name)
+		sources = append(sources, DefineGauge(clockSourceDesc, Label{Key: "source", Value: string(name)}))
+	}
+	o.RegisterFunction(func() {
+		b, err := current.Bytes()
+		if err != nil {
+			return
+		}
+		now := time.Now()
+		for i, name := range names {
+			sources[i].SampleAt(now, boolValue(bytes.Equal(b, name)))
+		}
+	}, sources...)
+
+	offset := DefineGauge(clockOffsetDesc)
+	freq := DefineGauge(clockFrequencyErrorDesc)
+	estError := DefineGauge(clockEstimatedErrorDesc)
+	maxError := DefineGauge(clockMaxErrorDesc)
+	synced := DefineGauge(clockSynchronizedDesc)
+	var tx syscall.Timex
+	o.RegisterFunction(func() {
+		// With no modes set, adjtimex only reads the state of the clock.
+		tx = syscall.Timex{}
+		state, err := adjtimex(&tx)
+		if err != nil {
+			return
+		}
+		now := time.Now()
+		off := uint64(max(tx.Offset, -tx.Offset))
+		if tx.Status&timexStatusNano == 0 {
+			off *= 1000
+		}
+		offset.SampleAt(now, off)
+		// The frequency is in ppm with a 16-bit fraction.
+		freq.SampleAt(now, uint64(max(tx.Freq, -tx.Freq))*1000>>16)
+		estError.SampleAt(now, uint64(tx.Esterror))
+		maxError.SampleAt(now, uint64(tx.Maxerror))
+		synced.SampleAt(now, boolValue(state != timexStateError && tx.Status&timexStatusUnsync == 0))
+	}, offset, freq, estError, maxError, synced)
+	return nil
+}
@@ -0,0 +1,49 @@
+package observability
+
+import (
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestClockStats(t *testing.T) {
+	o := NewOrigin()
+	err := registerClockStats(o, filepath.Join("testdata", "sys", "devices", "system", "clocksource", "clocksource0"),
+		func(tx *syscall.Timex) (int, error) {
+			tx.Offset = -1234
+			tx.Freq = -1 << 16 * 12 // -12 ppm
+			tx.Esterror = 150
+			tx.Maxerror = 16000
+			tx.Status = timexStatusNano
+			return 0, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/clock/offset":                 1234,
+		"/clock/frequency_error":        12000,
+		"/clock/estimated_error":        150,
+		"/clock/max_error":              16000,
+		"/clock/synchronized":           1,
+		"/clock/source{source=tsc}":     1,
+		"/clock/source{source=hpet}":    0,
+		"/clock/source{source=acpi_pm}": 0,
+	})
+	if len(got) != 8 {
+		t.Errorf("got %d samples, want 8", len(got))
+	}
+}
+
+func TestClockStatsLive(t *testing.T) {
+	o := NewOrigin()
+	if err := RegisterClockStats(o); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range o.Snapshot().Samples {
+		if s.Description.Name() != "/clock/source" && s.Time.IsZero() {
+			t.Errorf("%s%v not sampled", s.Description.Name(), s.Labels)
+		}
+	}
+}
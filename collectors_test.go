@@ -0,0 +1,1140 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixture returns the path of a file of the fixture corpus; see procParsers.
+func fixture(path string) string {
+	return filepath.Join("testdata", "proc", "6.18", path)
+}
+
+// sampleValues returns the values of o's samples, keyed by meter name and
+// labels, as in /disk/reads{device=sda}.
+func sampleValues(o *Origin) map[string]uint64 {
+	values := make(map[string]uint64)
+	for _, s := range o.Snapshot().Samples {
+		key := s.Description.Name()
+		if len(s.Labels) > 0 {
+			var ls []string
+			for _, l := range s.Labels {
+				ls = append(ls, l.Key+"="+l.Value)
+			}
+			key += "{" + strings.Join(ls, ",") + "}"
+		}
+		values[key] = s.Value
+	}
+	return values
+}
+
+// checkValues reports the values that differ from want.
+func checkValues(t *testing.T, got, want map[string]uint64) {
+	t.Helper()
+	for k, v := range want {
+		if g, ok := got[k]; !ok || g != v {
+			t.Errorf("%s = %d (present %v), want %d", k, g, ok, v)
+		}
+	}
+}
+
+func TestCPUStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerCPUStats(o, fixture("stat"), true); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/cpu/time{mode=user}":                 68039,
+		"/cpu/time{mode=idle}":                 252735,
+		"/cpu/time{mode=guest_nice}":           0,
+		"/cpu/time_by_cpu{cpu=0,mode=softirq}": 4,
+		"/kernel/interrupts":                   823019,
+		"/kernel/context_switches":             1722378,
+		"/kernel/forks":                        28510,
+		"/kernel/procs_running":                3,
+		"/kernel/procs_blocked":                0,
+	})
+	if len(got) != 2*len(cpuModes)+5 {
+		t.Errorf("got %d samples", len(got))
+	}
+}
+
+func TestDiskStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerDiskStats(o, fixture("diskstats"), nil); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/disk/reads{device=vda}":           11059,
+		"/disk/bytes_read{device=vda}":      1461754 * 512,
+		"/disk/in_flight{device=vda}":       0,
+		"/disk/queue_time{device=vda}":      17920,
+		"/disk/bytes_discarded{device=vda}": 2508568 * 512,
+		"/disk/flush_time{device=vda}":      2,
+		"/disk/reads{device=vdb}":           6,
+		"/disk/reads{device=zram0}":         0,
+	})
+	for k := range got {
+		if strings.Contains(k, "loop") {
+			t.Errorf("loop device sampled: %s", k)
+		}
+	}
+	if len(got) != 3*len(diskFields) {
+		t.Errorf("got %d samples", len(got))
+	}
+
+	o = NewOrigin()
+	only := func(device string) bool { return device == "vdb" }
+	if err := registerDiskStats(o, "testdata/proc/legacy/diskstats", only); err != nil {
+		t.Fatal(err)
+	}
+	if got := sampleValues(o); len(got) != 11 {
+		t.Errorf("got %d samples from a legacy kernel, want 11", len(got))
+	}
+}
+
+func TestNetSNMPStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerPairedMeters(o, fixture("net/snmp"), netSNMPMeters); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/net/ip/datagrams_received":  13878,
+		"/net/ip/datagrams_sent":      13844,
+		"/net/tcp/established":        2,
+		"/net/tcp/segments_received":  13685,
+		"/net/tcp/segments_sent":      13690,
+		"/net/tcp/established_resets": 261,
+		"/net/tcp/resets_sent":        128,
+		"/net/udp/datagrams_received": 193,
+	})
+	if len(got) != len(netSNMPMeters) {
+		t.Errorf("got %d samples, want %d", len(got), len(netSNMPMeters))
+	}
+
+	// Fields are found by name, wherever they are, and missing ones have no
+	// meters.
+	path := filepath.Join(t.TempDir(), "snmp")
+	os.WriteFile(path, []byte("Tcp: OutSegs Future InSegs\nTcp: 5 9 7\n"), 0644)
+	o = NewOrigin()
+	if err := registerPairedMeters(o, path, netSNMPMeters); err != nil {
+		t.Fatal(err)
+	}
+	got = sampleValues(o)
+	want := map[string]uint64{"/net/tcp/segments_sent": 5, "/net/tcp/segments_received": 7}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestNetNetstatStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerPairedMeters(o, fixture("net/netstat"), netNetstatMeters); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/net/tcp/listen_drops":  0,
+		"/net/tcp/timeouts":      0,
+		"/net/ip/bytes_received": 74054736,
+		"/net/ip/bytes_sent":     74054006,
+	})
+	if len(got) != len(netNetstatMeters) {
+		t.Errorf("got %d samples, want %d", len(got), len(netNetstatMeters))
+	}
+}
+
+func TestSoftnetStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerSoftnetStats(o, fixture("net/softnet_stat")); err != nil {
+		t.Fatal(err)
+	}
+	checkValues(t, sampleValues(o), map[string]uint64{
+		"/net/softnet/processed{cpu=0}":     0x3c3c,
+		"/net/softnet/dropped{cpu=0}":       0,
+		"/net/softnet/time_squeezes{cpu=0}": 0,
+		"/net/softnet/flow_limited{cpu=0}":  0,
+	})
+
+	// Before Linux 5.10, CPUs are numbered by line.
+	o = NewOrigin()
+	if err := registerSoftnetStats(o, "testdata/proc/legacy/net/softnet_stat"); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		checkValues(t, sampleValues(o), map[string]uint64{
+			"/net/softnet/processed{cpu=0}":     0xa2f1,
+			"/net/softnet/time_squeezes{cpu=0}": 3,
+			"/net/softnet/processed{cpu=1}":     0x19b44,
+			"/net/softnet/dropped{cpu=1}":       2,
+			"/net/softnet/time_squeezes{cpu=1}": 0x1c,
+		})
+	}
+}
+
+func TestSchedStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerSchedStats(o, "testdata/proc/legacy/schedstat"); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/cpu/run_time{cpu=0}":   1811652817347,
+		"/cpu/run_delay{cpu=0}":  94235190566,
+		"/cpu/timeslices{cpu=0}": 3710248,
+		"/cpu/run_delay{cpu=1}":  87512048213,
+	})
+	if len(got) != 6 {
+		t.Errorf("got %d samples, want 6", len(got))
+	}
+}
+
+func TestMemoryZoneStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerMemoryZoneStats(o, fixture("buddyinfo"), fixture("zoneinfo")); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/memory/zone/free_pages{node=0,zone=DMA32}":           774334,
+		"/memory/zone/min_watermark{node=0,zone=DMA32}":        9563,
+		"/memory/zone/low_watermark{node=0,zone=Normal}":       9105,
+		"/memory/zone/high_watermark{node=0,zone=DMA}":         69,
+		"/memory/zone/free_blocks{node=0,zone=Normal,order=0}": 4920,
+		"/memory/zone/free_blocks{node=0,zone=DMA32,order=10}": 754,
+	})
+	// Zones without memory aren't in buddyinfo.
+	for k := range got {
+		if strings.Contains(k, "Movable") {
+			t.Errorf("empty zone sampled: %s", k)
+		}
+	}
+	if len(got) != 3*(4+11) {
+		t.Errorf("got %d samples, want %d", len(got), 3*(4+11))
+	}
+}
+
+func TestSlabStats(t *testing.T) {
+	page := uint64(os.Getpagesize())
+	o := NewOrigin()
+	if err := registerSlabStats(o, fixture("slabinfo"), []string{"dentry", "inode_cache"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	want := map[string]uint64{
+		"/memory/slab/active_objects{cache=dentry}":      27712,
+		"/memory/slab/objects{cache=dentry}":             28161,
+		"/memory/slab/object_size{cache=dentry}":         192,
+		"/memory/slab/size{cache=dentry}":                1341 * page,
+		"/memory/slab/active_objects{cache=inode_cache}": 195,
+		"/memory/slab/objects{cache=inode_cache}":        195,
+		"/memory/slab/object_size{cache=inode_cache}":    616,
+		"/memory/slab/size{cache=inode_cache}":           15 * 2 * page,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	o = NewOrigin()
+	if err := registerSlabStats(o, fixture("slabinfo"), nil, 3); err != nil {
+		t.Fatal(err)
+	}
+	got = sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/memory/slab/size{cache=buffer_head}":      6658 * page,
+		"/memory/slab/size{cache=ext4_inode_cache}": 1527 * 4 * page,
+		"/memory/slab/size{cache=radix_tree_node}":  2302 * page,
+	})
+	if len(got) != 3*4 {
+		t.Errorf("got %d samples, want 12", len(got))
+	}
+}
+
+func TestHugePageStats(t *testing.T) {
+	o := NewOrigin()
+	err := registerHugePageStats(o, filepath.Join("testdata", "sys", "kernel", "mm", "hugepages"),
+		fixture("meminfo"), fixture("vmstat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/memory/huge_pages/pages{size=2048kB}":          512,
+		"/memory/huge_pages/free{size=2048kB}":           384,
+		"/memory/huge_pages/reserved{size=2048kB}":       96,
+		"/memory/huge_pages/surplus{size=2048kB}":        0,
+		"/memory/huge_pages/pages{size=1048576kB}":       1,
+		"/memory/transparent_huge_pages/anonymous":       0,
+		"/memory/transparent_huge_pages/splits":          0,
+		"/memory/transparent_huge_pages/fault_fallbacks": 0,
+	})
+	if want := 2*len(hugePageFiles) + 3 + len(thpEvents); len(got) != want {
+		t.Errorf("got %d samples, want %d", len(got), want)
+	}
+}
+
+func TestNFSStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerNFSStats(o, "testdata/proc/legacy/net/rpc/nfs", false); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/nfs/client/rpc/calls":                          2101387,
+		"/nfs/client/rpc/retransmissions":                12,
+		"/nfs/client/rpc/auth_refreshes":                 2101398,
+		"/nfs/client/operations{version=3,op=getattr}":   581021,
+		"/nfs/client/operations{version=3,op=commit}":    1822,
+		"/nfs/client/operations{version=4,op=read}":      1043,
+		"/nfs/client/operations{version=4,op=getattr}":   9210,
+		"/nfs/client/operations{version=4,op=read_plus}": 0,
+	})
+	if want := 3 + 22 + 69; len(got) != want {
+		t.Errorf("got %d client samples, want %d", len(got), want)
+	}
+
+	o = NewOrigin()
+	if err := registerNFSStats(o, "testdata/proc/legacy/net/rpc/nfsd", true); err != nil {
+		t.Fatal(err)
+	}
+	got = sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/nfs/server/rpc/calls":                         2100223,
+		"/nfs/server/rpc/bad_calls":                     2,
+		"/nfs/server/reply_cache/hits":                  0,
+		"/nfs/server/reply_cache/misses":                1882,
+		"/nfs/server/reply_cache/uncached":              2098341,
+		"/nfs/server/bytes_read":                        1872314880,
+		"/nfs/server/bytes_written":                     620197888,
+		"/nfs/server/operations{version=3,op=read}":     512310,
+		"/nfs/server/operations{version=4,op=putfh}":    4012,
+		"/nfs/server/operations{version=4,op=sequence}": 4190,
+		"/nfs/server/operations{version=4,op=0}":        0,
+	})
+	if want := 7 + 22 + 72; len(got) != want {
+		t.Errorf("got %d server samples, want %d", len(got), want)
+	}
+}
+
+func TestXFSStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerXFSStats(o, "testdata/proc/legacy/fs/xfs/stat"); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/xfs/extent/extents_allocated":      2850797,
+		"/xfs/extent/blocks_freed":           750744525,
+		"/xfs/dir/created":                   155380624,
+		"/xfs/writes":                        1344496242,
+		"/xfs/reads":                         2324555337,
+		"/xfs/log/blocks_written":            1060789568,
+		"/xfs/tail_push/flushes":             25742,
+		"/xfs/vnodes/active":                 36336,
+		"/xfs/buffer/reads":                  29137,
+		"/xfs/btree/lookups{btree=abtb2}":    5079763,
+		"/xfs/btree/moves{btree=ibt2}":       1582374,
+		"/xfs/btree/lookups{btree=refcntbt}": 0,
+		"/xfs/quota/unused":                  0,
+		"/xfs/bytes_flushed":                 5588678254592,
+		"/xfs/bytes_read":                    18802600680845,
+	})
+	want := len(xfsBtrees) * len(xfsBtreeDescs)
+	for _, l := range xfsLines {
+		want += len(l.descs)
+	}
+	if len(got) != want {
+		t.Errorf("got %d samples, want %d", len(got), want)
+	}
+}
+
+func TestBtrfsStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerBtrfsStats(o, filepath.Join("testdata", "sys", "fs", "btrfs")); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	fs := "uuid=6f2c1e7a-93b4-4d0e-8a61-0d3c5b2e9f14,label=backup"
+	checkValues(t, got, map[string]uint64{
+		"/btrfs/allocated{" + fs + ",type=data}":               1005022347264,
+		"/btrfs/used{" + fs + ",type=data}":                    812345372672,
+		"/btrfs/used{" + fs + ",type=metadata}":                2178433024,
+		"/btrfs/allocated{" + fs + ",type=system}":             33554432,
+		"/btrfs/device/read_errors{" + fs + ",device=1}":       0,
+		"/btrfs/device/read_errors{" + fs + ",device=2}":       17,
+		"/btrfs/device/corruption_errors{" + fs + ",device=2}": 2,
+	})
+	if want := 3*2 + 2*len(btrfsErrors); len(got) != want {
+		t.Errorf("got %d samples, want %d", len(got), want)
+	}
+}
+
+func TestBlockQueueStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerBlockQueueStats(o, filepath.Join("testdata", "sys", "block"), nil); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/disk/reads{device=vda}":                                 11063,
+		"/disk/bytes_written{device=vda}":                         2949344 * 512,
+		"/disk/flush_time{device=vda}":                            2,
+		"/disk/queue/requests{device=vda}":                        256,
+		"/disk/queue/rotational{device=vda}":                      1,
+		"/disk/queue/max_request_size{device=vda}":                4096 << 10,
+		"/disk/queue/read_ahead{device=vda}":                      8192 << 10,
+		"/disk/queue/scheduler{device=vda,scheduler=mq-deadline}": 1,
+		"/disk/queue/scheduler{device=vda,scheduler=none}":        0,
+		"/disk/queue/scheduler{device=vda,scheduler=bfq}":         0,
+	})
+	if want := len(diskFields) + 4 + 4; len(got) != want {
+		t.Errorf("got %d samples, want %d", len(got), want)
+	}
+}
+
+func TestThermalStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerThermalStats(o, filepath.Join("testdata", "sys", "class", "thermal")); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	want := map[string]uint64{
+		"/thermal/zone/temperature{zone=0,type=x86_pkg_temp}":                                61000,
+		"/thermal/zone/trip_point{zone=0,type=x86_pkg_temp,trip_point=0,trip_type=passive}":  85000,
+		"/thermal/zone/trip_point{zone=0,type=x86_pkg_temp,trip_point=1,trip_type=critical}": 100000,
+		"/thermal/zone/temperature{zone=1,type=acpitz}":                                      27800,
+		"/thermal/zone/trip_point{zone=1,type=acpitz,trip_point=0,trip_type=critical}":       105000,
+		"/thermal/cooling_device/state{device=0,type=intel_powerclamp}":                      0,
+		"/thermal/cooling_device/max_state{device=0,type=intel_powerclamp}":                  50,
+		"/thermal/cooling_device/state{device=1,type=Processor}":                             2,
+		"/thermal/cooling_device/max_state{device=1,type=Processor}":                         3,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSMARTStats(t *testing.T) {
+	runs := 0
+	run := func(_ context.Context, device string) ([]byte, error) {
+		runs++
+		return os.ReadFile(filepath.Join("testdata", "smartctl", filepath.Base(device)+".json"))
+	}
+	o := NewOrigin()
+	if err := registerSMARTStats(o, []string{"/dev/sda", "/dev/sdb"}, time.Hour, run); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	want := map[string]uint64{
+		"/smart/power_on_hours{device=/dev/sda}":           39712,
+		"/smart/temperature{device=/dev/sda}":              34,
+		"/smart/reallocated_sectors{device=/dev/sda}":      8,
+		"/smart/reported_uncorrectable{device=/dev/sda}":   0,
+		"/smart/pending_sectors{device=/dev/sda}":          16,
+		"/smart/offline_uncorrectable{device=/dev/sda}":    16,
+		"/smart/crc_errors{device=/dev/sda}":               3,
+		"/smart/power_on_hours{device=/dev/sdb}":           51802,
+		"/smart/temperature{device=/dev/sdb}":              29,
+		"/smart/grown_defects{device=/dev/sdb}":            12,
+		"/smart/uncorrected_read_errors{device=/dev/sdb}":  1,
+		"/smart/uncorrected_write_errors{device=/dev/sdb}": 0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// smartctl runs at registration, and not again within the interval.
+	sampleValues(o)
+	if runs != 2 {
+		t.Errorf("smartctl ran %d times, want 2", runs)
+	}
+}
+
+func TestRAPLStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerRAPLStats(o, filepath.Join("testdata", "sys", "class", "powercap")); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	want := map[string]uint64{
+		"/power/rapl/energy{zone=0,domain=package-0}": 183447620519,
+		"/power/rapl/energy{zone=0:0,domain=core}":    97236153400,
+		"/power/rapl/energy{zone=0:1,domain=dram}":    20716327063,
+		"/power/rapl/energy{zone=1,domain=psys}":      60187043222,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestRAPLZoneWrap(t *testing.T) {
+	z := raplZone{max: 1000}
+	for _, s := range []struct{ v, want uint64 }{
+		{900, 900},
+		{950, 950},
+		{50, 1050},
+		{40, 2040},
+		{60, 2060},
+	} {
+		if got := z.sample(s.v); got != s.want {
+			t.Errorf("sample(%d) = %d, want %d", s.v, got, s.want)
+		}
+	}
+}
+
+func TestPowerSupplyStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerPowerSupplyStats(o, filepath.Join("testdata", "sys", "class", "power_supply")); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/power_supply/online{supply=AC,type=Mains}":                         0,
+		"/power_supply/capacity{supply=BAT0,type=Battery}":                   87,
+		"/power_supply/energy{supply=BAT0,type=Battery}":                     44950000,
+		"/power_supply/energy_full{supply=BAT0,type=Battery}":                51670000,
+		"/power_supply/voltage{supply=BAT0,type=Battery}":                    12362000,
+		"/power_supply/power{supply=BAT0,type=Battery}":                      7804000,
+		"/power_supply/status{supply=BAT0,type=Battery,status=Discharging}":  1,
+		"/power_supply/status{supply=BAT0,type=Battery,status=Charging}":     0,
+		"/power_supply/charge{supply=BAT1,type=Battery}":                     2143000,
+		"/power_supply/charge_full_design{supply=BAT1,type=Battery}":         2300000,
+		"/power_supply/current{supply=BAT1,type=Battery}":                    0,
+		"/power_supply/status{supply=BAT1,type=Battery,status=Not charging}": 1,
+		"/power_supply/status{supply=BAT1,type=Battery,status=Full}":         0,
+	})
+	// AC has only online; each battery has 6 values and 5 statuses.
+	if want := 1 + 2*(6+len(powerSupplyStatuses)); len(got) != want {
+		t.Errorf("got %d samples, want %d", len(got), want)
+	}
+}
+
+func TestCgroupV1Stats(t *testing.T) {
+	dir, err := filepath.Abs(filepath.Join("testdata", "sys", "fs", "cgroup", "v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mounts := filepath.Join(t.TempDir(), "mounts")
+	if err := os.WriteFile(mounts, []byte(
+		"cgroup2 /sys/fs/cgroup/unified cgroup2 rw,nosuid,nodev,noexec,relatime 0 0\n"+
+			"cgroup "+dir+"/cpu,cpuacct cgroup rw,nosuid,nodev,noexec,relatime,cpu,cpuacct 0 0\n"+
+			"cgroup "+dir+"/memory cgroup rw,nosuid,nodev,noexec,relatime,memory 0 0\n"+
+			"cgroup "+dir+"/blkio cgroup rw,nosuid,nodev,noexec,relatime,blkio 0 0\n"+
+			"cgroup "+dir+"/pids cgroup rw,nosuid,nodev,noexec,relatime,pids 0 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	o := NewOrigin()
+	if err := registerCgroupV1Stats(o, mounts, []string{"/system.slice"}); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/cgroup/cpu/usage{cgroup=/system.slice}":                         1841205530937,
+		"/cgroup/memory/usage{cgroup=/system.slice}":                      1163894784,
+		"/cgroup/memory/cache{cgroup=/system.slice}":                      812421120,
+		"/cgroup/memory/major_page_faults{cgroup=/system.slice}":          1288,
+		"/cgroup/blkio/bytes{cgroup=/system.slice,device=8:0,op=read}":    611041280,
+		"/cgroup/blkio/bytes{cgroup=/system.slice,device=253:0,op=write}": 4137181184,
+		"/cgroup/pids/current{cgroup=/system.slice}":                      212,
+		// pids.max is "max", so it isn't sampled.
+		"/cgroup/pids/max{cgroup=/system.slice}": 0,
+	})
+	// memory.stat has no total_swap without swap accounting.
+	if want := 1 + 1 + len(cgroupMemoryStats) - 1 + 2*2 + 2; len(got) != want {
+		t.Errorf("got %d samples, want %d", len(got), want)
+	}
+
+	if err := os.WriteFile(mounts, []byte("cgroup2 /sys/fs/cgroup cgroup2 rw 0 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := registerCgroupV1Stats(NewOrigin(), mounts, nil); err != errNoCgroupV1 {
+		t.Errorf("got error %v under cgroup v2, want %v", err, errNoCgroupV1)
+	}
+}
+
+func TestProcessStats(t *testing.T) {
+	o := NewOrigin()
+	if _, err := registerProcessStats(o, fixture(""), "self"); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	want := map[string]uint64{
+		"/process/cpu_time{mode=user}":   5123,
+		"/process/cpu_time{mode=system}": 2087,
+		"/process/page_faults":           18423,
+		"/process/major_page_faults":     3,
+		"/process/resident":              1498 * uint64(os.Getpagesize()),
+		"/process/virtual":               13156352,
+		"/process/threads":               1,
+		"/process/start_time":            1792047667 + 983,
+		"/process/priority":              20,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestProcessIOStats(t *testing.T) {
+	o := NewOrigin()
+	if _, err := registerProcessIOStats(o, fixture("self/io")); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	want := map[string]uint64{
+		"/process/io/read_chars":            2911730318,
+		"/process/io/write_chars":           1203544829,
+		"/process/io/read_syscalls":         4117820,
+		"/process/io/write_syscalls":        2040399,
+		"/process/io/read_bytes":            48197632,
+		"/process/io/write_bytes":           897531904,
+		"/process/io/cancelled_write_bytes": 12288,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestProcessMemoryStats(t *testing.T) {
+	o := NewOrigin()
+	if _, err := registerProcessMemoryStats(o, fixture("self/smaps_rollup")); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	want := map[string]uint64{
+		"/process/memory/pss":           121386 << 10,
+		"/process/memory/rss":           184720 << 10,
+		"/process/memory/shared_clean":  71420 << 10,
+		"/process/memory/shared_dirty":  1024 << 10,
+		"/process/memory/private_clean": 14408 << 10,
+		"/process/memory/private_dirty": 97868 << 10,
+		"/process/memory/swap":          6144 << 10,
+		"/process/memory/locked":        0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestProcessFDStats(t *testing.T) {
+	o := NewOrigin()
+	if _, err := registerProcessFDStats(o, fixture("self")); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	want := map[string]uint64{
+		"/process/fds/open":        6,
+		"/process/fds/soft_limit":  1024,
+		"/process/fds/hard_limit":  524288,
+		"/process/fds/utilization": 0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSelfStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerSelfStats(o, fixture("self")); err != nil {
+		t.Fatal(err)
+	}
+	// The collection of another Origin is counted.
+	other := NewOrigin()
+	other.RegisterFunction(func() { time.Sleep(time.Millisecond) })
+	before := collections.Load()
+	other.Snapshot()
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/self/cpu_time{mode=user}":   5123,
+		"/self/cpu_time{mode=system}": 2087,
+		"/self/resident":              1498 * uint64(os.Getpagesize()),
+		"/self/fds/open":              6,
+		"/self/read_chars":            2911730318,
+	})
+	if n := got["/self/collections"]; n < before+1 {
+		t.Errorf("/self/collections = %d, want at least %d", n, before+1)
+	}
+	if ns := got["/self/collection_time"]; ns < uint64(time.Millisecond) {
+		t.Errorf("/self/collection_time = %d, want at least %d", ns, time.Millisecond)
+	}
+}
+
+func TestProcessDiscovery(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("no /proc")
+	}
+	cmd := exec.Command("sleep", "3599")
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	parent := NewOrigin(Label{Key: "host.name", Value: "alice"})
+	d, err := NewProcessDiscovery(parent, []ProcessRule{
+		{Name: "init", Comm: "no such command"},
+		{Name: "sleeper", Comm: "sleep", Cmdline: regexp.MustCompile(`^sleep 3599$`), UIDs: []int{os.Getuid()}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	children := parent.Children()
+	if len(children) != 1 {
+		cmd.Process.Kill()
+		t.Fatalf("found %d processes, want 1", len(children))
+	}
+	id := children[0].Identity()
+	if len(id) != 5 || id[1] != (Label{Key: "rule", Value: "sleeper"}) ||
+		id[2] != (Label{Key: "pid", Value: strconv.Itoa(cmd.Process.Pid)}) || id[4].Key != "start_time" {
+		t.Errorf("got identity %v", id)
+	}
+	if got := sampleValues(children[0]); got["/process/threads"] != 1 {
+		t.Errorf("got samples %v", got)
+	}
+
+	cmd.Process.Kill()
+	cmd.Wait()
+	if err := d.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	if children := parent.Children(); len(children) != 0 {
+		t.Errorf("found %d processes after exit, want 0", len(children))
+	}
+}
+
+func TestProcessDiscoveryClose(t *testing.T) {
+	proc := t.TempDir()
+	dir := filepath.Join(proc, "2215")
+	if err := os.MkdirAll(filepath.Join(dir, "fd"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"stat", "self/stat", "self/io", "self/smaps_rollup", "self/limits"} {
+		b, err := os.ReadFile(fixture(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst := filepath.Join(proc, "stat")
+		if base, ok := strings.CutPrefix(name, "self/"); ok {
+			dst = filepath.Join(dir, base)
+		}
+		if err := os.WriteFile(dst, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	parent := NewOrigin()
+	d, err := newProcessDiscovery(parent, []ProcessRule{{Name: "tmux", Comm: "tmux: server"}}, proc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	closers := d.procs["2215"].closers
+	if len(parent.Children()) != 1 || len(closers) != 4 {
+		t.Fatalf("found %d processes with %d files, want 1 with 4", len(parent.Children()), len(closers))
+	}
+
+	// The process exits.
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(parent.Children()); n != 0 {
+		t.Errorf("found %d processes after exit, want 0", n)
+	}
+	for i, c := range closers {
+		if err := c.Close(); !errors.Is(err, os.ErrClosed) {
+			t.Errorf("file %d was not closed: Close returned %v", i, err)
+		}
+	}
+}
+
+func TestConntrackStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerConntrackStats(o, fixture("sys/net/netfilter"), fixture("net/stat/nf_conntrack")); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	want := map[string]uint64{
+		"/net/conntrack/entries":       15900,
+		"/net/conntrack/max":           262144,
+		"/net/conntrack/insert_failed": 3,
+		"/net/conntrack/dropped":       12,
+		"/net/conntrack/early_dropped": 3,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestIPVSStats(t *testing.T) {
+	dir := filepath.Join("testdata", "proc", "legacy", "net")
+	o := NewOrigin()
+	if err := registerIPVSStats(o, filepath.Join(dir, "ip_vs_stats"), filepath.Join(dir, "ip_vs")); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/net/ipvs/connections":           0x16AA370,
+		"/net/ipvs/packets{direction=in}": 0xE33656E5,
+		"/net/ipvs/bytes{direction=in}":   0x51D8C8883F3,
+		"/net/ipvs/bytes{direction=out}":  0,
+		"/net/ipvs/backend/active_connections{protocol=TCP,service=192.168.0.22:3306,backend=192.168.82.22:3306}": 248,
+		"/net/ipvs/backend/inactive_connections{protocol=UDP,service=192.168.0.22:53,backend=192.168.82.22:53}":   13,
+		"/net/ipvs/backend/weight{protocol=TCP,service=[2620::1]:80,backend=[2620::2]:80}":                        50,
+		"/net/ipvs/backend/inactive_connections{protocol=TCP,service=[2620::1]:80,backend=[2620::2]:80}":          31,
+		"/net/ipvs/backend/weight{protocol=FWM,service=268439552,backend=192.168.50.26:3306}":                     0,
+	})
+	if want := 5 + 5*3; len(got) != want {
+		t.Errorf("got %d samples, want %d", len(got), want)
+	}
+}
+
+func TestBondingStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerBondingStats(o, filepath.Join("testdata", "proc", "legacy", "net", "bonding")); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	want := map[string]uint64{
+		"/net/bond/up{bond=bond0}":                             1,
+		"/net/bond/slave/up{bond=bond0,slave=eth0}":            0,
+		"/net/bond/slave/link_failures{bond=bond0,slave=eth0}": 3,
+		"/net/bond/slave/active{bond=bond0,slave=eth0}":        0,
+		"/net/bond/slave/up{bond=bond0,slave=eth1}":            1,
+		"/net/bond/slave/link_failures{bond=bond0,slave=eth1}": 0,
+		"/net/bond/slave/active{bond=bond0,slave=eth1}":        1,
+		"/net/bond/up{bond=bond1}":                             1,
+		"/net/bond/slave/up{bond=bond1,slave=eth2}":            1,
+		"/net/bond/slave/link_failures{bond=bond1,slave=eth2}": 1,
+		"/net/bond/slave/up{bond=bond1,slave=eth3}":            1,
+		"/net/bond/slave/link_failures{bond=bond1,slave=eth3}": 0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestNetInterfaceStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerNetInterfaceStats(o, filepath.Join("testdata", "sys", "class", "net"), func(iface string) bool {
+		return iface != "lo"
+	}); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/net/interface/carrier{iface=eno1}":               1,
+		"/net/interface/oper_state{iface=eno1,state=up}":   1,
+		"/net/interface/oper_state{iface=eno1,state=down}": 0,
+		"/net/interface/speed{iface=eno1}":                 10000000000,
+		"/net/interface/full_duplex{iface=eno1}":           1,
+		"/net/interface/mtu{iface=eno1}":                   9000,
+		"/net/interface/carrier_changes{iface=eno1}":       4,
+		"/net/interface/carrier{iface=eno2}":               0,
+		"/net/interface/oper_state{iface=eno2,state=down}": 1,
+		"/net/interface/carrier_changes{iface=eno2}":       17,
+	})
+	// lo is filtered out.
+	if want := 2 * (5 + len(netOperStates)); len(got) != want {
+		t.Errorf("got %d samples, want %d", len(got), want)
+	}
+}
+
+func TestSocketMemoryStats(t *testing.T) {
+	dir := filepath.Join("testdata", "proc", "legacy")
+	o := NewOrigin()
+	if err := registerSocketMemoryStats(o, filepath.Join(dir, "net", "sockstat"), filepath.Join(dir, "sys", "net", "ipv4")); err != nil {
+		t.Fatal(err)
+	}
+	page := uint64(os.Getpagesize())
+	got := sampleValues(o)
+	want := map[string]uint64{
+		"/net/socket/memory{protocol=tcp}":                                48213 * page,
+		"/net/socket/memory_limit{protocol=tcp,threshold=low}":            70812 * page,
+		"/net/socket/memory_limit{protocol=tcp,threshold=pressure}":       94416 * page,
+		"/net/socket/memory_limit{protocol=tcp,threshold=high}":           141624 * page,
+		"/net/socket/memory_utilization{protocol=tcp,threshold=pressure}": 51,
+		"/net/socket/memory_utilization{protocol=tcp,threshold=high}":     34,
+		"/net/socket/memory{protocol=udp}":                                141 * page,
+		"/net/socket/memory_limit{protocol=udp,threshold=low}":            141624 * page,
+		"/net/socket/memory_limit{protocol=udp,threshold=pressure}":       188833 * page,
+		"/net/socket/memory_limit{protocol=udp,threshold=high}":           283248 * page,
+		"/net/socket/memory_utilization{protocol=udp,threshold=pressure}": 0,
+		"/net/socket/memory_utilization{protocol=udp,threshold=high}":     0,
+	}
+	checkValues(t, got, want)
+	if len(got) != len(want) {
+		t.Errorf("got %d samples, want %d", len(got), len(want))
+	}
+}
+
+func TestInfinibandStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerInfinibandStats(o, filepath.Join("testdata", "sys", "class", "infiniband")); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	want := map[string]uint64{
+		"/net/infiniband/data{device=mlx5_0,port=1,direction=transmit}": 4 * 183447620519,
+		"/net/infiniband/data{device=mlx5_0,port=1,direction=receive}":  4 * 97236153400,
+		"/net/infiniband/symbol_errors{device=mlx5_0,port=1}":           0,
+		"/net/infiniband/link_downed{device=mlx5_0,port=1}":             1,
+		"/net/infiniband/data{device=mlx5_1,port=1,direction=transmit}": 4 * 5120,
+		"/net/infiniband/data{device=mlx5_1,port=1,direction=receive}":  4 * 8192,
+		"/net/infiniband/symbol_errors{device=mlx5_1,port=1}":           17,
+		"/net/infiniband/link_downed{device=mlx5_1,port=1}":             3,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestWirelessStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerWirelessStats(o, fixture("net/wireless")); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/net/wireless/link_quality{iface=wlp0s20f3}":           58,
+		"/net/wireless/signal_level{iface=wlp0s20f3}":           52,
+		"/net/wireless/discarded{iface=wlp0s20f3,reason=retry}": 17,
+		"/net/wireless/discarded{iface=wlp0s20f3,reason=misc}":  312,
+		"/net/wireless/missed_beacons{iface=wlp0s20f3}":         4,
+		"/net/wireless/link_quality{iface=wlan1}":               0,
+		"/net/wireless/discarded{iface=wlan1,reason=crypt}":     3,
+	})
+	// Each interface has its link, level, and beacon meters, and one per reason.
+	if len(got) != 2*(3+len(wirelessDiscardReasons)) {
+		t.Errorf("got %d samples, want %d", len(got), 2*(3+len(wirelessDiscardReasons)))
+	}
+}
+
+func TestKSMStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerKSMStats(o, filepath.Join("testdata", "sys", "kernel", "mm", "ksm")); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	want := map[string]uint64{
+		"/memory/ksm/run":            1,
+		"/memory/ksm/pages_shared":   20481,
+		"/memory/ksm/pages_sharing":  194325,
+		"/memory/ksm/pages_unshared": 5122,
+		"/memory/ksm/pages_volatile": 1730,
+		"/memory/ksm/full_scans":     318,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestNFSMountStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerNFSMountStats(o, fixture("self/mountstats")); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/nfs/mount/operations{mount=/home,export=filer1:/export/home,op=read}":                   14412,
+		"/nfs/mount/rtt{mount=/home,export=filer1:/export/home,op=read}":                          29106,
+		"/nfs/mount/execution_time{mount=/home,export=filer1:/export/home,op=read}":               29519,
+		"/nfs/mount/retransmissions{mount=/home,export=filer1:/export/home,op=write}":             2,
+		"/nfs/mount/major_timeouts{mount=/home,export=filer1:/export/home,op=write}":              1,
+		"/nfs/mount/operations{mount=/home,export=filer1:/export/home,op=read_plus}":              0,
+		"/nfs/mount/operations{mount=/mnt/scratch space,export=filer2:/vol/scratch,op=write}":     2764,
+		"/nfs/mount/retransmissions{mount=/mnt/scratch space,export=filer2:/vol/scratch,op=read}": 18,
+	})
+	// Each of the 8 and 5 operations of the two NFS mounts has 5 meters.
+	if want := 5 * (8 + 5); len(got) != want {
+		t.Errorf("got %d samples, want %d", len(got), want)
+	}
+}
+
+func TestDRBDStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerDRBDStats(o, filepath.Join("testdata", "proc", "legacy", "drbd")); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/drbd/connection_state{minor=0,state=Connected}":        1,
+		"/drbd/connection_state{minor=0,state=StandAlone}":       0,
+		"/drbd/primary{minor=0,node=local}":                      1,
+		"/drbd/primary{minor=0,node=peer}":                       0,
+		"/drbd/disk_state{minor=0,node=peer,state=UpToDate}":     1,
+		"/drbd/out_of_sync{minor=0}":                             0,
+		"/drbd/connection_state{minor=1,state=SyncSource}":       1,
+		"/drbd/disk_state{minor=1,node=peer,state=Inconsistent}": 1,
+		"/drbd/disk_state{minor=1,node=peer,state=UpToDate}":     0,
+		"/drbd/out_of_sync{minor=1}":                             409600 * 1024,
+		"/drbd/sync_progress{minor=1}":                           31,
+		"/drbd/connection_state{minor=2,state=StandAlone}":       1,
+		"/drbd/disk_state{minor=2,node=peer,state=DUnknown}":     1,
+		"/drbd/out_of_sync{minor=2}":                             73216 * 1024,
+	})
+	// Device 3 is unconfigured, so it has no meters.
+	if want := 3 * (len(drbdConnectionStates) + 2*(1+len(drbdDiskStates)) + 2); len(got) != want {
+		t.Errorf("got %d samples, want %d", len(got), want)
+	}
+}
+
+func TestAMDGPUStats(t *testing.T) {
+	o := NewOrigin()
+	if err := registerAMDGPUStats(o, filepath.Join("testdata", "sys", "class", "drm")); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	checkValues(t, got, map[string]uint64{
+		"/gpu/busy{card=card0}":                        37,
+		"/gpu/memory_busy{card=card0}":                 12,
+		"/gpu/vram_used{card=card0}":                   4294967296,
+		"/gpu/vram_total{card=card0}":                  17163091968,
+		"/gpu/gtt_used{card=card0}":                    58720256,
+		"/gpu/gtt_total{card=card0}":                   33554432000,
+		"/gpu/power{card=card0}":                       187000000,
+		"/gpu/power_cap{card=card0}":                   203000000,
+		"/gpu/fan_speed{card=card0}":                   1530,
+		"/gpu/temperature{card=card0,sensor=edge}":     54000,
+		"/gpu/temperature{card=card0,sensor=junction}": 61000,
+		"/gpu/temperature{card=card0,sensor=mem}":      68000,
+	})
+	// card1 is driven by i915, and card0-DP-1 is a connector.
+	if want := 12; len(got) != want {
+		t.Errorf("got %d samples, want %d", len(got), want)
+	}
+}
+
+func TestDMIInfo(t *testing.T) {
+	dir := filepath.Join("testdata", "sys", "class", "dmi", "id")
+	o := NewOrigin()
+	if err := registerDMIInfo(o, dir); err != nil {
+		t.Fatal(err)
+	}
+	// product_version is empty, so it has no label.
+	checkValues(t, sampleValues(o), map[string]uint64{
+		"/hardware/info{vendor=Dell Inc.,product=PowerEdge R650,serial=4XK2JM3,board_vendor=Dell Inc.," +
+			"board=0PYXKY,bios_vendor=Dell Inc.,bios_version=1.13.2,bios_date=12/19/2023}": 1,
+	})
+	labels, err := dmiLabels(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Label{{Key: "vendor", Value: "Dell Inc."}, {Key: "product", Value: "PowerEdge R650"}}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("got labels %v, want %v", labels, want)
+	}
+	if err := registerDMIInfo(NewOrigin(), t.TempDir()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v without DMI tables, want ErrNotExist", err)
+	}
+}
+
+func TestBootStats(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "boots")
+	register := func() map[string]uint64 {
+		t.Helper()
+		o := NewOrigin()
+		if err := registerBootStats(o, fixture(""), state); err != nil {
+			t.Fatal(err)
+		}
+		return sampleValues(o)
+	}
+	want := map[string]uint64{
+		"/kernel/boot_time": 1792047667,
+		"/kernel/info{release=6.18.44-fc-v130,version=#1 SMP PREEMPT_DYNAMIC Tue Sep 30 12:00:00 UTC 2026}": 1,
+		// The first boot seen isn't a reboot.
+		"/kernel/reboots": 0,
+	}
+	checkValues(t, register(), want)
+	// Registering again in the same boot counts nothing.
+	checkValues(t, register(), want)
+
+	if err := os.WriteFile(state, []byte("0d9c6a1e-previous-boot 4 1700000000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want["/kernel/reboots"] = 5
+	checkValues(t, register(), want)
+	checkValues(t, register(), want)
+}
+
+func TestGoRuntimeStats(t *testing.T) {
+	o := NewOrigin()
+	RegisterGoRuntimeStats(o)
+	runtime.GC()
+	got := sampleValues(o)
+	for _, name := range []string{"/go/goroutines", "/go/heap/allocated", "/go/gc/heap_goal", "/go/gc/cycles", "/go/memory/total"} {
+		if got[name] == 0 {
+			t.Errorf("%s = 0", name)
+		}
+	}
+	// The pause of the collection is counted in a bucket.
+	var pauses uint64
+	for k, v := range got {
+		if strings.HasPrefix(k, "/go/gc/pauses{le=") {
+			pauses += v
+		}
+	}
+	if pauses == 0 {
+		t.Error("no GC pauses counted")
+	}
+	if _, ok := got["/go/sched/latency{le=+Inf}"]; !ok {
+		t.Error("no scheduling latency bucket le=+Inf")
+	}
+}
+
+func TestGoMemStats(t *testing.T) {
+	o := NewOrigin()
+	RegisterGoMemStats(o)
+	runtime.GC()
+	got := sampleValues(o)
+	for _, name := range []string{"/go/memstats/heap_alloc", "/go/memstats/heap_inuse", "/go/memstats/stack_inuse",
+		"/go/memstats/sys", "/go/memstats/next_gc", "/go/memstats/num_gc", "/go/goroutines", "/go/threads"} {
+		if got[name] == 0 {
+			t.Errorf("%s = 0", name)
+		}
+	}
+	if want := len(goMemStats) + 2; len(got) != want {
+		t.Errorf("got %d samples, want %d", len(got), want)
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	o := NewOrigin()
+	registerBuildInfo(o, &debug.BuildInfo{
+		GoVersion: "go1.24.4",
+		Main:      debug.Module{Path: "example.com/agent", Version: "v1.3.0"},
+		Settings: []debug.BuildSetting{
+			{Key: "-trimpath", Value: "true"},
+			{Key: "vcs", Value: "git"},
+			{Key: "vcs.revision", Value: "5af174a2c9e1"},
+			{Key: "vcs.time", Value: "2026-10-01T09:12:44Z"},
+			{Key: "vcs.modified", Value: "false"},
+		},
+	})
+	got := sampleValues(o)
+	want := map[string]uint64{
+		"/build/info{path=example.com/agent,version=v1.3.0,revision=5af174a2c9e1," +
+			"commit_time=2026-10-01T09:12:44Z,modified=false,go_version=go1.24.4}": 1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Test binaries have build information too, if less of it.
+	if err := RegisterBuildInfo(NewOrigin()); err != nil {
+		t.Fatal(err)
+	}
+}
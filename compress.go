@@ -0,0 +1,113 @@
+package observability
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Compressor is a compressing writer that can be reused by resetting it onto a
+// new underlying writer, as *gzip.Writer and the zstd encoder in
+// github.com/klauspost/compress can be.
+type Compressor interface {
+	io.WriteCloser
+	Reset(io.Writer)
+}
+
+type compression struct {
+	name string
+	pool sync.Pool
+}
+
+// compressions are the content encodings available to the HTTP handlers, in
+// increasing order of preference.
+var compressions []*compression
+
+func init() {
+	RegisterCompression("gzip", func() Compressor {
+		return gzip.NewWriter(nil)
+	})
+}
+
+// RegisterCompression makes a content encoding available to the HTTP handlers.
+// Each response is compressed with the most preferred encoding the client
+// accepts, and encodings registered later are preferred over those registered
+// earlier. gzip is registered by default. To avoid a dependency, this package
+// does not register zstd, but it can be added with, for example:
+//
+//	observability.RegisterCompression("zstd", func() observability.Compressor {
+//		e, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+//		return e
+//	})
+//
+// Compressors are pooled and reused across responses, so the cost of
+// allocating them is not paid on every scrape. RegisterCompression is not safe
+// to call concurrently with serving, and should be called from init.
+func RegisterCompression(name string, newCompressor func() Compressor) {
+	c := &compression{name: name}
+	c.pool.New = func() any { return newCompressor() }
+	compressions = append(compressions, c)
+}
+
+// acceptedQuality returns the quality value the Accept-Encoding header gives
+// to the encoding, or zero if it is not acceptable.
+func acceptedQuality(accept, name string) float64 {
+	wildcard := 0.0
+	for _, part := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.TrimSpace(coding)
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		switch {
+		case strings.EqualFold(coding, name):
+			return q
+		case coding == "*":
+			wildcard = q
+		}
+	}
+	return wildcard
+}
+
+// negotiateCompression picks the compression for the response, if any.
+func negotiateCompression(r *http.Request) *compression {
+	accept := r.Header.Get("Accept-Encoding")
+	if accept == "" {
+		return nil
+	}
+	var best *compression
+	bestQ := 0.0
+	for i := len(compressions) - 1; i >= 0; i-- {
+		c := compressions[i]
+		if q := acceptedQuality(accept, c.name); q > bestQ {
+			best, bestQ = c, q
+		}
+	}
+	return best
+}
+
+// compressResponse returns a writer for the response body, compressed if the
+// client accepts one of the registered encodings, and a function that must be
+// called when the body is complete.
+func compressResponse(w http.ResponseWriter, r *http.Request) (io.Writer, func()) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	c := negotiateCompression(r)
+	if c == nil {
+		return w, func() {}
+	}
+	w.Header().Set("Content-Encoding", c.name)
+	w.Header().Del("Content-Length")
+	cw := c.pool.Get().(Compressor)
+	cw.Reset(w)
+	return cw, func() {
+		cw.Close()
+		cw.Reset(nil)
+		c.pool.Put(cw)
+	}
+}
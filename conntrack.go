@@ -0,0 +1,115 @@
+package observability
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	conntrackEntriesDesc = DescribeMeter(
+		"/net/conntrack/entries",
+		"Number of connections tracked by netfilter, nf_conntrack_count.")
+	conntrackMaxDesc = DescribeMeter(
+		"/net/conntrack/max",
+		"Maximum number of connections that netfilter may track, "+
+			"nf_conntrack_max. Once `/net/conntrack/entries` reaches it, "+
+			"packets of new connections are dropped, which only the "+
+			"kernel log reports.")
+	conntrackInsertFailedDesc = DescribeMeter(
+		"/net/conntrack/insert_failed",
+		"Number of connections that couldn't be added to the table, such as "+
+			"because of races between packets of new UDP flows.",
+		Cumulative())
+	conntrackDropDesc = DescribeMeter(
+		"/net/conntrack/dropped",
+		"Number of packets dropped because their connections couldn't be "+
+			"tracked, mostly because the table was full.",
+		Cumulative())
+	conntrackEarlyDropDesc = DescribeMeter(
+		"/net/conntrack/early_dropped",
+		"Number of unconfirmed connections evicted from the full table to "+
+			"make room for new ones.",
+		Cumulative())
+)
+
+// conntrackStats are the columns of /proc/net/stat/nf_conntrack that are
+// sampled, summed over CPUs, and the descriptions of their meters.
+var conntrackStats = []struct {
+	name string
+	desc MeterDescription
+}{
+	{"insert_failed", conntrackInsertFailedDesc},
+	{"drop", conntrackDropDesc},
+	{"early_drop", conntrackEarlyDropDesc},
+}
+
+var errConntrackColumn = errors.New("observability: missing column in nf_conntrack stats")
+
+// RegisterConntrackStats registers meters of the netfilter connection
+// tracking table with o: the number of connections tracked and the maximum,
+// from /proc/sys/net/netfilter, and the failures to track them, from
+// /proc/net/stat/nf_conntrack, summed over CPUs. The nf_conntrack module must
+// be loaded. The files stay open for the life of the Origin.
+func RegisterConntrackStats(o *Origin) error {
+	return registerConntrackStats(o, "/proc/sys/net/netfilter", "/proc/net/stat/nf_conntrack")
+}
+
+func registerConntrackStats(o *Origin, sysctlDir, statPath string) error {
+	if err := RegisterSysfsMeter(o, filepath.Join(sysctlDir, "nf_conntrack_count"), DefineGauge(conntrackEntriesDesc)); err != nil {
+		return err
+	}
+	if err := RegisterSysfsMeter(o, filepath.Join(sysctlDir, "nf_conntrack_max"), DefineGauge(conntrackMaxDesc)); err != nil {
+		return err
+	}
+
+	// The first line names the hexadecimal columns of the lines of each CPU,
+	// which have been added to over the years.
+	b, err := os.ReadFile(statPath)
+	if err != nil {
+		return err
+	}
+	header, _, _ := bytes.Cut(b, []byte("\n"))
+	columns := bytes.Fields(header)
+	indices := make([]int, len(conntrackStats))
+	last := 0
+	for i, s := range conntrackStats {
+		indices[i] = -1
+		for j, c := range columns {
+			if string(c) == s.name {
+				indices[i], last = j, max(last, j)
+			}
+		}
+		if indices[i] < 0 {
+			return errConntrackColumn
+		}
+	}
+	ms := make([]Meter, len(conntrackStats))
+	for i, s := range conntrackStats {
+		ms[i] = DefineCounter(s.desc)
+	}
+	sums := make([]uint64, len(conntrackStats))
+	fs, err := NewFileScanner(statPath, NewRowScanner(func(fields [][]byte) {
+		for i, j := range indices {
+			sums[i] += naiveAtoiHex(fields[j])
+		}
+	}, minFields(last+1), func(fields [][]byte) bool {
+		return string(fields[0]) != string(columns[0])
+	}))
+	if err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		clear(sums)
+		if fs.Scan() != nil {
+			return
+		}
+		now := time.Now()
+		for i, m := range ms {
+			m.SampleAt(now, sums[i])
+		}
+	}, ms...)
+	return nil
+}
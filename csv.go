@@ -0,0 +1,92 @@
+package observability
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CSVExporter appends one line per meter to a writer, with the fields
+// timestamp, origin, name, and value. The timestamp is the sample time in
+// RFC 3339 format. The origin is its identity labels, formatted as
+// key=value pairs separated by semicolons. Meter labels are appended to the
+// name in braces, as in /disk/reads{device=sda}. There is no header line, so
+// that the output of several runs can be concatenated. This is meant for
+// quick local capture and offline analysis with standard tools.
+type CSVExporter struct {
+	cfg     exportConfig
+	origins []*Origin
+
+	// mu serializes writes, so lines of concurrent pushes don't
+	// interleave.
+	mu     sync.Mutex
+	w      *csv.Writer
+	record [4]string
+}
+
+// NewCSVExporter returns an exporter that writes to w. Use the ExportTSV option
+// for tab-separated output.
+func NewCSVExporter(w io.Writer, origins []*Origin, opts ...ExportOption) *CSVExporter {
+	e := &CSVExporter{
+		cfg:     newExportConfig(opts),
+		origins: origins,
+		w:       csv.NewWriter(w),
+	}
+	e.w.Comma = e.cfg.comma
+	return e
+}
+
+// csvLabels formats labels as key=value pairs separated by sep.
+func csvLabels(labels []Label, sep string) string {
+	var sb strings.Builder
+	for i, l := range labels {
+		if i > 0 {
+			sb.WriteString(sep)
+		}
+		sb.WriteString(l.Key)
+		sb.WriteByte('=')
+		sb.WriteString(l.Value)
+	}
+	return sb.String()
+}
+
+// Push takes a snapshot of every Origin and writes it. Meters that have never
+// been sampled are omitted.
+func (e *CSVExporter) Push(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	err := e.cfg.collect(e.origins, func(_ int, snap Snapshot) error {
+		e.record[1] = csvLabels(snap.Origin, ";")
+		for _, s := range snap.Samples {
+			if s.Time.IsZero() {
+				continue
+			}
+			name := s.Description.Name()
+			if len(s.Labels) > 0 {
+				name += "{" + csvLabels(s.Labels, ",") + "}"
+			}
+			e.record[0] = s.Time.UTC().Format(time.RFC3339Nano)
+			e.record[2] = name
+			e.record[3] = strconv.FormatUint(s.Value, 10)
+			if err := e.w.Write(e.record[:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	e.w.Flush()
+	if err != nil {
+		return err
+	}
+	return e.w.Error()
+}
+
+// Run pushes periodically until the context is done. Failed pushes are
+// reported to the function set with ExportErrors, and do not stop the loop.
+func (e *CSVExporter) Run(ctx context.Context) error {
+	return runPeriodically(ctx, e.cfg, e.Push)
+}
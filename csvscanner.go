@@ -0,0 +1,191 @@
+package observability
+
+import (
+	"bytes"
+	"sync/atomic"
+)
+
+// CSVScanner scans comma-separated values, such as the output of sar and of
+// exporters that write CSV, including the quoted fields of RFC 4180, which may
+// contain commas, doubled quotes, and newlines. Each row is passed to the
+// lineFunc named by its first column, as if it were a line of a proc file:
+//
+//	device,reads,writes,model
+//	sda,1043,2210,"Samsung SSD 870, 1TB"
+//
+// calls the function named "sda". The function is passed the configured
+// columns of the row in order, or all of the columns after the first. The
+// lineFuncs may be in any order; masks are ignored, since the columns already
+// select the fields, and field counts, if any, are checked as usual.
+type CSVScanner struct {
+	comma     byte
+	columns   []string
+	lineFuncs []lineFunc
+	index     map[string]int
+	// sel holds the indices of the configured columns, found in the header.
+	sel    []int
+	record [][]byte
+	fields [][]byte
+	// unquoted is scratch space for quoted fields that contain doubled
+	// quotes.
+	unquoted []byte
+	errors   atomic.Uint64
+}
+
+// NewCSVScanner creates a CSVScanner for values separated by comma. If columns
+// is not empty, the first row is a header naming the columns, and the
+// functions are passed the named columns in the given order; rows without
+// them are counted as errors. Otherwise there is no header.
+func NewCSVScanner(comma byte, columns []string, lineFuncs []lineFunc) *CSVScanner {
+	cs := &CSVScanner{
+		comma:     comma,
+		columns:   columns,
+		lineFuncs: lineFuncs,
+		index:     make(map[string]int, len(lineFuncs)),
+	}
+	for i, f := range lineFuncs {
+		cs.index[string(f.name)] = i
+	}
+	return cs
+}
+
+// Scan reads all of the rows in the given byte buffer, calling the function
+// for each row whose first column names one. Like the fields, the columns
+// point into the input, or into scratch space for quoted fields with doubled
+// quotes, and are only valid during the call.
+func (cs *CSVScanner) Scan(b []byte) {
+	header := len(cs.columns) > 0
+	for len(b) > 0 {
+		var ok bool
+		if cs.record, b, ok = cs.nextRecord(b, cs.record[:0]); !ok {
+			cs.errors.Add(1)
+			return
+		}
+		if len(cs.record) == 1 && len(cs.record[0]) == 0 {
+			// A blank line.
+			continue
+		}
+		if header {
+			cs.readHeader()
+			header = false
+			continue
+		}
+		// The conversion doesn't allocate.
+		i, found := cs.index[string(cs.record[0])]
+		if !found {
+			continue
+		}
+		if !cs.selectFields() {
+			cs.errors.Add(1)
+			continue
+		}
+		f := &cs.lineFuncs[i]
+		if f.nfields != 0 && len(cs.fields) != f.nfields {
+			cs.errors.Add(1)
+			continue
+		}
+		f.invoke(nil, cs.fields)
+	}
+}
+
+// Errors returns the number of problems found in the input: malformed quoted
+// fields, and rows without the configured columns or the expected number of
+// fields. It may be called concurrently with scans.
+func (cs *CSVScanner) Errors() uint64 {
+	return cs.errors.Load()
+}
+
+func (cs *CSVScanner) readHeader() {
+	cs.sel = cs.sel[:0]
+	for _, c := range cs.columns {
+		j := -1
+		for k, name := range cs.record {
+			if string(name) == c {
+				j = k
+				break
+			}
+		}
+		cs.sel = append(cs.sel, j)
+	}
+}
+
+// selectFields sets the fields to the configured columns of the record, and
+// reports whether it has them all.
+func (cs *CSVScanner) selectFields() bool {
+	if len(cs.columns) == 0 {
+		cs.fields = append(cs.fields[:0], cs.record[1:]...)
+		return true
+	}
+	cs.fields = cs.fields[:0]
+	for _, j := range cs.sel {
+		if j < 0 || j >= len(cs.record) {
+			return false
+		}
+		cs.fields = append(cs.fields, cs.record[j])
+	}
+	return true
+}
+
+// nextRecord appends the fields of the first record of b to a, and returns the
+// rest of b after it. It reports false if a quoted field isn't terminated.
+func (cs *CSVScanner) nextRecord(b []byte, a [][]byte) ([][]byte, []byte, bool) {
+	if len(a) == 0 {
+		cs.unquoted = cs.unquoted[:0]
+	}
+	for {
+		var field []byte
+		if len(b) > 0 && b[0] == '"' {
+			var ok bool
+			if field, b, ok = cs.quotedField(b[1:]); !ok {
+				return a, nil, false
+			}
+		} else {
+			i := 0
+			for i < len(b) && b[i] != cs.comma && b[i] != '\n' {
+				i++
+			}
+			field, b = b[:i:i], b[i:]
+			field = bytes.TrimSuffix(field, []byte{'\r'})
+		}
+		a = append(a, field)
+		if len(b) == 0 {
+			return a, b, true
+		}
+		if b[0] == '\n' {
+			return a, b[1:], true
+		}
+		// b[0] is the comma. If there is nothing after it, there is an
+		// empty last field.
+		b = b[1:]
+		if len(b) == 0 {
+			return append(a, nil), b, true
+		}
+	}
+}
+
+// quotedField returns the contents of the quoted field whose opening quote
+// precedes b, and the rest of b after the closing quote. Doubled quotes are
+// undoubled into the scratch space.
+func (cs *CSVScanner) quotedField(b []byte) (field, rest []byte, ok bool) {
+	i := bytes.IndexByte(b, '"')
+	if i < 0 {
+		return nil, nil, false
+	}
+	if i+1 >= len(b) || b[i+1] != '"' {
+		// The common case, without doubled quotes.
+		return b[:i:i], bytes.TrimPrefix(b[i+1:], []byte{'\r'}), true
+	}
+	start := len(cs.unquoted)
+	for {
+		cs.unquoted = append(cs.unquoted, b[:i+1]...)
+		b = b[i+2:]
+		if i = bytes.IndexByte(b, '"'); i < 0 {
+			return nil, nil, false
+		}
+		if i+1 >= len(b) || b[i+1] != '"' {
+			cs.unquoted = append(cs.unquoted, b[:i]...)
+			end := len(cs.unquoted)
+			return cs.unquoted[start:end:end], bytes.TrimPrefix(b[i+1:], []byte{'\r'}), true
+		}
+	}
+}
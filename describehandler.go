@@ -0,0 +1,84 @@
+package observability
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// DescribeHandler is an http.Handler that serves a catalog of the meters of
+// one or more Origins, without their values, for operators discovering what
+// an agent exports. Each entry has the meter's explanation, units, and
+// cumulative flag, and the call site that described it, so a reader can find
+// the code that defines the meter. It is conventionally served at /describe.
+// Meters are listed once however many Origins and labels they have, sorted by
+// name. Because the registered functions are not called, serving the catalog
+// is cheap.
+type DescribeHandler struct {
+	cfg     exportConfig
+	origins []*Origin
+}
+
+// NewDescribeHandler returns a DescribeHandler for the given origins. The
+// ExportAllow and ExportDeny options limit which meters are listed.
+func NewDescribeHandler(origins []*Origin, opts ...ExportOption) *DescribeHandler {
+	return &DescribeHandler{
+		cfg:     newExportConfig(opts),
+		origins: origins,
+	}
+}
+
+type jsonDescription struct {
+	Name        string   `json:"name"`
+	Explanation string   `json:"explanation"`
+	Cumulative  bool     `json:"cumulative"`
+	Units       string   `json:"units,omitempty"`
+	DescribedAt []string `json:"describedAt,omitempty"`
+}
+
+// ServeHTTP writes a document of the form
+//
+//	{"meters": [
+//	  {"name": "/xfs/reads", "describedAt": ["main.init /src/xfs.go:12"], ...},
+//	  ...
+//	]}
+func (h *DescribeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	byName := make(map[string]jsonDescription)
+	for _, o := range withChildren(h.origins) {
+		for _, md := range o.Descriptions() {
+			if _, ok := byName[md.Name()]; ok || !h.cfg.exports(md.Name()) {
+				continue
+			}
+			jd := jsonDescription{
+				Name:        md.Name(),
+				Explanation: md.Explanation(),
+				Cumulative:  md.Cumulative(),
+				Units:       md.Units(),
+			}
+			for _, f := range md.Frames() {
+				jd.DescribedAt = append(jd.DescribedAt, f.Function+" "+f.File+":"+strconv.Itoa(f.Line))
+			}
+			byName[md.Name()] = jd
+		}
+	}
+	meters := make([]jsonDescription, 0, len(byName))
+	for _, jd := range byName {
+		meters = append(meters, jd)
+	}
+	sort.Slice(meters, func(i, j int) bool { return meters[i].Name < meters[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	body, done := compressResponse(w, r)
+	defer done()
+	body.Write([]byte(`{"meters": [`))
+	for i := range meters {
+		m, _ := json.Marshal(&meters[i])
+		if i > 0 {
+			body.Write([]byte{','})
+		}
+		body.Write([]byte("\n  "))
+		body.Write(m)
+	}
+	body.Write([]byte("\n]}\n"))
+}
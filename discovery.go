@@ -0,0 +1,303 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProcessRule selects processes for a ProcessDiscovery. A process matches the
+// rule if it matches every field that is set, so a rule with only a Comm
+// matches every process with that command name.
+type ProcessRule struct {
+	// Name identifies the rule in the identities of the Origins of the
+	// processes that it matches, as the label rule.
+	Name string
+	// Comm is the command name, as in /proc/<pid>/comm, which the kernel
+	// truncates to 15 bytes.
+	Comm string
+	// Cmdline matches the command line, with its arguments separated by
+	// spaces, as in "/usr/sbin/nginx -g daemon off;".
+	Cmdline *regexp.Regexp
+	// Cgroup is a prefix of the path of a cgroup of the process, as in
+	// /proc/<pid>/cgroup, such as /system.slice/nginx.service.
+	Cgroup string
+	// UIDs are the real user IDs, any of which the process may have.
+	UIDs []int
+}
+
+// ProcessDiscovery finds the processes that match its rules in /proc, and
+// creates a child Origin of its parent for each, with the meters of
+// RegisterProcessStats, RegisterProcessIOStats, RegisterProcessMemoryStats,
+// and RegisterProcessFDStats, those that the agent has the permissions to
+// read. The identity of each child is the parent's followed by the labels rule,
+// the name of the first rule that the process matches; pid; exe, the path of
+// its executable; and start_time, the Unix time at which it started, to the
+// hundredth of a second, which distinguishes it from earlier and later
+// processes with the same PID. The children of processes that have exited are
+// removed at the next scan, which closes their files.
+type ProcessDiscovery struct {
+	parent *Origin
+	rules  []ProcessRule
+	proc   string
+	btime  uint64
+
+	// mu serializes scans, and protects procs.
+	mu sync.Mutex
+	// procs are the processes found by the last scan, matching or not,
+	// by PID.
+	procs map[string]*discoveredProcess
+}
+
+// discoveredProcess is a process found by a scan.
+type discoveredProcess struct {
+	// start is the starttime field of /proc/<pid>/stat, in clock ticks
+	// since boot, which tells the process from later ones with the same
+	// PID.
+	start uint64
+	// origin is the child Origin of the process, or nil if it matches no
+	// rule.
+	origin *Origin
+	// closers are the files opened for the meters of origin.
+	closers []io.Closer
+}
+
+// processStatComm is the field of /proc/<pid>/stat with the command name, as
+// processStatResident.
+const processStatComm = 1
+
+// NewProcessDiscovery returns a ProcessDiscovery that adds the processes that
+// match any of the rules to parent. It finds none until it scans.
+func NewProcessDiscovery(parent *Origin, rules []ProcessRule) (*ProcessDiscovery, error) {
+	return newProcessDiscovery(parent, rules, "/proc")
+}
+
+func newProcessDiscovery(parent *Origin, rules []ProcessRule, proc string) (*ProcessDiscovery, error) {
+	btime, err := bootTime(filepath.Join(proc, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	return &ProcessDiscovery{
+		parent: parent,
+		rules:  rules,
+		proc:   proc,
+		btime:  btime,
+		procs:  make(map[string]*discoveredProcess),
+	}, nil
+}
+
+// Scan finds the processes that have started since the last scan, adding
+// those that match the rules, and removes those that have exited. Each
+// process is matched once, when it is first found, so those that later change
+// their command lines aren't matched again.
+func (d *ProcessDiscovery) Scan() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entries, err := os.ReadDir(d.proc)
+	if err != nil {
+		return err
+	}
+	found := make(map[string]*discoveredProcess, len(entries))
+	for _, e := range entries {
+		pid := e.Name()
+		if !isPID(pid) {
+			continue
+		}
+		comm, start, err := readProcessStat(filepath.Join(d.proc, pid, "stat"))
+		if err != nil {
+			// The process exited.
+			continue
+		}
+		if p, ok := d.procs[pid]; ok && p.start == start {
+			found[pid] = p
+			continue
+		}
+		p := &discoveredProcess{start: start}
+		if rule, ok := d.match(pid, comm); ok {
+			p.origin, p.closers = d.add(rule, pid, start)
+		}
+		found[pid] = p
+	}
+	for pid, p := range d.procs {
+		if p.origin != nil && found[pid] != p {
+			d.parent.RemoveChild(p.origin)
+			closeAll(p.closers)
+		}
+	}
+	d.procs = found
+	return nil
+}
+
+// Run scans every interval until the context is done.
+func (d *ProcessDiscovery) Run(ctx context.Context, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := d.Scan(); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// isPID reports whether the name of an entry of /proc is a PID.
+func isPID(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '0' || name[i] > '9' {
+			return false
+		}
+	}
+	return name != ""
+}
+
+var errShortProcessStat = errors.New("observability: /proc/<pid>/stat has too few fields")
+
+// readProcessStat returns the command name and start time of the process from
+// the /proc/<pid>/stat file at path.
+func readProcessStat(path string) (comm string, start uint64, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", 0, err
+	}
+	found := false
+	rs := NewRowScanner(func(fields [][]byte) {
+		comm, start, found = string(fields[processStatComm]), naiveAtoi(fields[processStatStartTime]), true
+	}, minFields(processStatResident+1))
+	rs.SetParenthesized(true)
+	rs.Scan(b)
+	if !found {
+		return "", 0, errShortProcessStat
+	}
+	return comm, start, nil
+}
+
+// match returns the first rule that the process matches.
+func (d *ProcessDiscovery) match(pid, comm string) (ProcessRule, bool) {
+	dir := filepath.Join(d.proc, pid)
+	for _, r := range d.rules {
+		if r.Comm != "" && r.Comm != comm {
+			continue
+		}
+		if r.Cmdline != nil {
+			b, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+			if err != nil || !r.Cmdline.Match(bytes.ReplaceAll(bytes.TrimRight(b, "\x00"), []byte{0}, []byte{' '})) {
+				continue
+			}
+		}
+		if r.Cgroup != "" && !processInCgroup(filepath.Join(dir, "cgroup"), r.Cgroup) {
+			continue
+		}
+		if len(r.UIDs) > 0 && !processHasUID(filepath.Join(dir, "status"), r.UIDs) {
+			continue
+		}
+		return r, true
+	}
+	return ProcessRule{}, false
+}
+
+// processInCgroup reports whether the /proc/<pid>/cgroup file at path, whose
+// lines are of the form "0::/system.slice/nginx.service", has a cgroup whose
+// path begins with prefix.
+func processInCgroup(path, prefix string) bool {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if parts := strings.SplitN(line, ":", 3); len(parts) == 3 && strings.HasPrefix(parts[2], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// processHasUID reports whether the real user ID in the /proc/<pid>/status
+// file at path, the first of the four of its Uid line, is any of the uids.
+func processHasUID(path string, uids []int) bool {
+	var uid uint64
+	found := false
+	fs, err := NewFileScanner(path, NewUnorderedBufferScanner(nil, []lineFunc{{
+		name:    []byte("Uid:"),
+		mask:    fieldMask(0),
+		nfields: 1,
+		f:       func(fields [][]byte) { uid, found = naiveAtoi(fields[0]), true },
+	}}))
+	if err != nil {
+		return false
+	}
+	defer fs.Close()
+	if fs.Scan() != nil || !found {
+		return false
+	}
+	for _, u := range uids {
+		if uint64(u) == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// add creates the child Origin of a process that matches the rule, and
+// registers its collectors, returning it and the files opened for them, or nil
+// if the process has exited.
+func (d *ProcessDiscovery) add(rule ProcessRule, pid string, start uint64) (*Origin, []io.Closer) {
+	dir := filepath.Join(d.proc, pid)
+	exe, _ := os.Readlink(filepath.Join(dir, "exe"))
+	o := d.parent.NewChild(
+		Label{Key: "rule", Value: rule.Name},
+		Label{Key: "pid", Value: pid},
+		Label{Key: "exe", Value: exe},
+		Label{Key: "start_time", Value: fmt.Sprintf("%d.%02d", d.btime+start/userHZ, start%userHZ)})
+	// If the process is abandoned, the files opened for it are closed,
+	// since the child is no longer collected.
+	var closers []io.Closer
+	abandon := func() (*Origin, []io.Closer) {
+		d.parent.RemoveChild(o)
+		closeAll(closers)
+		return nil, nil
+	}
+	c, err := registerProcessStats(o, d.proc, pid)
+	if err != nil {
+		return abandon()
+	}
+	closers = append(closers, c)
+	// The other files can only be read with the permission to ptrace the
+	// process, and smaps_rollup only from Linux 4.14.
+	for _, r := range []struct {
+		register func(*Origin, string) (io.Closer, error)
+		path     string
+	}{
+		{registerProcessIOStats, filepath.Join(dir, "io")},
+		{registerProcessMemoryStats, filepath.Join(dir, "smaps_rollup")},
+		{registerProcessFDStats, dir},
+	} {
+		c, err := r.register(o, r.path)
+		switch {
+		case err == nil:
+			closers = append(closers, c)
+		case !errors.Is(err, fs.ErrPermission) && !errors.Is(err, fs.ErrNotExist):
+			return abandon()
+		}
+	}
+	return o, closers
+}
+
+// closeAll closes the files.
+func closeAll(closers []io.Closer) {
+	for _, c := range closers {
+		c.Close()
+	}
+}
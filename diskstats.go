@@ -0,0 +1,209 @@
+package observability
+
+import (
+	"strings"
+	"time"
+)
+
+var (
+	diskReadsDesc = DescribeMeter(
+		"/disk/reads",
+		"Number of reads completed by each block device.",
+		Cumulative())
+	diskReadsMergedDesc = DescribeMeter(
+		"/disk/reads_merged",
+		"Number of reads merged with adjacent ones before being issued to "+
+			"each block device.",
+		Cumulative())
+	diskBytesReadDesc = DescribeMeter(
+		"/disk/bytes_read",
+		"Number of bytes read by each block device.",
+		Cumulative(), Units("By"))
+	diskReadTimeDesc = DescribeMeter(
+		"/disk/read_time",
+		"Time spent on reads by each block device, summed over the reads "+
+			"in flight.",
+		Cumulative(), Units("ms"))
+	diskWritesDesc = DescribeMeter(
+		"/disk/writes",
+		"Number of writes completed by each block device.",
+		Cumulative())
+	diskWritesMergedDesc = DescribeMeter(
+		"/disk/writes_merged",
+		"Number of writes merged with adjacent ones before being issued to "+
+			"each block device.",
+		Cumulative())
+	diskBytesWrittenDesc = DescribeMeter(
+		"/disk/bytes_written",
+		"Number of bytes written by each block device.",
+		Cumulative(), Units("By"))
+	diskWriteTimeDesc = DescribeMeter(
+		"/disk/write_time",
+		"Time spent on writes by each block device, summed over the writes "+
+			"in flight.",
+		Cumulative(), Units("ms"))
+	diskInFlightDesc = DescribeMeter(
+		"/disk/in_flight",
+		"Number of requests issued to each block device and not yet "+
+			"completed.")
+	diskBusyTimeDesc = DescribeMeter(
+		"/disk/busy_time",
+		"Time during which each block device had requests in flight. It can "+
+			"be used to calculate utilization.",
+		Cumulative(), Units("ms"))
+	diskQueueTimeDesc = DescribeMeter(
+		"/disk/queue_time",
+		"Time spent by requests in flight to each block device, summed over "+
+			"the requests. It can be used to calculate the average queue "+
+			"length.",
+		Cumulative(), Units("ms"))
+	diskDiscardsDesc = DescribeMeter(
+		"/disk/discards",
+		"Number of discards completed by each block device. Linux 4.18 "+
+			"and later.",
+		Cumulative())
+	diskDiscardsMergedDesc = DescribeMeter(
+		"/disk/discards_merged",
+		"Number of discards merged with adjacent ones before being issued "+
+			"to each block device. Linux 4.18 and later.",
+		Cumulative())
+	diskBytesDiscardedDesc = DescribeMeter(
+		"/disk/bytes_discarded",
+		"Number of bytes discarded by each block device. Linux 4.18 and "+
+			"later.",
+		Cumulative(), Units("By"))
+	diskDiscardTimeDesc = DescribeMeter(
+		"/disk/discard_time",
+		"Time spent on discards by each block device, summed over the "+
+			"discards in flight. Linux 4.18 and later.",
+		Cumulative(), Units("ms"))
+	diskFlushesDesc = DescribeMeter(
+		"/disk/flushes",
+		"Number of cache flushes completed by each block device. Linux 5.5 "+
+			"and later.",
+		Cumulative())
+	diskFlushTimeDesc = DescribeMeter(
+		"/disk/flush_time",
+		"Time spent on cache flushes by each block device. Linux 5.5 and "+
+			"later.",
+		Cumulative(), Units("ms"))
+)
+
+// diskField is a field of a line of /proc/diskstats, after the major and minor
+// device numbers and the device name.
+type diskField struct {
+	desc  MeterDescription
+	gauge bool
+	// sectors is set for counts of sectors, which are always of 512 bytes
+	// in /proc/diskstats, whatever the sector size of the device.
+	sectors bool
+}
+
+// diskFields are the fields of /proc/diskstats, in order. The last six were
+// added in Linux 4.18 and 5.5.
+var diskFields = []diskField{
+	{desc: diskReadsDesc},
+	{desc: diskReadsMergedDesc},
+	{desc: diskBytesReadDesc, sectors: true},
+	{desc: diskReadTimeDesc},
+	{desc: diskWritesDesc},
+	{desc: diskWritesMergedDesc},
+	{desc: diskBytesWrittenDesc, sectors: true},
+	{desc: diskWriteTimeDesc},
+	{desc: diskInFlightDesc, gauge: true},
+	{desc: diskBusyTimeDesc},
+	{desc: diskQueueTimeDesc},
+	{desc: diskDiscardsDesc},
+	{desc: diskDiscardsMergedDesc},
+	{desc: diskBytesDiscardedDesc, sectors: true},
+	{desc: diskDiscardTimeDesc},
+	{desc: diskFlushesDesc},
+	{desc: diskFlushTimeDesc},
+}
+
+// DefaultDiskFilter accepts the block devices other than loop and RAM disks,
+// whose traffic is already counted against the devices backing them, or is
+// just memory traffic.
+func DefaultDiskFilter(device string) bool {
+	return !strings.HasPrefix(device, "loop") && !strings.HasPrefix(device, "ram")
+}
+
+// RegisterDiskStats registers meters of the block devices accepted by the
+// filter, or by DefaultDiskFilter if it is nil, with o, sampled from
+// /proc/diskstats and labeled with the device name. There are meters for as
+// many fields as the kernel provides. The devices are those present at
+// registration; devices that appear later are not sampled. The file stays open
+// for the life of the Origin.
+func RegisterDiskStats(o *Origin, filter func(device string) bool) error {
+	return registerDiskStats(o, "/proc/diskstats", filter)
+}
+
+func registerDiskStats(o *Origin, path string, filter func(device string) bool) error {
+	if filter == nil {
+		filter = DefaultDiskFilter
+	}
+	var ms []Meter
+	devices := make(map[string][]Meter)
+	// Find the devices, and the fields that the kernel provides.
+	rs := NewRowScanner(func(fields [][]byte) {
+		device := string(fields[2])
+		if !filter(device) {
+			return
+		}
+		meters := defineDiskMeters(device, len(fields)-3)
+		devices[device] = meters
+		ms = append(ms, meters...)
+	}, minFields(4))
+	fs, err := NewFileScanner(path, rs)
+	if err != nil {
+		return err
+	}
+	err = fs.Scan()
+	fs.Close()
+	if err != nil {
+		return err
+	}
+
+	var now time.Time
+	rs = NewRowScanner(func(fields [][]byte) {
+		// The conversion doesn't allocate.
+		meters, ok := devices[string(fields[2])]
+		if !ok {
+			return
+		}
+		sampleDiskMeters(meters, now, fields[3:])
+	}, minFields(4))
+	if fs, err = NewFileScanner(path, rs); err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		fs.Scan()
+	}, ms...)
+	return nil
+}
+
+// defineDiskMeters defines the meters of the first n diskFields of a device.
+func defineDiskMeters(device string, n int) []Meter {
+	label := Label{Key: "device", Value: device}
+	meters := make([]Meter, min(n, len(diskFields)))
+	for i, f := range diskFields[:len(meters)] {
+		if f.gauge {
+			meters[i] = DefineGauge(f.desc, label)
+		} else {
+			meters[i] = DefineCounter(f.desc, label)
+		}
+	}
+	return meters
+}
+
+// sampleDiskMeters samples the meters of a device from the diskFields.
+func sampleDiskMeters(meters []Meter, now time.Time, fields [][]byte) {
+	for i, m := range meters[:min(len(meters), len(fields))] {
+		v := naiveAtoi(fields[i])
+		if diskFields[i].sectors {
+			v *= 512
+		}
+		m.SampleAt(now, v)
+	}
+}
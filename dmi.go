@@ -0,0 +1,104 @@
+package observability
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+var hardwareInfoDesc = DescribeMeter(
+	"/hardware/info",
+	"Always 1, labeled with the identity of the hardware from its DMI "+
+		"(SMBIOS) tables: the vendor, product, and serial number of the "+
+		"system, its board, and the vendor, version, and date of its BIOS. "+
+		"Labels that could not be read, such as the serial number without "+
+		"root, are absent. Join on the identity of the Origin to slice "+
+		"other meters by hardware generation or firmware.")
+
+// dmiFiles are the files of /sys/class/dmi/id that are read, and the keys of
+// their labels.
+var dmiFiles = []struct {
+	name, key string
+}{
+	{"sys_vendor", "vendor"},
+	{"product_name", "product"},
+	{"product_version", "product_version"},
+	{"product_serial", "serial"},
+	{"board_vendor", "board_vendor"},
+	{"board_name", "board"},
+	{"bios_vendor", "bios_vendor"},
+	{"bios_version", "bios_version"},
+	{"bios_date", "bios_date"},
+}
+
+// dmiIdentityKeys are the keys of the labels suggested for the identity of an
+// Origin, which don't change over the life of the hardware.
+var dmiIdentityKeys = []string{"vendor", "product"}
+
+// readDMILabels returns a label for each of the files of dmiFiles in dir that
+// can be read and isn't empty.
+func readDMILabels(dir string) ([]Label, error) {
+	var labels []Label
+	for _, f := range dmiFiles {
+		v, err := readSysfsString(filepath.Join(dir, f.name))
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if v != "" {
+			labels = append(labels, Label{Key: f.key, Value: v})
+		}
+	}
+	return labels, nil
+}
+
+// DMILabels returns labels of the vendor and product name of the hardware,
+// read from /sys/class/dmi/id, to be added to the identity of an Origin, so
+// that its meters can be sliced by hardware generation. Unlike the serial
+// number and BIOS version of `/hardware/info`, they don't change over the life
+// of the machine, as an identity must not. Those that could not be read are
+// absent.
+func DMILabels() ([]Label, error) {
+	return dmiLabels("/sys/class/dmi/id")
+}
+
+func dmiLabels(dir string) ([]Label, error) {
+	all, err := readDMILabels(dir)
+	if err != nil {
+		return nil, err
+	}
+	var labels []Label
+	for _, l := range all {
+		for _, k := range dmiIdentityKeys {
+			if l.Key == k {
+				labels = append(labels, l)
+			}
+		}
+	}
+	return labels, nil
+}
+
+// RegisterDMIInfo registers `/hardware/info` with o, labeled with the identity
+// of the hardware read from /sys/class/dmi/id at registration. It is absent on
+// machines without DMI tables, such as most ARM boards, where this fails.
+func RegisterDMIInfo(o *Origin) error {
+	return registerDMIInfo(o, "/sys/class/dmi/id")
+}
+
+func registerDMIInfo(o *Origin, dir string) error {
+	labels, err := readDMILabels(dir)
+	if err != nil {
+		return err
+	}
+	if len(labels) == 0 {
+		return &fs.PathError{Op: "open", Path: dir, Err: fs.ErrNotExist}
+	}
+	m := DefineGauge(hardwareInfoDesc, labels...)
+	o.RegisterFunction(func() {
+		m.SampleAt(time.Now(), 1)
+	}, m)
+	return nil
+}
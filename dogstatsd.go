@@ -0,0 +1,178 @@
+package observability
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default datagram sizes. The UDP size fits a 1500 byte Ethernet MTU after IP
+// and UDP headers. The Datadog agent accepts 8KiB datagrams on its unix
+// socket.
+const (
+	dogStatsDUDPPacket  = 1432
+	dogStatsDUnixPacket = 8192
+)
+
+// DogStatsDExporter pushes meters to a DogStatsD server, such as the Datadog
+// agent, in the DogStatsD dialect of StatsD. Origin identity and meter labels
+// become tags. Cumulative meters are sent as counts of their increase since
+// the previous push, and other meters are sent as gauges. With the
+// CumulativeTemporality option, cumulative meters are sent as gauges of their
+// totals instead, since StatsD counts are always deltas.
+type DogStatsDExporter struct {
+	cfg     exportConfig
+	origins []*Origin
+	network string
+	addr    string
+
+	// mu protects everything below, which is state carried between
+	// pushes.
+	mu     sync.Mutex
+	conn   net.Conn
+	packet []byte
+	line   []byte
+}
+
+// NewDogStatsDExporter returns an exporter that sends to the given address,
+// either a UDP "host:port" or "unix:///path/to/dsd.socket" for a unix datagram
+// socket.
+func NewDogStatsDExporter(addr string, origins []*Origin, opts ...ExportOption) *DogStatsDExporter {
+	e := &DogStatsDExporter{
+		cfg:     newExportConfig(append([]ExportOption{ExportTemporality(DeltaTemporality)}, opts...)),
+		origins: origins,
+		network: "udp",
+		addr:    addr,
+	}
+	if path, ok := strings.CutPrefix(addr, "unix://"); ok {
+		e.network = "unixgram"
+		e.addr = path
+	}
+	if e.cfg.maxPacket == 0 {
+		e.cfg.maxPacket = dogStatsDUDPPacket
+		if e.network == "unixgram" {
+			e.cfg.maxPacket = dogStatsDUnixPacket
+		}
+	}
+	return e
+}
+
+// dogStatsDName converts a meter name such as /xfs/reads to the conventional
+// dotted form, xfs.reads.
+func dogStatsDName(name string) string {
+	return strings.ReplaceAll(strings.TrimLeft(name, "/"), "/", ".")
+}
+
+// dogStatsDTagReplacer removes the characters that delimit the protocol.
+var dogStatsDTagReplacer = strings.NewReplacer(
+	",", "_", "|", "_", "#", "_", "\n", "_", ":", "_")
+
+func appendDogStatsDTags(b []byte, first bool, labels []Label) []byte {
+	for _, l := range labels {
+		if first {
+			b = append(b, "|#"...)
+			first = false
+		} else {
+			b = append(b, ',')
+		}
+		b = append(b, dogStatsDTagReplacer.Replace(l.Key)...)
+		b = append(b, ':')
+		b = append(b, dogStatsDTagReplacer.Replace(l.Value)...)
+	}
+	return b
+}
+
+// appendDogStatsDLine appends one datagram line, without the trailing
+// newline.
+func appendDogStatsDLine(b []byte, origin []Label, s *Sample, typ string) []byte {
+	b = append(b, dogStatsDName(s.Description.Name())...)
+	b = append(b, ':')
+	b = strconv.AppendUint(b, s.Value, 10)
+	b = append(b, '|')
+	b = append(b, typ...)
+	b = appendDogStatsDTags(b, true, origin)
+	return appendDogStatsDTags(b, len(origin) == 0, s.Labels)
+}
+
+// Push takes a snapshot of every Origin and sends it, batching lines into as
+// few datagrams as possible.
+func (e *DogStatsDExporter) Push(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn == nil {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, e.network, e.addr)
+		if err != nil {
+			return err
+		}
+		e.conn = conn
+	}
+	e.packet = e.packet[:0]
+	err := e.cfg.collect(e.origins, func(_ int, snap Snapshot) error {
+		for i := range snap.Samples {
+			s := &snap.Samples[i]
+			if s.Time.IsZero() {
+				continue
+			}
+			typ := "g"
+			if s.Description.Cumulative() && e.cfg.temporality == DeltaTemporality {
+				typ = "c"
+			}
+			e.line = appendDogStatsDLine(e.line[:0], snap.Origin, s, typ)
+			if err := e.append(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return e.flush()
+}
+
+// append adds the current line to the packet, first sending the packet if the
+// line doesn't fit. A line that is too big on its own is dropped, as the
+// server would reject it anyway.
+func (e *DogStatsDExporter) append() error {
+	if len(e.line) > e.cfg.maxPacket {
+		return nil
+	}
+	n := len(e.packet) + len(e.line)
+	if len(e.packet) > 0 {
+		n++ // newline
+	}
+	if n > e.cfg.maxPacket {
+		if err := e.flush(); err != nil {
+			return err
+		}
+	}
+	if len(e.packet) > 0 {
+		e.packet = append(e.packet, '\n')
+	}
+	e.packet = append(e.packet, e.line...)
+	return nil
+}
+
+func (e *DogStatsDExporter) flush() error {
+	if len(e.packet) == 0 {
+		return nil
+	}
+	_, err := e.conn.Write(e.packet)
+	e.packet = e.packet[:0]
+	if err != nil {
+		// Redial on the next push, in case the server restarted and
+		// recreated its socket.
+		e.conn.Close()
+		e.conn = nil
+	}
+	return err
+}
+
+// Run pushes periodically until the context is done. Failed pushes are
+// reported to the function set with ExportErrors, and do not stop the loop.
+func (e *DogStatsDExporter) Run(ctx context.Context) error {
+	return runPeriodically(ctx, e.cfg, e.Push)
+}
@@ -0,0 +1,55 @@
+package observability
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDogStatsDExporter(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	o := NewOrigin(Label{Key: "host", Value: "alice"})
+	n := uint64(10)
+	c := DefineCounter(DescribeMeter("/test/ops", "Ops.", Cumulative()))
+	g := DefineGauge(DescribeMeter("/test/temp", "Temp."), Label{Key: "zone", Value: "a,b"})
+	o.RegisterFunction(func() {
+		now := time.Now()
+		c.SampleAt(now, n)
+		g.SampleAt(now, 7)
+		n += 5
+	}, c, g)
+
+	// Small enough that every line gets its own datagram.
+	e := NewDogStatsDExporter(pc.LocalAddr().String(), []*Origin{o}, ExportMaxPacket(40))
+	var got []string
+	for i := 0; i < 2; i++ {
+		if err := e.Push(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := make([]byte, 1500)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		got = append(got, string(buf[:n]))
+	}
+	want := []string{
+		// The first push establishes the baseline for the counter.
+		"test.temp:7|g|#host:alice,zone:a_b",
+		"test.ops:5|c|#host:alice",
+		"test.temp:7|g|#host:alice,zone:a_b",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got datagrams %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,186 @@
+package observability
+
+import (
+	"bytes"
+	"time"
+)
+
+var (
+	drbdConnectionStateDesc = DescribeMeter(
+		"/drbd/connection_state",
+		"Whether the connection of each DRBD device to its peer is in each "+
+			"state, 1, or not, 0. StandAlone after a disconnection is how "+
+			"DRBD reacts to a split brain.")
+	drbdPrimaryDesc = DescribeMeter(
+		"/drbd/primary",
+		"Whether each DRBD device is primary, 1, or not, 0, on this node, "+
+			"local, and as last known of its peer, peer. Both being "+
+			"primary is a split brain.")
+	drbdDiskStateDesc = DescribeMeter(
+		"/drbd/disk_state",
+		"Whether the disk of each DRBD device, on this node, local, or as "+
+			"last known of its peer, peer, is in each state, 1, or not, 0.")
+	drbdOutOfSyncDesc = DescribeMeter(
+		"/drbd/out_of_sync",
+		"Data of each DRBD device that differs between this node and its "+
+			"peer, and must be synchronized.",
+		Units("By"))
+	drbdSyncProgressDesc = DescribeMeter(
+		"/drbd/sync_progress",
+		"Progress of the resynchronization of each DRBD device, rounded "+
+			"down. It is only sampled while the device is synchronizing.",
+		Units("%"))
+)
+
+// drbdConnectionStates and drbdDiskStates are the values of the cs and ds
+// fields of /proc/drbd, respectively.
+var (
+	drbdConnectionStates = []string{"StandAlone", "Disconnecting",
+		"Unconnected", "Timeout", "BrokenPipe", "NetworkFailure",
+		"ProtocolError", "TearDown", "WFConnection", "WFReportParams",
+		"Connected", "StartingSyncS", "StartingSyncT", "WFBitMapS",
+		"WFBitMapT", "WFSyncUUID", "SyncSource", "SyncTarget", "PausedSyncS",
+		"PausedSyncT", "VerifyS", "VerifyT", "Ahead", "Behind"}
+	drbdDiskStates = []string{"Diskless", "Attaching", "Failed",
+		"Negotiating", "Inconsistent", "Outdated", "DUnknown", "Consistent",
+		"UpToDate"}
+)
+
+// drbdScanner scans /proc/drbd of DRBD 8, in which each device has a line
+// like " 0: cs:Connected ro:Primary/Secondary ds:UpToDate/UpToDate C r-----",
+// followed by lines of its counters, like "ns:190336 ... oos:409600", and
+// while it synchronizes, its progress, like "sync'ed: 31.7% (400/580)M".
+// DRBD 9 only shows its version there.
+type drbdScanner struct {
+	// f is called for each key and value of each device with its minor
+	// number. Each points into the input.
+	f      func(minor, key, value []byte)
+	fields [][]byte
+}
+
+func (s *drbdScanner) Scan(b []byte) {
+	var minor []byte
+	for len(b) > 0 {
+		var line []byte
+		line, b = nextLine(b)
+		s.fields = asciiByteFields(line, s.fields[:0])
+		fields := s.fields
+		if len(fields) > 0 && len(fields[0]) > 1 && fields[0][len(fields[0])-1] == ':' && fields[0][0] >= '0' && fields[0][0] <= '9' {
+			minor, fields = fields[0][:len(fields[0])-1], fields[1:]
+		}
+		if minor == nil {
+			continue
+		}
+		for i := 0; i < len(fields); i++ {
+			key, value, ok := bytes.Cut(fields[i], []byte(":"))
+			if !ok {
+				continue
+			}
+			// Some keys are separated from their values by a space.
+			if len(value) == 0 && i+1 < len(fields) {
+				i++
+				value = fields[i]
+			}
+			s.f(minor, key, value)
+		}
+	}
+}
+
+// drbdDevice holds the meters of a DRBD device.
+type drbdDevice struct {
+	connection        []Meter
+	primary           [2]Meter   // Of the local node and the peer.
+	disk              [2][]Meter // Of the local node and the peer.
+	outOfSync, synced Meter
+}
+
+// sampleStates samples the meters of the given states with whether each is
+// the value.
+func sampleStates(now time.Time, ms []Meter, states []string, value []byte) {
+	for i, s := range states {
+		// The conversion doesn't allocate.
+		ms[i].SampleAt(now, boolValue(string(value) == s))
+	}
+}
+
+// RegisterDRBDStats registers meters of the replication of each DRBD device
+// with o, sampled from /proc/drbd: the state of its connection, the roles and
+// disk states of both nodes, the data out of sync, and the progress of
+// synchronization, so that degraded replication and split brains are caught.
+// The meters are labeled with the minor number of the device, and those of
+// states also with the state. The devices are those configured at
+// registration. Only DRBD 8 reports its devices in /proc/drbd. The file stays
+// open for the life of the Origin.
+func RegisterDRBDStats(o *Origin) error {
+	return registerDRBDStats(o, "/proc/drbd")
+}
+
+func registerDRBDStats(o *Origin, path string) error {
+	devices := make(map[string]*drbdDevice)
+	var ms []Meter
+	discover, err := NewFileScanner(path, &drbdScanner{f: func(minor, key, value []byte) {
+		if string(key) != "cs" || string(value) == "Unconfigured" {
+			return
+		}
+		label := Label{Key: "minor", Value: string(minor)}
+		d := &drbdDevice{
+			outOfSync: DefineGauge(drbdOutOfSyncDesc, label),
+			synced:    DefineGauge(drbdSyncProgressDesc, label),
+		}
+		for _, s := range drbdConnectionStates {
+			d.connection = append(d.connection, DefineGauge(drbdConnectionStateDesc, label, Label{Key: "state", Value: s}))
+		}
+		for i, node := range []string{"local", "peer"} {
+			nodeLabel := Label{Key: "node", Value: node}
+			d.primary[i] = DefineGauge(drbdPrimaryDesc, label, nodeLabel)
+			for _, s := range drbdDiskStates {
+				d.disk[i] = append(d.disk[i], DefineGauge(drbdDiskStateDesc, label, nodeLabel, Label{Key: "state", Value: s}))
+			}
+			ms = append(append(ms, d.primary[i]), d.disk[i]...)
+		}
+		devices[string(minor)] = d
+		ms = append(append(ms, d.outOfSync, d.synced), d.connection...)
+	}})
+	if err != nil {
+		return err
+	}
+	err = discover.Scan()
+	discover.Close()
+	if err != nil {
+		return err
+	}
+
+	var now time.Time
+	fs, err := NewFileScanner(path, &drbdScanner{f: func(minor, key, value []byte) {
+		d, ok := devices[string(minor)]
+		if !ok {
+			return
+		}
+		switch string(key) {
+		case "cs":
+			sampleStates(now, d.connection, drbdConnectionStates, value)
+		case "ro", "ds":
+			local, peer, _ := bytes.Cut(value, []byte("/"))
+			for i, v := range [][]byte{local, peer} {
+				if string(key) == "ro" {
+					d.primary[i].SampleAt(now, boolValue(string(v) == "Primary"))
+				} else {
+					sampleStates(now, d.disk[i], drbdDiskStates, v)
+				}
+			}
+		case "oos":
+			// The data out of sync is in KiB.
+			d.outOfSync.SampleAt(now, naiveAtoi(value)*1024)
+		case "sync'ed":
+			d.synced.SampleAt(now, uint64(naiveAtofMicro(bytes.TrimSuffix(value, []byte("%")))/1000000))
+		}
+	}})
+	if err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		fs.Scan()
+	}, ms...)
+	return nil
+}
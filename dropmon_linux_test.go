@@ -0,0 +1,99 @@
+package observability
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// childValues returns the values of the samples of the children of o, keyed
+// by their identities and the meter names.
+func childValues(o *Origin) map[string]uint64 {
+	got := make(map[string]uint64)
+	for _, c := range o.Children() {
+		var id string
+		for _, l := range c.Identity() {
+			id += l.Value + "|"
+		}
+		for k, v := range sampleValues(c) {
+			got[id+k] = v
+		}
+	}
+	return got
+}
+
+func TestPacketDropAlert(t *testing.T) {
+	o := NewOrigin()
+	d := &packetDrops{o: o, drops: make(map[string]*atomic.Uint64)}
+	alert := func(symbol, reason string) []byte {
+		b := appendGenlHeader(nil, netDMCmdPacketAlert, 2)
+		b = appendNetlinkAttr(b, 2, binary.NativeEndian.AppendUint64(nil, 0xffffffff81a2b3c4))
+		b = appendNetlinkAttr(b, netDMAttrSymbol, append([]byte(symbol), 0))
+		if reason != "" {
+			b = appendNetlinkAttr(b, netDMAttrReason, append([]byte(reason), 0))
+		}
+		return b
+	}
+	for _, b := range [][]byte{
+		alert("__udp4_lib_rcv+0x6a1/0xb50", "NO_SOCKET"),
+		alert("__udp4_lib_rcv+0x6a1/0xb50", "NO_SOCKET"),
+		alert("nf_hook_slow+0x91/0xc0", "NETFILTER_DROP"),
+		alert("tcp_v4_rcv+0x1a0/0xa30", ""),
+		// Other commands are ignored.
+		appendGenlHeader(nil, 1, 2),
+	} {
+		if err := d.alert(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]uint64{
+		"__udp4_lib_rcv|NO_SOCKET|/net/drops":    2,
+		"nf_hook_slow|NETFILTER_DROP|/net/drops": 1,
+		"tcp_v4_rcv|NOT_SPECIFIED|/net/drops":    1,
+	}
+	if got := childValues(o); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPacketDropStats(t *testing.T) {
+	o := NewOrigin()
+	err := RegisterPacketDropStats(o)
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.ENOENT) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c, err := DialNetlink(netlinkGeneric)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		family, err := c.genericFamily("NET_DM")
+		if err == nil {
+			// Stop the drop monitor, with NET_DM_CMD_STOP.
+			c.Execute(family, 0, appendGenlHeader(nil, 4, 2), func(netlinkMessage) error { return nil })
+		}
+	})
+	// A datagram to a port without a socket is dropped.
+	conn, err := net.Dial("udp", "127.0.0.1:9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("drop"))
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		o.Snapshot()
+		if len(o.Children()) > 0 {
+			return
+		}
+	}
+	t.Error("no drops reported")
+}
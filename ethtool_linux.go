@@ -0,0 +1,271 @@
+package observability
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	ethtoolStatDesc = DescribeMeter(
+		"/net/ethtool/stat",
+		"Counters kept by the driver and firmware of each network "+
+			"interface, as shown by ethtool -S, such as drops for lack of "+
+			"receive buffers or transmit timeouts, which /proc/net/dev "+
+			"doesn't count. The names of some common ones are normalized "+
+			"across drivers, and those of per-queue ones are labeled with "+
+			"the queue. Statistics that are levels are "+
+			"`/net/ethtool/level`.",
+		Cumulative())
+	ethtoolLevelDesc = DescribeMeter(
+		"/net/ethtool/level",
+		"Statistics of each network interface, as shown by ethtool -S, "+
+			"that are levels rather than counters, such as queue depths, "+
+			"buffers in use, and link states, which may go down. They are "+
+			"labeled as `/net/ethtool/stat`.")
+)
+
+const (
+	// siocEthtool is SIOCETHTOOL, the ioctl of all ethtool commands.
+	siocEthtool         = 0x8946
+	ethtoolGetDrvInfo   = 0x03
+	ethtoolGetStrings   = 0x1b
+	ethtoolGetStats     = 0x1d
+	ethtoolStatsStrings = 1 // ETH_SS_STATS
+	ethtoolStringLen    = 32
+)
+
+// ifreq is struct ifreq of linux/if.h, with the pointer member of its union.
+type ifreq struct {
+	name [16]byte
+	data uintptr
+	_    [16]byte
+}
+
+// ethtoolDrvInfo is struct ethtool_drvinfo of linux/ethtool.h.
+type ethtoolDrvInfo struct {
+	cmd         uint32
+	driver      [32]byte
+	version     [32]byte
+	fwVersion   [32]byte
+	busInfo     [32]byte
+	eromVersion [32]byte
+	reserved2   [12]byte
+	nPrivFlags  uint32
+	nStats      uint32
+	testinfoLen uint32
+	eedumpLen   uint32
+	regdumpLen  uint32
+}
+
+// ethtoolQueueStats match the names of the statistics of a single queue,
+// which drivers spell differently, such as rx_queue_0_drops (virtio_net,
+// ixgbe), rx-0.drops (i40e), queue_0_rx_drops (ena), and rx0_drops (mlx5).
+// Each has the direction, the queue, and the statistic as named groups.
+var ethtoolQueueStats = []*regexp.Regexp{
+	regexp.MustCompile(`^(?P<dir>rx|tx)_queue_(?P<queue>\d+)_(?P<stat>.+)$`),
+	regexp.MustCompile(`^(?P<dir>rx|tx)-(?P<queue>\d+)\.(?P<stat>.+)$`),
+	regexp.MustCompile(`^queue_(?P<queue>\d+)_(?P<dir>rx|tx)_(?P<stat>.+)$`),
+	regexp.MustCompile(`^(?P<dir>rx|tx)(?P<queue>\d+)_(?P<stat>.+)$`),
+}
+
+// ethtoolStatNames are the names by driver of the statistics that are
+// normalized, so that they can be compared across drivers.
+var ethtoolStatNames = map[string]map[string]string{
+	"ixgbe":     {"rx_missed_errors": "rx_missed", "tx_timeout_count": "tx_timeout"},
+	"igb":       {"rx_missed_errors": "rx_missed", "tx_timeout_count": "tx_timeout"},
+	"e1000e":    {"rx_missed_errors": "rx_missed", "tx_timeout_count": "tx_timeout"},
+	"i40e":      {"rx_missed_errors": "rx_missed"},
+	"ice":       {"rx_missed_errors": "rx_missed"},
+	"mlx5_core": {"rx_out_of_buffer": "rx_missed"},
+	"bnxt_en":   {"rx_total_discard_pkts": "rx_missed"},
+	"ena":       {"rx_drops": "rx_missed"},
+}
+
+// ethtoolLevelStat matches the normalized names of the statistics that are
+// levels, rather than counters, by the suffixes drivers give them, such as
+// tx_queue_depth, rx_bufs_inuse, and link_state.
+var ethtoolLevelStat = regexp.MustCompile(`(^|_)(state|link_up|carrier|level|depth|inuse|in_use|ring_size|avail|temp|temperature)$`)
+
+// ethtoolStatName returns the normalized name of the statistic of the driver,
+// and its queue, if any.
+func ethtoolStatName(driver, name string) (stat, queue string) {
+	for _, re := range ethtoolQueueStats {
+		m := re.FindStringSubmatch(name)
+		if m == nil {
+			continue
+		}
+		dir, stat := m[re.SubexpIndex("dir")], m[re.SubexpIndex("stat")]
+		// Some statistics repeat the direction, as in tx_queue_0_tx_timeouts.
+		if !strings.HasPrefix(stat, dir+"_") {
+			stat = dir + "_" + stat
+		}
+		return stat, m[re.SubexpIndex("queue")]
+	}
+	if n, ok := ethtoolStatNames[driver][name]; ok {
+		return n, ""
+	}
+	return name, ""
+}
+
+// ethtoolDevice is a network interface whose statistics are read with
+// ETHTOOL_GSTATS.
+type ethtoolDevice struct {
+	fd   int
+	name [16]byte
+	info ethtoolDrvInfo
+	// stats is struct ethtool_stats: the command and number of statistics
+	// in the first element, followed by the statistics.
+	stats []uint64
+	// meters holds the meter of each statistic, or nil for those filtered
+	// out.
+	meters []Meter
+}
+
+// ioctl runs an ethtool command on the interface, whose struct is at data.
+func (d *ethtoolDevice) ioctl(data unsafe.Pointer) error {
+	ifr := ifreq{name: d.name, data: uintptr(data)}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(d.fd), siocEthtool, uintptr(unsafe.Pointer(&ifr)))
+	runtime.KeepAlive(data)
+	if errno != 0 {
+		return os.NewSyscallError("ioctl", errno)
+	}
+	return nil
+}
+
+// driverInfo reads the driver information of the interface, which includes
+// its number of statistics.
+func (d *ethtoolDevice) driverInfo() error {
+	d.info = ethtoolDrvInfo{cmd: ethtoolGetDrvInfo}
+	return d.ioctl(unsafe.Pointer(&d.info))
+}
+
+// statNames reads the names of the n statistics of the interface.
+func (d *ethtoolDevice) statNames(n int) ([]string, error) {
+	// The buffer is struct ethtool_gstrings: the command, the string set,
+	// and the number of strings, followed by the strings.
+	buf := make([]uint32, 3+n*ethtoolStringLen/4)
+	buf[0], buf[1], buf[2] = ethtoolGetStrings, ethtoolStatsStrings, uint32(n)
+	if err := d.ioctl(unsafe.Pointer(&buf[0])); err != nil {
+		return nil, err
+	}
+	b := unsafe.Slice((*byte)(unsafe.Pointer(&buf[3])), n*ethtoolStringLen)
+	names := make([]string, n)
+	for i := range names {
+		s := b[i*ethtoolStringLen : (i+1)*ethtoolStringLen]
+		if j := bytes.IndexByte(s, 0); j >= 0 {
+			s = s[:j]
+		}
+		names[i] = string(s)
+	}
+	return names, nil
+}
+
+var errEthtoolStatsChanged = errors.New("observability: number of ethtool statistics changed")
+
+// readStats reads the statistics of the interface. The kernel writes as many
+// as the driver has, so their number is checked first, in case the driver
+// has been reloaded with more.
+func (d *ethtoolDevice) readStats() error {
+	if err := d.driverInfo(); err != nil {
+		return err
+	}
+	if int(d.info.nStats) != len(d.stats)-1 {
+		return errEthtoolStatsChanged
+	}
+	header := (*[2]uint32)(unsafe.Pointer(&d.stats[0]))
+	header[0], header[1] = ethtoolGetStats, d.info.nStats
+	return d.ioctl(unsafe.Pointer(&d.stats[0]))
+}
+
+// RegisterEthtoolStats registers meters of the statistics kept by the drivers
+// of the network interfaces with o, read with the ETHTOOL_GSTATS ioctl, as
+// ethtool -S shows them. The interfaces are those in /sys/class/net at
+// registration whose drivers have statistics, and the statistics are those of
+// their drivers at registration, such as rx_missed and per-queue drops,
+// accepted by the filter, which is given the name of the interface and the
+// normalized name of the statistic. If it is nil, all are accepted, which may
+// be thousands for some drivers. The meters are labeled with the interface,
+// driver, statistic, and queue, for per-queue statistics. A socket stays open
+// for the life of the Origin.
+func RegisterEthtoolStats(o *Origin, filter func(iface, stat string) bool) error {
+	return registerEthtoolStats(o, "/sys/class/net", filter)
+}
+
+func registerEthtoolStats(o *Origin, dir string, filter func(iface, stat string) bool) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*", "operstate"))
+	if err != nil {
+		return err
+	}
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return os.NewSyscallError("socket", err)
+	}
+	registered := false
+	for _, path := range paths {
+		iface := filepath.Base(filepath.Dir(path))
+		d := &ethtoolDevice{fd: fd}
+		copy(d.name[:len(d.name)-1], iface)
+		// Interfaces without a driver, such as lo, whose driver has no
+		// statistics, or that go away while they are named, are
+		// skipped rather than failing, since those already registered
+		// share fd.
+		if d.driverInfo() != nil || d.info.nStats == 0 {
+			continue
+		}
+		names, err := d.statNames(int(d.info.nStats))
+		if err != nil {
+			continue
+		}
+		driver := string(bytes.TrimRight(d.info.driver[:], "\x00"))
+		d.stats = make([]uint64, 1+len(names))
+		d.meters = make([]Meter, len(names))
+		var ms []Meter
+		for i, name := range names {
+			stat, queue := ethtoolStatName(driver, name)
+			if filter != nil && !filter(iface, stat) {
+				continue
+			}
+			labels := []Label{
+				{Key: "iface", Value: iface},
+				{Key: "driver", Value: driver},
+				{Key: "stat", Value: stat},
+			}
+			if queue != "" {
+				labels = append(labels, Label{Key: "queue", Value: queue})
+			}
+			if ethtoolLevelStat.MatchString(stat) {
+				d.meters[i] = DefineGauge(ethtoolLevelDesc, labels...)
+			} else {
+				d.meters[i] = DefineCounter(ethtoolStatDesc, labels...)
+			}
+			ms = append(ms, d.meters[i])
+		}
+		if len(ms) == 0 {
+			continue
+		}
+		registered = true
+		o.RegisterFunction(func() {
+			if d.readStats() != nil {
+				return
+			}
+			now := time.Now()
+			for i, m := range d.meters {
+				if m != nil {
+					m.SampleAt(now, d.stats[1+i])
+				}
+			}
+		}, ms...)
+	}
+	if !registered {
+		syscall.Close(fd)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package observability
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestEthtoolStatName(t *testing.T) {
+	if size := unsafe.Sizeof(ethtoolDrvInfo{}); size != 196 {
+		t.Errorf("ethtoolDrvInfo is %d bytes", size)
+	}
+	if size := unsafe.Sizeof(ifreq{}); size != 40 {
+		t.Errorf("ifreq is %d bytes", size)
+	}
+	for _, tc := range []struct {
+		driver, name, stat, queue string
+	}{
+		{"virtio_net", "rx_queue_3_drops", "rx_drops", "3"},
+		{"virtio_net", "tx_queue_0_tx_timeouts", "tx_timeouts", "0"},
+		{"i40e", "tx-12.packets", "tx_packets", "12"},
+		{"ena", "queue_0_rx_bad_csum", "rx_bad_csum", "0"},
+		{"mlx5_core", "rx0_packets", "rx_packets", "0"},
+		{"mlx5_core", "rx_out_of_buffer", "rx_missed", ""},
+		{"ixgbe", "tx_timeout_count", "tx_timeout", ""},
+		{"ixgbe", "rx_missed_errors", "rx_missed", ""},
+		{"e1000", "rx_missed_errors", "rx_missed_errors", ""},
+	} {
+		if stat, queue := ethtoolStatName(tc.driver, tc.name); stat != tc.stat || queue != tc.queue {
+			t.Errorf("ethtoolStatName(%q, %q) = %q, %q, want %q, %q", tc.driver, tc.name, stat, queue, tc.stat, tc.queue)
+		}
+	}
+	for stat, want := range map[string]bool{
+		"tx_queue_depth":    true,
+		"rx_bufs_inuse":     true,
+		"link_state":        true,
+		"rx_drops":          false,
+		"tx_timeout":        false,
+		"rx_missed":         false,
+		"link_state_change": false,
+	} {
+		if got := ethtoolLevelStat.MatchString(stat); got != want {
+			t.Errorf("ethtoolLevelStat.MatchString(%q) = %v, want %v", stat, got, want)
+		}
+	}
+}
+
+func TestEthtoolStats(t *testing.T) {
+	o := NewOrigin()
+	if err := RegisterEthtoolStats(o, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Whatever the interfaces, every meter is sampled.
+	for _, s := range o.Snapshot().Samples {
+		if s.Time.IsZero() {
+			t.Errorf("%s%v not sampled", s.Description.Name(), s.Labels)
+		}
+	}
+}
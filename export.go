@@ -0,0 +1,257 @@
+package observability
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ExportOption is used to configure an exporter during instantiation. Not
+// every option is meaningful to every exporter; exporters ignore options that
+// don't apply to them.
+type ExportOption interface {
+	apply(exportConfig) exportConfig
+}
+
+type exportFunctor func(exportConfig) exportConfig
+
+func (f exportFunctor) apply(c exportConfig) exportConfig {
+	return f(c)
+}
+
+// exportConfig holds the settings shared by all exporters.
+type exportConfig struct {
+	// interval is the period between pushes, for exporters that push.
+	interval time.Duration
+	// timeout bounds each push.
+	timeout time.Duration
+	// errorf is called with errors that occur in the background, where
+	// there is no caller to return them to.
+	errorf func(error)
+	// otlpJSON selects the JSON encoding for OTLP/HTTP.
+	otlpJSON bool
+	// maxPacket is the largest datagram a packet-oriented exporter may
+	// send, or zero for the exporter's default.
+	maxPacket int
+	// comma is the field separator for the CSV exporter.
+	comma rune
+	// allow and deny select the meters to export by name.
+	allow nameFilter
+	deny  nameFilter
+	// temporality is how cumulative meters are reported. deltas holds
+	// the previous values when it is DeltaTemporality.
+	temporality Temporality
+	deltas      *deltaTracker
+	// chunk is the maximum number of samples serialized at once.
+	chunk int
+	// community is the SNMP community string.
+	community string
+	// originKey is the identity label whose value selects an Origin by
+	// path, if the scrape handlers serve them separately.
+	originKey string
+	// maxScrapes limits the concurrent requests to a scrape handler, if
+	// positive. scrapeOrigin is where the handler registers its meters.
+	maxScrapes   int
+	scrapeOrigin *Origin
+	// syslogApp is the application name of syslog records, if the log
+	// exporter writes them.
+	syslogApp string
+}
+
+func newExportConfig(opts []ExportOption) exportConfig {
+	c := exportConfig{
+		interval:  time.Minute,
+		timeout:   10 * time.Second,
+		comma:     ',',
+		chunk:     1000,
+		community: "public",
+		errorf: func(err error) {
+			log.Printf("observability: export failed: %v", err)
+		},
+	}
+	for _, opt := range opts {
+		c = opt.apply(c)
+	}
+	if c.temporality == DeltaTemporality {
+		c.deltas = new(deltaTracker)
+	}
+	return c
+}
+
+// ExportInterval returns an ExportOption that sets the period between pushes.
+// The default is one minute.
+func ExportInterval(d time.Duration) ExportOption {
+	return exportFunctor(func(c exportConfig) exportConfig {
+		c.interval = d
+		return c
+	})
+}
+
+// ExportTimeout returns an ExportOption that bounds the time spent on a single
+// push, or on serving a single scrape. The default is ten seconds.
+func ExportTimeout(d time.Duration) ExportOption {
+	return exportFunctor(func(c exportConfig) exportConfig {
+		c.timeout = d
+		return c
+	})
+}
+
+// ExportErrors returns an ExportOption that sets the function called with
+// errors from pushes made in the background. By default such errors are
+// logged with the standard logger.
+func ExportErrors(f func(error)) ExportOption {
+	return exportFunctor(func(c exportConfig) exportConfig {
+		c.errorf = f
+		return c
+	})
+}
+
+// OTLPJSON returns an ExportOption that makes an OTLP/HTTP exporter send JSON
+// instead of protobuf. It is larger and slower, but some proxies and receivers
+// only accept JSON.
+func OTLPJSON() ExportOption {
+	return exportFunctor(func(c exportConfig) exportConfig {
+		c.otlpJSON = true
+		return c
+	})
+}
+
+// ExportMaxPacket returns an ExportOption that sets the largest datagram that
+// a packet-oriented exporter such as DogStatsD may send. Samples are batched
+// into datagrams up to this size. It should not exceed the path MTU for UDP.
+func ExportMaxPacket(n int) ExportOption {
+	return exportFunctor(func(c exportConfig) exportConfig {
+		c.maxPacket = n
+		return c
+	})
+}
+
+// ExportTSV returns an ExportOption that makes the CSV exporter separate
+// fields with tabs instead of commas.
+func ExportTSV() ExportOption {
+	return exportFunctor(func(c exportConfig) exportConfig {
+		c.comma = '\t'
+		return c
+	})
+}
+
+// ExportChunkSize returns an ExportOption that sets the maximum number of
+// samples an exporter serializes at once, which bounds its memory use however
+// many meters there are. Push exporters send each chunk as a separate message.
+// The default is 1000.
+func ExportChunkSize(n int) ExportOption {
+	return exportFunctor(func(c exportConfig) exportConfig {
+		c.chunk = n
+		return c
+	})
+}
+
+// ExportPerOrigin returns an ExportOption that makes a scrape handler, such as
+// PrometheusHandler or JSONHandler, serve each Origin at its own path rather
+// than all of them merged. The last element of the request path selects the
+// Origins whose identity label with the given key has that value, so with the
+// handler at /metrics/ and the key "instance", /metrics/cache1 serves the
+// Origin with the label instance=cache1. The handler answers a request for the
+// bare prefix with a list of the values, one per line, and any other request
+// with 404. This suits processes that export many similar Origins, such as one
+// per memcached server, to a scraper that wants a target per Origin.
+func ExportPerOrigin(key string) ExportOption {
+	return exportFunctor(func(c exportConfig) exportConfig {
+		c.originKey = key
+		return c
+	})
+}
+
+// selectOrigins returns the origins a scrape handler should serve for the
+// request. If it returns false, it has answered the request itself.
+func (c *exportConfig) selectOrigins(origins []*Origin, w http.ResponseWriter, r *http.Request) ([]*Origin, bool) {
+	if c.originKey == "" {
+		return origins, true
+	}
+	want := r.URL.Path[strings.LastIndexByte(r.URL.Path, '/')+1:]
+	var selected []*Origin
+	var index []byte
+	for _, o := range origins {
+		for _, l := range o.Identity() {
+			if l.Key != c.originKey {
+				continue
+			}
+			if want == "" {
+				index = append(index, url.PathEscape(l.Value)...)
+				index = append(index, '\n')
+			} else if l.Value == want {
+				selected = append(selected, o)
+			}
+		}
+	}
+	switch {
+	case want == "":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(index)
+		return nil, false
+	case len(selected) == 0:
+		http.NotFound(w, r)
+		return nil, false
+	}
+	return selected, true
+}
+
+// withChildren returns the origins, each followed by its children and theirs,
+// depth first.
+func withChildren(origins []*Origin) []*Origin {
+	var all []*Origin
+	for _, o := range origins {
+		all = append(all, o)
+		all = append(all, withChildren(o.Children())...)
+	}
+	return all
+}
+
+// collect passes the samples of each of the given origins and their children
+// to f, in chunks of at most the configured size, along with the index of the
+// Origin. The chunks exclude the meters that the exporter is configured not to
+// export, and have cumulative meters converted to the exporter's temporality.
+// f is called at least once for each Origin, in order.
+func (c *exportConfig) collect(origins []*Origin, f func(int, Snapshot) error) error {
+	if c.deltas != nil {
+		c.deltas.begin()
+		defer c.deltas.end()
+	}
+	for i, o := range withChildren(origins) {
+		err := o.Collect(c.chunk, func(snap Snapshot) error {
+			snap = c.filter(snap)
+			if c.deltas != nil {
+				snap = c.deltas.convert(snap)
+			}
+			return f(i, snap)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPeriodically calls push every interval until the context is done. Each
+// call gets a context bounded by the timeout. Errors go to errorf, and do not
+// stop the loop.
+func runPeriodically(ctx context.Context, c exportConfig, push func(context.Context) error) error {
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		pctx, cancel := context.WithTimeout(ctx, c.timeout)
+		err := push(pctx)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			c.errorf(err)
+		}
+	}
+}
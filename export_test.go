@@ -0,0 +1,575 @@
+package observability
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONHandler(t *testing.T) {
+	h := NewJSONHandler([]*Origin{newTestOrigin()})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metricsz", nil))
+	var got struct {
+		Origins []struct {
+			Identity map[string]string
+			Meters   []jsonMeter
+		}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Origins) != 1 || got.Origins[0].Identity["host.name"] != "alice" {
+		t.Fatalf("got origins %+v", got.Origins)
+	}
+	m := got.Origins[0].Meters
+	if len(m) != 1 || m[0].Name != "/test/reads" || !m[0].Cumulative || m[0].Value != 42 || m[0].Sampled == nil {
+		t.Errorf("got meters %+v", m)
+	}
+}
+
+func TestDescribeHandler(t *testing.T) {
+	h := NewDescribeHandler([]*Origin{newTestOrigin(), newTestOrigin()})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/describe", nil))
+	var got struct{ Meters []jsonDescription }
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Meters) != 1 || got.Meters[0].Name != "/test/reads" || len(got.Meters[0].DescribedAt) != 1 ||
+		!strings.HasSuffix(got.Meters[0].DescribedAt[0], "otlp_test.go:15") {
+		t.Errorf("got meters %+v", got.Meters)
+	}
+}
+
+func TestCSVExporter(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewCSVExporter(&buf, []*Origin{newTestOrigin()}, ExportTSV())
+	if err := e.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	f := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\t")
+	if len(f) != 4 || f[1] != "host.name=alice" || f[2] != "/test/reads" || f[3] != "42" {
+		t.Errorf("got fields %q", f)
+	}
+}
+
+func TestLogExporter(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewLogExporter(&buf, []*Origin{newTestOrigin()}, ExportSyslog("agent"))
+	if err := e.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	line := buf.String()
+	prefix := "<14>1 "
+	if !strings.HasPrefix(line, prefix) || !strings.Contains(line, " alice agent ") {
+		t.Fatalf("got %q", line)
+	}
+	var got logLine
+	if err := json.Unmarshal([]byte(line[strings.Index(line, "{"):]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "/test/reads" || got.Value != 42 || got.Origin["host.name"] != "alice" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestSnapshotWriterReader(t *testing.T) {
+	o := newTestOrigin()
+	g := DefineGauge(DescribeMeter("/test/temp", "Temp.", Units("Cel")), Label{Key: "zone", Value: "a"})
+	o.RegisterFunction(func() {}, g)
+	want := o.Snapshot()
+
+	var buf bytes.Buffer
+	w := NewSnapshotWriter(&buf)
+	for i := 0; i < 2; i++ {
+		if err := w.Write(want); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := NewSnapshotReader(&buf)
+	for i := 0; i < 2; i++ {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got.Origin, want.Origin) || len(got.Samples) != len(want.Samples) {
+			t.Fatalf("got %+v, want %+v", got, want)
+		}
+		for j, s := range got.Samples {
+			w := want.Samples[j]
+			if s.Description.Name() != w.Description.Name() ||
+				s.Description.Units() != w.Description.Units() ||
+				s.Description.Cumulative() != w.Description.Cumulative() ||
+				!reflect.DeepEqual(s.Labels, w.Labels) ||
+				!s.Time.Equal(w.Time) || !s.Reset.Equal(w.Reset) || s.Value != w.Value {
+				t.Errorf("sample %d: got %+v, want %+v", j, s, w)
+			}
+			gf, wf := s.Description.Frames(), w.Description.Frames()
+			if len(gf) != 1 || gf[0].Function != wf[0].Function || gf[0].Line != wf[0].Line {
+				t.Errorf("sample %d: got frames %+v, want %+v", j, gf, wf)
+			}
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("Read() at end = %v, want EOF", err)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.sock")
+	// A stale socket from a previous run is replaced.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := ListenUnix(path, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("Stat(%q) = %v, %v; want mode 0600", path, fi, err)
+	}
+	go http.Serve(l, NewJSONHandler([]*Origin{newTestOrigin()}))
+	c := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := c.Get("http://agent/metricsz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %s", resp.Status)
+	}
+	l.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket remains after Close: %v", err)
+	}
+
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ListenUnix(path, 0600); err == nil {
+		t.Error("ListenUnix replaced a regular file")
+	}
+}
+
+func TestExportFilter(t *testing.T) {
+	c := newExportConfig([]ExportOption{
+		ExportAllow("/xfs/", "/disk/*/reads", "/load"),
+		ExportDeny("/xfs/dir/", "/disk/sdb/reads"),
+	})
+	for name, want := range map[string]bool{
+		"/xfs/reads":         true,
+		"/xfs/extent/blocks": true,
+		"/xfs/dir/created":   false,
+		"/disk/sda/reads":    true,
+		"/disk/sdb/reads":    false,
+		"/disk/sda/io/reads": false,
+		"/load":              true,
+		"/loadavg":           false,
+		"/vm/pgfault":        false,
+	} {
+		if got := c.exports(name); got != want {
+			t.Errorf("exports(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	o := newTestOrigin()
+	g := DefineGauge(DescribeMeter("/test/temp", "Temp\n\"C\"."), Label{Key: "zone.id", Value: `a"b`})
+	o.RegisterFunction(func() { g.SampleAt(time.Now(), 7) }, g)
+	h := NewPrometheusHandler([]*Origin{o})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	want := `# HELP test_reads_total Reads.
+# TYPE test_reads_total counter
+test_reads_total{host_name="alice"} 42
+# HELP test_temp Temp\n"C".
+# TYPE test_temp gauge
+test_temp{host_name="alice",zone_id="a\"b"} 7
+`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept-Encoding", "br;q=1.0, gzip;q=0.5")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if ce := rec.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", ce)
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(zr); string(got) != want {
+		t.Errorf("got gzipped:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestExportPerOrigin(t *testing.T) {
+	bob := NewOrigin(Label{"host.name", "bob"})
+	h := NewPrometheusHandler([]*Origin{newTestOrigin(), bob}, ExportPerOrigin("host.name"))
+	for _, tc := range []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/metrics/", 200, "alice\nbob\n"},
+		{"/metrics/alice", 200, `test_reads_total{host_name="alice"} 42`},
+		{"/metrics/bob", 200, ""},
+		{"/metrics/carol", 404, "not found"},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", tc.path, nil))
+		if rec.Code != tc.code || !strings.Contains(rec.Body.String(), tc.body) {
+			t.Errorf("%s got %d %q", tc.path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestScrapeLimits(t *testing.T) {
+	o := newTestOrigin()
+	h := NewPrometheusHandler([]*Origin{o}, ExportMaxScrapes(1), ExportScrapeMeters(o))
+	_, finish, ok := h.limit.begin(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+	if !ok {
+		t.Fatal("first scrape rejected")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("second scrape got %d, want 503", rec.Code)
+	}
+	finish()
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`observability_scrapes_in_flight{host_name="alice",handler="prometheus"} 1`,
+		`observability_scrapes_rejected_total{host_name="alice",handler="prometheus"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("scrape lacks %s:\n%s", want, rec.Body.String())
+		}
+	}
+
+	h = NewPrometheusHandler([]*Origin{o}, ExportTimeout(-time.Second))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Body.Len() != 0 {
+		t.Errorf("expired scrape got %q", rec.Body.String())
+	}
+}
+
+func TestAcceptedQuality(t *testing.T) {
+	for _, tc := range []struct {
+		accept string
+		want   float64
+	}{
+		{"gzip", 1},
+		{"deflate, gzip;q=0.8", 0.8},
+		{"GZIP", 1},
+		{"gzip;q=0", 0},
+		{"*;q=0.3", 0.3},
+		{"identity", 0},
+	} {
+		if got := acceptedQuality(tc.accept, "gzip"); got != tc.want {
+			t.Errorf("acceptedQuality(%q) = %v, want %v", tc.accept, got, tc.want)
+		}
+	}
+}
+
+func TestDeltaTemporality(t *testing.T) {
+	o := NewOrigin()
+	c := DefineCounter(DescribeMeter("/test/ops", "Ops.", Cumulative()))
+	values := []uint64{10, 15, 15, 3}
+	i := 0
+	o.RegisterFunction(func() {
+		c.SampleAt(time.Now(), values[i])
+		i++
+	}, c)
+	cfg := newExportConfig([]ExportOption{ExportTemporality(DeltaTemporality)})
+	var got []uint64
+	for range values {
+		cfg.collect([]*Origin{o}, func(_ int, snap Snapshot) error {
+			for _, s := range snap.Samples {
+				got = append(got, s.Value)
+			}
+			return nil
+		})
+	}
+	// The first snapshot is the baseline, and the counter wraps before
+	// the last, so its delta is its whole value since the reset.
+	if want := []uint64{5, 0, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got deltas %v, want %v", got, want)
+	}
+}
+
+func TestCollectChunks(t *testing.T) {
+	o := NewOrigin()
+	var ms []Meter
+	for i := 0; i < 10; i++ {
+		ms = append(ms, DefineGauge(DescribeMeter("/test/g", "G."), Label{Key: "i", Value: strconv.Itoa(i)}))
+	}
+	o.RegisterFunction(func() {
+		for i, m := range ms {
+			m.SampleAt(time.Now(), uint64(i))
+		}
+	}, ms...)
+	var sizes []int
+	var sum uint64
+	cfg := newExportConfig([]ExportOption{ExportChunkSize(4)})
+	err := cfg.collect([]*Origin{o}, func(_ int, snap Snapshot) error {
+		sizes = append(sizes, len(snap.Samples))
+		for _, s := range snap.Samples {
+			sum += s.Value
+		}
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(sizes, []int{4, 4, 2}) || sum != 45 {
+		t.Errorf("got chunks %v summing to %d, err %v; want [4 4 2] summing to 45", sizes, sum, err)
+	}
+	// The chunks are passed with o unlocked, so a slow exporter doesn't
+	// hold up the others.
+	err = o.Collect(4, func(Snapshot) error {
+		o.Snapshot()
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSNMPAgent(t *testing.T) {
+	a, err := NewSNMPAgent("1.3.6.1.4.1.32473", []*Origin{newTestOrigin()}, SNMPCommunity("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(pdu byte, community string, oid []uint32) []byte {
+		return appendBER(nil, berSequence, func(b []byte) []byte {
+			b = appendBERInt(b, berInteger, snmpVersion2c)
+			b = appendBERString(b, berOctetString, community)
+			return appendBER(b, pdu, func(b []byte) []byte {
+				b = appendBERInt(b, berInteger, 7)
+				b = appendBERInt(b, berInteger, 0)
+				b = appendBERInt(b, berInteger, 0)
+				return appendBER(b, berSequence, func(b []byte) []byte {
+					return appendBER(b, berSequence, func(b []byte) []byte {
+						return append(appendBEROID(b, oid), berNull, 0)
+					})
+				})
+			})
+		})
+	}
+	// varbind digs the first variable binding out of a response.
+	varbind := func(resp []byte) ([]uint32, byte, []byte) {
+		_, msg, _, _ := nextBER(resp)
+		_, _, msg, _ = nextBER(msg)
+		_, _, msg, _ = nextBER(msg)
+		_, pdu, _, _ := nextBER(msg)
+		for range 3 {
+			_, _, pdu, _ = nextBER(pdu)
+		}
+		_, list, _, _ := nextBER(pdu)
+		_, vb, _, _ := nextBER(list)
+		_, body, vb, _ := nextBER(vb)
+		oid, err := parseBEROID(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tag, val, _, _ := nextBER(vb)
+		return oid, tag, val
+	}
+
+	if resp := a.respond(request(snmpGetNextRequest, "public", []uint32{1, 3})); resp != nil {
+		t.Errorf("responded to the wrong community")
+	}
+	oid := []uint32{1, 3, 6, 1, 4, 1, 32473}
+	var values []string
+	for {
+		var tag byte
+		var val []byte
+		oid, tag, val = varbind(a.respond(request(snmpGetNextRequest, "secret", oid)))
+		if tag == snmpEndOfMibView {
+			break
+		}
+		if tag == berCounter64 || tag == berInteger {
+			v, _ := parseBERInt(append([]byte{0}, val...))
+			values = append(values, strconv.FormatInt(v, 10))
+		} else {
+			values = append(values, string(val))
+		}
+	}
+	want := []string{"/test/reads", "host.name=alice", "", "Reads.", "", "2", "42"}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("walk got %q, want %q", values, want)
+	}
+	_, tag, _ := varbind(a.respond(request(snmpGetRequest, "secret", []uint32{1, 3, 6, 1, 4, 1, 32473, 1, 1, 7, 1, 65})))
+	if tag != snmpNoSuchInstance {
+		t.Errorf("get of missing row got tag %#x, want noSuchInstance", tag)
+	}
+}
+
+func TestZabbixExporter(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	got := make(chan zabbixRequest, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var header [13]byte
+		io.ReadFull(conn, header[:])
+		body := make([]byte, binary.LittleEndian.Uint64(header[5:]))
+		io.ReadFull(conn, body)
+		var req zabbixRequest
+		json.Unmarshal(body, &req)
+		got <- req
+		resp := []byte(`{"response":"success","info":"processed: 0; failed: 1; total: 1; seconds spent: 0.000055"}`)
+		conn.Write(binary.LittleEndian.AppendUint64([]byte(zabbixMagic), uint64(len(resp))))
+		conn.Write(resp)
+	}()
+	e := NewZabbixExporter(l.Addr().String(), []*Origin{newTestOrigin()})
+	if err := e.Push(context.Background()); err == nil || !strings.Contains(err.Error(), "rejected 1 of 1") {
+		t.Errorf("Push returned %v, want rejection", err)
+	}
+	req := <-got
+	if len(req.Data) != 1 || req.Data[0].Host != "alice" || req.Data[0].Key != "test.reads" || req.Data[0].Value != "42" {
+		t.Errorf("got request %+v", req)
+	}
+	if k := zabbixKey("/disk/reads", []Label{{"device", "sda"}, {"mode", "a b"}}); k != `disk.reads[sda,"a b"]` {
+		t.Errorf("zabbixKey got %s", k)
+	}
+}
+
+// recordingExporter is an Exporter that records the names it is passed.
+type recordingExporter struct {
+	names  []string
+	closed bool
+}
+
+func (e *recordingExporter) Export(snap Snapshot) error {
+	for _, s := range snap.Samples {
+		e.names = append(e.names, s.Description.Name())
+	}
+	return nil
+}
+
+func (e *recordingExporter) Close() error {
+	e.closed = true
+	return nil
+}
+
+func TestScheduler(t *testing.T) {
+	s := NewScheduler([]*Origin{newTestOrigin()}, ExportInterval(time.Millisecond))
+	e := &recordingExporter{}
+	s.AddExporter(e)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Run returned %v", err)
+	}
+	if len(e.names) == 0 || e.names[0] != "/test/reads" || !e.closed {
+		t.Errorf("exporter got %q, closed %v", e.names, e.closed)
+	}
+}
+
+// sliceExporter is an Exporter whose type isn't comparable.
+type sliceExporter struct {
+	names []string
+}
+
+func (e sliceExporter) Export(Snapshot) error {
+	return nil
+}
+
+func TestSchedulerRemoveExporter(t *testing.T) {
+	s := NewScheduler([]*Origin{newTestOrigin()})
+	e := &recordingExporter{}
+	s.AddExporter(sliceExporter{names: []string{"a"}})
+	s.AddExporter(e)
+	// The exporter that isn't comparable is skipped without panicking.
+	if err := s.RemoveExporter(sliceExporter{names: []string{"a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveExporter(e); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.exporters) != 1 || !e.closed {
+		t.Errorf("got %d exporters, closed %v; want 1, closed", len(s.exporters), e.closed)
+	}
+}
+
+func TestRegisterSysfsMeter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "temp1_input")
+	if err := os.WriteFile(path, []byte("41500\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	o := NewOrigin()
+	m := DefineGauge(DescribeMeter("/test/temperature", "Temperature.", Units("m[degC]")))
+	if err := RegisterSysfsMeter(o, path, m); err != nil {
+		t.Fatal(err)
+	}
+	if s := o.Snapshot().Samples; len(s) != 1 || s[0].Value != 41500 {
+		t.Errorf("got %+v, want 41500", s)
+	}
+	// The file is reread in place.
+	os.WriteFile(path, []byte("42000\n"), 0644)
+	if s := o.Snapshot().Samples; len(s) != 1 || s[0].Value != 42000 {
+		t.Errorf("got %+v, want 42000", s)
+	}
+}
+
+func TestOriginChildren(t *testing.T) {
+	parent := newTestOrigin()
+	child := parent.NewChild(Label{Key: "pid", Value: "1"})
+	grandchild := child.NewChild(Label{Key: "tid", Value: "2"})
+	other := parent.NewChild(Label{Key: "pid", Value: "3"})
+	parent.RemoveChild(other)
+	var got [][]Label
+	cfg := newExportConfig(nil)
+	cfg.collect([]*Origin{parent}, func(_ int, snap Snapshot) error {
+		got = append(got, snap.Origin)
+		return nil
+	})
+	want := [][]Label{parent.Identity(), child.Identity(), grandchild.Identity()}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got origins %v, want %v", got, want)
+	}
+	if id := grandchild.Identity(); len(id) != 3 || id[0].Value != "alice" || id[2].Key != "tid" {
+		t.Errorf("got identity %v", id)
+	}
+	// A registered function may add children while o is collected.
+	parent.RegisterFunction(func() { parent.NewChild(Label{Key: "pid", Value: "4"}) })
+	if parent.Snapshot(); len(parent.Children()) != 2 {
+		t.Errorf("got %d children, want 2", len(parent.Children()))
+	}
+}
@@ -0,0 +1,57 @@
+package observability
+
+import (
+	"io"
+	"os"
+)
+
+// Scanner is implemented by the scanners that parse a whole input at once,
+// such as BufferScanner and KeyValueScanner.
+type Scanner interface {
+	Scan(b []byte)
+}
+
+// FileScanner reads a file, typically in /proc, and scans it with a Scanner.
+// The file is opened once, and each scan rereads it from the beginning with
+// pread(2) into a buffer that is kept between scans, which avoids the open and
+// close system calls and the path lookup when collecting every second.
+type FileScanner struct {
+	f   *os.File
+	s   Scanner
+	buf []byte
+}
+
+// NewFileScanner opens the file at path, to be scanned with s.
+func NewFileScanner(path string, s Scanner) (*FileScanner, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileScanner{f: f, s: s, buf: make([]byte, 4096)}, nil
+}
+
+// Scan rereads the file and scans it. The buffer grows to fit the file, since
+// files in /proc don't report their sizes.
+func (fs *FileScanner) Scan() error {
+	n := 0
+	for {
+		if n == len(fs.buf) {
+			fs.buf = append(fs.buf, make([]byte, len(fs.buf))...)
+		}
+		m, err := fs.f.ReadAt(fs.buf[n:], int64(n))
+		n += m
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	fs.s.Scan(fs.buf[:n])
+	return nil
+}
+
+// Close closes the file.
+func (fs *FileScanner) Close() error {
+	return fs.f.Close()
+}
@@ -0,0 +1,126 @@
+package observability
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+var (
+	filesystemSizeDesc = DescribeMeter(
+		"/filesystem/size",
+		"Size of each mounted filesystem.",
+		Units("By"))
+	filesystemFreeDesc = DescribeMeter(
+		"/filesystem/free",
+		"Free space in each mounted filesystem, including the space "+
+			"reserved for root.",
+		Units("By"))
+	filesystemAvailableDesc = DescribeMeter(
+		"/filesystem/available",
+		"Free space in each mounted filesystem that is available to "+
+			"unprivileged users.",
+		Units("By"))
+	filesystemInodesDesc = DescribeMeter(
+		"/filesystem/inodes",
+		"Number of inodes of each mounted filesystem. Filesystems that "+
+			"allocate inodes dynamically may report zero.")
+	filesystemInodesFreeDesc = DescribeMeter(
+		"/filesystem/inodes_free",
+		"Number of free inodes of each mounted filesystem.")
+)
+
+// pseudoFilesystems are the types of filesystems that don't store files, or
+// whose usage isn't meaningful, such as read-only images.
+var pseudoFilesystems = map[string]bool{
+	"autofs": true, "binfmt_misc": true, "bpf": true, "cgroup": true,
+	"cgroup2": true, "configfs": true, "debugfs": true, "devpts": true,
+	"devtmpfs": true, "fusectl": true, "hugetlbfs": true, "iso9660": true,
+	"mqueue": true, "nsfs": true, "overlay": true, "proc": true,
+	"pstore": true, "rpc_pipefs": true, "securityfs": true, "selinuxfs": true,
+	"squashfs": true, "sysfs": true, "tracefs": true,
+}
+
+// DefaultFilesystemFilter accepts the mounts of filesystems other than pseudo
+// filesystems such as proc and cgroup2, and read-only images such as squashfs.
+// tmpfs is accepted, since its usage is memory usage.
+func DefaultFilesystemFilter(mountpoint, fstype string) bool {
+	return !pseudoFilesystems[fstype]
+}
+
+// mountMeters are the meters of a mounted filesystem.
+type mountMeters struct {
+	mountpoint                       string
+	size, free, avail, inodes, ifree Meter
+}
+
+// RegisterFilesystemStats registers meters of the usage of the filesystems
+// mounted at the mountpoints accepted by the filter, or by
+// DefaultFilesystemFilter if it is nil, with o, sampled with statfs(2) and
+// labeled with the mountpoint, device, and filesystem type. The mounts are
+// those in /proc/mounts at registration; where filesystems are mounted over
+// one another, the last is sampled. A mountpoint that can't be statted, such
+// as that of an unreachable network filesystem, keeps its old samples, but may
+// delay collection.
+func RegisterFilesystemStats(o *Origin, filter func(mountpoint, fstype string) bool) error {
+	return registerFilesystemStats(o, "/proc/mounts", filter)
+}
+
+func registerFilesystemStats(o *Origin, path string, filter func(mountpoint, fstype string) bool) error {
+	if filter == nil {
+		filter = DefaultFilesystemFilter
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var mounts []*mountMeters
+	index := make(map[string]int)
+	rs := NewRowScanner(func(fields [][]byte) {
+		device, mountpoint, fstype := unescapeMount(fields[0]), unescapeMount(fields[1]), string(fields[2])
+		if !filter(mountpoint, fstype) {
+			return
+		}
+		labels := []Label{
+			{Key: "mountpoint", Value: mountpoint},
+			{Key: "device", Value: device},
+			{Key: "fstype", Value: fstype},
+		}
+		m := &mountMeters{
+			mountpoint: mountpoint,
+			size:       DefineGauge(filesystemSizeDesc, labels...),
+			free:       DefineGauge(filesystemFreeDesc, labels...),
+			avail:      DefineGauge(filesystemAvailableDesc, labels...),
+			inodes:     DefineGauge(filesystemInodesDesc, labels...),
+			ifree:      DefineGauge(filesystemInodesFreeDesc, labels...),
+		}
+		if i, ok := index[mountpoint]; ok {
+			mounts[i] = m
+			return
+		}
+		index[mountpoint] = len(mounts)
+		mounts = append(mounts, m)
+	}, minFields(3))
+	rs.Scan(b)
+
+	var ms []Meter
+	for _, m := range mounts {
+		ms = append(ms, m.size, m.free, m.avail, m.inodes, m.ifree)
+	}
+	var st syscall.Statfs_t
+	o.RegisterFunction(func() {
+		for _, m := range mounts {
+			if err := syscall.Statfs(m.mountpoint, &st); err != nil {
+				continue
+			}
+			now := time.Now()
+			bsize := uint64(st.Bsize)
+			m.size.SampleAt(now, st.Blocks*bsize)
+			m.free.SampleAt(now, st.Bfree*bsize)
+			m.avail.SampleAt(now, st.Bavail*bsize)
+			m.inodes.SampleAt(now, st.Files)
+			m.ifree.SampleAt(now, st.Ffree)
+		}
+	}, ms...)
+	return nil
+}
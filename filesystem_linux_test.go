@@ -0,0 +1,43 @@
+package observability
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestFilesystemStats(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mounts")
+	mounts := "proc /proc proc rw,relatime 0 0\n" +
+		"/dev/vda / ext4 rw,relatime 0 0\n" +
+		"tmpfs / tmpfs rw 0 0\n" +
+		"/dev/vdb " + dir + "/with\\040space ext4 ro 0 0\n"
+	if err := os.WriteFile(path, []byte(mounts), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "with space"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	o := NewOrigin()
+	if err := registerFilesystemStats(o, path, nil); err != nil {
+		t.Fatal(err)
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs("/", &st); err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	// The tmpfs mounted over / replaces the ext4 filesystem.
+	checkValues(t, got, map[string]uint64{
+		"/filesystem/size{mountpoint=/,device=tmpfs,fstype=tmpfs}": st.Blocks * uint64(st.Bsize),
+	})
+	key := "/filesystem/inodes{mountpoint=" + dir + "/with space,device=/dev/vdb,fstype=ext4}"
+	if _, ok := got[key]; !ok {
+		t.Errorf("no sample %s in %v", key, got)
+	}
+	if len(got) != 2*5 {
+		t.Errorf("got %d samples, want 10", len(got))
+	}
+}
@@ -0,0 +1,104 @@
+package observability
+
+import (
+	"path"
+	"strings"
+)
+
+// nameFilter decides which meters an exporter exports, by name. A pattern
+// ending in "/" matches every name beginning with it, so "/xfs/" matches
+// everything under /xfs. A pattern containing any of the characters *?[ is a
+// glob with the syntax of path.Match, in which * does not match "/". Any other
+// pattern matches exactly that name.
+type nameFilter struct {
+	exact    map[string]bool
+	prefixes []string
+	globs    []string
+}
+
+func (f *nameFilter) add(patterns []string) {
+	for _, p := range patterns {
+		switch {
+		case strings.HasSuffix(p, "/"):
+			f.prefixes = append(f.prefixes, p)
+		case strings.ContainsAny(p, "*?["):
+			if _, err := path.Match(p, ""); err != nil {
+				panic("observability: bad filter pattern " + p + ": " + err.Error())
+			}
+			f.globs = append(f.globs, p)
+		default:
+			if f.exact == nil {
+				f.exact = make(map[string]bool)
+			}
+			f.exact[p] = true
+		}
+	}
+}
+
+func (f *nameFilter) empty() bool {
+	return len(f.exact) == 0 && len(f.prefixes) == 0 && len(f.globs) == 0
+}
+
+func (f *nameFilter) match(name string) bool {
+	if f.exact[name] {
+		return true
+	}
+	for _, p := range f.prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	for _, g := range f.globs {
+		if ok, _ := path.Match(g, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ExportAllow returns an ExportOption that restricts an exporter to the meters
+// whose names match at least one of the patterns. See ExportDeny for the
+// pattern syntax. It panics if a glob pattern is malformed.
+func ExportAllow(patterns ...string) ExportOption {
+	return exportFunctor(func(c exportConfig) exportConfig {
+		c.allow.add(patterns)
+		return c
+	})
+}
+
+// ExportDeny returns an ExportOption that stops an exporter from exporting the
+// meters whose names match any of the patterns, even if they are allowed. A
+// pattern ending in "/" matches every name beginning with it, so "/xfs/"
+// drops everything under /xfs. A pattern containing any of the characters *?[
+// is a glob with the syntax of path.Match, in which * does not match "/". Any
+// other pattern matches exactly that name. It panics if a glob pattern is
+// malformed.
+func ExportDeny(patterns ...string) ExportOption {
+	return exportFunctor(func(c exportConfig) exportConfig {
+		c.deny.add(patterns)
+		return c
+	})
+}
+
+// exports reports whether the exporter should export the named meter.
+func (c *exportConfig) exports(name string) bool {
+	if !c.allow.empty() && !c.allow.match(name) {
+		return false
+	}
+	return !c.deny.match(name)
+}
+
+// filter removes the samples that the exporter shouldn't export, in place.
+func (c *exportConfig) filter(snap Snapshot) Snapshot {
+	if c.allow.empty() && c.deny.empty() {
+		return snap
+	}
+	kept := snap.Samples[:0]
+	for _, s := range snap.Samples {
+		if c.exports(s.Description.Name()) {
+			kept = append(kept, s)
+		}
+	}
+	snap.Samples = kept
+	return snap
+}
@@ -0,0 +1,138 @@
+package observability
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// GlobScanner reads every file matching a glob pattern, such as
+// /sys/class/hwmon/hwmon*/temp*_input, and calls a function with the contents
+// of each. The pattern is expanded on every scan, so files that appear, such
+// as hot-plugged devices, are picked up, and files that disappear are
+// dropped. Files stay open between scans, and are reread with pread(2) like
+// a SysfsValue.
+type GlobScanner struct {
+	pattern string
+	f       func(path string, captures []string, contents []byte)
+	files   map[string]*os.File
+	seen    map[string]bool
+	buf     []byte
+	caps    []string
+}
+
+// NewGlobScanner creates a GlobScanner for the pattern, which has the syntax
+// of filepath.Match, that calls f for each matching file. The captures are the
+// parts of the path matched by each * in the pattern, in order, so for the
+// pattern above and the file /sys/class/hwmon/hwmon2/temp1_input they are "2"
+// and "1". The contents have surrounding whitespace removed. The captures and
+// contents are overwritten by the next call.
+func NewGlobScanner(pattern string, f func(path string, captures []string, contents []byte)) *GlobScanner {
+	return &GlobScanner{
+		pattern: pattern,
+		f:       f,
+		files:   make(map[string]*os.File),
+		seen:    make(map[string]bool),
+		buf:     make([]byte, 4096),
+	}
+}
+
+// Scan expands the pattern, and reads every matching file. Files that can't be
+// read are skipped.
+func (gs *GlobScanner) Scan() error {
+	matches, err := filepath.Glob(gs.pattern)
+	if err != nil {
+		return err
+	}
+	clear(gs.seen)
+	for _, p := range matches {
+		f, ok := gs.files[p]
+		if !ok {
+			if f, err = os.Open(p); err != nil {
+				continue
+			}
+			gs.files[p] = f
+		}
+		n, err := f.ReadAt(gs.buf, 0)
+		if err != nil && err != io.EOF {
+			// The file may have been removed since the glob.
+			f.Close()
+			delete(gs.files, p)
+			continue
+		}
+		gs.seen[p] = true
+		gs.caps = globCaptures(gs.pattern, p, gs.caps[:0])
+		gs.f(p, gs.caps, bytes.TrimSpace(gs.buf[:n]))
+	}
+	for p, f := range gs.files {
+		if !gs.seen[p] {
+			f.Close()
+			delete(gs.files, p)
+		}
+	}
+	return nil
+}
+
+// Close closes the files that are open.
+func (gs *GlobScanner) Close() error {
+	for p, f := range gs.files {
+		f.Close()
+		delete(gs.files, p)
+	}
+	return nil
+}
+
+// globCaptures appends the parts of name matched by each * in pattern, which
+// name is known to match, to caps. Each element of the path is matched
+// separately, as * doesn't match separators.
+func globCaptures(pattern, name string, caps []string) []string {
+	for pattern != "" && name != "" {
+		var pe, ne string
+		pe, pattern, _ = strings.Cut(pattern, string(filepath.Separator))
+		ne, name, _ = strings.Cut(name, string(filepath.Separator))
+		caps, _ = matchCaptures(pe, ne, caps)
+	}
+	return caps
+}
+
+// matchCaptures matches a single path element against a pattern, preferring
+// the shortest match for each *, and appends the captures to caps.
+func matchCaptures(pattern, name string, caps []string) ([]string, bool) {
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			for i := 0; i <= len(name); i++ {
+				if c, ok := matchCaptures(pattern[1:], name[i:], append(caps, name[:i])); ok {
+					return c, true
+				}
+			}
+			return caps, false
+		case '[':
+			end := strings.IndexByte(pattern, ']')
+			if end < 0 || name == "" {
+				return caps, false
+			}
+			if ok, _ := path.Match(pattern[:end+1], name[:1]); !ok {
+				return caps, false
+			}
+			pattern, name = pattern[end+1:], name[1:]
+		case '?':
+			if name == "" {
+				return caps, false
+			}
+			pattern, name = pattern[1:], name[1:]
+		default:
+			if pattern[0] == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			if name == "" || name[0] != pattern[0] {
+				return caps, false
+			}
+			pattern, name = pattern[1:], name[1:]
+		}
+	}
+	return caps, name == ""
+}
@@ -0,0 +1,96 @@
+package observability
+
+import (
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+var goThreadsDesc = DescribeMeter(
+	"/go/threads",
+	"Number of OS threads created by the Go runtime of the process, which "+
+		"seldom ends them. Goroutines blocked in system calls or cgo each "+
+		"hold one.")
+
+// goMemStats are the fields of runtime.MemStats that are sampled, and the
+// descriptions of their meters, named after them.
+var goMemStats = []struct {
+	desc  MeterDescription
+	value func(*runtime.MemStats) uint64
+}{
+	{DescribeMeter(
+		"/go/memstats/heap_alloc",
+		"Bytes of allocated heap objects of the process, HeapAlloc, "+
+			"including unreachable ones not yet freed by the garbage "+
+			"collector.",
+		Units("By")),
+		func(s *runtime.MemStats) uint64 { return s.HeapAlloc }},
+	{DescribeMeter(
+		"/go/memstats/heap_inuse",
+		"Bytes of the heap spans of the process holding at least one "+
+			"object, HeapInuse. Less `/go/memstats/heap_alloc`, it is "+
+			"memory lost to fragmentation.",
+		Units("By")),
+		func(s *runtime.MemStats) uint64 { return s.HeapInuse }},
+	{DescribeMeter(
+		"/go/memstats/stack_inuse",
+		"Bytes of the stack spans of the process, StackInuse.",
+		Units("By")),
+		func(s *runtime.MemStats) uint64 { return s.StackInuse }},
+	{DescribeMeter(
+		"/go/memstats/sys",
+		"Bytes of memory obtained from the OS by the Go runtime of the "+
+			"process, Sys.",
+		Units("By")),
+		func(s *runtime.MemStats) uint64 { return s.Sys }},
+	{DescribeMeter(
+		"/go/memstats/next_gc",
+		"Size of the heap of the process at which the next garbage "+
+			"collection is to finish, NextGC.",
+		Units("By")),
+		func(s *runtime.MemStats) uint64 { return s.NextGC }},
+	{DescribeMeter(
+		"/go/memstats/num_gc",
+		"Number of completed garbage collections of the process, NumGC.",
+		Cumulative()),
+		func(s *runtime.MemStats) uint64 { return uint64(s.NumGC) }},
+	{DescribeMeter(
+		"/go/memstats/pause_total",
+		"Time the process spent stopped for garbage collection, "+
+			"PauseTotalNs.",
+		Cumulative(), Units("ns")),
+		func(s *runtime.MemStats) uint64 { return s.PauseTotalNs }},
+}
+
+// RegisterGoMemStats registers meters of the Go runtime of this process with
+// o, read from runtime.MemStats and named after its fields, for dashboards
+// keyed to them: the heap allocated and in use, the stacks, the memory
+// obtained from the OS, the heap size at which the next collection finishes,
+// and the number and total pause time of garbage collections; with meters of
+// the goroutines and OS threads. o should be the Origin of the process.
+// Reading MemStats stops the world briefly, so RegisterGoRuntimeStats is
+// cheaper. Both register `/go/goroutines`, so only one should be registered
+// with o.
+func RegisterGoMemStats(o *Origin) {
+	ms := make([]Meter, len(goMemStats))
+	for i, f := range goMemStats {
+		if f.desc.Cumulative() {
+			ms[i] = DefineCounter(f.desc)
+		} else {
+			ms[i] = DefineGauge(f.desc)
+		}
+	}
+	goroutines := DefineGauge(goGoroutinesDesc)
+	threads := DefineGauge(goThreadsDesc)
+	threadCreate := pprof.Lookup("threadcreate")
+	var stats runtime.MemStats
+	o.RegisterFunction(func() {
+		runtime.ReadMemStats(&stats)
+		now := time.Now()
+		for i, f := range goMemStats {
+			ms[i].SampleAt(now, f.value(&stats))
+		}
+		goroutines.SampleAt(now, uint64(runtime.NumGoroutine()))
+		threads.SampleAt(now, uint64(threadCreate.Count()))
+	}, append(ms, goroutines, threads)...)
+}
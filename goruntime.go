@@ -0,0 +1,172 @@
+package observability
+
+import (
+	"math"
+	"runtime/metrics"
+	"strconv"
+	"time"
+)
+
+var (
+	goGoroutinesDesc = DescribeMeter(
+		"/go/goroutines",
+		"Number of live goroutines of the process.")
+	goHeapAllocatedDesc = DescribeMeter(
+		"/go/heap/allocated",
+		"Bytes of memory allocated on the heap by the process.",
+		Cumulative(), Units("By"))
+	goHeapAllocationsDesc = DescribeMeter(
+		"/go/heap/allocations",
+		"Number of objects allocated on the heap by the process. Its rate "+
+			"drives `/go/gc/cycles`.",
+		Cumulative())
+	goHeapLiveDesc = DescribeMeter(
+		"/go/gc/heap_live",
+		"Bytes of heap objects of the process marked live by the last "+
+			"garbage collection.",
+		Units("By"))
+	goHeapGoalDesc = DescribeMeter(
+		"/go/gc/heap_goal",
+		"Size of the heap of the process at which the next garbage "+
+			"collection is to finish, from GOGC and the memory limit.",
+		Units("By"))
+	goMemoryLimitDesc = DescribeMeter(
+		"/go/gc/memory_limit",
+		"Memory limit of the process, GOMEMLIMIT, or the largest int64 if "+
+			"there is none.",
+		Units("By"))
+	goMemoryTotalDesc = DescribeMeter(
+		"/go/memory/total",
+		"Bytes of memory mapped by the Go runtime of the process, which "+
+			"resident memory approaches from below.",
+		Units("By"))
+	goGCCyclesDesc = DescribeMeter(
+		"/go/gc/cycles",
+		"Number of completed garbage collections of the process.",
+		Cumulative())
+	goGCCPUTimeDesc = DescribeMeter(
+		"/go/gc/cpu_time",
+		"CPU time spent by the process on garbage collection, including "+
+			"the assists of goroutines that allocate. It is estimated by "+
+			"the runtime.",
+		Cumulative(), Units("ns"))
+	goGCPausesDesc = DescribeMeter(
+		"/go/gc/pauses",
+		"Number of stop-the-world pauses of the process for garbage "+
+			"collection that lasted up to the bound of each bucket, le, "+
+			"and longer than that of the previous one.",
+		Cumulative())
+	goSchedulingLatencyDesc = DescribeMeter(
+		"/go/sched/latency",
+		"Number of times goroutines of the process waited to run, after "+
+			"becoming runnable, up to the bound of each bucket, le, and "+
+			"longer than that of the previous one. Long waits mean the "+
+			"process is short of CPU, such as from a GOMAXPROCS above its "+
+			"CPU quota.",
+		Cumulative())
+)
+
+// goRuntimeMetrics are the metrics of runtime/metrics that are sampled, and
+// the descriptions of their meters. The values of float metrics, which are in
+// seconds, are scaled to nanoseconds.
+var goRuntimeMetrics = []struct {
+	name string
+	desc MeterDescription
+}{
+	{"/sched/goroutines:goroutines", goGoroutinesDesc},
+	{"/gc/heap/allocs:bytes", goHeapAllocatedDesc},
+	{"/gc/heap/allocs:objects", goHeapAllocationsDesc},
+	{"/gc/heap/live:bytes", goHeapLiveDesc},
+	{"/gc/heap/goal:bytes", goHeapGoalDesc},
+	{"/gc/gomemlimit:bytes", goMemoryLimitDesc},
+	{"/memory/classes/total:bytes", goMemoryTotalDesc},
+	{"/gc/cycles/total:gc-cycles", goGCCyclesDesc},
+	{"/cpu/classes/gc/total:cpu-seconds", goGCCPUTimeDesc},
+	{"/sched/pauses/total/gc:seconds", goGCPausesDesc},
+	{"/sched/latencies:seconds", goSchedulingLatencyDesc},
+}
+
+// goHistogramBounds are the upper bounds, in nanoseconds, of the buckets of
+// the meters of histograms, which are coarser than those of runtime/metrics.
+// The last bucket is unbounded.
+var goHistogramBounds = []float64{1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9}
+
+// RegisterGoRuntimeStats registers meters of the Go runtime of this process
+// with o, read from runtime/metrics, so that any program using this package
+// can export its own garbage collection and scheduling telemetry: its
+// goroutines, heap allocations, heap size and goal, garbage collections and
+// their CPU time, and histograms of GC pauses and scheduling latency. o should
+// be the Origin of the process. The histograms have a meter for each bucket,
+// whose bounds are the powers of 10 from 1µs to 1s, labeled with le, the
+// bound in nanoseconds, or +Inf. Metrics that the Go release lacks are
+// skipped.
+func RegisterGoRuntimeStats(o *Origin) {
+	samples := make([]metrics.Sample, len(goRuntimeMetrics))
+	for i, m := range goRuntimeMetrics {
+		samples[i].Name = m.name
+	}
+	metrics.Read(samples)
+
+	// Each metric has a meter, or a meter for each bucket of the coarse
+	// histogram, and each bucket of the histogram of runtime/metrics is
+	// counted in one of them.
+	var ms []Meter
+	meters := make([][]Meter, len(samples))
+	buckets := make([][]int, len(samples))
+	for i, s := range samples {
+		desc := goRuntimeMetrics[i].desc
+		define := func(labels ...Label) {
+			var m Meter
+			if desc.Cumulative() {
+				m = DefineCounter(desc, labels...)
+			} else {
+				m = DefineGauge(desc, labels...)
+			}
+			meters[i] = append(meters[i], m)
+			ms = append(ms, m)
+		}
+		switch s.Value.Kind() {
+		case metrics.KindUint64, metrics.KindFloat64:
+			define()
+		case metrics.KindFloat64Histogram:
+			for _, b := range goHistogramBounds {
+				define(Label{Key: "le", Value: strconv.FormatFloat(b, 'f', -1, 64)})
+			}
+			define(Label{Key: "le", Value: "+Inf"})
+			h := s.Value.Float64Histogram()
+			buckets[i] = make([]int, len(h.Counts))
+			for j := range h.Counts {
+				// The bucket of runtime/metrics is counted in the
+				// first coarse one that its upper bound fits in.
+				upper := h.Buckets[j+1] * 1e9
+				k := 0
+				for k < len(goHistogramBounds) && upper > goHistogramBounds[k] {
+					k++
+				}
+				buckets[i][j] = k
+			}
+		}
+	}
+
+	counts := make([]uint64, len(goHistogramBounds)+1)
+	o.RegisterFunction(func() {
+		metrics.Read(samples)
+		now := time.Now()
+		for i, s := range samples {
+			switch s.Value.Kind() {
+			case metrics.KindUint64:
+				meters[i][0].SampleAt(now, s.Value.Uint64())
+			case metrics.KindFloat64:
+				meters[i][0].SampleAt(now, uint64(math.Round(s.Value.Float64()*1e9)))
+			case metrics.KindFloat64Histogram:
+				clear(counts)
+				for j, n := range s.Value.Float64Histogram().Counts {
+					counts[buckets[i][j]] += n
+				}
+				for k, m := range meters[i] {
+					m.SampleAt(now, counts[k])
+				}
+			}
+		}
+	}, ms...)
+}
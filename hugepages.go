@@ -0,0 +1,186 @@
+package observability
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	hugePagesDesc = DescribeMeter(
+		"/memory/huge_pages/pages",
+		"Number of persistent huge pages of each size in the pool, allocated "+
+			"or not.")
+	hugePagesFreeDesc = DescribeMeter(
+		"/memory/huge_pages/free",
+		"Number of huge pages of each size in the pool that are not "+
+			"allocated, including those reserved.")
+	hugePagesReservedDesc = DescribeMeter(
+		"/memory/huge_pages/reserved",
+		"Number of free huge pages of each size that are reserved for "+
+			"mappings that have not yet faulted them in.")
+	hugePagesSurplusDesc = DescribeMeter(
+		"/memory/huge_pages/surplus",
+		"Number of huge pages of each size allocated beyond the persistent "+
+			"pool, up to nr_overcommit_hugepages.")
+	thpAnonDesc = DescribeMeter(
+		"/memory/transparent_huge_pages/anonymous",
+		"Memory in anonymous transparent huge pages.",
+		Units("By"))
+	thpShmemDesc = DescribeMeter(
+		"/memory/transparent_huge_pages/shmem",
+		"Memory in transparent huge pages of shared memory and tmpfs.",
+		Units("By"))
+	thpFileDesc = DescribeMeter(
+		"/memory/transparent_huge_pages/file",
+		"Memory in transparent huge pages of the page cache.",
+		Units("By"))
+)
+
+// hugePageFiles are the files of each huge page size in
+// /sys/kernel/mm/hugepages, and the meters sampled from them.
+var hugePageFiles = []struct {
+	name string
+	desc MeterDescription
+}{
+	{"nr_hugepages", hugePagesDesc},
+	{"free_hugepages", hugePagesFreeDesc},
+	{"resv_hugepages", hugePagesReservedDesc},
+	{"surplus_hugepages", hugePagesSurplusDesc},
+}
+
+// thpEvents are the transparent huge page events of /proc/vmstat that are
+// sampled. Faults that fall back to small pages, and splits, are the usual
+// causes of latency blamed on THP, as are the collapses by khugepaged.
+var thpEvents = []struct {
+	name string
+	desc MeterDescription
+}{
+	{"thp_fault_alloc", DescribeMeter(
+		"/memory/transparent_huge_pages/fault_allocations",
+		"Number of page faults satisfied with a newly allocated transparent "+
+			"huge page.",
+		Cumulative())},
+	{"thp_fault_fallback", DescribeMeter(
+		"/memory/transparent_huge_pages/fault_fallbacks",
+		"Number of page faults that fell back to small pages because a "+
+			"transparent huge page could not be allocated.",
+		Cumulative())},
+	{"thp_collapse_alloc", DescribeMeter(
+		"/memory/transparent_huge_pages/collapses",
+		"Number of transparent huge pages allocated by khugepaged to collapse "+
+			"ranges of small pages.",
+		Cumulative())},
+	{"thp_collapse_alloc_failed", DescribeMeter(
+		"/memory/transparent_huge_pages/collapse_failures",
+		"Number of failures of khugepaged to allocate a transparent huge "+
+			"page for a collapse.",
+		Cumulative())},
+	{"thp_split_page", DescribeMeter(
+		"/memory/transparent_huge_pages/splits",
+		"Number of transparent huge pages split into small pages, for "+
+			"reclaim or migration, for example.",
+		Cumulative())},
+	{"thp_split_page_failed", DescribeMeter(
+		"/memory/transparent_huge_pages/split_failures",
+		"Number of failures to split a transparent huge page, because it "+
+			"was pinned, for example.",
+		Cumulative())},
+	{"thp_split_pmd", DescribeMeter(
+		"/memory/transparent_huge_pages/pmd_splits",
+		"Number of times the mapping of a transparent huge page was split "+
+			"into mappings of small pages, by mprotect or munmap of part of "+
+			"it, for example.",
+		Cumulative())},
+}
+
+// RegisterHugePageStats registers meters of huge pages with o: the pool of
+// each size of persistent huge pages, sampled from /sys/kernel/mm/hugepages
+// and labeled with the size, such as 2048kB; and the memory in transparent
+// huge pages and their events, sampled from /proc/meminfo and /proc/vmstat.
+// The sizes are those supported at registration, and the events those the
+// kernel counts. The files stay open for the life of the Origin.
+func RegisterHugePageStats(o *Origin) error {
+	return registerHugePageStats(o, "/sys/kernel/mm/hugepages", "/proc/meminfo", "/proc/vmstat")
+}
+
+func registerHugePageStats(o *Origin, hugepages, meminfo, vmstat string) error {
+	dirs, err := os.ReadDir(hugepages)
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		size, ok := strings.CutPrefix(d.Name(), "hugepages-")
+		if !ok {
+			continue
+		}
+		label := Label{Key: "size", Value: size}
+		for _, f := range hugePageFiles {
+			m := DefineGauge(f.desc, label)
+			if err := RegisterSysfsMeter(o, filepath.Join(hugepages, d.Name(), f.name), m); err != nil {
+				return err
+			}
+		}
+	}
+
+	var now time.Time
+	var ms []Meter
+	var vfs []valueFunc
+	for _, v := range []struct {
+		name string
+		desc MeterDescription
+	}{
+		{"AnonHugePages", thpAnonDesc},
+		{"ShmemHugePages", thpShmemDesc},
+		{"FileHugePages", thpFileDesc},
+	} {
+		m := DefineGauge(v.desc)
+		vfs = append(vfs, valueFunc{name: []byte(v.name), f: func(n uint64) { m.SampleAt(now, n) }})
+		ms = append(ms, m)
+	}
+	mem, err := NewFileScanner(meminfo, NewKeyValueScanner(nil, vfs))
+	if err != nil {
+		return err
+	}
+
+	// Find the events that the kernel counts, which it doesn't without
+	// CONFIG_TRANSPARENT_HUGEPAGE.
+	var lfs []lineFunc
+	for _, e := range thpEvents {
+		lfs = append(lfs, lineFunc{name: []byte(e.name), nfields: 1, f: func([][]byte) {}})
+	}
+	discover := NewUnorderedBufferScanner(nil, lfs)
+	vm, err := NewFileScanner(vmstat, discover)
+	if err == nil {
+		err = vm.Scan()
+		vm.Close()
+	}
+	if err != nil {
+		mem.Close()
+		return err
+	}
+	lfs = lfs[:0]
+	for i, hit := range discover.Hits() {
+		if !hit {
+			continue
+		}
+		m := DefineCounter(thpEvents[i].desc)
+		lfs = append(lfs, lineFunc{
+			name:    []byte(thpEvents[i].name),
+			nfields: 1,
+			f:       func(fields [][]byte) { m.SampleAt(now, naiveAtoi(fields[0])) },
+		})
+		ms = append(ms, m)
+	}
+	if vm, err = NewFileScanner(vmstat, NewUnorderedBufferScanner(nil, lfs)); err != nil {
+		mem.Close()
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		mem.Scan()
+		vm.Scan()
+	}, ms...)
+	return nil
+}
@@ -0,0 +1,87 @@
+package observability
+
+import (
+	"path/filepath"
+	"time"
+)
+
+var (
+	infinibandDataDesc = DescribeMeter(
+		"/net/infiniband/data",
+		"Data transmitted and received by each InfiniBand or RDMA port, "+
+			"across all its lanes, including packet headers.",
+		Cumulative(), Units("By"))
+	infinibandSymbolErrorsDesc = DescribeMeter(
+		"/net/infiniband/symbol_errors",
+		"Number of minor link errors detected on each InfiniBand or RDMA "+
+			"port. A steadily rising count is a degrading cable or "+
+			"transceiver.",
+		Cumulative())
+	infinibandLinkDownedDesc = DescribeMeter(
+		"/net/infiniband/link_downed",
+		"Number of times the link of each InfiniBand or RDMA port has "+
+			"failed to recover from errors and gone down.",
+		Cumulative())
+)
+
+// RegisterInfinibandStats registers meters of the counters of each port of
+// each InfiniBand or RDMA device with o, sampled from /sys/class/infiniband:
+// the data transmitted and received, symbol errors, and link downs. The meters
+// are labeled with the device and port, and the data also with the direction.
+// The ports are those present at registration. Devices without extended
+// counters saturate their data counters at 16 GiB. The files stay open for the
+// life of the Origin.
+func RegisterInfinibandStats(o *Origin) error {
+	return registerInfinibandStats(o, "/sys/class/infiniband")
+}
+
+func registerInfinibandStats(o *Origin, dir string) error {
+	ports, err := filepath.Glob(filepath.Join(dir, "*", "ports", "*", "counters"))
+	if err != nil {
+		return err
+	}
+	for _, counters := range ports {
+		port := filepath.Dir(counters)
+		labels := []Label{
+			{Key: "device", Value: filepath.Base(filepath.Dir(filepath.Dir(port)))},
+			{Key: "port", Value: filepath.Base(port)},
+		}
+		if err := registerInfinibandPort(o, counters, labels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func registerInfinibandPort(o *Origin, dir string, labels []Label) error {
+	for _, v := range []struct {
+		name string
+		m    Meter
+	}{
+		{"symbol_error", DefineCounter(infinibandSymbolErrorsDesc, labels...)},
+		{"link_downed", DefineCounter(infinibandLinkDownedDesc, labels...)},
+	} {
+		if err := RegisterSysfsMeter(o, filepath.Join(dir, v.name), v.m); err != nil {
+			return err
+		}
+	}
+	for _, v := range []struct {
+		name, direction string
+	}{
+		{"port_xmit_data", "transmit"},
+		{"port_rcv_data", "receive"},
+	} {
+		data, err := OpenSysfsValue(filepath.Join(dir, v.name))
+		if err != nil {
+			return err
+		}
+		m := DefineCounter(infinibandDataDesc, append(labels, Label{Key: "direction", Value: v.direction})...)
+		o.RegisterFunction(func() {
+			// The data counters count 4-byte words.
+			if n, err := data.Uint(); err == nil {
+				m.SampleAt(time.Now(), n*4)
+			}
+		}, m)
+	}
+	return nil
+}
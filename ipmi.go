@@ -0,0 +1,318 @@
+package observability
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	ipmiTemperatureDesc = DescribeMeter(
+		"/ipmi/sensor/temperature",
+		"Temperature read by each IPMI temperature sensor, such as those "+
+			"of the inlet, the CPUs, and the DIMMs. Negative temperatures "+
+			"are not sampled.",
+		Units("mCel"))
+	ipmiFanSpeedDesc = DescribeMeter(
+		"/ipmi/sensor/fan_speed",
+		"Speed of each fan read by IPMI. A fan at 0 while others spin has "+
+			"likely failed.",
+		Units("1/min"))
+	ipmiVoltageDesc = DescribeMeter(
+		"/ipmi/sensor/voltage",
+		"Voltage read by each IPMI voltage sensor, such as those of the "+
+			"power rails and the CMOS battery.",
+		Units("uV"))
+	ipmiCurrentDesc = DescribeMeter(
+		"/ipmi/sensor/current",
+		"Current read by each IPMI current sensor.",
+		Units("uA"))
+	ipmiPowerDesc = DescribeMeter(
+		"/ipmi/sensor/power",
+		"Power read by each IPMI power sensor, such as the input or output "+
+			"of each power supply.",
+		Units("uW"))
+	ipmiPowerSupplyStatusDesc = DescribeMeter(
+		"/ipmi/power_supply/status",
+		"Status of each power supply read by IPMI, as a bitmask: 1 for "+
+			"present, 2 for failed, 4 for failure predicted, 8 for input "+
+			"lost, 16 for input out of range, and 32 for input lost or out "+
+			"of range. Anything but 1 needs attention.")
+	ipmiChassisIntrusionDesc = DescribeMeter(
+		"/ipmi/chassis/intrusion",
+		"Intrusion detected by each IPMI physical security sensor, as a "+
+			"bitmask: 1 for the chassis, 2 for a drive bay, 4 for the I/O "+
+			"card area, 8 for the processor area, and 16 for the LAN cable "+
+			"unplugged. Anything but 0 needs attention.")
+)
+
+// The network functions and commands of IPMI used, and its completion codes.
+const (
+	ipmiNetFnSensor            = 0x04
+	ipmiNetFnStorage           = 0x0a
+	ipmiGetSensorReading       = 0x2d
+	ipmiReserveSDRRepository   = 0x22
+	ipmiGetSDR                 = 0x23
+	ipmiCompletionOK           = 0x00
+	ipmiReservationCanceled    = 0xc5
+	ipmiSDRLastRecord          = 0xffff
+	ipmiSDRHeaderSize          = 5
+	ipmiSDRChunkSize           = 16
+	ipmiSDRMaxRecords          = 1024
+	ipmiSDRFullSensor          = 0x01
+	ipmiSDRCompactSensor       = 0x02
+	ipmiBMCAddress             = 0x20
+	ipmiSensorSpecificReading  = 0x6f
+	ipmiSensorPhysicalSecurity = 0x05
+	ipmiSensorPowerSupply      = 0x08
+)
+
+// ipmiCompletionError is a completion code of a response other than success.
+type ipmiCompletionError uint8
+
+func (e ipmiCompletionError) Error() string {
+	return fmt.Sprintf("observability: IPMI completion code %#02x", uint8(e))
+}
+
+var errIPMIMalformed = errors.New("observability: malformed IPMI response")
+
+// ipmiCommand sends a request with the given data to a LUN of the BMC, and
+// returns the data of its response after the completion code, or an
+// ipmiCompletionError if it is not success.
+type ipmiCommand func(lun, netfn, cmd uint8, data []byte) ([]byte, error)
+
+// ipmiSensor is a sensor described by a full or compact sensor record of the
+// SDR repository.
+type ipmiSensor struct {
+	name       string
+	lun        uint8
+	number     uint8
+	typ        uint8
+	readingTyp uint8
+	unit       uint8
+	// Whether the reading is analog, and its format and conversion
+	// factors, from full sensor records only.
+	analog bool
+	format uint8
+	m, b   int
+	bExp   int
+	rExp   int
+}
+
+// signExtend returns the signed value of the low n bits of v.
+func signExtend(v uint, n uint) int {
+	return int(v<<(64-n)) >> (64 - n)
+}
+
+// parseIPMISensor parses an SDR, and returns the sensor it describes and
+// whether it is a sensor record of the BMC. Sensors of other controllers would
+// have to be bridged to.
+func parseIPMISensor(r []byte) (ipmiSensor, bool, error) {
+	if len(r) < ipmiSDRHeaderSize {
+		return ipmiSensor{}, false, errIPMIMalformed
+	}
+	var s ipmiSensor
+	var idOffset int
+	switch r[3] {
+	case ipmiSDRFullSensor:
+		idOffset = 47
+	case ipmiSDRCompactSensor:
+		idOffset = 31
+	default:
+		return s, false, nil
+	}
+	if len(r) <= idOffset {
+		return s, false, errIPMIMalformed
+	}
+	if r[5] != ipmiBMCAddress {
+		return s, false, nil
+	}
+	s.lun = r[6] & 0x3
+	s.number = r[7]
+	s.typ = r[12]
+	s.readingTyp = r[13]
+	s.unit = r[21]
+	if r[3] == ipmiSDRFullSensor {
+		s.format = r[20] >> 6
+		// Only linear conversions are supported.
+		s.analog = s.format != 3 && r[23]&0x7f == 0
+		s.m = signExtend(uint(r[24])|uint(r[25]>>6)<<8, 10)
+		s.b = signExtend(uint(r[26])|uint(r[27]>>6)<<8, 10)
+		s.rExp = signExtend(uint(r[29]>>4), 4)
+		s.bExp = signExtend(uint(r[29]&0xf), 4)
+	}
+	// The ID string is usually 8-bit ASCII, of up to 16 bytes.
+	n := int(r[idOffset] & 0x1f)
+	id := r[idOffset+1:]
+	if n < len(id) {
+		id = id[:n]
+	}
+	s.name = strings.TrimRight(string(id), " \x00")
+	return s, true, nil
+}
+
+// convert returns the value of a raw analog reading of the sensor.
+func (s *ipmiSensor) convert(raw uint8) float64 {
+	var x int
+	switch s.format {
+	case 0:
+		x = int(raw)
+	case 1:
+		x = int(int8(raw))
+		if x < 0 {
+			x++
+		}
+	default:
+		x = int(int8(raw))
+	}
+	return (float64(s.m*x) + float64(s.b)*math.Pow10(s.bExp)) * math.Pow10(s.rExp)
+}
+
+// ipmiAnalogUnits are the base units of analog sensors that are sampled, with
+// their descriptions and the scales to the units of the meters.
+var ipmiAnalogUnits = map[uint8]struct {
+	desc  MeterDescription
+	scale float64
+}{
+	1:  {ipmiTemperatureDesc, 1e3},
+	4:  {ipmiVoltageDesc, 1e6},
+	5:  {ipmiCurrentDesc, 1e6},
+	6:  {ipmiPowerDesc, 1e6},
+	18: {ipmiFanSpeedDesc, 1},
+}
+
+// readIPMISDR reads the SDR repository of the BMC with cmd, and calls f with
+// each record. A record is read in chunks, and the reservation is renewed if
+// the repository changes while it is read.
+func readIPMISDR(cmd ipmiCommand, f func(record []byte) error) error {
+	var reservation [2]byte
+	reserve := func() error {
+		resp, err := cmd(0, ipmiNetFnStorage, ipmiReserveSDRRepository, nil)
+		if err != nil {
+			return err
+		}
+		if len(resp) < 2 {
+			return errIPMIMalformed
+		}
+		reservation = [2]byte(resp)
+		return nil
+	}
+	if err := reserve(); err != nil {
+		return err
+	}
+	// get reads a part of a record, and returns it and the ID of the next
+	// record.
+	get := func(id uint16, offset, n uint8) ([]byte, uint16, error) {
+		req := []byte{reservation[0], reservation[1], byte(id), byte(id >> 8), offset, n}
+		resp, err := cmd(0, ipmiNetFnStorage, ipmiGetSDR, req)
+		if err == ipmiCompletionError(ipmiReservationCanceled) {
+			if err = reserve(); err != nil {
+				return nil, 0, err
+			}
+			req[0], req[1] = reservation[0], reservation[1]
+			resp, err = cmd(0, ipmiNetFnStorage, ipmiGetSDR, req)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(resp) < 2+int(n) {
+			return nil, 0, errIPMIMalformed
+		}
+		return resp[2 : 2+int(n)], binary.LittleEndian.Uint16(resp), nil
+	}
+	var record []byte
+	id := uint16(0)
+	for range ipmiSDRMaxRecords {
+		header, next, err := get(id, 0, ipmiSDRHeaderSize)
+		if err != nil {
+			return err
+		}
+		record = append(record[:0], header...)
+		for length := int(header[4]); length > 0; {
+			n := min(length, ipmiSDRChunkSize)
+			chunk, _, err := get(id, uint8(len(record)), uint8(n))
+			if err != nil {
+				return err
+			}
+			record = append(record, chunk...)
+			length -= n
+		}
+		if err := f(record); err != nil {
+			return err
+		}
+		if next == ipmiSDRLastRecord || next == id {
+			break
+		}
+		id = next
+	}
+	return nil
+}
+
+func registerIPMIStats(o *Origin, cmd ipmiCommand) error {
+	type sensorMeter struct {
+		sensor ipmiSensor
+		m      Meter
+		scale  float64
+	}
+	var sensors []sensorMeter
+	err := readIPMISDR(cmd, func(r []byte) error {
+		s, ok, err := parseIPMISensor(r)
+		if err != nil || !ok {
+			return err
+		}
+		label := Label{Key: "sensor", Value: s.name}
+		if u, ok := ipmiAnalogUnits[s.unit]; ok && s.analog {
+			sensors = append(sensors, sensorMeter{s, DefineGauge(u.desc, label), u.scale})
+			return nil
+		}
+		if s.readingTyp != ipmiSensorSpecificReading {
+			return nil
+		}
+		switch s.typ {
+		case ipmiSensorPowerSupply:
+			sensors = append(sensors, sensorMeter{s, DefineGauge(ipmiPowerSupplyStatusDesc, label), 0})
+		case ipmiSensorPhysicalSecurity:
+			sensors = append(sensors, sensorMeter{s, DefineGauge(ipmiChassisIntrusionDesc, label), 0})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	ms := make([]Meter, len(sensors))
+	for i, s := range sensors {
+		ms[i] = s.m
+	}
+	o.RegisterFunction(func() {
+		now := time.Now()
+		for _, s := range sensors {
+			resp, err := cmd(s.sensor.lun, ipmiNetFnSensor, ipmiGetSensorReading, []byte{s.sensor.number})
+			// Sensors whose reading is unavailable, or that are not
+			// scanning, such as those of absent devices, are not
+			// sampled.
+			if err != nil || len(resp) < 2 || resp[1]&0x20 != 0 || resp[1]&0x40 == 0 {
+				continue
+			}
+			if s.scale == 0 {
+				// The discrete states are in the third and
+				// optional fourth bytes.
+				var states uint64
+				if len(resp) > 2 {
+					states = uint64(resp[2])
+				}
+				if len(resp) > 3 {
+					states |= uint64(resp[3]&0x7f) << 8
+				}
+				s.m.SampleAt(now, states)
+				continue
+			}
+			if v := math.Round(s.sensor.convert(resp[0]) * s.scale); v >= 0 {
+				s.m.SampleAt(now, uint64(v))
+			}
+		}
+	}, ms...)
+	return nil
+}
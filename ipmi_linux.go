@@ -0,0 +1,179 @@
+package observability
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// ipmiDevice is an open IPMI device of the OpenIPMI driver, such as
+// /dev/ipmi0.
+type ipmiDevice struct {
+	f     *os.File
+	msgid int
+	addr  ipmiSystemInterfaceAddr
+	data  [ipmiMaxMsgLength]byte
+}
+
+// ipmiSystemInterfaceAddr is struct ipmi_system_interface_addr of
+// linux/ipmi.h.
+type ipmiSystemInterfaceAddr struct {
+	addrType int32
+	channel  int16
+	lun      uint8
+}
+
+// ipmiMsg is struct ipmi_msg of linux/ipmi.h.
+type ipmiMsg struct {
+	netfn   uint8
+	cmd     uint8
+	dataLen uint16
+	data    unsafe.Pointer
+}
+
+// ipmiReq is struct ipmi_req of linux/ipmi.h.
+type ipmiReq struct {
+	addr    unsafe.Pointer
+	addrLen uint32
+	msgid   int
+	msg     ipmiMsg
+}
+
+// ipmiRecv is struct ipmi_recv of linux/ipmi.h.
+type ipmiRecv struct {
+	recvType int32
+	addr     unsafe.Pointer
+	addrLen  uint32
+	msgid    int
+	msg      ipmiMsg
+}
+
+const (
+	// ipmictlSendCommand is IPMICTL_SEND_COMMAND, _IOR('i', 13, struct
+	// ipmi_req), whose size depends on the architecture.
+	ipmictlSendCommand = 2<<30 | unsafe.Sizeof(ipmiReq{})<<16 | 'i'<<8 | 13
+	// ipmictlReceiveMsgTrunc is IPMICTL_RECEIVE_MSG_TRUNC, _IOWR('i', 11,
+	// struct ipmi_recv).
+	ipmictlReceiveMsgTrunc = 3<<30 | unsafe.Sizeof(ipmiRecv{})<<16 | 'i'<<8 | 11
+
+	ipmiSystemInterfaceAddrType = 0x0c
+	ipmiBMCChannel              = 0xf
+	ipmiResponseRecvType        = 1
+	ipmiMaxMsgLength            = 272
+	// ipmiTimeout bounds the wait for each response of the BMC.
+	ipmiTimeout = 5 * time.Second
+)
+
+// openIPMIDevice opens an IPMI device for commands to the BMC.
+func openIPMIDevice(path string) (*ipmiDevice, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &ipmiDevice{f: f}, nil
+}
+
+func (d *ipmiDevice) ioctl(req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, d.f.Fd(), req, uintptr(arg))
+	runtime.KeepAlive(d)
+	if errno != 0 {
+		return os.NewSyscallError("ioctl", errno)
+	}
+	return nil
+}
+
+// wait waits until a response can be received, for at most ipmiTimeout.
+func (d *ipmiDevice) wait() error {
+	fd := int(d.f.Fd())
+	var fds syscall.FdSet
+	bits := int(8 * unsafe.Sizeof(fds.Bits[0]))
+	fds.Bits[fd/bits] |= 1 << (fd % bits)
+	tv := syscall.NsecToTimeval(int64(ipmiTimeout))
+	n, err := syscall.Select(fd+1, &fds, nil, nil, &tv)
+	runtime.KeepAlive(d)
+	if err != nil {
+		return os.NewSyscallError("select", err)
+	}
+	if n == 0 {
+		return os.NewSyscallError("select", syscall.ETIMEDOUT)
+	}
+	return nil
+}
+
+// command is an ipmiCommand that sends the request to the BMC through the
+// device, and receives its response, skipping those of earlier requests that
+// timed out.
+func (d *ipmiDevice) command(lun, netfn, cmd uint8, data []byte) ([]byte, error) {
+	d.msgid++
+	d.addr = ipmiSystemInterfaceAddr{addrType: ipmiSystemInterfaceAddrType, channel: ipmiBMCChannel, lun: lun}
+	n := copy(d.data[:], data)
+	req := ipmiReq{
+		addr:    unsafe.Pointer(&d.addr),
+		addrLen: uint32(unsafe.Sizeof(d.addr)),
+		msgid:   d.msgid,
+		msg:     ipmiMsg{netfn: netfn, cmd: cmd, dataLen: uint16(n), data: unsafe.Pointer(&d.data[0])},
+	}
+	if err := d.ioctl(ipmictlSendCommand, unsafe.Pointer(&req)); err != nil {
+		return nil, err
+	}
+	for {
+		if err := d.wait(); err != nil {
+			return nil, err
+		}
+		recv := ipmiRecv{
+			addr:    unsafe.Pointer(&d.addr),
+			addrLen: uint32(unsafe.Sizeof(d.addr)),
+			msg:     ipmiMsg{dataLen: uint16(len(d.data)), data: unsafe.Pointer(&d.data[0])},
+		}
+		err := d.ioctl(ipmictlReceiveMsgTrunc, unsafe.Pointer(&recv))
+		if errors.Is(err, syscall.EAGAIN) {
+			continue
+		}
+		// A truncated response is returned with EMSGSIZE, and is
+		// used anyway.
+		if err != nil && !errors.Is(err, syscall.EMSGSIZE) {
+			return nil, err
+		}
+		if recv.recvType != ipmiResponseRecvType || recv.msgid != d.msgid {
+			continue
+		}
+		resp := d.data[:min(int(recv.msg.dataLen), len(d.data))]
+		if len(resp) == 0 {
+			return nil, errIPMIMalformed
+		}
+		if resp[0] != ipmiCompletionOK {
+			return nil, ipmiCompletionError(resp[0])
+		}
+		return resp[1:], nil
+	}
+}
+
+// Close closes the device.
+func (d *ipmiDevice) Close() error {
+	return d.f.Close()
+}
+
+// RegisterIPMIStats registers meters of the sensors of the BMC with o, read in
+// band through the OpenIPMI driver at /dev/ipmi0, which usually requires root.
+// They are those of the temperature, fan speed, voltage, current, and power
+// sensors, and the status of the power supplies and the chassis intrusion
+// sensors, as read by ipmitool sensor, labeled with the sensor name. The
+// sensors are those of the SDR repository at registration, read with a command
+// to the BMC per record; each collection reads each sensor with another.
+// BMCs are slow, taking milliseconds per command, so the sensors are best
+// collected at a long interval. The device stays open for the life of the
+// Origin.
+func RegisterIPMIStats(o *Origin) error {
+	d, err := openIPMIDevice("/dev/ipmi0")
+	if err != nil {
+		return err
+	}
+	if err := registerIPMIStats(o, d.command); err != nil {
+		d.Close()
+		return err
+	}
+	return nil
+}
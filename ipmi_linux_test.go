@@ -0,0 +1,17 @@
+package observability
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestIPMIIoctlNumbers(t *testing.T) {
+	// The sizes encoded in the ioctl numbers depend on the size of
+	// pointers.
+	if unsafe.Sizeof(uintptr(0)) != 8 {
+		t.Skip("not a 64-bit architecture")
+	}
+	if ipmictlSendCommand != 0x8028690d || ipmictlReceiveMsgTrunc != 0xc030690b {
+		t.Fatalf("ioctl numbers are %#x and %#x", ipmictlSendCommand, ipmictlReceiveMsgTrunc)
+	}
+}
@@ -0,0 +1,129 @@
+package observability
+
+import "testing"
+
+// ipmiFullSensorRecord returns a full sensor record of a linear analog sensor
+// of the BMC.
+func ipmiFullSensorRecord(id uint16, number, unit uint8, m, b int, rExp, bExp int, name string) []byte {
+	r := make([]byte, 48, 48+len(name))
+	r[0], r[1], r[2], r[3] = byte(id), byte(id>>8), 0x51, ipmiSDRFullSensor
+	r[5], r[7], r[12], r[13] = ipmiBMCAddress, number, 0x01, 0x01
+	r[21] = unit
+	r[24], r[25] = byte(m), byte(m>>8)<<6
+	r[26], r[27] = byte(b), byte(b>>8)<<6
+	r[29] = byte(rExp)<<4 | byte(bExp)&0xf
+	r[47] = 0xc0 | byte(len(name))
+	r = append(r, name...)
+	r[4] = byte(len(r) - ipmiSDRHeaderSize)
+	return r
+}
+
+// ipmiCompactSensorRecord returns a compact sensor record of a discrete
+// sensor.
+func ipmiCompactSensorRecord(id uint16, owner, number, typ uint8, name string) []byte {
+	r := make([]byte, 32, 32+len(name))
+	r[0], r[1], r[2], r[3] = byte(id), byte(id>>8), 0x51, ipmiSDRCompactSensor
+	r[5], r[7], r[12], r[13] = owner, number, typ, ipmiSensorSpecificReading
+	r[31] = 0xc0 | byte(len(name))
+	r = append(r, name...)
+	r[4] = byte(len(r) - ipmiSDRHeaderSize)
+	return r
+}
+
+// fakeBMC answers the commands of an ipmiCommand from an SDR repository and
+// sensor readings.
+type fakeBMC struct {
+	records  [][]byte
+	readings map[uint8][]byte
+	// Whether the next Get SDR command fails because the reservation was
+	// canceled.
+	cancel      bool
+	reservation byte
+}
+
+func (b *fakeBMC) command(lun, netfn, cmd uint8, data []byte) ([]byte, error) {
+	switch {
+	case netfn == ipmiNetFnStorage && cmd == ipmiReserveSDRRepository:
+		b.reservation++
+		return []byte{b.reservation, 0}, nil
+	case netfn == ipmiNetFnStorage && cmd == ipmiGetSDR:
+		if b.cancel || data[0] != b.reservation {
+			b.cancel = false
+			return nil, ipmiCompletionError(ipmiReservationCanceled)
+		}
+		id := int(data[2]) | int(data[3])<<8
+		offset, n := int(data[4]), int(data[5])
+		r := b.records[id]
+		next := id + 1
+		if next == len(b.records) {
+			next = ipmiSDRLastRecord
+		}
+		return append([]byte{byte(next), byte(next >> 8)}, r[offset:offset+n]...), nil
+	case netfn == ipmiNetFnSensor && cmd == ipmiGetSensorReading:
+		if r, ok := b.readings[data[0]]; ok {
+			return r, nil
+		}
+	}
+	return nil, ipmiCompletionError(0xcb)
+}
+
+func TestIPMIStats(t *testing.T) {
+	b := &fakeBMC{
+		records: [][]byte{
+			ipmiFullSensorRecord(0, 1, 1, 1, 0, 0, 0, "Inlet Temp"),
+			ipmiFullSensorRecord(1, 2, 18, 60, 0, 0, 0, "Fan1"),
+			// A reading of 0.02 V per count, offset by 0.1 V.
+			ipmiFullSensorRecord(2, 3, 4, 2, 1, -2, 1, "12V"),
+			ipmiFullSensorRecord(3, 4, 6, 2, 0, 1, 0, "Pwr Consumption"),
+			ipmiFullSensorRecord(4, 5, 18, 60, 0, 0, 0, "Fan2"),
+			ipmiCompactSensorRecord(5, ipmiBMCAddress, 6, ipmiSensorPowerSupply, "PS1 Status"),
+			ipmiCompactSensorRecord(6, ipmiBMCAddress, 7, ipmiSensorPhysicalSecurity, "Intrusion"),
+			// A sensor of another controller, which is skipped.
+			ipmiCompactSensorRecord(7, 0x2c, 8, ipmiSensorPowerSupply, "PS2 Status"),
+			// A management controller device locator, which is
+			// skipped.
+			{8, 0, 0x51, 0x12, 3, 0x20, 0, 0},
+		},
+		readings: map[uint8][]byte{
+			1: {45, 0xc0},
+			2: {95, 0xc0},
+			3: {60, 0xc0},
+			4: {21, 0xc0},
+			// Fan2 is absent, so its reading is unavailable.
+			5: {0, 0xe0},
+			6: {0, 0xc0, 0x0b, 0x80},
+			7: {0, 0xc0, 0x01},
+		},
+		cancel: true,
+	}
+	o := NewOrigin()
+	if err := registerIPMIStats(o, b.command); err != nil {
+		t.Fatal(err)
+	}
+	checkValues(t, sampleValues(o), map[string]uint64{
+		"/ipmi/sensor/temperature{sensor=Inlet Temp}":  45000,
+		"/ipmi/sensor/fan_speed{sensor=Fan1}":          5700,
+		"/ipmi/sensor/fan_speed{sensor=Fan2}":          0,
+		"/ipmi/sensor/voltage{sensor=12V}":             1300000,
+		"/ipmi/sensor/power{sensor=Pwr Consumption}":   420000000,
+		"/ipmi/power_supply/status{sensor=PS1 Status}": 0x0b,
+		"/ipmi/chassis/intrusion{sensor=Intrusion}":    1,
+	})
+}
+
+func TestIPMISensorConversion(t *testing.T) {
+	for _, test := range []struct {
+		format uint8
+		raw    uint8
+		want   float64
+	}{
+		{0, 0xff, 255},
+		{1, 0xfe, -1},
+		{2, 0xfe, -2},
+	} {
+		s := ipmiSensor{format: test.format, m: 1}
+		if got := s.convert(test.raw); got != test.want {
+			t.Errorf("format %d: convert(%#x) = %v, want %v", test.format, test.raw, got, test.want)
+		}
+	}
+}
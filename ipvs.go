@@ -0,0 +1,225 @@
+package observability
+
+import (
+	"encoding/hex"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ipvsConnectionsDesc = DescribeMeter(
+		"/net/ipvs/connections",
+		"Number of connections scheduled by IPVS, the kernel's layer 4 load "+
+			"balancer.",
+		Cumulative())
+	ipvsPacketsDesc = DescribeMeter(
+		"/net/ipvs/packets",
+		"Number of packets forwarded by IPVS in each direction, in or out. "+
+			"Outgoing packets are only seen by IPVS in NAT mode.",
+		Cumulative())
+	ipvsBytesDesc = DescribeMeter(
+		"/net/ipvs/bytes",
+		"Bytes forwarded by IPVS in each direction, as `/net/ipvs/packets`.",
+		Cumulative(), Units("By"))
+	ipvsActiveConnectionsDesc = DescribeMeter(
+		"/net/ipvs/backend/active_connections",
+		"Number of established connections to each real server of each "+
+			"virtual service.")
+	ipvsInactiveConnectionsDesc = DescribeMeter(
+		"/net/ipvs/backend/inactive_connections",
+		"Number of connections to each real server of each virtual service "+
+			"in other states, such as TIME_WAIT, and of UDP flows.")
+	ipvsWeightDesc = DescribeMeter(
+		"/net/ipvs/backend/weight",
+		"Weight of each real server of each virtual service. A weight of 0 "+
+			"takes it out of rotation.")
+)
+
+// The fields of the lines of the real servers of /proc/net/ip_vs, as in
+// "-> C0A85216:0CEA Tunnel 100 248 2".
+const (
+	ipvsBackendAddress  = 1
+	ipvsBackendWeight   = 3
+	ipvsBackendActive   = 4
+	ipvsBackendInactive = 5
+)
+
+// ipvsBackend holds the meters of a real server of a virtual service.
+type ipvsBackend struct {
+	active, inactive, weight Meter
+}
+
+// RegisterIPVSStats registers meters of IPVS with o: the connections,
+// packets, and bytes it has forwarded, from /proc/net/ip_vs_stats, and the
+// connections and weight of each real server of each virtual service, from
+// /proc/net/ip_vs. The meters of real servers are labeled with the protocol
+// and address of the virtual service, such as TCP and 192.168.0.22:3306, or
+// FWM and the firewall mark, and the address of the real server. The services
+// and servers are those configured at registration. The per-service byte
+// counters shown by ipvsadm --stats are only available over netlink. The
+// files stay open for the life of the Origin.
+func RegisterIPVSStats(o *Origin) error {
+	return registerIPVSStats(o, "/proc/net/ip_vs_stats", "/proc/net/ip_vs")
+}
+
+func registerIPVSStats(o *Origin, statsPath, servicesPath string) error {
+	if err := registerIPVSTotals(o, statsPath); err != nil {
+		return err
+	}
+	return registerIPVSServices(o, servicesPath)
+}
+
+func registerIPVSTotals(o *Origin, path string) error {
+	var (
+		conns      = DefineCounter(ipvsConnectionsDesc)
+		inPackets  = DefineCounter(ipvsPacketsDesc, Label{Key: "direction", Value: "in"})
+		outPackets = DefineCounter(ipvsPacketsDesc, Label{Key: "direction", Value: "out"})
+		inBytes    = DefineCounter(ipvsBytesDesc, Label{Key: "direction", Value: "in"})
+		outBytes   = DefineCounter(ipvsBytesDesc, Label{Key: "direction", Value: "out"})
+	)
+	// The third line holds the totals, in hexadecimal, after two lines of
+	// headings. Rates follow.
+	var now time.Time
+	row := 0
+	fs, err := NewFileScanner(path, NewRowScanner(func(fields [][]byte) {
+		row++
+		if row != 3 {
+			return
+		}
+		conns.SampleAt(now, naiveAtoiHex(fields[0]))
+		inPackets.SampleAt(now, naiveAtoiHex(fields[1]))
+		outPackets.SampleAt(now, naiveAtoiHex(fields[2]))
+		inBytes.SampleAt(now, naiveAtoiHex(fields[3]))
+		outBytes.SampleAt(now, naiveAtoiHex(fields[4]))
+	}, minFields(5)))
+	if err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		row = 0
+		fs.Scan()
+	}, conns, inPackets, outPackets, inBytes, outBytes)
+	return nil
+}
+
+// ipvsAddress returns the address of /proc/net/ip_vs in the usual notation,
+// such as 192.168.0.22:3306 for C0A80016:0CEA or [2620::1]:80 for
+// [2620:0000:0000:0000:0000:0000:0000:0001]:0050. Addresses it can't decode
+// are returned unchanged.
+func ipvsAddress(s string) string {
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return s
+	}
+	port, err := strconv.ParseUint(s[i+1:], 16, 16)
+	if err != nil {
+		return s
+	}
+	var addr netip.Addr
+	if host := s[:i]; strings.HasPrefix(host, "[") {
+		addr, err = netip.ParseAddr(strings.Trim(host, "[]"))
+	} else {
+		var b []byte
+		if b, err = hex.DecodeString(host); err == nil && len(b) == 4 {
+			addr = netip.AddrFrom4([4]byte(b))
+		}
+	}
+	if err != nil || !addr.IsValid() {
+		return s
+	}
+	return netip.AddrPortFrom(addr, uint16(port)).String()
+}
+
+// ipvsService holds the real servers of a virtual service, by their addresses
+// in /proc/net/ip_vs.
+type ipvsService struct {
+	labels   []Label
+	backends map[string]*ipvsBackend
+}
+
+// ipvsLine classifies a line of /proc/net/ip_vs: that of a virtual service,
+// such as "TCP C0A80016:0CEA wlc", that of one of its real servers, which
+// follow it, or neither, such as the headings.
+func ipvsLine(fields [][]byte) (service, backend bool) {
+	switch string(fields[0]) {
+	case "TCP", "UDP", "SCTP", "FWM":
+		return len(fields) > 1, false
+	case "->":
+		if len(fields) <= ipvsBackendInactive {
+			return false, false
+		}
+		w := fields[ipvsBackendWeight]
+		return false, w[0] >= '0' && w[0] <= '9'
+	}
+	return false, false
+}
+
+func registerIPVSServices(o *Origin, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// Services are keyed by protocol and address.
+	services := make(map[string]map[string]*ipvsService)
+	var current *ipvsService
+	var ms []Meter
+	NewRowScanner(func(fields [][]byte) {
+		service, backend := ipvsLine(fields)
+		switch {
+		case service:
+			proto, addr := string(fields[0]), string(fields[1])
+			label := ipvsAddress(addr)
+			if proto == "FWM" {
+				mark, _ := strconv.ParseUint(addr, 16, 32)
+				label = strconv.FormatUint(mark, 10)
+			}
+			current = &ipvsService{
+				labels:   []Label{{Key: "protocol", Value: proto}, {Key: "service", Value: label}},
+				backends: make(map[string]*ipvsBackend),
+			}
+			if services[proto] == nil {
+				services[proto] = make(map[string]*ipvsService)
+			}
+			services[proto][addr] = current
+		case backend && current != nil:
+			addr := string(fields[ipvsBackendAddress])
+			labels := append(current.labels[:2:2], Label{Key: "backend", Value: ipvsAddress(addr)})
+			be := &ipvsBackend{
+				active:   DefineGauge(ipvsActiveConnectionsDesc, labels...),
+				inactive: DefineGauge(ipvsInactiveConnectionsDesc, labels...),
+				weight:   DefineGauge(ipvsWeightDesc, labels...),
+			}
+			current.backends[addr] = be
+			ms = append(ms, be.active, be.inactive, be.weight)
+		}
+	}, minFields(2)).Scan(b)
+
+	var now time.Time
+	fs, err := NewFileScanner(path, NewRowScanner(func(fields [][]byte) {
+		service, backend := ipvsLine(fields)
+		switch {
+		case service:
+			// The conversions don't allocate.
+			current = services[string(fields[0])][string(fields[1])]
+		case backend && current != nil:
+			if be, ok := current.backends[string(fields[ipvsBackendAddress])]; ok {
+				be.active.SampleAt(now, naiveAtoi(fields[ipvsBackendActive]))
+				be.inactive.SampleAt(now, naiveAtoi(fields[ipvsBackendInactive]))
+				be.weight.SampleAt(now, naiveAtoi(fields[ipvsBackendWeight]))
+			}
+		}
+	}, minFields(2)))
+	if err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		current = nil
+		fs.Scan()
+	}, ms...)
+	return nil
+}
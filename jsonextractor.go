@@ -0,0 +1,214 @@
+package observability
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+)
+
+// pathFunc associates a dotted path into a JSON document, such as
+// "devices.0.temperature", with a function, which is called with the text of
+// the number at that path, such as "311" or "-1.5e3". Array elements are
+// named by their index. Like the fields passed to lineFuncs, the number
+// points into the input, and should be parsed with naiveAtoi, naiveAtof, or
+// strconv.
+type pathFunc struct {
+	path string
+	f    func(number []byte)
+}
+
+// JSONExtractor extracts numbers from JSON documents, such as the output of
+// nvme-cli and the stats endpoints of HTTP servers, without decoding the
+// documents into objects, and without allocating. Only numbers can be
+// extracted; other values are skipped, as are numbers without a pathFunc.
+// Object keys are compared as they appear in the document, so a path can't
+// match a key containing escapes or dots.
+type JSONExtractor struct {
+	pathFuncs []pathFunc
+	index     map[string]int
+	// path is the path of the value being parsed.
+	path   []byte
+	errors atomic.Uint64
+}
+
+// jsonMaxDepth bounds the nesting of documents, so that a hostile document
+// can't exhaust the stack.
+const jsonMaxDepth = 64
+
+var errJSONMalformed = errors.New("observability: malformed JSON")
+
+// NewJSONExtractor creates a JSONExtractor for the given pathFuncs, whose paths
+// must be distinct.
+func NewJSONExtractor(pathFuncs []pathFunc) *JSONExtractor {
+	x := &JSONExtractor{
+		pathFuncs: pathFuncs,
+		index:     make(map[string]int, len(pathFuncs)),
+	}
+	for i, pf := range pathFuncs {
+		x.index[pf.path] = i
+	}
+	return x
+}
+
+// Extract parses the JSON document in b, calling the pathFuncs for the paths
+// that appear. It returns an error if the document is malformed, in which case
+// the functions for the numbers before the error have been called.
+func (x *JSONExtractor) Extract(b []byte) error {
+	x.path = x.path[:0]
+	i, err := x.value(b, skipJSONSpace(b, 0), 0)
+	if err == nil && skipJSONSpace(b, i) != len(b) {
+		err = errJSONMalformed
+	}
+	return err
+}
+
+// Scan is Extract, for use as a Scanner, except that it counts errors rather
+// than returning them.
+func (x *JSONExtractor) Scan(b []byte) {
+	if err := x.Extract(b); err != nil {
+		x.errors.Add(1)
+	}
+}
+
+// Errors returns the number of malformed documents found by Scan. It may be
+// called concurrently with scans.
+func (x *JSONExtractor) Errors() uint64 {
+	return x.errors.Load()
+}
+
+func skipJSONSpace(b []byte, i int) int {
+	for i < len(b) && (b[i] == ' ' || b[i] == '\t' || b[i] == '\n' || b[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// value parses the value starting at b[i], and returns the index after it.
+func (x *JSONExtractor) value(b []byte, i, depth int) (int, error) {
+	if i >= len(b) {
+		return i, errJSONMalformed
+	}
+	switch c := b[i]; {
+	case c == '{':
+		return x.object(b, i+1, depth+1)
+	case c == '[':
+		return x.array(b, i+1, depth+1)
+	case c == '"':
+		_, i, err := jsonString(b, i)
+		return i, err
+	case c == '-' || (c >= '0' && c <= '9'):
+		start := i
+		for i < len(b) && isJSONNumber(b[i]) {
+			i++
+		}
+		// The conversion doesn't allocate.
+		if j, ok := x.index[string(x.path)]; ok {
+			x.pathFuncs[j].f(b[start:i])
+		}
+		return i, nil
+	}
+	for _, lit := range []string{"true", "false", "null"} {
+		if len(b)-i >= len(lit) && string(b[i:i+len(lit)]) == lit {
+			return i + len(lit), nil
+		}
+	}
+	return i, errJSONMalformed
+}
+
+func isJSONNumber(c byte) bool {
+	return c >= '0' && c <= '9' || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E'
+}
+
+// jsonString returns the contents of the string starting at b[i], with any
+// escapes intact, and the index after it.
+func jsonString(b []byte, i int) ([]byte, int, error) {
+	start := i + 1
+	for i = start; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			i++
+		case '"':
+			return b[start:i], i + 1, nil
+		}
+	}
+	return nil, i, errJSONMalformed
+}
+
+// push appends an element to the path, and returns the length of the path
+// before it, to which pop restores it.
+func (x *JSONExtractor) push(elem []byte) int {
+	n := len(x.path)
+	if n > 0 {
+		x.path = append(x.path, '.')
+	}
+	x.path = append(x.path, elem...)
+	return n
+}
+
+func (x *JSONExtractor) object(b []byte, i, depth int) (int, error) {
+	if depth > jsonMaxDepth {
+		return i, errJSONMalformed
+	}
+	if i = skipJSONSpace(b, i); i < len(b) && b[i] == '}' {
+		return i + 1, nil
+	}
+	for {
+		if i >= len(b) || b[i] != '"' {
+			return i, errJSONMalformed
+		}
+		key, j, err := jsonString(b, i)
+		if err != nil {
+			return j, err
+		}
+		if i = skipJSONSpace(b, j); i >= len(b) || b[i] != ':' {
+			return i, errJSONMalformed
+		}
+		n := x.push(key)
+		i, err = x.value(b, skipJSONSpace(b, i+1), depth)
+		x.path = x.path[:n]
+		if err != nil {
+			return i, err
+		}
+		if i = skipJSONSpace(b, i); i >= len(b) {
+			return i, errJSONMalformed
+		}
+		switch b[i] {
+		case ',':
+			i = skipJSONSpace(b, i+1)
+		case '}':
+			return i + 1, nil
+		default:
+			return i, errJSONMalformed
+		}
+	}
+}
+
+func (x *JSONExtractor) array(b []byte, i, depth int) (int, error) {
+	if depth > jsonMaxDepth {
+		return i, errJSONMalformed
+	}
+	if i = skipJSONSpace(b, i); i < len(b) && b[i] == ']' {
+		return i + 1, nil
+	}
+	var elem [20]byte
+	for k := 0; ; k++ {
+		n := x.push(strconv.AppendInt(elem[:0], int64(k), 10))
+		var err error
+		i, err = x.value(b, i, depth)
+		x.path = x.path[:n]
+		if err != nil {
+			return i, err
+		}
+		if i = skipJSONSpace(b, i); i >= len(b) {
+			return i, errJSONMalformed
+		}
+		switch b[i] {
+		case ',':
+			i = skipJSONSpace(b, i+1)
+		case ']':
+			return i + 1, nil
+		default:
+			return i, errJSONMalformed
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package observability
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// JSONHandler is an http.Handler that dumps every meter of one or more Origins
+// as JSON, one meter per line, with all of the metadata in the meter
+// descriptions. It is intended for humans and ad-hoc scripts debugging a
+// single host, in the style of a /metricsz page, rather than for collection at
+// scale. Like PrometheusHandler, it can serve each Origin separately; see
+// ExportPerOrigin. Responses are compressed when the client accepts it; see
+// RegisterCompression.
+type JSONHandler struct {
+	cfg     exportConfig
+	origins []*Origin
+	limit   *scrapeLimiter
+}
+
+// NewJSONHandler returns a JSONHandler for the given origins.
+func NewJSONHandler(origins []*Origin, opts ...ExportOption) *JSONHandler {
+	cfg := newExportConfig(opts)
+	return &JSONHandler{
+		cfg:     cfg,
+		origins: origins,
+		limit:   newScrapeLimiter(&cfg, "json"),
+	}
+}
+
+type jsonMeter struct {
+	Name        string            `json:"name"`
+	Explanation string            `json:"explanation"`
+	Cumulative  bool              `json:"cumulative"`
+	Units       string            `json:"units,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	// Sampled is omitted if the meter has never been sampled.
+	Sampled *time.Time `json:"sampled,omitempty"`
+	Reset   time.Time  `json:"reset"`
+	Value   uint64     `json:"value"`
+}
+
+func labelMap(labels []Label) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(labels))
+	for _, l := range labels {
+		m[l.Key] = l.Value
+	}
+	return m
+}
+
+func newJSONMeter(s *Sample) jsonMeter {
+	jm := jsonMeter{
+		Name:        s.Description.Name(),
+		Explanation: s.Description.Explanation(),
+		Cumulative:  s.Description.Cumulative(),
+		Units:       s.Description.Units(),
+		Labels:      labelMap(s.Labels),
+		Reset:       s.Reset,
+		Value:       s.Value,
+	}
+	if !s.Time.IsZero() {
+		t := s.Time
+		jm.Sampled = &t
+	}
+	return jm
+}
+
+// ServeHTTP writes a document of the form
+//
+//	{"origins": [
+//	{"identity": {"host": "alice"}, "meters": [
+//	  {"name": "/xfs/reads", ...},
+//	  ...
+//	]},
+//	...
+//	]}
+//
+// The document is written a chunk of meters at a time, rather than built in
+// memory, so it can be arbitrarily large.
+func (h *JSONHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, finish, ok := h.limit.begin(w, r)
+	if !ok {
+		return
+	}
+	defer finish()
+	origins, ok := h.cfg.selectOrigins(h.origins, w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	body, done := compressResponse(w, r)
+	defer done()
+	bw := bufio.NewWriter(body)
+	defer bw.Flush()
+	bw.WriteString(`{"origins": [`)
+	current := -1
+	first := true
+	h.cfg.collect(origins, func(i int, snap Snapshot) error {
+		// Give up on a scrape that has run out of time, or whose
+		// client has gone away, leaving the response truncated.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if i != current {
+			if current >= 0 {
+				bw.WriteString("\n]},")
+			}
+			current = i
+			first = true
+			id, _ := json.Marshal(labelMap(snap.Origin))
+			fmt.Fprintf(bw, "\n{\"identity\": %s, \"meters\": [", id)
+		}
+		for j := range snap.Samples {
+			m, _ := json.Marshal(newJSONMeter(&snap.Samples[j]))
+			if !first {
+				bw.WriteByte(',')
+			}
+			first = false
+			bw.WriteString("\n  ")
+			bw.Write(m)
+		}
+		return nil
+	})
+	if current >= 0 {
+		bw.WriteString("\n]}")
+	}
+	bw.WriteString("\n]}\n")
+}
@@ -0,0 +1,171 @@
+package observability
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+var (
+	kernelLogMessagesDesc = DescribeMeter(
+		"/kernel/log/messages",
+		"Number of messages logged by the kernel at each priority, from "+
+			"emerg to debug.",
+		Cumulative())
+	kernelLogMatchesDesc = DescribeMeter(
+		"/kernel/log/matches",
+		"Number of messages logged by the kernel that match each pattern: "+
+			"io_error, for failed block I/O; oom_kill, for processes "+
+			"killed by the OOM killer of the system or of a cgroup; "+
+			"hung_task, for tasks blocked in the kernel for too long; and "+
+			"machine_check, for hardware errors reported by MCE.",
+		Cumulative())
+)
+
+// kernelLogPriorities are the names of the syslog priorities of kernel
+// messages, from 0.
+var kernelLogPriorities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// kernelLogPatterns are the patterns counted by /kernel/log/matches, and the
+// text that messages matching them contain.
+var kernelLogPatterns = []struct {
+	name string
+	text []byte
+}{
+	{"io_error", []byte("I/O error")},
+	{"oom_kill", []byte("Killed process")},
+	{"hung_task", []byte("blocked for more than")},
+	{"machine_check", []byte("[Hardware Error]")},
+}
+
+// kmsgReader reads the records of /dev/kmsg, such as
+// "3,1042,7312901,-;blk_update_request: I/O error, dev sdb, sector 2048",
+// without blocking.
+type kmsgReader struct {
+	fd int
+	// buf holds a record, which is at most 8 KiB, with its continuation
+	// lines. A read with a smaller buffer fails.
+	buf [8192]byte
+	// f is called for each record with its priority and the first line of
+	// its text, which points into buf.
+	f func(priority uint64, text []byte)
+}
+
+// openKmsg opens the kernel log device at path, positioned after the last
+// record logged.
+func openKmsg(path string) (*kmsgReader, error) {
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	if _, err := syscall.Seek(fd, 0, io.SeekEnd); err != nil {
+		syscall.Close(fd)
+		return nil, &os.PathError{Op: "seek", Path: path, Err: err}
+	}
+	return &kmsgReader{fd: fd}, nil
+}
+
+// record passes a record to f.
+func (r *kmsgReader) record(b []byte) {
+	header, text, ok := bytes.Cut(b, []byte(";"))
+	if !ok {
+		return
+	}
+	// The header begins with the facility and priority, as in syslog,
+	// followed by the sequence number, timestamp, and flags.
+	prefix, _, _ := bytes.Cut(header, []byte(","))
+	// Continuation lines hold the key-value dictionary of the record.
+	text, _ = nextLine(text)
+	r.f(naiveAtoi(prefix)&7, text)
+}
+
+// read passes the records that have been logged since the last read to f.
+func (r *kmsgReader) read() error {
+	for {
+		n, err := syscall.Read(r.fd, r.buf[:])
+		switch err {
+		case nil:
+		case syscall.EINTR:
+			continue
+		case syscall.EPIPE:
+			// Records were overwritten before they were read; the
+			// next read resumes at the oldest one left.
+			continue
+		case syscall.EAGAIN:
+			return nil
+		default:
+			return os.NewSyscallError("read", err)
+		}
+		if n <= 0 {
+			return nil
+		}
+		r.record(r.buf[:n])
+	}
+}
+
+// Close closes the device.
+func (r *kmsgReader) Close() error {
+	return syscall.Close(r.fd)
+}
+
+// kernelLogCounts counts the records of the kernel log.
+type kernelLogCounts struct {
+	messages [8]uint64 // By priority.
+	matches  []uint64  // By pattern.
+}
+
+func (c *kernelLogCounts) count(priority uint64, text []byte) {
+	c.messages[priority]++
+	for i, p := range kernelLogPatterns {
+		if bytes.Contains(text, p.text) {
+			c.matches[i]++
+		}
+	}
+}
+
+// RegisterKernelLogStats registers meters of the messages logged by the kernel
+// with o, read from /dev/kmsg without blocking: the number at each priority,
+// and the number matching patterns of trouble, such as I/O errors and OOM
+// kills, so that kernel log noise becomes alertable. The meters are labeled
+// with the priority or pattern. Only messages logged after registration are
+// counted, and those overwritten in the ring buffer between samples are lost.
+// Reading /dev/kmsg needs CAP_SYSLOG if kernel.dmesg_restrict is set. The
+// device stays open for the life of the Origin.
+func RegisterKernelLogStats(o *Origin) error {
+	return registerKernelLogStats(o, "/dev/kmsg")
+}
+
+func registerKernelLogStats(o *Origin, path string) error {
+	r, err := openKmsg(path)
+	if err != nil {
+		return err
+	}
+	c := &kernelLogCounts{matches: make([]uint64, len(kernelLogPatterns))}
+	r.f = c.count
+	var ms []Meter
+	messages := make([]Meter, len(kernelLogPriorities))
+	for i, p := range kernelLogPriorities {
+		messages[i] = DefineCounter(kernelLogMessagesDesc, Label{Key: "priority", Value: p})
+		ms = append(ms, messages[i])
+	}
+	matches := make([]Meter, len(kernelLogPatterns))
+	for i, p := range kernelLogPatterns {
+		matches[i] = DefineCounter(kernelLogMatchesDesc, Label{Key: "pattern", Value: p.name})
+		ms = append(ms, matches[i])
+	}
+	o.RegisterFunction(func() {
+		if r.read() != nil {
+			return
+		}
+		now := time.Now()
+		for i, m := range messages {
+			m.SampleAt(now, c.messages[i])
+		}
+		for i, m := range matches {
+			m.SampleAt(now, c.matches[i])
+		}
+	}, ms...)
+	return nil
+}
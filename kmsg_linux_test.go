@@ -0,0 +1,118 @@
+package observability
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestKernelLogRecord(t *testing.T) {
+	c := &kernelLogCounts{matches: make([]uint64, len(kernelLogPatterns))}
+	r := &kmsgReader{f: c.count}
+	for _, rec := range []string{
+		"6,1041,7312900,-;sd 2:0:0:0: [sdb] Synchronizing SCSI cache\n",
+		"3,1042,7312901,-;blk_update_request: I/O error, dev sdb, sector 2048 op 0x0:(READ)\n SUBSYSTEM=block\n DEVICE=b8:16\n",
+		"3,1043,7312902,c;Buffer I/O error on dev sdb, logical block 256, async page read\n",
+		"3,1044,9120331,-;Out of memory: Killed process 4120 (java) total-vm:8123412kB\n",
+		"3,1045,9320331,-;INFO: task kworker/3:1:121 blocked for more than 122 seconds.\n",
+		"0,1046,9420331,-;mce: [Hardware Error]: CPU 2: Machine Check Exception: 5 Bank 4\n",
+		// Facility 3, daemon, and priority 4, warning.
+		"28,1047,9520331,-;systemd[1]: Started Journal Service.\n",
+		// Matches are only counted in the message, not the dictionary.
+		"6,1048,9620331,-;usb 1-1: new device\n NOTE=I/O error\n",
+	} {
+		r.record([]byte(rec))
+	}
+	if want := [8]uint64{1, 0, 0, 4, 1, 0, 2, 0}; c.messages != want {
+		t.Errorf("messages = %v, want %v", c.messages, want)
+	}
+	for i, want := range []uint64{2, 1, 1, 1} {
+		if c.matches[i] != want {
+			t.Errorf("matches of %s = %d, want %d", kernelLogPatterns[i].name, c.matches[i], want)
+		}
+	}
+}
+
+func TestKernelLogStats(t *testing.T) {
+	o := NewOrigin()
+	if err := RegisterKernelLogStats(o); errors.Is(err, os.ErrPermission) || errors.Is(err, os.ErrNotExist) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range o.Snapshot().Samples {
+		if s.Time.IsZero() {
+			t.Errorf("%s%v not sampled", s.Description.Name(), s.Labels)
+		}
+	}
+}
+
+func TestOOMKillStats(t *testing.T) {
+	o := NewOrigin()
+	r := &kmsgReader{fd: -1}
+	if err := registerOOMKillStats(o, fixture("vmstat"), r); err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range []string{
+		"4,2001,1000,-;java invoked oom-killer: gfp_mask=0xcc0(GFP_KERNEL), order=0, oom_score_adj=0\n",
+		"6,2002,1001,-;oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=/,mems_allowed=0,oom_memcg=/system.slice/app.service,task_memcg=/system.slice/app.service,task=java,pid=4120,uid=1000\n",
+		"3,2003,1002,-;Memory cgroup out of memory: Killed process 4120 (java) total-vm:8123412kB, anon-rss:2097152kB\n",
+		"6,2004,2001,-;oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=/,mems_allowed=0,oom_memcg=/system.slice/app.service,task_memcg=/system.slice/app.service,task=java,pid=4188,uid=1000\n",
+		"3,2005,2002,-;Memory cgroup out of memory: Killed process 4188 (java) total-vm:8123412kB, anon-rss:2097152kB\n",
+		// Kernels before 4.19 don't log the cgroup.
+		"3,2006,3002,-;Out of memory: Killed process 981 (tmux: server) total-vm:10212kB\n",
+		"6,2007,3003,-;oom_reaper: reaped process 981 (tmux: server), now anon-rss:0kB\n",
+	} {
+		r.record([]byte(rec))
+	}
+	checkValues(t, sampleValues(o), map[string]uint64{"/memory/oom_kills": 0})
+	got := make(map[string]uint64)
+	for _, c := range o.Children() {
+		id := c.Identity()
+		for k, v := range sampleValues(c) {
+			got[id[0].Value+"|"+id[1].Value+"|"+k] = v
+		}
+	}
+	want := map[string]uint64{
+		"java|/system.slice/app.service|/memory/oom_task_kills": 2,
+		"tmux: server||/memory/oom_task_kills":                  1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestOOMKillStatsCollect(t *testing.T) {
+	// A datagram socket, like /dev/kmsg, returns a record from each read.
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_DGRAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fds[1])
+	o := NewOrigin()
+	r := &kmsgReader{fd: fds[0]}
+	defer r.Close()
+	if err := registerOOMKillStats(o, fixture("vmstat"), r); err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range []string{
+		"6,2002,1001,-;oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=/,mems_allowed=0,oom_memcg=/system.slice/app.service,task_memcg=/system.slice/app.service,task=java,pid=4120,uid=1000\n",
+		"3,2003,1002,-;Memory cgroup out of memory: Killed process 4120 (java) total-vm:8123412kB, anon-rss:2097152kB\n",
+	} {
+		if _, err := syscall.Write(fds[1], []byte(rec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The kill is read, and the child added, while o is collected.
+	o.Snapshot()
+	children := o.Children()
+	if len(children) != 1 {
+		t.Fatalf("got %d children, want 1", len(children))
+	}
+	if id := children[0].Identity(); len(id) != 2 || id[0].Value != "java" || id[1].Value != "/system.slice/app.service" {
+		t.Errorf("got identity %v", id)
+	}
+	checkValues(t, sampleValues(children[0]), map[string]uint64{"/memory/oom_task_kills": 1})
+}
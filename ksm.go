@@ -0,0 +1,59 @@
+package observability
+
+import (
+	"path/filepath"
+)
+
+// ksmFiles are the files of /sys/kernel/mm/ksm that are sampled, and the
+// descriptions of their meters.
+var ksmFiles = []struct {
+	name string
+	desc MeterDescription
+}{
+	{"run", DescribeMeter(
+		"/memory/ksm/run",
+		"State of the KSM daemon: 0, stopped; 1, merging pages; or 2, "+
+			"unmerging all merged pages.")},
+	{"pages_shared", DescribeMeter(
+		"/memory/ksm/pages_shared",
+		"Number of pages that KSM has merged, each of which backs one or "+
+			"more duplicates.")},
+	{"pages_sharing", DescribeMeter(
+		"/memory/ksm/pages_sharing",
+		"Number of duplicate pages that map `/memory/ksm/pages_shared`, "+
+			"which is the number of pages that KSM saves. Its ratio to "+
+			"`/memory/ksm/pages_shared` is the benefit of each merge.")},
+	{"pages_unshared", DescribeMeter(
+		"/memory/ksm/pages_unshared",
+		"Number of pages that KSM scans but has found unique. A high ratio "+
+			"to `/memory/ksm/pages_sharing` is scanning wasted on memory "+
+			"that doesn't deduplicate.")},
+	{"pages_volatile", DescribeMeter(
+		"/memory/ksm/pages_volatile",
+		"Number of pages that change too fast for KSM to merge.")},
+	{"full_scans", DescribeMeter(
+		"/memory/ksm/full_scans",
+		"Number of times KSM has scanned all of the mergeable memory.",
+		Cumulative())},
+}
+
+// RegisterKSMStats registers meters of kernel samepage merging with o, sampled
+// from /sys/kernel/mm/ksm, so that the memory it saves, and the effort it
+// spends, can be tracked on hosts that rely on it to pack virtual machines.
+// The files stay open for the life of the Origin.
+func RegisterKSMStats(o *Origin) error {
+	return registerKSMStats(o, "/sys/kernel/mm/ksm")
+}
+
+func registerKSMStats(o *Origin, dir string) error {
+	for _, f := range ksmFiles {
+		m := DefineGauge(f.desc)
+		if f.desc.Cumulative() {
+			m = DefineCounter(f.desc)
+		}
+		if err := RegisterSysfsMeter(o, filepath.Join(dir, f.name), m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package observability
+
+import (
+	"bytes"
+)
+
+// valueFunc associates a key with a function, for files of "key: value unit"
+// lines such as /proc/meminfo. The function is called with the value, scaled
+// to the base unit, whenever the key is encountered.
+type valueFunc struct {
+	name []byte
+	f    func(v uint64)
+}
+
+// KeyValueScanner scans files of colon-terminated keys followed by values with
+// optional units, such as
+//
+//	MemTotal:       32768 kB
+//	HugePages_Total:       0
+//
+// which is the format of /proc/meminfo, /proc/<pid>/status, and many other
+// files. Values in kB, MB, or GB are scaled to bytes, using the kernel's
+// convention that a kB is 1024 bytes. The keys may appear in any order, as
+// they differ between kernel versions. Values must be unsigned decimal
+// integers; lines with other values should not be given a valueFunc.
+type KeyValueScanner struct {
+	bs *BufferScanner
+}
+
+// kvUnits are the multipliers of the unit suffixes.
+var kvUnits = map[string]uint64{
+	"kB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+}
+
+// NewKeyValueScanner creates a KeyValueScanner from the given buffer and
+// valueFuncs, whose names are the keys without the colon. See NewBufferScanner
+// for the requirements of the buffer.
+func NewKeyValueScanner(lineBuf []byte, valueFuncs []valueFunc) *KeyValueScanner {
+	lineFuncs := make([]lineFunc, len(valueFuncs))
+	for i, vf := range valueFuncs {
+		f := vf.f
+		lineFuncs[i] = lineFunc{
+			name: append(bytes.Clone(vf.name), ':'),
+			f: func(fields [][]byte) {
+				v := naiveAtoi(fields[0])
+				if len(fields) > 1 {
+					// The conversion doesn't allocate.
+					if m, ok := kvUnits[string(fields[1])]; ok {
+						v *= m
+					}
+				}
+				f(v)
+			},
+		}
+	}
+	return &KeyValueScanner{bs: NewUnorderedBufferScanner(lineBuf, lineFuncs)}
+}
+
+// Scan reads all of the lines in the given byte buffer, calling the
+// valueFuncs for the keys that appear.
+func (s *KeyValueScanner) Scan(b []byte) {
+	s.bs.Scan(b)
+}
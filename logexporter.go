@@ -0,0 +1,134 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LogExporter periodically writes meters to a log as structured JSON lines, one
+// per meter, for environments where logs are the only reliable way off the
+// host. A line looks like
+//
+//	{"time":"2009-11-10T23:00:00Z","origin":{"host.name":"alice"},"name":"/xfs/reads","value":42}
+//
+// With the ExportSyslog option, each line is instead the message of an RFC 5424
+// syslog record. Every line or record is written with a single Write, so w can
+// be a datagram connection to a syslog daemon. Use ExportAllow to select the
+// meters worth logging.
+type LogExporter struct {
+	cfg      exportConfig
+	origins  []*Origin
+	hostname string
+	procID   string
+
+	// mu serializes writes, and protects buf.
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+// NewLogExporter returns an exporter that writes to w.
+func NewLogExporter(w io.Writer, origins []*Origin, opts ...ExportOption) *LogExporter {
+	hostname, _ := os.Hostname()
+	return &LogExporter{
+		cfg:      newExportConfig(opts),
+		origins:  origins,
+		hostname: hostname,
+		procID:   strconv.Itoa(os.Getpid()),
+		w:        w,
+	}
+}
+
+// ExportSyslog returns an ExportOption that makes a LogExporter write RFC 5424
+// syslog records, with facility user, severity informational, the given
+// application name, and message ID "metric". The host name of each record is
+// the host.name identity label of the Origin, or the local host name.
+func ExportSyslog(app string) ExportOption {
+	return exportFunctor(func(c exportConfig) exportConfig {
+		c.syslogApp = app
+		return c
+	})
+}
+
+type logLine struct {
+	Time   time.Time         `json:"time"`
+	Origin map[string]string `json:"origin,omitempty"`
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  uint64            `json:"value"`
+}
+
+// syslogPriority is facility user (1) and severity informational (6).
+const syslogPriority = "<14>"
+
+// Push takes a snapshot of every Origin and writes it. Meters that have never
+// been sampled are omitted.
+func (e *LogExporter) Push(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.cfg.collect(e.origins, func(_ int, snap Snapshot) error {
+		origin := labelMap(snap.Origin)
+		host := e.hostname
+		if h, ok := origin["host.name"]; ok {
+			host = h
+		}
+		for _, s := range snap.Samples {
+			if s.Time.IsZero() {
+				continue
+			}
+			line, err := json.Marshal(logLine{
+				Time:   s.Time.UTC(),
+				Origin: origin,
+				Name:   s.Description.Name(),
+				Labels: labelMap(s.Labels),
+				Value:  s.Value,
+			})
+			if err != nil {
+				return err
+			}
+			e.buf = e.buf[:0]
+			if e.cfg.syslogApp != "" {
+				e.buf = append(e.buf, syslogPriority+"1 "...)
+				e.buf = s.Time.UTC().AppendFormat(e.buf, "2006-01-02T15:04:05.000000Z07:00")
+				e.buf = append(e.buf, ' ')
+				e.buf = appendSyslogField(e.buf, host, 255)
+				e.buf = appendSyslogField(e.buf, e.cfg.syslogApp, 48)
+				e.buf = appendSyslogField(e.buf, e.procID, 128)
+				e.buf = append(e.buf, "metric - "...)
+			}
+			e.buf = append(e.buf, line...)
+			e.buf = append(e.buf, '\n')
+			if _, err := e.w.Write(e.buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// appendSyslogField appends a header field of at most limit characters, and the
+// following space. Header fields are printable ASCII without spaces.
+func appendSyslogField(b []byte, s string, limit int) []byte {
+	if s == "" {
+		return append(b, "- "...)
+	}
+	for i := 0; i < len(s) && i < limit; i++ {
+		c := s[i]
+		if c <= ' ' || c > '~' {
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	return append(b, ' ')
+}
+
+// Run pushes periodically until the context is done. Failed pushes are
+// reported to the function set with ExportErrors, and do not stop the loop.
+func (e *LogExporter) Run(ctx context.Context) error {
+	return runPeriodically(ctx, e.cfg, e.Push)
+}
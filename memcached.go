@@ -0,0 +1,123 @@
+package observability
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// statFunc associates a memcached stat name with a function, which is called
+// with the stat's value whenever the name is encountered.
+type statFunc struct {
+	name []byte
+	f    func(v uint64)
+	// micro makes the value be parsed as a decimal fraction, such as the
+	// seconds of rusage_user, "0.508297", and passed in millionths.
+	// Otherwise it must be an unsigned decimal integer.
+	micro bool
+}
+
+// MemcachedScanner scans the response of a memcached server to the stats
+// command, which is one line per stat, in no defined order, ended by a line
+// of its own:
+//
+//	STAT pid 2807
+//	STAT uptime 1203
+//	STAT rusage_user 0.508297
+//	STAT curr_connections 10
+//	END
+//
+// Stats without a statFunc, such as version, are ignored. A fleet of servers
+// can be scanned with one MemcachedScanner per server, each sampling the
+// Meters of the server's own Origin.
+type MemcachedScanner struct {
+	statFuncs []statFunc
+	index     map[string]int
+	lineBuf   []byte
+	fields    [][]byte
+}
+
+// errMemcachedTruncated is returned by ScanReader when the response ends
+// before its END line.
+var errMemcachedTruncated = errors.New("observability: memcached stats response ended without END")
+
+// NewMemcachedScanner creates a MemcachedScanner from the given buffer and
+// statFuncs, which may be in any order. The buffer is only used by
+// ScanReader, and must hold the longest line of the response. The names of
+// the statFuncs must be distinct.
+func NewMemcachedScanner(lineBuf []byte, statFuncs []statFunc) *MemcachedScanner {
+	ms := &MemcachedScanner{
+		statFuncs: statFuncs,
+		index:     make(map[string]int, len(statFuncs)),
+		lineBuf:   lineBuf[:cap(lineBuf)],
+	}
+	for i, sf := range statFuncs {
+		ms.index[string(sf.name)] = i
+	}
+	return ms
+}
+
+// Scan reads the lines in the given byte buffer up to END, calling the
+// statFuncs for the stats that appear.
+func (ms *MemcachedScanner) Scan(b []byte) {
+	var line []byte
+	for len(b) > 0 {
+		line, b = nextLine(b)
+		if done, _ := ms.scanLine(line); done {
+			return
+		}
+	}
+}
+
+// ScanReader is like Scan, but reads the response from r, such as a
+// connection to which "stats\r\n" has been written. It returns at the END
+// line without waiting for more input, so the connection can be used for the
+// next request, provided that requests aren't pipelined. It returns an error
+// if the server responded with an error, or the response ended without END.
+func (ms *MemcachedScanner) ScanReader(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(ms.lineBuf, cap(ms.lineBuf))
+	for scanner.Scan() {
+		if done, err := ms.scanLine(scanner.Bytes()); done {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errMemcachedTruncated
+}
+
+// scanLine handles one line of the response, and reports whether it ended the
+// response, and whether with an error.
+func (ms *MemcachedScanner) scanLine(line []byte) (done bool, err error) {
+	ms.fields = asciiByteFields(line, ms.fields[:0])
+	if len(ms.fields) == 0 {
+		return false, nil
+	}
+	switch string(ms.fields[0]) {
+	case "STAT":
+		if len(ms.fields) < 3 {
+			return false, nil
+		}
+		// The conversion doesn't allocate.
+		i, ok := ms.index[string(ms.fields[1])]
+		if !ok {
+			return false, nil
+		}
+		sf := &ms.statFuncs[i]
+		if sf.micro {
+			sf.f(uint64(naiveAtofMicro(ms.fields[2])))
+		} else {
+			sf.f(naiveAtoi(ms.fields[2]))
+		}
+		return false, nil
+	case "END":
+		return true, nil
+	case "ERROR", "CLIENT_ERROR", "SERVER_ERROR":
+		return true, fmt.Errorf("observability: memcached: %s", bytes.TrimSpace(line))
+	}
+	return false, nil
+}
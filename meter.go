@@ -37,6 +37,10 @@ memcached servers, and you use a central daemon that exports the stats for all
 of them. The ability to instantiate multiple Origins in a single process
 accommodates that.
 
+Origins that come and go, such as the processes on a host, can be created as
+children of a long-lived Origin, with NewChild, so that they are exported with
+it without reconfiguring the exporters.
+
 The other core concept is the Meter. A Meter measures something, for example it
 might measure the number of page faults taken by a process. A Meter is
 described exactly once in any given process. The description gives the name,
@@ -53,6 +57,8 @@ be updated in a consistent way.
 
 import (
 	"runtime"
+	"slices"
+	"sync"
 	"time"
 )
 
@@ -71,15 +77,51 @@ type MeterDescription struct {
 	// as time) or not (such as memory usage). Cumulative meters are
 	// checked for wrap-around, while others are not.
 	cumulative bool
+	// units of the measured value, if applicable, such as "By" for bytes.
+	units string
 	// describedAt contains the stack trace that called DescribeMeter. This
 	// helps readers understand the exact meaning of the meter, so they can
 	// refer to the code where it is instantiated.
 	describedAt []uintptr
+	// frames are the symbolized describedAt frames of a description that
+	// was decoded from a snapshot written by another process, where the
+	// program counters would be meaningless.
+	frames []runtime.Frame
+}
+
+// Name returns the name of the meter.
+func (md MeterDescription) Name() string { return md.name }
+
+// Explanation returns the explanation of the meter.
+func (md MeterDescription) Explanation() string { return md.explanation }
+
+// Cumulative returns whether the meter describes a cumulative process.
+func (md MeterDescription) Cumulative() bool { return md.cumulative }
+
+// Units returns the units of the meter, or the empty string if it has none.
+func (md MeterDescription) Units() string { return md.units }
+
+// DescribedAt returns the program counters of the call stack that described
+// the meter, suitable for runtime.CallersFrames.
+func (md MeterDescription) DescribedAt() []uintptr { return md.describedAt }
+
+// Frames returns the symbolized call stack that described the meter.
+func (md MeterDescription) Frames() []runtime.Frame {
+	if len(md.describedAt) == 0 {
+		return md.frames
+	}
+	var fs []runtime.Frame
+	frames := runtime.CallersFrames(md.describedAt)
+	for {
+		f, more := frames.Next()
+		fs = append(fs, f)
+		if !more {
+			return fs
+		}
+	}
 }
 
-// DescOption is used to mutate the description during instantiation. TODO:
-// currently there is just Cumulative option. I imagine there will also be
-// units decorators (bytes, nanoseconds, whatever).
+// DescOption is used to mutate the description during instantiation.
 type DescOption interface {
 	apply(MeterDescription) MeterDescription
 }
@@ -99,6 +141,16 @@ func Cumulative() DescOption {
 	})
 }
 
+// Units returns a DescOption that sets the units of the MeterDescription. Use
+// the case-sensitive UCUM codes that OpenTelemetry expects, for example "By"
+// for bytes, "s" or "ns" for time, and "Cel" for degrees Celsius.
+func Units(u string) DescOption {
+	return functorOption(func(md MeterDescription) MeterDescription {
+		md.units = u
+		return md
+	})
+}
+
 // DescribeMeter returns a MeterDescription with the given name, explanation,
 // and options.
 func DescribeMeter(name, explan string, opts ...DescOption) MeterDescription {
@@ -121,20 +173,99 @@ func DescribeMeter(name, explan string, opts ...DescOption) MeterDescription {
 // single instance of Linux running on some host, a single container, one
 // process within the container. Meters are registered, along with a function
 // to set them, with one or more Origins.
-type Origin struct{}
+type Origin struct {
+	// identity is the set of labels that uniquely identifies this Origin,
+	// for example the host name.
+	identity []Label
+	// mu serializes calls to the registered functions, and protects regs.
+	mu   sync.Mutex
+	regs []registration
+	// childMu protects children. It is separate from mu so that the
+	// registered functions may add and remove children.
+	childMu  sync.Mutex
+	children []*Origin
+}
+
+// registration is a setting function and the meters it sets.
+type registration struct {
+	f  func()
+	ms []Meter
+}
+
+// Label is a key-value pair. A set of Labels identifies an Origin. Labels on a
+// Meter distinguish instances of the same MeterDescription within an Origin,
+// such as the per-device instances of a disk meter.
+type Label struct {
+	Key   string
+	Value string
+}
+
+// NewOrigin returns an Origin identified by the given labels. The labels
+// should be chosen so that they identify the Origin over time; see the package
+// documentation.
+func NewOrigin(identity ...Label) *Origin {
+	return &Origin{identity: identity}
+}
+
+// Identity returns the labels identifying the Origin. The caller must not
+// modify the returned slice.
+func (o *Origin) Identity() []Label {
+	return o.identity
+}
+
+// NewChild returns a new Origin whose identity is o's followed by the given
+// labels, such as one for each process on a host, whose meters come and go.
+// Exporters of o also export the child, after o, until it is removed with
+// RemoveChild. Functions registered with o may add and remove its children,
+// which are exported from the next collection.
+func (o *Origin) NewChild(identity ...Label) *Origin {
+	c := NewOrigin(append(o.identity[:len(o.identity):len(o.identity)], identity...)...)
+	o.childMu.Lock()
+	defer o.childMu.Unlock()
+	o.children = append(o.children, c)
+	return c
+}
+
+// RemoveChild removes the child c of o, so that it is no longer exported.
+func (o *Origin) RemoveChild(c *Origin) {
+	o.childMu.Lock()
+	defer o.childMu.Unlock()
+	if i := slices.Index(o.children, c); i >= 0 {
+		o.children = slices.Delete(o.children, i, i+1)
+	}
+}
+
+// Children returns the children of o, in the order they were added.
+func (o *Origin) Children() []*Origin {
+	o.childMu.Lock()
+	defer o.childMu.Unlock()
+	return slices.Clone(o.children)
+}
 
 // RegisterFunction registers the provided nullary functor |f| as the exclusive
 // means of mutating the provided Meters. The function is expected to modify
 // all of the provided meters when called, and no other context may modify
-// them. The function is called exclusively by this origin. No locking is
-// provided; if the function requires synchronization it must do so internally,
-// for example by closing over a *sync.Mutex.
-func (o *Origin) RegisterFunction(f func(), ms ...Meter) {}
+// them. The function is called exclusively by this origin, and the origin
+// never calls its functions concurrently. No other locking is provided; if the
+// function shares state with other origins it must synchronize internally, for
+// example by closing over a *sync.Mutex.
+func (o *Origin) RegisterFunction(f func(), ms ...Meter) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.regs = append(o.regs, registration{f: f, ms: ms})
+}
 
 type Meter interface {
 	SampleAt(time.Time, uint64)
 	Value() (time.Time, uint64)
 	ResetAt(time.Time)
+	// ResetTime returns the time at which the meter was defined or last
+	// reset. Cumulative meters count from this time.
+	ResetTime() time.Time
+	Description() MeterDescription
+	// Labels returns the labels distinguishing this meter from others
+	// with the same description in the same Origin.
+	Labels() []Label
 }
 
 type setFunc func(Meter, time.Time, uint64)
@@ -153,6 +284,7 @@ func gaugeSet(_ Meter, _ time.Time, _ uint64) {
 
 type scalarMeter struct {
 	md MeterDescription
+	l  []Label
 	v  uint64
 	t  time.Time
 	r  time.Time
@@ -175,10 +307,56 @@ func (m *scalarMeter) Value() (time.Time, uint64) {
 	return m.t, m.v
 }
 
-func DefineCounter(md MeterDescription) Meter {
+func (m *scalarMeter) ResetTime() time.Time {
+	return m.r
+}
+
+func (m *scalarMeter) Description() MeterDescription {
+	return m.md
+}
+
+func (m *scalarMeter) Labels() []Label {
+	return m.l
+}
+
+// DefineCounter returns a Meter for a value that only increases, except when
+// it wraps or is reset. The labels, if any, distinguish it from other meters
+// with the same description.
+func DefineCounter(md MeterDescription, labels ...Label) Meter {
 	return &scalarMeter{
 		md: md,
+		l:  labels,
 		r:  time.Now(),
 		f:  counterSet,
 	}
 }
+
+// DefineGauge returns a Meter for a value that may go up and down.
+func DefineGauge(md MeterDescription, labels ...Label) Meter {
+	return &scalarMeter{
+		md: md,
+		l:  labels,
+		r:  time.Now(),
+		f:  gaugeSet,
+	}
+}
+
+// Descriptions returns the descriptions of the meters registered with the
+// Origin, once each, in the order they were registered. Unlike Snapshot, it
+// doesn't call the registered functions.
+func (o *Origin) Descriptions() []MeterDescription {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var mds []MeterDescription
+	seen := make(map[string]bool)
+	for _, r := range o.regs {
+		for _, m := range r.ms {
+			md := m.Description()
+			if !seen[md.name] {
+				seen[md.name] = true
+				mds = append(mds, md)
+			}
+		}
+	}
+	return mds
+}
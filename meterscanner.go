@@ -0,0 +1,136 @@
+package observability
+
+import (
+	"io"
+	"slices"
+	"time"
+)
+
+// fieldMeter binds a field of the line with the given name to a Meter, which
+// is sampled with the field's value as an unsigned decimal integer. Fields are
+// counted from zero after the name, as in lineFuncs, and must be less than 64.
+type fieldMeter struct {
+	name  string
+	field int
+	m     Meter
+}
+
+// MeterScanner is a BufferScanner that samples Meters from the fields of its
+// input according to a table of fieldMeters, for the common case of sources
+// whose fields are simply counters or gauges, such as
+//
+//	[]fieldMeter{
+//		{"rw", 0, DefineCounter(xfsWriteCallsDesc)},
+//		{"rw", 1, DefineCounter(xfsReadCallsDesc)},
+//	}
+//
+// for /proc/fs/xfs/stat. Only the bound fields are split out of each line. The
+// methods of the BufferScanner, such as SetStrict and RegisterErrorMeter, can
+// be used as usual.
+type MeterScanner struct {
+	*BufferScanner
+	// src is the scanner of the input, which is the BufferScanner or a
+	// scanner built on it.
+	src interface {
+		Scan([]byte)
+		ScanReader(io.Reader) error
+	}
+	meters []Meter
+	// now is the time of the scan in progress.
+	now time.Time
+}
+
+// NewMeterScanner creates a MeterScanner from the given buffer and
+// fieldMeters. Like the lineFuncs of NewBufferScanner, the names must be in
+// the order in which they appear in the input, and every one of them must
+// appear; the fieldMeters of a line may be in any order among themselves. A
+// line with too few fields for its fieldMeters is counted as an error, and
+// its Meters aren't sampled.
+func NewMeterScanner(lineBuf []byte, fieldMeters []fieldMeter) *MeterScanner {
+	s := &MeterScanner{}
+	s.BufferScanner = NewBufferScanner(lineBuf, s.lineFuncs(fieldMeters))
+	s.src = s.BufferScanner
+	return s
+}
+
+// NewRedisMeterScanner is like NewMeterScanner, except that it scans the
+// response to the Redis INFO command, with a RedisInfoScanner. The fieldMeters
+// are named by key, and may be in any order.
+func NewRedisMeterScanner(lineBuf []byte, fieldMeters []fieldMeter) *MeterScanner {
+	s := &MeterScanner{}
+	rs := NewRedisInfoScanner(lineBuf, s.lineFuncs(fieldMeters))
+	s.BufferScanner = rs.BufferScanner
+	s.src = rs
+	return s
+}
+
+// lineFuncs returns a lineFunc for each line named by the fieldMeters.
+func (s *MeterScanner) lineFuncs(fieldMeters []fieldMeter) []lineFunc {
+	// Group the fieldMeters by line, in the order of the lines.
+	var lines [][]fieldMeter
+	index := make(map[string]int)
+	for _, fm := range fieldMeters {
+		i, ok := index[fm.name]
+		if !ok {
+			i = len(lines)
+			index[fm.name] = i
+			lines = append(lines, nil)
+		}
+		lines[i] = append(lines[i], fm)
+		s.meters = append(s.meters, fm.m)
+	}
+	lineFuncs := make([]lineFunc, len(lines))
+	for i, fms := range lines {
+		lineFuncs[i] = s.lineFunc(fms)
+	}
+	return lineFuncs
+}
+
+// lineFunc returns a lineFunc that samples the Meters of the fieldMeters of
+// one line.
+func (s *MeterScanner) lineFunc(fms []fieldMeter) lineFunc {
+	var indices []int
+	for _, fm := range fms {
+		indices = append(indices, fm.field)
+	}
+	slices.Sort(indices)
+	indices = slices.Compact(indices)
+	// The selected fields are passed in order, so find each Meter's field
+	// in the selection.
+	sel := make([]int, len(fms))
+	for i, fm := range fms {
+		sel[i], _ = slices.BinarySearch(indices, fm.field)
+	}
+	return lineFunc{
+		name: []byte(fms[0].name),
+		mask: fieldMask(indices...),
+		f: func(fields [][]byte) {
+			for i, fm := range fms {
+				if v, ok := s.Atoi(fields[sel[i]]); ok {
+					fm.m.SampleAt(s.now, v)
+				}
+			}
+		},
+		nfields: len(indices),
+	}
+}
+
+// Scan reads all of the lines in the given byte buffer, sampling the Meters
+// from their fields at the current time.
+func (s *MeterScanner) Scan(b []byte) {
+	s.now = time.Now()
+	s.src.Scan(b)
+}
+
+// ScanReader is like Scan, but reads the input from r; see
+// BufferScanner.ScanReader and RedisInfoScanner.ScanReader.
+func (s *MeterScanner) ScanReader(r io.Reader) error {
+	s.now = time.Now()
+	return s.src.ScanReader(r)
+}
+
+// Meters returns the Meters of the fieldMeters, for registration with an
+// Origin along with a function that reads the source and calls Scan.
+func (s *MeterScanner) Meters() []Meter {
+	return s.meters
+}
@@ -0,0 +1,20 @@
+package observability
+
+// unescapeMount undoes the octal escapes of spaces, tabs, newlines, and
+// backslashes in the fields of /proc/mounts, such as \040 for a space.
+func unescapeMount(b []byte) string {
+	var out []byte
+	for i := 0; i < len(b); i++ {
+		if b[i] == '\\' && i+3 < len(b) && isOctal(b[i+1]) && isOctal(b[i+2]) && isOctal(b[i+3]) {
+			out = append(out, (b[i+1]-'0')<<6|(b[i+2]-'0')<<3|(b[i+3]-'0'))
+			i += 3
+			continue
+		}
+		out = append(out, b[i])
+	}
+	return string(out)
+}
+
+func isOctal(c byte) bool {
+	return c >= '0' && c <= '7'
+}
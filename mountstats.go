@@ -0,0 +1,171 @@
+package observability
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	nfsMountOperationsDesc = DescribeMeter(
+		"/nfs/mount/operations",
+		"Number of NFS operations of each type completed on each mount.",
+		Cumulative())
+	nfsMountRetransmissionsDesc = DescribeMeter(
+		"/nfs/mount/retransmissions",
+		"Number of times operations of each type on each NFS mount were "+
+			"transmitted again because the server didn't reply in time.",
+		Cumulative())
+	nfsMountMajorTimeoutsDesc = DescribeMeter(
+		"/nfs/mount/major_timeouts",
+		"Number of times operations of each type on each NFS mount timed "+
+			"out after all of their retransmissions, which hard mounts "+
+			"log as the server not responding.",
+		Cumulative())
+	nfsMountRTTDesc = DescribeMeter(
+		"/nfs/mount/rtt",
+		"Total time between sending the RPC of each operation of each type "+
+			"on each NFS mount and receiving its reply. Divided by "+
+			"`/nfs/mount/operations`, it is the mean latency of the server "+
+			"and network.",
+		Cumulative(), Units("ms"))
+	nfsMountExecutionTimeDesc = DescribeMeter(
+		"/nfs/mount/execution_time",
+		"Total time to complete each operation of each type on each NFS "+
+			"mount, from its creation to its completion, including the time "+
+			"it was queued in the client. Divided by "+
+			"`/nfs/mount/operations`, it is the mean latency seen by "+
+			"applications.",
+		Cumulative(), Units("ms"))
+)
+
+// The fields of the per-op statistics of /proc/self/mountstats, after the
+// name of the operation.
+const (
+	mountstatsOps           = 0
+	mountstatsTransmissions = 1
+	mountstatsMajorTimeouts = 2
+	mountstatsRTT           = 6
+	mountstatsExecute       = 7
+)
+
+// mountstatsScanner scans /proc/self/mountstats, in which each mount has a
+// line like "device server:/export mounted on /mnt with fstype nfs4
+// statvers=1.1", which those of NFS follow with indented statistics, ending
+// with a line per operation after "per-op statistics", such as
+// "READ: 14412 14412 0 2765568 ...".
+type mountstatsScanner struct {
+	// f is called for each operation of each NFS mount with the device and
+	// mount point, escaped as in /proc/mounts, the name of the operation,
+	// and its fields, which point into the input.
+	f      func(device, mount, op []byte, fields [][]byte)
+	fields [][]byte
+}
+
+func (s *mountstatsScanner) Scan(b []byte) {
+	var device, mount []byte
+	perOp := false
+	for len(b) > 0 {
+		var line []byte
+		line, b = nextLine(b)
+		if rest, ok := bytes.CutPrefix(line, []byte("device ")); ok {
+			s.fields = asciiByteFields(rest, s.fields[:0])
+			device, mount, perOp = nil, nil, false
+			// The fields are the device, "mounted", "on", the mount
+			// point, "with", "fstype", and the type.
+			if len(s.fields) >= 7 && bytes.HasPrefix(s.fields[6], []byte("nfs")) {
+				device, mount = s.fields[0], s.fields[3]
+			}
+			continue
+		}
+		if mount == nil {
+			continue
+		}
+		line = bytes.TrimSpace(line)
+		if !perOp {
+			perOp = string(line) == "per-op statistics"
+			continue
+		}
+		op, rest, ok := bytes.Cut(line, []byte(":"))
+		if !ok {
+			continue
+		}
+		s.fields = asciiByteFields(rest, s.fields[:0])
+		if len(s.fields) > mountstatsExecute {
+			s.f(device, mount, op, s.fields)
+		}
+	}
+}
+
+// nfsMountOp holds the meters of an operation of an NFS mount.
+type nfsMountOp struct {
+	ops, retransmissions, majorTimeouts, rtt, execute Meter
+}
+
+// RegisterNFSMountStats registers meters of the operations of each NFS mount
+// with o, sampled from /proc/self/mountstats: the number of each type, their
+// retransmissions and major timeouts, and their total round trip and
+// execution times, from which their mean latency follows. No other source
+// breaks NFS latency down by mount and operation. The meters are labeled with
+// the mount point, the export, such as server:/export, and the operation, such
+// as READ. The mounts are those of the mount namespace of the process at
+// registration. The file stays open for the life of the Origin.
+func RegisterNFSMountStats(o *Origin) error {
+	return registerNFSMountStats(o, "/proc/self/mountstats")
+}
+
+func registerNFSMountStats(o *Origin, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// The operations of each mount, by mount point and operation.
+	mounts := make(map[string]map[string]*nfsMountOp)
+	var ms []Meter
+	(&mountstatsScanner{f: func(device, mount, op []byte, _ [][]byte) {
+		ops, ok := mounts[string(mount)]
+		if !ok {
+			ops = make(map[string]*nfsMountOp)
+			mounts[string(mount)] = ops
+		}
+		labels := []Label{
+			{Key: "mount", Value: unescapeMount(mount)},
+			{Key: "export", Value: unescapeMount(device)},
+			{Key: "op", Value: strings.ToLower(string(op))},
+		}
+		m := &nfsMountOp{
+			ops:             DefineCounter(nfsMountOperationsDesc, labels...),
+			retransmissions: DefineCounter(nfsMountRetransmissionsDesc, labels...),
+			majorTimeouts:   DefineCounter(nfsMountMajorTimeoutsDesc, labels...),
+			rtt:             DefineCounter(nfsMountRTTDesc, labels...),
+			execute:         DefineCounter(nfsMountExecutionTimeDesc, labels...),
+		}
+		ops[string(op)] = m
+		ms = append(ms, m.ops, m.retransmissions, m.majorTimeouts, m.rtt, m.execute)
+	}}).Scan(b)
+
+	var now time.Time
+	fs, err := NewFileScanner(path, &mountstatsScanner{f: func(_, mount, op []byte, fields [][]byte) {
+		// The conversions don't allocate.
+		m, ok := mounts[string(mount)][string(op)]
+		if !ok {
+			return
+		}
+		ops := naiveAtoi(fields[mountstatsOps])
+		m.ops.SampleAt(now, ops)
+		// Each operation is transmitted at least once.
+		m.retransmissions.SampleAt(now, max(naiveAtoi(fields[mountstatsTransmissions]), ops)-ops)
+		m.majorTimeouts.SampleAt(now, naiveAtoi(fields[mountstatsMajorTimeouts]))
+		m.rtt.SampleAt(now, naiveAtoi(fields[mountstatsRTT]))
+		m.execute.SampleAt(now, naiveAtoi(fields[mountstatsExecute]))
+	}})
+	if err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		fs.Scan()
+	}, ms...)
+	return nil
+}
@@ -0,0 +1,143 @@
+package observability
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+var (
+	netInterfaceCarrierDesc = DescribeMeter(
+		"/net/interface/carrier",
+		"Whether each network interface has a link, 1, or not, 0. It is not "+
+			"sampled while the interface is administratively down.")
+	netInterfaceOperStateDesc = DescribeMeter(
+		"/net/interface/oper_state",
+		"Whether each network interface is in each RFC 2863 operational "+
+			"state, 1, or not, 0: up, down, lowerlayerdown, dormant, "+
+			"testing, notpresent, or unknown, which is that of many "+
+			"virtual interfaces.")
+	netInterfaceSpeedDesc = DescribeMeter(
+		"/net/interface/speed",
+		"Link speed of each network interface, as negotiated. It is not "+
+			"sampled for interfaces without a link or a speed, such as "+
+			"virtual ones.",
+		Units("bit/s"))
+	netInterfaceFullDuplexDesc = DescribeMeter(
+		"/net/interface/full_duplex",
+		"Whether each network interface is in full duplex, 1, or half "+
+			"duplex, 0. It is not sampled if the duplex is unknown.")
+	netInterfaceMTUDesc = DescribeMeter(
+		"/net/interface/mtu",
+		"Maximum transmission unit of each network interface.",
+		Units("By"))
+	netInterfaceCarrierChangesDesc = DescribeMeter(
+		"/net/interface/carrier_changes",
+		"Number of times the link of each network interface has gone up or "+
+			"down. A steadily rising count is a flapping link.",
+		Cumulative())
+)
+
+// netOperStates are the values of the operstate file of a network interface.
+var netOperStates = []string{"unknown", "notpresent", "down", "lowerlayerdown", "testing", "dormant", "up"}
+
+// RegisterNetInterfaceStats registers meters of the attributes of the network
+// interfaces accepted by the filter, or all of them if it is nil, with o,
+// sampled from /sys/class/net: their carrier, operational state, speed,
+// duplex, MTU, and carrier changes. The meters are labeled with the interface
+// name. The interfaces are those present at registration. The files stay open
+// for the life of the Origin.
+func RegisterNetInterfaceStats(o *Origin, filter func(iface string) bool) error {
+	return registerNetInterfaceStats(o, "/sys/class/net", filter)
+}
+
+func registerNetInterfaceStats(o *Origin, dir string, filter func(iface string) bool) error {
+	// The directory also holds files, such as bonding_masters.
+	paths, err := filepath.Glob(filepath.Join(dir, "*", "operstate"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		iface := filepath.Base(filepath.Dir(path))
+		if filter != nil && !filter(iface) {
+			continue
+		}
+		if err := registerNetInterface(o, filepath.Dir(path), iface); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func registerNetInterface(o *Origin, dir, iface string) error {
+	label := Label{Key: "iface", Value: iface}
+	for _, v := range []struct {
+		name string
+		m    Meter
+	}{
+		{"carrier", DefineGauge(netInterfaceCarrierDesc, label)},
+		{"mtu", DefineGauge(netInterfaceMTUDesc, label)},
+		{"carrier_changes", DefineCounter(netInterfaceCarrierChangesDesc, label)},
+	} {
+		if err := RegisterSysfsMeter(o, filepath.Join(dir, v.name), v.m); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	operstate, err := OpenSysfsValue(filepath.Join(dir, "operstate"))
+	if err != nil {
+		return err
+	}
+	states := make([]Meter, len(netOperStates))
+	for i, s := range netOperStates {
+		states[i] = DefineGauge(netInterfaceOperStateDesc, label, Label{Key: "state", Value: s})
+	}
+	o.RegisterFunction(func() {
+		b, err := operstate.Bytes()
+		if err != nil {
+			return
+		}
+		now := time.Now()
+		for i, s := range netOperStates {
+			// The conversion doesn't allocate.
+			states[i].SampleAt(now, boolValue(string(b) == s))
+		}
+	}, states...)
+
+	// Only physical interfaces have a speed and duplex.
+	speed, err := OpenSysfsValue(filepath.Join(dir, "speed"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		operstate.Close()
+		return err
+	}
+	duplex, err := OpenSysfsValue(filepath.Join(dir, "duplex"))
+	if err != nil {
+		operstate.Close()
+		speed.Close()
+		return err
+	}
+	speedMeter := DefineGauge(netInterfaceSpeedDesc, label)
+	fullDuplex := DefineGauge(netInterfaceFullDuplexDesc, label)
+	o.RegisterFunction(func() {
+		now := time.Now()
+		// The speed is in Mb/s, or -1 if unknown.
+		if n, err := speed.Uint(); err == nil {
+			speedMeter.SampleAt(now, n*1000000)
+		}
+		b, err := duplex.Bytes()
+		if err != nil {
+			return
+		}
+		switch string(b) {
+		case "full":
+			fullDuplex.SampleAt(now, 1)
+		case "half":
+			fullDuplex.SampleAt(now, 0)
+		}
+	}, speedMeter, fullDuplex)
+	return nil
+}
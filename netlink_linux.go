@@ -0,0 +1,372 @@
+package observability
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// These are the pieces of netlink shared by the collectors of statistics that
+// the kernel only provides in binary, over netlink, such as taskstats,
+// sock_diag, and drop_monitor. Messages and attributes are parsed in place,
+// without allocating, in the manner of the text scanners.
+
+// netlinkMessage is a message received over netlink.
+type netlinkMessage struct {
+	Header  syscall.NlMsghdr
+	Payload []byte
+}
+
+// netlinkAttr is a netlink attribute, in the type-length-value format used
+// within the payloads of most netlink families.
+type netlinkAttr struct {
+	Type uint16
+	// Nested reports whether the NLA_F_NESTED flag is set, in which case the
+	// value holds attributes of its own.
+	Nested bool
+	Value  []byte
+}
+
+const (
+	nlaFNested     = 1 << 15
+	nlaFByteOrder  = 1 << 14
+	netlinkAttrHdr = 4
+)
+
+var errNetlinkMalformed = errors.New("observability: malformed netlink message")
+
+// netlinkAlign rounds n up to the 4-byte alignment of netlink messages and
+// attributes.
+func netlinkAlign(n int) int {
+	return (n + 3) &^ 3
+}
+
+// nextNetlinkMessage returns the first message of b, which holds messages as
+// received from a netlink socket, and the rest of b after it.
+func nextNetlinkMessage(b []byte) (netlinkMessage, []byte, error) {
+	if len(b) < syscall.NLMSG_HDRLEN {
+		return netlinkMessage{}, nil, errNetlinkMalformed
+	}
+	h := syscall.NlMsghdr{
+		Len:   binary.NativeEndian.Uint32(b[0:4]),
+		Type:  binary.NativeEndian.Uint16(b[4:6]),
+		Flags: binary.NativeEndian.Uint16(b[6:8]),
+		Seq:   binary.NativeEndian.Uint32(b[8:12]),
+		Pid:   binary.NativeEndian.Uint32(b[12:16]),
+	}
+	if h.Len < syscall.NLMSG_HDRLEN || int(h.Len) > len(b) {
+		return netlinkMessage{}, nil, errNetlinkMalformed
+	}
+	m := netlinkMessage{Header: h, Payload: b[syscall.NLMSG_HDRLEN:h.Len:h.Len]}
+	return m, b[min(netlinkAlign(int(h.Len)), len(b)):], nil
+}
+
+// nextNetlinkAttr returns the first attribute of b, which holds attributes,
+// and the rest of b after it.
+func nextNetlinkAttr(b []byte) (netlinkAttr, []byte, error) {
+	if len(b) < netlinkAttrHdr {
+		return netlinkAttr{}, nil, errNetlinkMalformed
+	}
+	n := int(binary.NativeEndian.Uint16(b[0:2]))
+	typ := binary.NativeEndian.Uint16(b[2:4])
+	if n < netlinkAttrHdr || n > len(b) {
+		return netlinkAttr{}, nil, errNetlinkMalformed
+	}
+	a := netlinkAttr{
+		Type:   typ &^ (nlaFNested | nlaFByteOrder),
+		Nested: typ&nlaFNested != 0,
+		Value:  b[netlinkAttrHdr:n:n],
+	}
+	return a, b[min(netlinkAlign(n), len(b)):], nil
+}
+
+// rangeNetlinkAttrs calls f for each attribute in b, until f returns an
+// error, which it returns.
+func rangeNetlinkAttrs(b []byte, f func(netlinkAttr) error) error {
+	for len(b) > 0 {
+		a, rest, err := nextNetlinkAttr(b)
+		if err != nil {
+			return err
+		}
+		if err := f(a); err != nil {
+			return err
+		}
+		b = rest
+	}
+	return nil
+}
+
+// Uint32 and the like return the value of an attribute as an integer in host
+// byte order, or zero if it is too short.
+func (a netlinkAttr) Uint32() uint32 {
+	if len(a.Value) < 4 {
+		return 0
+	}
+	return binary.NativeEndian.Uint32(a.Value)
+}
+
+func (a netlinkAttr) Uint64() uint64 {
+	if len(a.Value) < 8 {
+		return 0
+	}
+	return binary.NativeEndian.Uint64(a.Value)
+}
+
+// String returns the value of an attribute holding a NUL-terminated string.
+func (a netlinkAttr) String() string {
+	v := a.Value
+	for i, c := range v {
+		if c == 0 {
+			v = v[:i]
+			break
+		}
+	}
+	return string(v)
+}
+
+// appendNetlinkAttr appends an attribute to b, padded to alignment.
+func appendNetlinkAttr(b []byte, typ uint16, value []byte) []byte {
+	b = binary.NativeEndian.AppendUint16(b, uint16(netlinkAttrHdr+len(value)))
+	b = binary.NativeEndian.AppendUint16(b, typ)
+	b = append(b, value...)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// NetlinkConn is a netlink socket for request and response exchanges with
+// the kernel, such as dumps of sockets or requests for the statistics of a
+// task. It serializes exchanges, and reuses its buffers between them.
+type NetlinkConn struct {
+	mu  sync.Mutex
+	fd  int
+	seq uint32
+	req []byte
+	buf []byte
+}
+
+// DialNetlink opens a netlink socket for the given protocol, such as
+// syscall.NETLINK_ROUTE, or NETLINK_GENERIC (16) for families such as
+// taskstats.
+func DialNetlink(protocol int) (*NetlinkConn, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, protocol)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	return &NetlinkConn{fd: fd, buf: make([]byte, os.Getpagesize())}, nil
+}
+
+// Execute sends a request of the given message type and flags, to which
+// NLM_F_REQUEST and NLM_F_ACK are added, with the given payload, such as a
+// family header followed by attributes. It calls f for each message of the
+// response, which for an NLM_F_DUMP request may be many, until the kernel
+// acknowledges or finishes the request. A negative error reported by the
+// kernel is returned as a syscall.Errno. After f returns an error it isn't
+// called again, and the error is returned once the rest of the response has
+// been drained. The payloads passed to f are only valid during the call.
+func (c *NetlinkConn) Execute(typ, flags uint16, payload []byte, f func(netlinkMessage) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	c.req = binary.NativeEndian.AppendUint32(c.req[:0], uint32(syscall.NLMSG_HDRLEN+len(payload)))
+	c.req = binary.NativeEndian.AppendUint16(c.req, typ)
+	c.req = binary.NativeEndian.AppendUint16(c.req, flags|syscall.NLM_F_REQUEST|syscall.NLM_F_ACK)
+	c.req = binary.NativeEndian.AppendUint32(c.req, c.seq)
+	c.req = binary.NativeEndian.AppendUint32(c.req, 0)
+	c.req = append(c.req, payload...)
+	if err := syscall.Sendto(c.fd, c.req, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return os.NewSyscallError("sendto", err)
+	}
+	var ferr error
+	for {
+		// Peek at the size of the next datagram, so that it can't be
+		// truncated, as dumps may have larger ones than a page.
+		n, _, err := syscall.Recvfrom(c.fd, c.buf, syscall.MSG_PEEK|syscall.MSG_TRUNC)
+		if err != nil {
+			return os.NewSyscallError("recvfrom", err)
+		}
+		if n > len(c.buf) {
+			c.buf = make([]byte, n)
+		}
+		if n, _, err = syscall.Recvfrom(c.fd, c.buf, 0); err != nil {
+			return os.NewSyscallError("recvfrom", err)
+		}
+		b := c.buf[:n]
+		for len(b) > 0 {
+			var m netlinkMessage
+			if m, b, err = nextNetlinkMessage(b); err != nil {
+				return err
+			}
+			if m.Header.Seq != c.seq {
+				// A stale response to an abandoned request.
+				continue
+			}
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return ferr
+			case syscall.NLMSG_ERROR:
+				if len(m.Payload) < 4 {
+					return errNetlinkMalformed
+				}
+				if errno := int32(binary.NativeEndian.Uint32(m.Payload)); errno != 0 {
+					return syscall.Errno(-errno)
+				}
+				// The acknowledgement, which ends a request
+				// that isn't a dump.
+				return ferr
+			default:
+				if ferr == nil {
+					// After f fails, the rest of the
+					// response is drained, so that the next
+					// exchange doesn't read it.
+					ferr = f(m)
+				}
+			}
+		}
+	}
+}
+
+// The generic netlink controller, which resolves the names of families, such
+// as TASKSTATS, to their message types, and the names of their multicast
+// groups to their numbers.
+const (
+	netlinkGeneric           = 16
+	genlIDCtrl               = 0x10
+	genlCtrlGetFamily        = 3
+	genlCtrlAttrFamilyID     = 1
+	genlCtrlAttrName         = 2
+	genlCtrlAttrMcastGroups  = 7
+	genlCtrlAttrMcastGrpName = 1
+	genlCtrlAttrMcastGrpID   = 2
+	genlHdrLen               = 4
+)
+
+// appendGenlHeader appends the header of a generic netlink message, struct
+// genlmsghdr, with the given command, to b.
+func appendGenlHeader(b []byte, cmd, version uint8) []byte {
+	return append(b, cmd, version, 0, 0)
+}
+
+// getGenericFamily requests the generic netlink family with the given name,
+// on a NETLINK_GENERIC socket, and calls f for each of its attributes.
+func (c *NetlinkConn) getGenericFamily(name string, f func(netlinkAttr) error) error {
+	req := appendGenlHeader(nil, genlCtrlGetFamily, 1)
+	req = appendNetlinkAttr(req, genlCtrlAttrName, append([]byte(name), 0))
+	return c.Execute(genlIDCtrl, 0, req, func(m netlinkMessage) error {
+		if len(m.Payload) < genlHdrLen {
+			return errNetlinkMalformed
+		}
+		return rangeNetlinkAttrs(m.Payload[genlHdrLen:], f)
+	})
+}
+
+// genericFamily returns the message type of the generic netlink family with
+// the given name.
+func (c *NetlinkConn) genericFamily(name string) (uint16, error) {
+	var id uint16
+	err := c.getGenericFamily(name, func(a netlinkAttr) error {
+		if a.Type == genlCtrlAttrFamilyID && len(a.Value) >= 2 {
+			id = binary.NativeEndian.Uint16(a.Value)
+		}
+		return nil
+	})
+	if err == nil && id == 0 {
+		err = errNetlinkMalformed
+	}
+	return id, err
+}
+
+// genericMulticastGroup returns the number of the multicast group with the
+// given name of the generic netlink family with the given name.
+func (c *NetlinkConn) genericMulticastGroup(family, group string) (uint32, error) {
+	var id uint32
+	err := c.getGenericFamily(family, func(a netlinkAttr) error {
+		if a.Type != genlCtrlAttrMcastGroups {
+			return nil
+		}
+		// The groups are nested in attributes of their own, numbered
+		// from 1.
+		return rangeNetlinkAttrs(a.Value, func(g netlinkAttr) error {
+			var name string
+			var gid uint32
+			err := rangeNetlinkAttrs(g.Value, func(a netlinkAttr) error {
+				switch a.Type {
+				case genlCtrlAttrMcastGrpName:
+					name = a.String()
+				case genlCtrlAttrMcastGrpID:
+					gid = a.Uint32()
+				}
+				return nil
+			})
+			if name == group {
+				id = gid
+			}
+			return err
+		})
+	})
+	if err == nil && id == 0 {
+		err = errNetlinkMalformed
+	}
+	return id, err
+}
+
+// joinGroup subscribes the socket to the multicast group with the given
+// number, whose messages are then read with Receive.
+func (c *NetlinkConn) joinGroup(group uint32) error {
+	const solNetlink, netlinkAddMembership = 270, 1
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(c.fd, solNetlink, netlinkAddMembership, int(group)))
+}
+
+// Receive calls f for each of the messages that the socket has received
+// outside of exchanges, such as those of multicast groups, without waiting
+// for more. After f returns an error it isn't called again, and the error is
+// returned once the messages have been drained. Messages that overflowed the
+// receive buffer of the socket are lost. The payloads passed to f are only
+// valid during the call.
+func (c *NetlinkConn) Receive(f func(netlinkMessage) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var ferr error
+	for {
+		n, _, err := syscall.Recvfrom(c.fd, c.buf, syscall.MSG_PEEK|syscall.MSG_TRUNC|syscall.MSG_DONTWAIT)
+		switch err {
+		case nil:
+		case syscall.EAGAIN:
+			return ferr
+		case syscall.ENOBUFS:
+			// The buffer overflowed, and the kernel dropped
+			// messages. Those that were queued remain.
+			continue
+		default:
+			return os.NewSyscallError("recvfrom", err)
+		}
+		if n > len(c.buf) {
+			c.buf = make([]byte, n)
+		}
+		if n, _, err = syscall.Recvfrom(c.fd, c.buf, syscall.MSG_DONTWAIT); err != nil {
+			return os.NewSyscallError("recvfrom", err)
+		}
+		b := c.buf[:n]
+		for len(b) > 0 {
+			var m netlinkMessage
+			if m, b, err = nextNetlinkMessage(b); err != nil {
+				return err
+			}
+			if ferr == nil {
+				ferr = f(m)
+			}
+		}
+	}
+}
+
+// Close closes the socket.
+func (c *NetlinkConn) Close() error {
+	return os.NewSyscallError("close", syscall.Close(c.fd))
+}
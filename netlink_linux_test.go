@@ -0,0 +1,79 @@
+package observability
+
+import (
+	"encoding/binary"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestNetlinkParsing(t *testing.T) {
+	inner := appendNetlinkAttr(nil, 1, binary.NativeEndian.AppendUint64(nil, 42))
+	attrs := appendNetlinkAttr(nil, 3, []byte("eth0\x00"))
+	attrs = appendNetlinkAttr(attrs, 7|nlaFNested, inner)
+	msg := binary.NativeEndian.AppendUint32(nil, uint32(syscall.NLMSG_HDRLEN+len(attrs)))
+	msg = binary.NativeEndian.AppendUint16(msg, 16)
+	msg = binary.NativeEndian.AppendUint16(msg, syscall.NLM_F_MULTI)
+	msg = binary.NativeEndian.AppendUint32(msg, 9)
+	msg = binary.NativeEndian.AppendUint32(msg, 0)
+	msg = append(msg, attrs...)
+
+	m, rest, err := nextNetlinkMessage(append(msg, msg...))
+	if err != nil || m.Header.Type != 16 || m.Header.Seq != 9 || len(rest) != len(msg) {
+		t.Fatalf("got %+v, %d bytes left, %v", m.Header, len(rest), err)
+	}
+	var got []string
+	err = rangeNetlinkAttrs(m.Payload, func(a netlinkAttr) error {
+		if !a.Nested {
+			got = append(got, a.String())
+			return nil
+		}
+		return rangeNetlinkAttrs(a.Value, func(a netlinkAttr) error {
+			if a.Type == 1 && a.Uint64() == 42 {
+				got = append(got, "nested 42")
+			}
+			return nil
+		})
+	})
+	if want := []string{"eth0", "nested 42"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, %v, want %q", got, err, want)
+	}
+	if _, _, err := nextNetlinkMessage(msg[:len(msg)-1]); err == nil {
+		t.Error("truncated message wasn't reported")
+	}
+	if err := rangeNetlinkAttrs([]byte{200, 0, 1, 0}, func(netlinkAttr) error { return nil }); err == nil {
+		t.Error("overlong attribute wasn't reported")
+	}
+}
+
+func TestNetlinkConn(t *testing.T) {
+	c, err := DialNetlink(syscall.NETLINK_ROUTE)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer c.Close()
+	// Dump the network interfaces, which always include lo. The payload
+	// is an empty struct ifinfomsg.
+	ifinfomsg := make([]byte, syscall.SizeofIfInfomsg)
+	for range 2 {
+		var names []string
+		err := c.Execute(syscall.RTM_GETLINK, syscall.NLM_F_DUMP, ifinfomsg, func(m netlinkMessage) error {
+			return rangeNetlinkAttrs(m.Payload[syscall.SizeofIfInfomsg:], func(a netlinkAttr) error {
+				if a.Type == syscall.IFLA_IFNAME {
+					names = append(names, a.String())
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) == 0 || names[0] != "lo" {
+			t.Errorf("got interfaces %q", names)
+		}
+	}
+	// A request for a message type that doesn't exist is refused.
+	if err := c.Execute(0x7ff, 0, nil, func(netlinkMessage) error { return nil }); err == nil {
+		t.Error("bogus request succeeded")
+	}
+}
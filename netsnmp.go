@@ -0,0 +1,238 @@
+package observability
+
+import (
+	"time"
+)
+
+// pairedMeter binds a field of a section of a paired file to the description
+// of a meter of it.
+type pairedMeter struct {
+	section, field string
+	desc           MeterDescription
+	gauge          bool
+}
+
+// netSNMPMeters are the meters of /proc/net/snmp. Counters of the rarer ICMP
+// message types, and the constants of the Ip and Tcp sections, are omitted.
+var netSNMPMeters = []pairedMeter{
+	{section: "Ip", field: "InReceives", desc: DescribeMeter(
+		"/net/ip/datagrams_received",
+		"Number of IP datagrams received, including those received in error.",
+		Cumulative())},
+	{section: "Ip", field: "InHdrErrors", desc: DescribeMeter(
+		"/net/ip/header_errors",
+		"Number of IP datagrams discarded due to errors in their headers.",
+		Cumulative())},
+	{section: "Ip", field: "InAddrErrors", desc: DescribeMeter(
+		"/net/ip/address_errors",
+		"Number of IP datagrams discarded because their destination address "+
+			"was invalid for this host.",
+		Cumulative())},
+	{section: "Ip", field: "ForwDatagrams", desc: DescribeMeter(
+		"/net/ip/datagrams_forwarded",
+		"Number of IP datagrams forwarded to another host.",
+		Cumulative())},
+	{section: "Ip", field: "InDiscards", desc: DescribeMeter(
+		"/net/ip/datagrams_discarded",
+		"Number of IP datagrams received without error but discarded, for "+
+			"lack of buffer space, for example.",
+		Cumulative())},
+	{section: "Ip", field: "InDelivers", desc: DescribeMeter(
+		"/net/ip/datagrams_delivered",
+		"Number of IP datagrams delivered to transport protocols.",
+		Cumulative())},
+	{section: "Ip", field: "OutRequests", desc: DescribeMeter(
+		"/net/ip/datagrams_sent",
+		"Number of IP datagrams that transport protocols asked to send.",
+		Cumulative())},
+	{section: "Ip", field: "OutDiscards", desc: DescribeMeter(
+		"/net/ip/datagrams_not_sent",
+		"Number of outgoing IP datagrams discarded without error, for lack "+
+			"of buffer space, for example.",
+		Cumulative())},
+	{section: "Ip", field: "OutNoRoutes", desc: DescribeMeter(
+		"/net/ip/no_routes",
+		"Number of outgoing IP datagrams discarded because there was no "+
+			"route to their destination.",
+		Cumulative())},
+	{section: "Ip", field: "ReasmFails", desc: DescribeMeter(
+		"/net/ip/reassembly_failures",
+		"Number of failures to reassemble fragmented IP datagrams.",
+		Cumulative())},
+	{section: "Ip", field: "FragFails", desc: DescribeMeter(
+		"/net/ip/fragmentation_failures",
+		"Number of IP datagrams discarded because they needed to be "+
+			"fragmented but could not be.",
+		Cumulative())},
+	{section: "Icmp", field: "InMsgs", desc: DescribeMeter(
+		"/net/icmp/messages_received",
+		"Number of ICMP messages received, including those received in error.",
+		Cumulative())},
+	{section: "Icmp", field: "InErrors", desc: DescribeMeter(
+		"/net/icmp/receive_errors",
+		"Number of ICMP messages received with errors, such as bad checksums.",
+		Cumulative())},
+	{section: "Icmp", field: "InDestUnreachs", desc: DescribeMeter(
+		"/net/icmp/unreachables_received",
+		"Number of ICMP Destination Unreachable messages received.",
+		Cumulative())},
+	{section: "Icmp", field: "OutMsgs", desc: DescribeMeter(
+		"/net/icmp/messages_sent",
+		"Number of ICMP messages sent, including those not sent due to errors.",
+		Cumulative())},
+	{section: "Icmp", field: "OutErrors", desc: DescribeMeter(
+		"/net/icmp/send_errors",
+		"Number of ICMP messages not sent due to errors.",
+		Cumulative())},
+	{section: "Icmp", field: "OutDestUnreachs", desc: DescribeMeter(
+		"/net/icmp/unreachables_sent",
+		"Number of ICMP Destination Unreachable messages sent.",
+		Cumulative())},
+	{section: "Tcp", field: "ActiveOpens", desc: DescribeMeter(
+		"/net/tcp/active_opens",
+		"Number of TCP connections opened by this host.",
+		Cumulative())},
+	{section: "Tcp", field: "PassiveOpens", desc: DescribeMeter(
+		"/net/tcp/passive_opens",
+		"Number of TCP connections accepted by this host.",
+		Cumulative())},
+	{section: "Tcp", field: "AttemptFails", desc: DescribeMeter(
+		"/net/tcp/attempt_failures",
+		"Number of TCP connection attempts that failed before being "+
+			"established.",
+		Cumulative())},
+	{section: "Tcp", field: "EstabResets", desc: DescribeMeter(
+		"/net/tcp/established_resets",
+		"Number of established TCP connections that were reset.",
+		Cumulative())},
+	{section: "Tcp", field: "CurrEstab", gauge: true, desc: DescribeMeter(
+		"/net/tcp/established",
+		"Number of TCP connections that are established or being closed by "+
+			"the peer.")},
+	{section: "Tcp", field: "InSegs", desc: DescribeMeter(
+		"/net/tcp/segments_received",
+		"Number of TCP segments received, including those received in error.",
+		Cumulative())},
+	{section: "Tcp", field: "OutSegs", desc: DescribeMeter(
+		"/net/tcp/segments_sent",
+		"Number of TCP segments sent, excluding retransmissions.",
+		Cumulative())},
+	{section: "Tcp", field: "RetransSegs", desc: DescribeMeter(
+		"/net/tcp/segments_retransmitted",
+		"Number of TCP segments retransmitted. It can be used in conjunction "+
+			"with `/net/tcp/segments_sent` to calculate the retransmission "+
+			"rate.",
+		Cumulative())},
+	{section: "Tcp", field: "InErrs", desc: DescribeMeter(
+		"/net/tcp/receive_errors",
+		"Number of TCP segments received in error, such as with bad "+
+			"checksums.",
+		Cumulative())},
+	{section: "Tcp", field: "OutRsts", desc: DescribeMeter(
+		"/net/tcp/resets_sent",
+		"Number of TCP segments sent with the RST flag.",
+		Cumulative())},
+	{section: "Udp", field: "InDatagrams", desc: DescribeMeter(
+		"/net/udp/datagrams_received",
+		"Number of UDP datagrams delivered to sockets.",
+		Cumulative())},
+	{section: "Udp", field: "NoPorts", desc: DescribeMeter(
+		"/net/udp/no_ports",
+		"Number of UDP datagrams received for ports without a socket.",
+		Cumulative())},
+	{section: "Udp", field: "InErrors", desc: DescribeMeter(
+		"/net/udp/receive_errors",
+		"Number of UDP datagrams that could not be delivered, other than for "+
+			"lack of a socket, including for full receive buffers.",
+		Cumulative())},
+	{section: "Udp", field: "OutDatagrams", desc: DescribeMeter(
+		"/net/udp/datagrams_sent",
+		"Number of UDP datagrams sent.",
+		Cumulative())},
+	{section: "Udp", field: "RcvbufErrors", desc: DescribeMeter(
+		"/net/udp/receive_buffer_errors",
+		"Number of UDP datagrams dropped because the receive buffer of their "+
+			"socket was full.",
+		Cumulative())},
+	{section: "Udp", field: "SndbufErrors", desc: DescribeMeter(
+		"/net/udp/send_buffer_errors",
+		"Number of UDP datagrams not sent because the send buffer of their "+
+			"socket was full.",
+		Cumulative())},
+}
+
+// RegisterNetSNMPStats registers meters of the IP, ICMP, TCP, and UDP
+// protocols with o, sampled from /proc/net/snmp. Fields are found by name, so
+// there are meters for those the kernel provides at registration, wherever it
+// puts them. The file stays open for the life of the Origin.
+func RegisterNetSNMPStats(o *Origin) error {
+	return registerPairedMeters(o, "/proc/net/snmp", netSNMPMeters)
+}
+
+// registerPairedMeters registers the meters of the fields of the paired file
+// at path that are present at registration.
+func registerPairedMeters(o *Origin, path string, pms []pairedMeter) error {
+	type binding struct {
+		field string
+		m     Meter
+	}
+	bindings := make(map[string][]binding)
+	var ms []Meter
+	var sfs []sectionFunc
+	for _, pm := range pms {
+		if _, ok := bindings[pm.section]; !ok {
+			bindings[pm.section] = nil
+			section := pm.section
+			sfs = append(sfs, sectionFunc{name: []byte(section), f: func(p PairedFields) {
+				for _, pm := range pms {
+					if pm.section != section {
+						continue
+					}
+					if _, ok := p.Get(pm.field); !ok {
+						continue
+					}
+					var m Meter
+					if pm.gauge {
+						m = DefineGauge(pm.desc)
+					} else {
+						m = DefineCounter(pm.desc)
+					}
+					bindings[section] = append(bindings[section], binding{pm.field, m})
+					ms = append(ms, m)
+				}
+			}})
+		}
+	}
+	fs, err := NewFileScanner(path, NewPairedScanner(sfs))
+	if err != nil {
+		return err
+	}
+	err = fs.Scan()
+	fs.Close()
+	if err != nil {
+		return err
+	}
+
+	var now time.Time
+	sfs = sfs[:0]
+	for section, bs := range bindings {
+		if len(bs) == 0 {
+			continue
+		}
+		sfs = append(sfs, sectionFunc{name: []byte(section), f: func(p PairedFields) {
+			for _, b := range bs {
+				if v, ok := p.Get(b.field); ok {
+					b.m.SampleAt(now, naiveAtoi(v))
+				}
+			}
+		}})
+	}
+	if fs, err = NewFileScanner(path, NewPairedScanner(sfs)); err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		fs.Scan()
+	}, ms...)
+	return nil
+}
@@ -0,0 +1,110 @@
+package observability
+
+// netNetstatMeters are the meters of /proc/net/netstat, the extensions of the
+// counters of /proc/net/snmp. Of its hundreds of fields, these are the ones
+// that explain lost connections and slow transfers.
+var netNetstatMeters = []pairedMeter{
+	{section: "TcpExt", field: "ListenOverflows", desc: DescribeMeter(
+		"/net/tcp/listen_overflows",
+		"Number of times the accept queue of a listening TCP socket was "+
+			"full when a connection completed its handshake.",
+		Cumulative())},
+	{section: "TcpExt", field: "ListenDrops", desc: DescribeMeter(
+		"/net/tcp/listen_drops",
+		"Number of incoming TCP connection requests dropped by listening "+
+			"sockets, for any reason, including accept queue overflows.",
+		Cumulative())},
+	{section: "TcpExt", field: "TCPReqQFullDrop", desc: DescribeMeter(
+		"/net/tcp/syn_queue_drops",
+		"Number of incoming TCP connection requests dropped because the SYN "+
+			"queue was full and SYN cookies were disabled.",
+		Cumulative())},
+	{section: "TcpExt", field: "SyncookiesSent", desc: DescribeMeter(
+		"/net/tcp/syncookies_sent",
+		"Number of SYN cookies sent because the SYN queue was full.",
+		Cumulative())},
+	{section: "TcpExt", field: "TCPSynRetrans", desc: DescribeMeter(
+		"/net/tcp/syn_retransmits",
+		"Number of retransmitted TCP SYN and SYN-ACK segments. They delay "+
+			"the establishment of connections by at least a second.",
+		Cumulative())},
+	{section: "TcpExt", field: "TCPTimeouts", desc: DescribeMeter(
+		"/net/tcp/timeouts",
+		"Number of TCP retransmission timeouts, after which the congestion "+
+			"window collapses.",
+		Cumulative())},
+	{section: "TcpExt", field: "TCPFastRetrans", desc: DescribeMeter(
+		"/net/tcp/fast_retransmits",
+		"Number of TCP segments retransmitted by fast retransmission, "+
+			"without waiting for a timeout.",
+		Cumulative())},
+	{section: "TcpExt", field: "TCPLostRetransmit", desc: DescribeMeter(
+		"/net/tcp/lost_retransmits",
+		"Number of retransmitted TCP segments that were lost again.",
+		Cumulative())},
+	{section: "TcpExt", field: "TCPSpuriousRTOs", desc: DescribeMeter(
+		"/net/tcp/spurious_timeouts",
+		"Number of TCP retransmission timeouts found by F-RTO to have been "+
+			"unnecessary.",
+		Cumulative())},
+	{section: "TcpExt", field: "TCPOFOQueue", desc: DescribeMeter(
+		"/net/tcp/out_of_order_queued",
+		"Number of TCP segments received out of order and queued until the "+
+			"gap before them is filled.",
+		Cumulative())},
+	{section: "TcpExt", field: "TCPOFODrop", desc: DescribeMeter(
+		"/net/tcp/out_of_order_dropped",
+		"Number of TCP segments received out of order and dropped for lack "+
+			"of receive buffer space.",
+		Cumulative())},
+	{section: "TcpExt", field: "PruneCalled", desc: DescribeMeter(
+		"/net/tcp/prunes",
+		"Number of times the receive queue of a TCP socket was pruned to "+
+			"reclaim memory because the socket exceeded its receive buffer.",
+		Cumulative())},
+	{section: "TcpExt", field: "RcvPruned", desc: DescribeMeter(
+		"/net/tcp/prune_drops",
+		"Number of TCP segments dropped from receive queues because pruning "+
+			"did not reclaim enough memory.",
+		Cumulative())},
+	{section: "TcpExt", field: "TCPBacklogDrop", desc: DescribeMeter(
+		"/net/tcp/backlog_drops",
+		"Number of TCP segments dropped because the backlog of a socket "+
+			"locked by its owner was full.",
+		Cumulative())},
+	{section: "TcpExt", field: "TCPAbortOnTimeout", desc: DescribeMeter(
+		"/net/tcp/timeout_aborts",
+		"Number of TCP connections aborted after too many retransmission "+
+			"timeouts.",
+		Cumulative())},
+	{section: "TcpExt", field: "TCPAbortOnMemory", desc: DescribeMeter(
+		"/net/tcp/memory_aborts",
+		"Number of TCP connections aborted for lack of memory or because "+
+			"there were too many orphaned sockets.",
+		Cumulative())},
+	{section: "IpExt", field: "InOctets", desc: DescribeMeter(
+		"/net/ip/bytes_received",
+		"Number of bytes received in IP datagrams, including their headers.",
+		Cumulative(), Units("By"))},
+	{section: "IpExt", field: "OutOctets", desc: DescribeMeter(
+		"/net/ip/bytes_sent",
+		"Number of bytes sent in IP datagrams, including their headers.",
+		Cumulative(), Units("By"))},
+	{section: "IpExt", field: "InNoRoutes", desc: DescribeMeter(
+		"/net/ip/no_routes_received",
+		"Number of incoming IP datagrams discarded because there was no "+
+			"route to their destination.",
+		Cumulative())},
+	{section: "IpExt", field: "InCEPkts", desc: DescribeMeter(
+		"/net/ip/congestion_experienced",
+		"Number of IP datagrams received marked with ECN Congestion "+
+			"Experienced.",
+		Cumulative())},
+}
+
+// RegisterNetNetstatStats registers meters of the extended TCP and IP
+// counters with o, sampled from /proc/net/netstat, as RegisterNetSNMPStats
+// does for /proc/net/snmp.
+func RegisterNetNetstatStats(o *Origin) error {
+	return registerPairedMeters(o, "/proc/net/netstat", netNetstatMeters)
+}
@@ -0,0 +1,232 @@
+package observability
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	nfsClientCallsDesc = DescribeMeter(
+		"/nfs/client/rpc/calls",
+		"Number of RPC calls made by the NFS client.",
+		Cumulative())
+	nfsClientRetransmissionsDesc = DescribeMeter(
+		"/nfs/client/rpc/retransmissions",
+		"Number of RPC calls retransmitted by the NFS client because the "+
+			"server did not reply in time. It can be used in conjunction "+
+			"with `/nfs/client/rpc/calls` to calculate the retransmission "+
+			"rate, which shows an overloaded server or a lossy network.",
+		Cumulative())
+	nfsClientAuthRefreshesDesc = DescribeMeter(
+		"/nfs/client/rpc/auth_refreshes",
+		"Number of times the NFS client refreshed its RPC credentials.",
+		Cumulative())
+	nfsClientOperationsDesc = DescribeMeter(
+		"/nfs/client/operations",
+		"Number of NFS operations of each type made by the client, by "+
+			"protocol version.",
+		Cumulative())
+	nfsServerCallsDesc = DescribeMeter(
+		"/nfs/server/rpc/calls",
+		"Number of RPC calls received by the NFS server.",
+		Cumulative())
+	nfsServerBadCallsDesc = DescribeMeter(
+		"/nfs/server/rpc/bad_calls",
+		"Number of RPC calls rejected by the NFS server, because they were "+
+			"malformed or failed authentication.",
+		Cumulative())
+	nfsServerCacheHitsDesc = DescribeMeter(
+		"/nfs/server/reply_cache/hits",
+		"Number of retransmitted calls answered from the reply cache of the "+
+			"NFS server.",
+		Cumulative())
+	nfsServerCacheMissesDesc = DescribeMeter(
+		"/nfs/server/reply_cache/misses",
+		"Number of calls to the NFS server that could be cached but were not "+
+			"in the reply cache.",
+		Cumulative())
+	nfsServerCacheUncachedDesc = DescribeMeter(
+		"/nfs/server/reply_cache/uncached",
+		"Number of calls to the NFS server that are idempotent, and so "+
+			"bypass the reply cache.",
+		Cumulative())
+	nfsServerBytesReadDesc = DescribeMeter(
+		"/nfs/server/bytes_read",
+		"Number of bytes read from disk by the NFS server for its clients.",
+		Cumulative(), Units("By"))
+	nfsServerBytesWrittenDesc = DescribeMeter(
+		"/nfs/server/bytes_written",
+		"Number of bytes written to disk by the NFS server for its clients.",
+		Cumulative(), Units("By"))
+	nfsServerOperationsDesc = DescribeMeter(
+		"/nfs/server/operations",
+		"Number of NFS operations of each type served, by protocol "+
+			"version. For NFSv4, these are the operations within compound "+
+			"calls.",
+		Cumulative())
+)
+
+// The names of the operations counted by the procN lines of /proc/net/rpc/nfs
+// and nfsd, in order. Those of NFSv2 and NFSv3 are the procedures of their
+// RFCs, and those of the NFSv4 server, on the proc4ops line, are the operation
+// numbers of RFC 7862 and 8276. Those of the NFSv4 client follow the kernel's
+// own numbering. Operations past the end of a list are labeled with their
+// numbers.
+var (
+	nfsV2Ops = []string{"null", "getattr", "setattr", "root", "lookup",
+		"readlink", "read", "wrcache", "write", "create", "remove", "rename",
+		"link", "symlink", "mkdir", "rmdir", "readdir", "fsstat"}
+	nfsV3Ops = []string{"null", "getattr", "setattr", "lookup", "access",
+		"readlink", "read", "write", "create", "mkdir", "symlink", "mknod",
+		"remove", "rmdir", "rename", "link", "readdir", "readdirplus",
+		"fsstat", "fsinfo", "pathconf", "commit"}
+	nfsV4ClientOps = []string{"null", "read", "write", "commit", "open",
+		"open_confirm", "open_noattr", "open_downgrade", "close", "setattr",
+		"fsinfo", "renew", "setclientid", "setclientid_confirm", "lock",
+		"lockt", "locku", "access", "getattr", "lookup", "lookup_root",
+		"remove", "rename", "link", "symlink", "create", "pathconf", "statfs",
+		"readlink", "readdir", "server_caps", "delegreturn", "getacl",
+		"setacl", "fs_locations", "release_lockowner", "secinfo",
+		"fsid_present", "exchange_id", "create_session", "destroy_session",
+		"sequence", "get_lease_time", "reclaim_complete", "layoutget",
+		"getdeviceinfo", "layoutcommit", "layoutreturn", "secinfo_no_name",
+		"test_stateid", "free_stateid", "getdevicelist",
+		"bind_conn_to_session", "destroy_clientid", "seek", "allocate",
+		"deallocate", "layoutstats", "clone", "copy", "offload_cancel",
+		"lookupp", "layouterror", "copy_notify", "getxattr", "setxattr",
+		"listxattrs", "removexattr", "read_plus"}
+	nfsV4ServerOps = []string{"", "", "", "access", "close", "commit",
+		"create", "delegpurge", "delegreturn", "getattr", "getfh", "link",
+		"lock", "lockt", "locku", "lookup", "lookupp", "nverify", "open",
+		"openattr", "open_confirm", "open_downgrade", "putfh", "putpubfh",
+		"putrootfh", "read", "readdir", "readlink", "remove", "rename",
+		"renew", "restorefh", "savefh", "secinfo", "setattr", "setclientid",
+		"setclientid_confirm", "verify", "write", "release_lockowner",
+		"backchannel_ctl", "bind_conn_to_session", "exchange_id",
+		"create_session", "destroy_session", "free_stateid",
+		"get_dir_delegation", "getdeviceinfo", "getdevicelist",
+		"layoutcommit", "layoutget", "layoutreturn", "secinfo_no_name",
+		"sequence", "set_ssv", "test_stateid", "want_delegation",
+		"destroy_clientid", "reclaim_complete", "allocate", "copy",
+		"copy_notify", "deallocate", "io_advise", "layouterror",
+		"layoutstats", "offload_cancel", "offload_status", "read_plus",
+		"seek", "write_same", "clone", "getxattr", "setxattr", "listxattrs",
+		"removexattr"}
+)
+
+// RegisterNFSClientStats registers meters of the RPC calls and operations of
+// the NFS client with o, sampled from /proc/net/rpc/nfs, which exists once
+// the nfs module is loaded. The operation meters are labeled with the
+// protocol version and the operation, for the versions the client supports at
+// registration. The file stays open for the life of the Origin.
+func RegisterNFSClientStats(o *Origin) error {
+	return registerNFSStats(o, "/proc/net/rpc/nfs", false)
+}
+
+// RegisterNFSServerStats registers meters of the RPC calls, reply cache,
+// disk traffic, and operations of the NFS server with o, sampled from
+// /proc/net/rpc/nfsd, as RegisterNFSClientStats does for the client.
+func RegisterNFSServerStats(o *Origin) error {
+	return registerNFSStats(o, "/proc/net/rpc/nfsd", true)
+}
+
+func registerNFSStats(o *Origin, path string, server bool) error {
+	// The procN lines begin with the number of operations that follow.
+	// Discover the versions, and the number of operations of each.
+	versions := make(map[string]int)
+	discover := NewUnorderedBufferScanner(nil, []lineFunc{{
+		name: []byte("proc"),
+		prefixed: func(suffix []byte, fields [][]byte) {
+			versions[string(suffix)] = len(fields) - 1
+		},
+	}})
+	fs, err := NewFileScanner(path, discover)
+	if err != nil {
+		return err
+	}
+	err = fs.Scan()
+	fs.Close()
+	if err != nil {
+		return err
+	}
+
+	opsDesc := nfsClientOperationsDesc
+	names := map[string][]string{"2": nfsV2Ops, "3": nfsV3Ops, "4": nfsV4ClientOps}
+	if server {
+		// The proc4 line of the server only counts the null and compound
+		// calls; the operations within them are on the proc4ops line.
+		opsDesc = nfsServerOperationsDesc
+		names = map[string][]string{"2": nfsV2Ops, "3": nfsV3Ops, "4ops": nfsV4ServerOps}
+	}
+	var ms []Meter
+	ops := make(map[string][]Meter)
+	for suffix, n := range versions {
+		opNames, ok := names[suffix]
+		if !ok {
+			continue
+		}
+		version := strings.TrimSuffix(suffix, "ops")
+		for i := range n {
+			name := strconv.Itoa(i)
+			if i < len(opNames) && opNames[i] != "" {
+				name = opNames[i]
+			}
+			m := DefineCounter(opsDesc, Label{Key: "version", Value: version}, Label{Key: "op", Value: name})
+			ops[suffix] = append(ops[suffix], m)
+			ms = append(ms, m)
+		}
+	}
+
+	var now time.Time
+	// sampleFields returns a function that samples the meters from the
+	// fields of a line in order.
+	sampleFields := func(meters ...Meter) func([][]byte) {
+		ms = append(ms, meters...)
+		return func(fields [][]byte) {
+			for i, m := range meters[:min(len(meters), len(fields))] {
+				m.SampleAt(now, naiveAtoi(fields[i]))
+			}
+		}
+	}
+	lfs := []lineFunc{{
+		name: []byte("proc"),
+		prefixed: func(suffix []byte, fields [][]byte) {
+			// The conversion doesn't allocate.
+			meters, ok := ops[string(suffix)]
+			if !ok {
+				return
+			}
+			fields = fields[1:]
+			for i, m := range meters[:min(len(meters), len(fields))] {
+				m.SampleAt(now, naiveAtoi(fields[i]))
+			}
+		},
+	}}
+	if server {
+		lfs = append(lfs,
+			lineFunc{name: []byte("rpc"), f: sampleFields(
+				DefineCounter(nfsServerCallsDesc),
+				DefineCounter(nfsServerBadCallsDesc))},
+			lineFunc{name: []byte("rc"), f: sampleFields(
+				DefineCounter(nfsServerCacheHitsDesc),
+				DefineCounter(nfsServerCacheMissesDesc),
+				DefineCounter(nfsServerCacheUncachedDesc))},
+			lineFunc{name: []byte("io"), f: sampleFields(
+				DefineCounter(nfsServerBytesReadDesc),
+				DefineCounter(nfsServerBytesWrittenDesc))})
+	} else {
+		lfs = append(lfs, lineFunc{name: []byte("rpc"), f: sampleFields(
+			DefineCounter(nfsClientCallsDesc),
+			DefineCounter(nfsClientRetransmissionsDesc),
+			DefineCounter(nfsClientAuthRefreshesDesc))})
+	}
+	if fs, err = NewFileScanner(path, NewUnorderedBufferScanner(nil, lfs)); err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		fs.Scan()
+	}, ms...)
+	return nil
+}
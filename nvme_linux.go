@@ -0,0 +1,241 @@
+package observability
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	nvmeCriticalWarningDesc = DescribeMeter(
+		"/nvme/critical_warning",
+		"Critical warnings of each NVMe controller, as a bitmask: 1 for "+
+			"available spare below its threshold, 2 for temperature beyond "+
+			"a threshold, 4 for reliability degraded by media errors, 8 for "+
+			"read-only media, and 16 for a failed volatile memory backup. "+
+			"Anything but 0 needs attention.")
+	nvmeTemperatureDesc = DescribeMeter(
+		"/nvme/temperature",
+		"Composite temperature of each NVMe controller.",
+		Units("K"))
+	nvmeAvailableSpareDesc = DescribeMeter(
+		"/nvme/available_spare",
+		"Remaining spare capacity of each NVMe controller, as a percentage "+
+			"of the original.",
+		Units("%"))
+	nvmeAvailableSpareThresholdDesc = DescribeMeter(
+		"/nvme/available_spare_threshold",
+		"Available spare of each NVMe controller below which it raises a "+
+			"critical warning.",
+		Units("%"))
+	nvmePercentageUsedDesc = DescribeMeter(
+		"/nvme/percentage_used",
+		"Estimate by each NVMe controller of the percentage of its rated "+
+			"endurance that has been used. It may exceed 100.",
+		Units("%"))
+	nvmeBytesReadDesc = DescribeMeter(
+		"/nvme/bytes_read",
+		"Number of bytes read from each NVMe controller by the host, "+
+			"counted by the controller in data units of 1000 512-byte "+
+			"blocks.",
+		Cumulative(), Units("By"))
+	nvmeBytesWrittenDesc = DescribeMeter(
+		"/nvme/bytes_written",
+		"Number of bytes written to each NVMe controller by the host, "+
+			"counted by the controller in data units of 1000 512-byte "+
+			"blocks. It wears the media.",
+		Cumulative(), Units("By"))
+	nvmePowerCyclesDesc = DescribeMeter(
+		"/nvme/power_cycles",
+		"Number of power cycles of each NVMe controller.",
+		Cumulative())
+	nvmePowerOnHoursDesc = DescribeMeter(
+		"/nvme/power_on_hours",
+		"Time each NVMe controller has been powered on.",
+		Cumulative(), Units("h"))
+	nvmeUnsafeShutdownsDesc = DescribeMeter(
+		"/nvme/unsafe_shutdowns",
+		"Number of times each NVMe controller lost power without being "+
+			"notified of the shutdown first.",
+		Cumulative())
+	nvmeMediaErrorsDesc = DescribeMeter(
+		"/nvme/media_errors",
+		"Number of unrecovered data integrity errors detected by each NVMe "+
+			"controller.",
+		Cumulative())
+	nvmeErrorLogEntriesDesc = DescribeMeter(
+		"/nvme/error_log_entries",
+		"Number of entries added to the error log of each NVMe controller.",
+		Cumulative())
+)
+
+// The offsets of the fields of the SMART / Health Information log page, and
+// their scales. The counters are 128-bit little-endian integers, of which
+// only the low 64 bits are used.
+var nvmeSMARTFields = []struct {
+	desc   MeterDescription
+	offset int
+	size   int
+	scale  uint64
+}{
+	{nvmeCriticalWarningDesc, 0, 1, 1},
+	{nvmeTemperatureDesc, 1, 2, 1},
+	{nvmeAvailableSpareDesc, 3, 1, 1},
+	{nvmeAvailableSpareThresholdDesc, 4, 1, 1},
+	{nvmePercentageUsedDesc, 5, 1, 1},
+	{nvmeBytesReadDesc, 32, 8, 512000},
+	{nvmeBytesWrittenDesc, 48, 8, 512000},
+	{nvmePowerCyclesDesc, 112, 8, 1},
+	{nvmePowerOnHoursDesc, 128, 8, 1},
+	{nvmeUnsafeShutdownsDesc, 144, 8, 1},
+	{nvmeMediaErrorsDesc, 160, 8, 1},
+	{nvmeErrorLogEntriesDesc, 176, 8, 1},
+}
+
+const (
+	// nvmeIoctlAdminCmd is NVME_IOCTL_ADMIN_CMD, _IOWR('N', 0x41, struct
+	// nvme_admin_cmd).
+	nvmeIoctlAdminCmd = 0xc0484e41
+	nvmeGetLogPage    = 0x02
+	nvmeLogSMART      = 0x02
+	nvmeSMARTLogSize  = 512
+)
+
+// nvmeAdminCmd is struct nvme_admin_cmd of linux/nvme_ioctl.h.
+type nvmeAdminCmd struct {
+	opcode      uint8
+	flags       uint8
+	rsvd1       uint16
+	nsid        uint32
+	cdw2        uint32
+	cdw3        uint32
+	metadata    uint64
+	addr        uint64
+	metadataLen uint32
+	dataLen     uint32
+	cdw10       uint32
+	cdw11       uint32
+	cdw12       uint32
+	cdw13       uint32
+	cdw14       uint32
+	cdw15       uint32
+	timeoutMs   uint32
+	result      uint32
+}
+
+// nvmeController is an open NVMe controller, and the meters of its SMART
+// log.
+type nvmeController struct {
+	f      *os.File
+	log    [nvmeSMARTLogSize]byte
+	meters []Meter
+}
+
+// readSMARTLog reads the SMART / Health Information log page of the
+// controller with the Get Log Page admin command.
+func (c *nvmeController) readSMARTLog() error {
+	cmd := nvmeAdminCmd{
+		opcode: nvmeGetLogPage,
+		// The log page is for the controller, not a namespace.
+		nsid:    0xffffffff,
+		addr:    uint64(uintptr(unsafe.Pointer(&c.log[0]))),
+		dataLen: nvmeSMARTLogSize,
+		// The number of dwords to read, less one, and the log page.
+		cdw10: (nvmeSMARTLogSize/4-1)<<16 | nvmeLogSMART,
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, c.f.Fd(), nvmeIoctlAdminCmd, uintptr(unsafe.Pointer(&cmd)))
+	runtime.KeepAlive(c)
+	if errno != 0 {
+		return os.NewSyscallError("ioctl", errno)
+	}
+	return nil
+}
+
+// sampleSMARTLog samples the meters from the log page.
+func (c *nvmeController) sampleSMARTLog(now time.Time) {
+	for i, f := range nvmeSMARTFields {
+		b := c.log[f.offset : f.offset+f.size]
+		var v uint64
+		switch f.size {
+		case 1:
+			v = uint64(b[0])
+		case 2:
+			v = uint64(binary.LittleEndian.Uint16(b))
+		default:
+			v = binary.LittleEndian.Uint64(b)
+		}
+		c.meters[i].SampleAt(now, v*f.scale)
+	}
+}
+
+// RegisterNVMeStats registers meters of the SMART / Health Information log of
+// each NVMe controller with o, such as its wear, spare capacity, temperature,
+// media errors, and unsafe shutdowns, which sysfs mostly lacks. The log is read
+// with an admin command, which requires CAP_SYS_ADMIN, so this fails
+// otherwise. The meters are labeled with the controller name, such as nvme0,
+// and its model and serial number. The controllers are those present at
+// registration, and their device files stay open for the life of the Origin.
+// Reading the log costs a command to each controller, so it is best collected
+// at a long interval.
+func RegisterNVMeStats(o *Origin) error {
+	return registerNVMeStats(o, "/sys/class/nvme", "/dev")
+}
+
+func registerNVMeStats(o *Origin, class, dev string) error {
+	controllers, err := os.ReadDir(class)
+	if err != nil {
+		return err
+	}
+	// Every controller is opened before any is registered, so that o is
+	// left untouched if one can't be.
+	var cs []*nvmeController
+	fail := func(err error) error {
+		for _, c := range cs {
+			c.f.Close()
+		}
+		return err
+	}
+	for _, d := range controllers {
+		name := d.Name()
+		model, err := readSysfsString(filepath.Join(class, name, "model"))
+		if err != nil {
+			return fail(err)
+		}
+		serial, err := readSysfsString(filepath.Join(class, name, "serial"))
+		if err != nil {
+			return fail(err)
+		}
+		f, err := os.Open(filepath.Join(dev, name))
+		if err != nil {
+			return fail(err)
+		}
+		c := &nvmeController{f: f}
+		cs = append(cs, c)
+		labels := []Label{
+			{Key: "controller", Value: name},
+			{Key: "model", Value: model},
+			{Key: "serial", Value: serial},
+		}
+		for _, field := range nvmeSMARTFields {
+			if field.desc.Cumulative() {
+				c.meters = append(c.meters, DefineCounter(field.desc, labels...))
+			} else {
+				c.meters = append(c.meters, DefineGauge(field.desc, labels...))
+			}
+		}
+	}
+	for _, c := range cs {
+		o.RegisterFunction(func() {
+			// If the log can't be read, the meters keep their old
+			// sample times, which shows that they are stale.
+			if c.readSMARTLog() == nil {
+				c.sampleSMARTLog(time.Now())
+			}
+		}, c.meters...)
+	}
+	return nil
+}
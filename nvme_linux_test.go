@@ -0,0 +1,76 @@
+package observability
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestNVMeSMARTLog(t *testing.T) {
+	// The size is encoded in the ioctl number.
+	if size := unsafe.Sizeof(nvmeAdminCmd{}); size != nvmeIoctlAdminCmd>>16&0x3fff {
+		t.Fatalf("nvmeAdminCmd is %d bytes", size)
+	}
+	o := NewOrigin()
+	c := &nvmeController{}
+	for _, f := range nvmeSMARTFields {
+		if f.desc.Cumulative() {
+			c.meters = append(c.meters, DefineCounter(f.desc))
+		} else {
+			c.meters = append(c.meters, DefineGauge(f.desc))
+		}
+	}
+	o.RegisterFunction(func() {}, c.meters...)
+	c.log[0] = 0x04
+	binary.LittleEndian.PutUint16(c.log[1:], 310)
+	c.log[3], c.log[4], c.log[5] = 100, 10, 3
+	binary.LittleEndian.PutUint64(c.log[32:], 21339210)
+	binary.LittleEndian.PutUint64(c.log[48:], 32718903)
+	// The high half of a 128-bit counter is ignored.
+	binary.LittleEndian.PutUint64(c.log[56:], 1)
+	binary.LittleEndian.PutUint64(c.log[128:], 12044)
+	binary.LittleEndian.PutUint64(c.log[144:], 71)
+	binary.LittleEndian.PutUint64(c.log[160:], 2)
+	c.sampleSMARTLog(time.Now())
+	checkValues(t, sampleValues(o), map[string]uint64{
+		"/nvme/critical_warning":          4,
+		"/nvme/temperature":               310,
+		"/nvme/available_spare":           100,
+		"/nvme/available_spare_threshold": 10,
+		"/nvme/percentage_used":           3,
+		"/nvme/bytes_read":                21339210 * 512000,
+		"/nvme/bytes_written":             32718903 * 512000,
+		"/nvme/power_on_hours":            12044,
+		"/nvme/unsafe_shutdowns":          71,
+		"/nvme/media_errors":              2,
+		"/nvme/error_log_entries":         0,
+	})
+}
+
+func TestNVMeStatsOpenFailure(t *testing.T) {
+	class, dev := t.TempDir(), t.TempDir()
+	for _, name := range []string{"nvme0", "nvme1"} {
+		if err := os.Mkdir(filepath.Join(class, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, attr := range []string{"model", "serial"} {
+			if err := os.WriteFile(filepath.Join(class, name, attr), []byte("x\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// nvme1 has no device, so nothing is registered.
+	if err := os.WriteFile(filepath.Join(dev, "nvme0"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	o := NewOrigin()
+	if err := registerNVMeStats(o, class, dev); err == nil {
+		t.Fatal("registerNVMeStats succeeded without a device")
+	}
+	if n := len(o.Snapshot().Samples); n != 0 {
+		t.Errorf("got %d samples, want 0", n)
+	}
+}
@@ -0,0 +1,130 @@
+package observability
+
+import (
+	"bytes"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	oomKillsDesc = DescribeMeter(
+		"/memory/oom_kills",
+		"Number of processes killed by the OOM killer, of the system or of "+
+			"a cgroup.",
+		Cumulative())
+	oomTaskKillsDesc = DescribeMeter(
+		"/memory/oom_task_kills",
+		"Number of processes with the name of the task label, in the cgroup "+
+			"of the cgroup label, killed by the OOM killer since it first "+
+			"killed one of them.",
+		Cumulative())
+)
+
+// oomKillMaxTasks bounds the number of distinct tasks and cgroups whose kills
+// are counted separately, since their names are arbitrary. The kills of
+// others are only counted by /memory/oom_kills.
+const oomKillMaxTasks = 256
+
+// oomKills counts the OOM kills logged by the kernel by task and cgroup, and
+// adds a child of its Origin for each.
+type oomKills struct {
+	o *Origin
+	// tasks holds the kills of each task and cgroup, separated by a NUL.
+	tasks map[string]*atomic.Uint64
+	// task and cgroup are those of the last oom-kill line, until the kill
+	// that follows it.
+	task, cgroup []byte
+}
+
+// oomKillField returns the value of the given key in the fields of an
+// oom-kill line, such as "constraint=CONSTRAINT_MEMCG,...,task=java,pid=41".
+func oomKillField(fields, key []byte) []byte {
+	for len(fields) > 0 {
+		var field []byte
+		field, fields, _ = bytes.Cut(fields, []byte(","))
+		if k, v, ok := bytes.Cut(field, []byte("=")); ok && bytes.Equal(k, key) {
+			return v
+		}
+	}
+	return nil
+}
+
+// record counts the kill in a record of the kernel log, if any. Since Linux
+// 4.19, each kill is logged with a line like "oom-kill:...,task_memcg=/a.slice,
+// task=java,pid=4120,uid=1000", which is followed by "Out of memory: Killed
+// process 4120 (java) ...". Before then, only the latter is, so the cgroup is
+// not known.
+func (k *oomKills) record(_ uint64, text []byte) {
+	if fields, ok := bytes.CutPrefix(text, []byte("oom-kill:")); ok {
+		k.task = append(k.task[:0], oomKillField(fields, []byte("task"))...)
+		k.cgroup = append(k.cgroup[:0], oomKillField(fields, []byte("task_memcg"))...)
+		return
+	}
+	_, rest, ok := bytes.Cut(text, []byte("Killed process "))
+	if !ok {
+		return
+	}
+	if len(k.task) == 0 {
+		// The name of the task follows the pid, in parentheses.
+		if _, comm, ok := bytes.Cut(rest, []byte(" (")); ok {
+			if i := bytes.LastIndexByte(comm, ')'); i >= 0 {
+				k.task = append(k.task[:0], comm[:i]...)
+			}
+		}
+	}
+	key := string(k.task) + "\x00" + string(k.cgroup)
+	n, ok := k.tasks[key]
+	if !ok && len(k.tasks) < oomKillMaxTasks {
+		n = new(atomic.Uint64)
+		k.tasks[key] = n
+		c := k.o.NewChild(Label{Key: "task", Value: string(k.task)}, Label{Key: "cgroup", Value: string(k.cgroup)})
+		m := DefineCounter(oomTaskKillsDesc)
+		c.RegisterFunction(func() { m.SampleAt(time.Now(), n.Load()) }, m)
+	}
+	if n != nil {
+		n.Add(1)
+	}
+	k.task, k.cgroup = k.task[:0], k.cgroup[:0]
+}
+
+// RegisterOOMKillStats registers a meter of the processes killed by the OOM
+// killer with o, sampled from /proc/vmstat, and counts the kills of each task
+// and cgroup from the messages of the kernel log in /dev/kmsg, so that the
+// workloads being killed are known. For each task name and cgroup whose
+// processes are killed after registration, a child of o with the task and
+// cgroup as its identity is added, with a meter of their kills. Reading
+// /dev/kmsg needs CAP_SYSLOG if kernel.dmesg_restrict is set. The files stay
+// open for the life of the Origin.
+func RegisterOOMKillStats(o *Origin) error {
+	r, err := openKmsg("/dev/kmsg")
+	if err != nil {
+		return err
+	}
+	if err := registerOOMKillStats(o, "/proc/vmstat", r); err != nil {
+		r.Close()
+		return err
+	}
+	return nil
+}
+
+func registerOOMKillStats(o *Origin, vmstat string, r *kmsgReader) error {
+	var now time.Time
+	kills := DefineCounter(oomKillsDesc)
+	fs, err := NewFileScanner(vmstat, NewUnorderedBufferScanner(nil, []lineFunc{{
+		name:    []byte("oom_kill"),
+		nfields: 1,
+		f:       func(fields [][]byte) { kills.SampleAt(now, naiveAtoi(fields[0])) },
+	}}))
+	if err != nil {
+		return err
+	}
+	k := &oomKills{o: o, tasks: make(map[string]*atomic.Uint64)}
+	r.f = k.record
+	o.RegisterFunction(func() {
+		now = time.Now()
+		fs.Scan()
+		// The children sample the counts when they are exported, after o.
+		r.read()
+	}, kills)
+	return nil
+}
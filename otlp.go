@@ -0,0 +1,320 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strings"
+	"sync"
+)
+
+// This file maps Snapshots onto the OpenTelemetry metrics data model, as
+// defined by opentelemetry/proto/metrics/v1/metrics.proto, and encodes the
+// result. The mapping is shared by the OTLP/gRPC and OTLP/HTTP transports.
+// Origin identity becomes resource attributes, and meter labels become data
+// point attributes. Cumulative meters become monotonic sums, with cumulative or
+// delta temporality as the exporter is configured, starting at the sample's
+// Reset time. All other meters become gauges.
+
+// otlpScopeName is the instrumentation scope reported with every metric.
+const otlpScopeName = "github.com/jwbee/observability"
+
+// AggregationTemporality values from metrics.proto.
+const (
+	otlpTemporalityDelta      = 1
+	otlpTemporalityCumulative = 2
+)
+
+type otlpExportRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	// Exactly one of Gauge or Sum is set.
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+// The OTLP JSON encoding represents 64-bit integers as decimal strings.
+type otlpNumberDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano uint64         `json:"startTimeUnixNano,omitempty,string"`
+	TimeUnixNano      uint64         `json:"timeUnixNano,string"`
+	// Exactly one of AsInt or AsDouble is set. Values that don't fit in
+	// an int64 are sent as doubles.
+	AsInt    *int64   `json:"asInt,omitempty,string"`
+	AsDouble *float64 `json:"asDouble,omitempty"`
+}
+
+// otlpMetricName converts a meter name to an OpenTelemetry instrument name,
+// which must begin with a letter.
+func otlpMetricName(name string) string {
+	return strings.TrimLeft(name, "/")
+}
+
+func otlpAttributes(labels []Label) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, len(labels))
+	for i, l := range labels {
+		kvs[i] = otlpKeyValue{Key: l.Key, Value: otlpAnyValue{StringValue: l.Value}}
+	}
+	return kvs
+}
+
+func otlpDataPoint(s Sample) otlpNumberDataPoint {
+	dp := otlpNumberDataPoint{TimeUnixNano: uint64(s.Time.UnixNano())}
+	if len(s.Labels) > 0 {
+		dp.Attributes = otlpAttributes(s.Labels)
+	}
+	if s.Description.Cumulative() {
+		dp.StartTimeUnixNano = uint64(s.Reset.UnixNano())
+	}
+	if s.Value <= math.MaxInt64 {
+		v := int64(s.Value)
+		dp.AsInt = &v
+	} else {
+		v := float64(s.Value)
+		dp.AsDouble = &v
+	}
+	return dp
+}
+
+// newOTLPRequest maps the snapshots onto an export request. Meters that have
+// never been sampled are omitted.
+func newOTLPRequest(snaps []Snapshot, t Temporality) otlpExportRequest {
+	temporality := otlpTemporalityCumulative
+	if t == DeltaTemporality {
+		temporality = otlpTemporalityDelta
+	}
+	req := otlpExportRequest{
+		ResourceMetrics: make([]otlpResourceMetrics, 0, len(snaps)),
+	}
+	for _, snap := range snaps {
+		metrics := make([]otlpMetric, 0, len(snap.Samples))
+		byName := make(map[string]int, len(snap.Samples))
+		for _, s := range snap.Samples {
+			if s.Time.IsZero() {
+				continue
+			}
+			name := s.Description.Name()
+			i, ok := byName[name]
+			if !ok {
+				m := otlpMetric{
+					Name:        otlpMetricName(name),
+					Description: s.Description.Explanation(),
+					Unit:        s.Description.Units(),
+				}
+				if s.Description.Cumulative() {
+					m.Sum = &otlpSum{
+						AggregationTemporality: temporality,
+						IsMonotonic:            true,
+					}
+				} else {
+					m.Gauge = &otlpGauge{}
+				}
+				i = len(metrics)
+				byName[name] = i
+				metrics = append(metrics, m)
+			}
+			m := &metrics[i]
+			if m.Sum != nil {
+				m.Sum.DataPoints = append(m.Sum.DataPoints, otlpDataPoint(s))
+			} else {
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, otlpDataPoint(s))
+			}
+		}
+		req.ResourceMetrics = append(req.ResourceMetrics, otlpResourceMetrics{
+			Resource: otlpResource{Attributes: otlpAttributes(snap.Origin)},
+			ScopeMetrics: []otlpScopeMetrics{{
+				Scope:   otlpScope{Name: otlpScopeName},
+				Metrics: metrics,
+			}},
+		})
+	}
+	return req
+}
+
+// appendOTLPProto appends the protobuf encoding of the request.
+func appendOTLPProto(b []byte, req *otlpExportRequest) []byte {
+	return req.appendProto(b)
+}
+
+// appendOTLPJSON appends the OTLP JSON encoding of the request.
+func appendOTLPJSON(b []byte, req *otlpExportRequest) []byte {
+	j, err := json.Marshal(req)
+	if err != nil {
+		// The request contains only strings and numbers.
+		panic(err)
+	}
+	return append(b, j...)
+}
+
+// The appendProto methods encode the messages in the protobuf wire format.
+// Field numbers are from metrics.proto, common.proto, resource.proto, and
+// metrics_service.proto.
+
+func (r *otlpExportRequest) appendProto(b []byte) []byte {
+	for i := range r.ResourceMetrics {
+		b = appendMessageField(b, 1, r.ResourceMetrics[i].appendProto)
+	}
+	return b
+}
+
+func (r *otlpResourceMetrics) appendProto(b []byte) []byte {
+	b = appendMessageField(b, 1, r.Resource.appendProto)
+	for i := range r.ScopeMetrics {
+		b = appendMessageField(b, 2, r.ScopeMetrics[i].appendProto)
+	}
+	return b
+}
+
+func (r *otlpResource) appendProto(b []byte) []byte {
+	for i := range r.Attributes {
+		b = appendMessageField(b, 1, r.Attributes[i].appendProto)
+	}
+	return b
+}
+
+func (kv *otlpKeyValue) appendProto(b []byte) []byte {
+	b = appendStringField(b, 1, kv.Key)
+	return appendMessageField(b, 2, kv.Value.appendProto)
+}
+
+func (v *otlpAnyValue) appendProto(b []byte) []byte {
+	// The oneof must be present even when the string is empty, so this
+	// doesn't use appendStringField.
+	b = appendTag(b, 1, wireBytes)
+	b = appendVarint(b, uint64(len(v.StringValue)))
+	return append(b, v.StringValue...)
+}
+
+func (sm *otlpScopeMetrics) appendProto(b []byte) []byte {
+	b = appendMessageField(b, 1, sm.Scope.appendProto)
+	for i := range sm.Metrics {
+		b = appendMessageField(b, 2, sm.Metrics[i].appendProto)
+	}
+	return b
+}
+
+func (s *otlpScope) appendProto(b []byte) []byte {
+	return appendStringField(b, 1, s.Name)
+}
+
+func (m *otlpMetric) appendProto(b []byte) []byte {
+	b = appendStringField(b, 1, m.Name)
+	b = appendStringField(b, 2, m.Description)
+	b = appendStringField(b, 3, m.Unit)
+	switch {
+	case m.Gauge != nil:
+		b = appendMessageField(b, 5, m.Gauge.appendProto)
+	case m.Sum != nil:
+		b = appendMessageField(b, 7, m.Sum.appendProto)
+	}
+	return b
+}
+
+func (g *otlpGauge) appendProto(b []byte) []byte {
+	for i := range g.DataPoints {
+		b = appendMessageField(b, 1, g.DataPoints[i].appendProto)
+	}
+	return b
+}
+
+func (s *otlpSum) appendProto(b []byte) []byte {
+	for i := range s.DataPoints {
+		b = appendMessageField(b, 1, s.DataPoints[i].appendProto)
+	}
+	b = appendVarintField(b, 2, uint64(s.AggregationTemporality))
+	return appendBoolField(b, 3, s.IsMonotonic)
+}
+
+func (dp *otlpNumberDataPoint) appendProto(b []byte) []byte {
+	b = appendFixed64Field(b, 2, dp.StartTimeUnixNano)
+	b = appendFixed64Field(b, 3, dp.TimeUnixNano)
+	for i := range dp.Attributes {
+		b = appendMessageField(b, 7, dp.Attributes[i].appendProto)
+	}
+	// Like the oneof above, the value must be present even when zero.
+	switch {
+	case dp.AsDouble != nil:
+		b = appendTag(b, 4, wireFixed64)
+		b = appendFixed64(b, math.Float64bits(*dp.AsDouble))
+	case dp.AsInt != nil:
+		b = appendTag(b, 6, wireFixed64)
+		b = appendFixed64(b, uint64(*dp.AsInt))
+	}
+	return b
+}
+
+// OTLPExporter pushes the meters of one or more Origins to an OpenTelemetry
+// collector. Each Origin becomes one resource.
+type OTLPExporter struct {
+	cfg     exportConfig
+	origins []*Origin
+	encode  func([]byte, *otlpExportRequest) []byte
+	send    func(ctx context.Context, msg []byte) error
+
+	// mu protects buf, which is reused across pushes.
+	mu  sync.Mutex
+	buf []byte
+}
+
+// Push takes a snapshot of every Origin and sends it to the collector. Large
+// Origins are sent in several requests; see ExportChunkSize.
+func (e *OTLPExporter) Push(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.cfg.collect(e.origins, func(_ int, snap Snapshot) error {
+		req := newOTLPRequest([]Snapshot{snap}, e.cfg.temporality)
+		if len(req.ResourceMetrics[0].ScopeMetrics[0].Metrics) == 0 {
+			return nil
+		}
+		e.buf = e.encode(e.buf[:0], &req)
+		return e.send(ctx, e.buf)
+	})
+}
+
+// Run pushes periodically until the context is done. Failed pushes are
+// reported to the function set with ExportErrors, and do not stop the loop.
+func (e *OTLPExporter) Run(ctx context.Context) error {
+	return runPeriodically(ctx, e.cfg, e.Push)
+}
@@ -0,0 +1,128 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testReadsDesc = DescribeMeter("/test/reads", "Reads.", Cumulative())
+
+func newTestOrigin() *Origin {
+	o := NewOrigin(Label{Key: "host.name", Value: "alice"})
+	m := DefineCounter(testReadsDesc)
+	o.RegisterFunction(func() { m.SampleAt(time.Now(), 42) }, m)
+	return o
+}
+
+func TestOTLPGRPCExporter(t *testing.T) {
+	var got []byte
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != otlpGRPCMethod {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+			t.Errorf("bad length prefix on %d byte body", len(body))
+			return
+		}
+		got = body[5:]
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}))
+	var protos http.Protocols
+	protos.SetUnencryptedHTTP2(true)
+	srv.Config.Protocols = &protos
+	srv.Start()
+	defer srv.Close()
+
+	e, err := NewOTLPGRPCExporter(strings.TrimPrefix(srv.URL, "http://"), []*Origin{newTestOrigin()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"host.name", "alice", "test/reads", "Reads.", otlpScopeName} {
+		if !bytes.Contains(got, []byte(want)) {
+			t.Errorf("request does not contain %q", want)
+		}
+	}
+}
+
+func TestOTLPGRPCExporterStatus(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Grpc-Status", "14")
+		w.Header().Set("Grpc-Message", "no%20way")
+	}))
+	var protos http.Protocols
+	protos.SetUnencryptedHTTP2(true)
+	srv.Config.Protocols = &protos
+	srv.Start()
+	defer srv.Close()
+
+	e, err := NewOTLPGRPCExporter(srv.URL, []*Origin{newTestOrigin()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = e.Push(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "status 14: no way") {
+		t.Errorf("Push() = %v, want status 14", err)
+	}
+}
+
+func TestAppendMessageField(t *testing.T) {
+	long := strings.Repeat("x", 200)
+	b := appendMessageField(nil, 1, func(b []byte) []byte {
+		return appendStringField(b, 2, long)
+	})
+	// tag, two byte length, tag, two byte length, payload
+	if len(b) != 1+2+1+2+len(long) || b[1] != 0xcb || b[2] != 0x01 {
+		t.Errorf("appendMessageField = % x", b[:6])
+	}
+}
+
+func TestOTLPHTTPExporter(t *testing.T) {
+	for _, tc := range []struct {
+		opts        []ExportOption
+		contentType string
+		want        []string
+	}{
+		{nil, "application/x-protobuf", []string{"alice", "test/reads"}},
+		{[]ExportOption{OTLPJSON()}, "application/json", []string{
+			`{"key":"host.name","value":{"stringValue":"alice"}}`,
+			`"name":"test/reads"`,
+			`"aggregationTemporality":2,"isMonotonic":true`,
+			`"asInt":"42"`,
+		}},
+	} {
+		var got []byte
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != otlpHTTPPath {
+				t.Errorf("path = %q", r.URL.Path)
+			}
+			if ct := r.Header.Get("Content-Type"); ct != tc.contentType {
+				t.Errorf("Content-Type = %q, want %q", ct, tc.contentType)
+			}
+			got, _ = io.ReadAll(r.Body)
+		}))
+		e, err := NewOTLPHTTPExporter(srv.URL, []*Origin{newTestOrigin()}, tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Push(context.Background()); err != nil {
+			t.Error(err)
+		}
+		srv.Close()
+		for _, want := range tc.want {
+			if !bytes.Contains(got, []byte(want)) {
+				t.Errorf("request %s does not contain %s", got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// otlpGRPCMethod is the path of the OTLP metrics export RPC.
+const otlpGRPCMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+
+// NewOTLPGRPCExporter returns an exporter that pushes to an OTLP/gRPC receiver
+// at the given target, such as "collector:4317". Targets without a scheme, or
+// with the "http" scheme, are dialed in cleartext; "https" targets use TLS.
+//
+// This speaks just enough gRPC to make unary calls over the standard
+// library's HTTP/2 client, so it does not require the grpc module.
+func NewOTLPGRPCExporter(target string, origins []*Origin, opts ...ExportOption) (*OTLPExporter, error) {
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	var protos http.Protocols
+	switch u.Scheme {
+	case "http":
+		protos.SetUnencryptedHTTP2(true)
+	case "https":
+		protos.SetHTTP2(true)
+	default:
+		return nil, fmt.Errorf("observability: unsupported OTLP/gRPC scheme %q", u.Scheme)
+	}
+	u.Path = otlpGRPCMethod
+	c := &otlpGRPCClient{
+		url: u.String(),
+		client: &http.Client{
+			Transport: &http.Transport{Protocols: &protos},
+		},
+	}
+	return &OTLPExporter{
+		cfg:     newExportConfig(opts),
+		origins: origins,
+		encode:  appendOTLPProto,
+		send:    c.send,
+	}, nil
+}
+
+type otlpGRPCClient struct {
+	url    string
+	client *http.Client
+}
+
+// send makes a unary gRPC call with the given encoded request message.
+func (c *otlpGRPCClient) send(ctx context.Context, msg []byte) error {
+	// Length-prefixed message: one byte compression flag (uncompressed),
+	// then the big-endian length.
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+	body := io.MultiReader(bytes.NewReader(prefix[:]), bytes.NewReader(msg))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(prefix) + len(msg))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// The response message is an ExportMetricsServiceResponse, which we
+	// don't need, but the body must be consumed to receive the trailers.
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("observability: OTLP/gRPC export: HTTP status %s", resp.Status)
+	}
+	return grpcStatus(resp)
+}
+
+// grpcStatus returns an error if the response carries a non-OK gRPC status.
+// Servers send the status in the trailers, or in the headers of a response
+// with no body.
+func grpcStatus(resp *http.Response) error {
+	h := resp.Trailer
+	if h.Get("Grpc-Status") == "" {
+		h = resp.Header
+	}
+	status := h.Get("Grpc-Status")
+	switch status {
+	case "0":
+		return nil
+	case "":
+		return fmt.Errorf("observability: OTLP/gRPC export: missing grpc-status")
+	}
+	msg, err := url.PathUnescape(h.Get("Grpc-Message"))
+	if err != nil {
+		msg = h.Get("Grpc-Message")
+	}
+	return fmt.Errorf("observability: OTLP/gRPC export: status %s: %s", status, msg)
+}
@@ -0,0 +1,73 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// otlpHTTPPath is the default path of the OTLP/HTTP metrics receiver.
+const otlpHTTPPath = "/v1/metrics"
+
+// NewOTLPHTTPExporter returns an exporter that pushes to an OTLP/HTTP receiver
+// at the given URL, such as "http://collector:4318". If the URL has no path,
+// the standard /v1/metrics is used. Requests are encoded as protobuf unless
+// the OTLPJSON option is given. This is useful where gRPC egress is blocked.
+func NewOTLPHTTPExporter(endpoint string, origins []*Origin, opts ...ExportOption) (*OTLPExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("observability: unsupported OTLP/HTTP scheme %q", u.Scheme)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpHTTPPath
+	}
+	cfg := newExportConfig(opts)
+	c := &otlpHTTPClient{
+		url:         u.String(),
+		contentType: "application/x-protobuf",
+		client:      &http.Client{},
+	}
+	encode := appendOTLPProto
+	if cfg.otlpJSON {
+		c.contentType = "application/json"
+		encode = appendOTLPJSON
+	}
+	return &OTLPExporter{
+		cfg:     cfg,
+		origins: origins,
+		encode:  encode,
+		send:    c.send,
+	}, nil
+}
+
+type otlpHTTPClient struct {
+	url         string
+	contentType string
+	client      *http.Client
+}
+
+func (c *otlpHTTPClient) send(ctx context.Context, msg []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(msg))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", c.contentType)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// The error response, if any, is a google.rpc.Status in the request
+	// encoding. Include a bounded amount of it in the error.
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("observability: OTLP/HTTP export: HTTP status %s: %q", resp.Status, body)
+	}
+	return nil
+}
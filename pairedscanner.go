@@ -0,0 +1,96 @@
+package observability
+
+import (
+	"bytes"
+)
+
+// PairedFields are the fields of one section of a paired file, whose values
+// are looked up by name. Like the fields passed to a lineFunc, they point into
+// temporary scratch space.
+type PairedFields struct {
+	names  [][]byte
+	values [][]byte
+}
+
+// Get returns the value of the named field, and whether there is such a
+// field.
+func (p PairedFields) Get(name string) ([]byte, bool) {
+	for i, n := range p.names {
+		if i < len(p.values) && string(n) == name {
+			return p.values[i], true
+		}
+	}
+	return nil, false
+}
+
+// Range calls f with the name and value of every field, in order.
+func (p PairedFields) Range(f func(name, value []byte)) {
+	for i := 0; i < len(p.names) && i < len(p.values); i++ {
+		f(p.names[i], p.values[i])
+	}
+}
+
+// sectionFunc associates the name of a section of a paired file with a
+// function, which is called with the fields of the section.
+type sectionFunc struct {
+	name []byte
+	f    func(PairedFields)
+}
+
+// PairedScanner scans files in which a line of field names is followed by a
+// line of their values, both beginning with the name of the section, such as
+// /proc/net/snmp and /proc/net/netstat:
+//
+//	Tcp: RtoAlgorithm RtoMin RtoMax MaxConn ActiveOpens ...
+//	Tcp: 1 200 120000 -1 4161 ...
+//
+// Fields are looked up by name rather than position, so fields added by newer
+// kernels don't disturb the callbacks, and fields missing from older ones can
+// be detected.
+type PairedScanner struct {
+	sectionFuncs []sectionFunc
+	// names and values are the scratch space for the fields of the two
+	// lines of a section.
+	names  [][]byte
+	values [][]byte
+}
+
+// NewPairedScanner creates a PairedScanner that calls the sectionFuncs, in any
+// order, for the sections that appear. Their names are the section names
+// without the colon, such as "Tcp".
+func NewPairedScanner(sectionFuncs []sectionFunc) *PairedScanner {
+	return &PairedScanner{sectionFuncs: sectionFuncs}
+}
+
+// Scan reads all of the lines in the given byte buffer, calling the
+// corresponding function for each section.
+func (ps *PairedScanner) Scan(b []byte) {
+	var line []byte
+	pending := false
+	for len(b) > 0 {
+		line, b = nextLine(b)
+		if !pending {
+			ps.names = asciiByteFields(line, ps.names[:0])
+			pending = len(ps.names) > 0
+			continue
+		}
+		ps.values = asciiByteFields(line, ps.values[:0])
+		if len(ps.values) == 0 {
+			continue
+		}
+		if !bytes.Equal(ps.values[0], ps.names[0]) {
+			// The previous line had no values; this one is
+			// the names of the next section.
+			ps.names, ps.values = ps.values, ps.names
+			continue
+		}
+		pending = false
+		section := bytes.TrimSuffix(ps.names[0], []byte(":"))
+		for _, sf := range ps.sectionFuncs {
+			if bytes.Equal(sf.name, section) {
+				sf.f(PairedFields{names: ps.names[1:], values: ps.values[1:]})
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package observability
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	powerSupplyOnlineDesc = DescribeMeter(
+		"/power_supply/online",
+		"Whether each external power supply, such as AC mains, is "+
+			"connected, 1, or not, 0.")
+	powerSupplyCapacityDesc = DescribeMeter(
+		"/power_supply/capacity",
+		"Charge of each battery, as a percentage of its full charge.",
+		Units("%"))
+	powerSupplyChargeDesc = DescribeMeter(
+		"/power_supply/charge",
+		"Charge of each battery, for batteries that report charge rather "+
+			"than energy.",
+		Units("uA.h"))
+	powerSupplyChargeFullDesc = DescribeMeter(
+		"/power_supply/charge_full",
+		"Charge of each battery when full. It falls as the battery wears, "+
+			"below `/power_supply/charge_full_design`.",
+		Units("uA.h"))
+	powerSupplyChargeFullDesignDesc = DescribeMeter(
+		"/power_supply/charge_full_design",
+		"Charge of each battery when full, as designed.",
+		Units("uA.h"))
+	powerSupplyEnergyDesc = DescribeMeter(
+		"/power_supply/energy",
+		"Energy stored in each battery, for batteries that report energy "+
+			"rather than charge.",
+		Units("uW.h"))
+	powerSupplyEnergyFullDesc = DescribeMeter(
+		"/power_supply/energy_full",
+		"Energy stored in each battery when full. It falls as the battery "+
+			"wears, below `/power_supply/energy_full_design`.",
+		Units("uW.h"))
+	powerSupplyEnergyFullDesignDesc = DescribeMeter(
+		"/power_supply/energy_full_design",
+		"Energy stored in each battery when full, as designed.",
+		Units("uW.h"))
+	powerSupplyVoltageDesc = DescribeMeter(
+		"/power_supply/voltage",
+		"Voltage of each power supply.",
+		Units("uV"))
+	powerSupplyCurrentDesc = DescribeMeter(
+		"/power_supply/current",
+		"Current drawn from each power supply. Drivers that report it as "+
+			"negative while discharging are not sampled then.",
+		Units("uA"))
+	powerSupplyPowerDesc = DescribeMeter(
+		"/power_supply/power",
+		"Power drawn from each power supply.",
+		Units("uW"))
+	powerSupplyStatusDesc = DescribeMeter(
+		"/power_supply/status",
+		"Whether each battery is in each status, 1, or not, 0: Charging, "+
+			"Discharging, Not charging, Full, or Unknown.")
+)
+
+// powerSupplyValues are the files of each power supply that hold a value, and
+// the descriptions of their meters. Each power supply has only some of them.
+var powerSupplyValues = []struct {
+	name string
+	desc MeterDescription
+}{
+	{"online", powerSupplyOnlineDesc},
+	{"capacity", powerSupplyCapacityDesc},
+	{"charge_now", powerSupplyChargeDesc},
+	{"charge_full", powerSupplyChargeFullDesc},
+	{"charge_full_design", powerSupplyChargeFullDesignDesc},
+	{"energy_now", powerSupplyEnergyDesc},
+	{"energy_full", powerSupplyEnergyFullDesc},
+	{"energy_full_design", powerSupplyEnergyFullDesignDesc},
+	{"voltage_now", powerSupplyVoltageDesc},
+	{"current_now", powerSupplyCurrentDesc},
+	{"power_now", powerSupplyPowerDesc},
+}
+
+// powerSupplyStatuses are the values of the status file of a battery.
+var powerSupplyStatuses = []string{"Unknown", "Charging", "Discharging", "Not charging", "Full"}
+
+// RegisterPowerSupplyStats registers meters of the batteries and external
+// power supplies in /sys/class/power_supply with o, such as whether AC power
+// is connected, and the charge, status, and voltage of batteries, for laptops
+// and edge devices. The meters are labeled with the name of the power supply,
+// such as BAT0, and its type, such as Battery or Mains. They are those of the
+// power supplies, and their values, present at registration. The files stay
+// open for the life of the Origin.
+func RegisterPowerSupplyStats(o *Origin) error {
+	return registerPowerSupplyStats(o, "/sys/class/power_supply")
+}
+
+func registerPowerSupplyStats(o *Origin, dir string) error {
+	supplies, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, s := range supplies {
+		path := filepath.Join(dir, s.Name())
+		typ, err := readSysfsString(filepath.Join(path, "type"))
+		if err != nil {
+			return err
+		}
+		labels := []Label{{Key: "supply", Value: s.Name()}, {Key: "type", Value: typ}}
+		for _, v := range powerSupplyValues {
+			err := RegisterSysfsMeter(o, filepath.Join(path, v.name), DefineGauge(v.desc, labels...))
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		err = registerPowerSupplyStatus(o, filepath.Join(path, "status"), labels)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func registerPowerSupplyStatus(o *Origin, path string, labels []Label) error {
+	status, err := OpenSysfsValue(path)
+	if err != nil {
+		return err
+	}
+	ms := make([]Meter, len(powerSupplyStatuses))
+	for i, s := range powerSupplyStatuses {
+		ms[i] = DefineGauge(powerSupplyStatusDesc, append(labels[:len(labels):len(labels)], Label{Key: "status", Value: s})...)
+	}
+	o.RegisterFunction(func() {
+		b, err := status.Bytes()
+		if err != nil {
+			return
+		}
+		now := time.Now()
+		for i, s := range powerSupplyStatuses {
+			var v uint64
+			// The conversion doesn't allocate.
+			if string(b) == s {
+				v = 1
+			}
+			ms[i].SampleAt(now, v)
+		}
+	}, ms...)
+	return nil
+}
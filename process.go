@@ -0,0 +1,146 @@
+package observability
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var (
+	processCPUTimeDesc = DescribeMeter(
+		"/process/cpu_time",
+		"CPU time consumed by the process in each mode, user or system, in "+
+			"hundredths of a second (USER_HZ jiffies).",
+		Cumulative(), Units("cs"))
+	processPageFaultsDesc = DescribeMeter(
+		"/process/page_faults",
+		"Number of minor page faults incurred by the process, which didn't "+
+			"require I/O.",
+		Cumulative())
+	processMajorPageFaultsDesc = DescribeMeter(
+		"/process/major_page_faults",
+		"Number of major page faults incurred by the process, which "+
+			"required I/O.",
+		Cumulative())
+	processResidentDesc = DescribeMeter(
+		"/process/resident",
+		"Resident memory of the process, RSS, which counts shared pages in "+
+			"full.",
+		Units("By"))
+	processVirtualDesc = DescribeMeter(
+		"/process/virtual",
+		"Virtual memory size of the process.",
+		Units("By"))
+	processThreadsDesc = DescribeMeter(
+		"/process/threads",
+		"Number of threads of the process.")
+	processStartTimeDesc = DescribeMeter(
+		"/process/start_time",
+		"Time at which the process started, as a Unix time.",
+		Units("s"))
+	processPriorityDesc = DescribeMeter(
+		"/process/priority",
+		"Scheduling priority of the process, its nice value plus 20 for "+
+			"normal processes, so that lower values are favored. Real-time "+
+			"processes, whose priorities are negative, are not sampled.")
+)
+
+// The fields of /proc/<pid>/stat, counting from 0, with the command name, in
+// parentheses, as field 1.
+const (
+	processStatMinorFaults = 9
+	processStatMajorFaults = 11
+	processStatUserTime    = 13
+	processStatSystemTime  = 14
+	processStatPriority    = 17
+	processStatThreads     = 19
+	processStatStartTime   = 21
+	processStatVirtual     = 22
+	processStatResident    = 23
+)
+
+// userHZ is the frequency of the clock ticks of the times in /proc, USER_HZ,
+// which is 100 on every architecture.
+const userHZ = 100
+
+var errNoBootTime = errors.New("observability: no btime in /proc/stat")
+
+// bootTime returns the boot time in the stat file at path, as a Unix time.
+func bootTime(path string) (uint64, error) {
+	var btime uint64
+	found := false
+	fs, err := NewFileScanner(path, NewUnorderedBufferScanner(nil, []lineFunc{{
+		name:    []byte("btime"),
+		nfields: 1,
+		f:       func(fields [][]byte) { btime, found = naiveAtoi(fields[0]), true },
+	}}))
+	if err != nil {
+		return 0, err
+	}
+	defer fs.Close()
+	if err := fs.Scan(); err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, errNoBootTime
+	}
+	return btime, nil
+}
+
+// RegisterProcessStats registers meters of the process with the given PID
+// with o, sampled from /proc/<pid>/stat: its CPU time, page faults, memory
+// size, threads, start time, and scheduling priority. The meters are
+// unlabeled, so each process needs an Origin of its own, whose identity
+// distinguishes it from other processes, including ones that later reuse its
+// PID. Once the process exits, the meters keep their last samples. The file
+// stays open for the life of the Origin.
+func RegisterProcessStats(o *Origin, pid int) error {
+	_, err := registerProcessStats(o, "/proc", strconv.Itoa(pid))
+	return err
+}
+
+func registerProcessStats(o *Origin, proc, pid string) (io.Closer, error) {
+	btime, err := bootTime(filepath.Join(proc, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	pageSize := uint64(os.Getpagesize())
+	var (
+		user        = DefineCounter(processCPUTimeDesc, Label{Key: "mode", Value: "user"})
+		system      = DefineCounter(processCPUTimeDesc, Label{Key: "mode", Value: "system"})
+		minorFaults = DefineCounter(processPageFaultsDesc)
+		majorFaults = DefineCounter(processMajorPageFaultsDesc)
+		resident    = DefineGauge(processResidentDesc)
+		virtual     = DefineGauge(processVirtualDesc)
+		threads     = DefineGauge(processThreadsDesc)
+		startTime   = DefineGauge(processStartTimeDesc)
+		priority    = DefineGauge(processPriorityDesc)
+	)
+	var now time.Time
+	rs := NewRowScanner(func(fields [][]byte) {
+		user.SampleAt(now, naiveAtoi(fields[processStatUserTime]))
+		system.SampleAt(now, naiveAtoi(fields[processStatSystemTime]))
+		minorFaults.SampleAt(now, naiveAtoi(fields[processStatMinorFaults]))
+		majorFaults.SampleAt(now, naiveAtoi(fields[processStatMajorFaults]))
+		resident.SampleAt(now, naiveAtoi(fields[processStatResident])*pageSize)
+		virtual.SampleAt(now, naiveAtoi(fields[processStatVirtual]))
+		threads.SampleAt(now, naiveAtoi(fields[processStatThreads]))
+		startTime.SampleAt(now, btime+naiveAtoi(fields[processStatStartTime])/userHZ)
+		if p := fields[processStatPriority]; p[0] != '-' {
+			priority.SampleAt(now, naiveAtoi(p))
+		}
+	}, minFields(processStatResident+1))
+	rs.SetParenthesized(true)
+	fs, err := NewFileScanner(filepath.Join(proc, pid, "stat"), rs)
+	if err != nil {
+		return nil, err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		fs.Scan()
+	}, user, system, minorFaults, majorFaults, resident, virtual, threads, startTime, priority)
+	return fs, nil
+}
@@ -0,0 +1,110 @@
+package observability
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var (
+	processOpenFDsDesc = DescribeMeter(
+		"/process/fds/open",
+		"Number of file descriptors the process has open.")
+	processFDSoftLimitDesc = DescribeMeter(
+		"/process/fds/soft_limit",
+		"Maximum number of file descriptors the process may open, "+
+			"RLIMIT_NOFILE, beyond which open(2) and similar system calls "+
+			"fail with EMFILE. It is not sampled if there is no limit.")
+	processFDHardLimitDesc = DescribeMeter(
+		"/process/fds/hard_limit",
+		"Maximum to which the process may raise `/process/fds/soft_limit` "+
+			"without privileges.")
+	processFDUtilizationDesc = DescribeMeter(
+		"/process/fds/utilization",
+		"Open file descriptors of the process as a percentage of "+
+			"`/process/fds/soft_limit`, rounded down. A steady rise is a "+
+			"file descriptor leak.",
+		Units("%"))
+)
+
+// The fields of the open files line of /proc/<pid>/limits, as in
+// "Max open files 1024 524288 files".
+const (
+	processLimitsSoft = 3
+	processLimitsHard = 4
+)
+
+// RegisterProcessFDStats registers meters of the file descriptors of the
+// process with the given PID with o: the number it has open, from
+// /proc/<pid>/fd, its soft and hard limits, from /proc/<pid>/limits, and the
+// percentage of the soft limit in use. The meters are unlabeled, as those of
+// RegisterProcessStats. Counting the open file descriptors requires the
+// permission to ptrace the process, and takes time in proportion to their
+// number. The limits file stays open for the life of the Origin.
+func RegisterProcessFDStats(o *Origin, pid int) error {
+	_, err := registerProcessFDStats(o, filepath.Join("/proc", strconv.Itoa(pid)))
+	return err
+}
+
+// countDirEntries returns the number of entries in the directory at path.
+func countDirEntries(path string) (uint64, error) {
+	d, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer d.Close()
+	var n uint64
+	for {
+		names, err := d.Readdirnames(256)
+		n += uint64(len(names))
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func registerProcessFDStats(o *Origin, dir string) (io.Closer, error) {
+	var (
+		open        = DefineGauge(processOpenFDsDesc)
+		soft        = DefineGauge(processFDSoftLimitDesc)
+		hard        = DefineGauge(processFDHardLimitDesc)
+		utilization = DefineGauge(processFDUtilizationDesc)
+	)
+	var now time.Time
+	// The limits are "unlimited" or decimal numbers.
+	var softLimit uint64
+	limits, err := NewFileScanner(filepath.Join(dir, "limits"), NewRowScanner(func(fields [][]byte) {
+		softLimit = 0
+		if s := fields[processLimitsSoft]; s[0] != 'u' {
+			softLimit = naiveAtoi(s)
+			soft.SampleAt(now, softLimit)
+		}
+		if h := fields[processLimitsHard]; h[0] != 'u' {
+			hard.SampleAt(now, naiveAtoi(h))
+		}
+	}, minFields(processLimitsHard+1), fieldIn(1, "open"), fieldIn(2, "files")))
+	if err != nil {
+		return nil, err
+	}
+	fdDir := filepath.Join(dir, "fd")
+	o.RegisterFunction(func() {
+		now = time.Now()
+		if limits.Scan() != nil {
+			return
+		}
+		n, err := countDirEntries(fdDir)
+		if err != nil {
+			return
+		}
+		open.SampleAt(now, n)
+		if softLimit > 0 {
+			utilization.SampleAt(now, n*100/softLimit)
+		}
+	}, open, soft, hard, utilization)
+	return limits, nil
+}
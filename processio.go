@@ -0,0 +1,91 @@
+package observability
+
+import (
+	"io"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var (
+	processReadCharsDesc = DescribeMeter(
+		"/process/io/read_chars",
+		"Bytes read by the process with read(2) and similar system calls, "+
+			"whether from storage, the page cache, pipes, or sockets.",
+		Cumulative(), Units("By"))
+	processWriteCharsDesc = DescribeMeter(
+		"/process/io/write_chars",
+		"Bytes written by the process with write(2) and similar system "+
+			"calls, as `/process/io/read_chars`.",
+		Cumulative(), Units("By"))
+	processReadSyscallsDesc = DescribeMeter(
+		"/process/io/read_syscalls",
+		"Number of read(2) and similar system calls made by the process.",
+		Cumulative())
+	processWriteSyscallsDesc = DescribeMeter(
+		"/process/io/write_syscalls",
+		"Number of write(2) and similar system calls made by the process.",
+		Cumulative())
+	processReadBytesDesc = DescribeMeter(
+		"/process/io/read_bytes",
+		"Bytes that the process caused to be read from storage.",
+		Cumulative(), Units("By"))
+	processWriteBytesDesc = DescribeMeter(
+		"/process/io/write_bytes",
+		"Bytes that the process caused to be written to storage, counted "+
+			"when it dirties the page cache.",
+		Cumulative(), Units("By"))
+	processCancelledWriteBytesDesc = DescribeMeter(
+		"/process/io/cancelled_write_bytes",
+		"Bytes that the process dirtied but were never written to storage, "+
+			"such as those of a file truncated before writeback. They are "+
+			"counted in `/process/io/write_bytes`.",
+		Cumulative(), Units("By"))
+)
+
+// processIOValues are the keys of /proc/<pid>/io, and the descriptions of
+// their meters.
+var processIOValues = []struct {
+	name string
+	desc MeterDescription
+}{
+	{"rchar", processReadCharsDesc},
+	{"wchar", processWriteCharsDesc},
+	{"syscr", processReadSyscallsDesc},
+	{"syscw", processWriteSyscallsDesc},
+	{"read_bytes", processReadBytesDesc},
+	{"write_bytes", processWriteBytesDesc},
+	{"cancelled_write_bytes", processCancelledWriteBytesDesc},
+}
+
+// RegisterProcessIOStats registers meters of the I/O of the process with the
+// given PID with o, sampled from /proc/<pid>/io: the bytes and system calls of
+// all of its reads and writes, and the bytes of those that reached storage.
+// The meters are unlabeled, as those of RegisterProcessStats. Reading the file
+// requires the permission to ptrace the process, so processes of other users
+// are only sampled with CAP_SYS_PTRACE. The file stays open for the life of
+// the Origin.
+func RegisterProcessIOStats(o *Origin, pid int) error {
+	_, err := registerProcessIOStats(o, filepath.Join("/proc", strconv.Itoa(pid), "io"))
+	return err
+}
+
+func registerProcessIOStats(o *Origin, path string) (io.Closer, error) {
+	var now time.Time
+	var ms []Meter
+	var vfs []valueFunc
+	for _, v := range processIOValues {
+		m := DefineCounter(v.desc)
+		vfs = append(vfs, valueFunc{name: []byte(v.name), f: func(n uint64) { m.SampleAt(now, n) }})
+		ms = append(ms, m)
+	}
+	fs, err := NewFileScanner(path, NewKeyValueScanner(nil, vfs))
+	if err != nil {
+		return nil, err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		fs.Scan()
+	}, ms...)
+	return fs, nil
+}
@@ -0,0 +1,131 @@
+package observability
+
+import (
+	"time"
+)
+
+var (
+	cpuTimeDesc = DescribeMeter(
+		"/cpu/time",
+		"Time spent by all CPUs in each mode, in hundredths of a second (the "+
+			"USER_HZ jiffies of /proc/stat). Guest time is also counted "+
+			"as user time, and guest_nice as nice.",
+		Cumulative(), Units("cs"))
+	cpuTimeByCPUDesc = DescribeMeter(
+		"/cpu/time_by_cpu",
+		"Time spent by each CPU in each mode, as /cpu/time.",
+		Cumulative(), Units("cs"))
+	kernelInterruptsDesc = DescribeMeter(
+		"/kernel/interrupts",
+		"Number of interrupts serviced, including unnumbered architecture-"+
+			"specific ones.",
+		Cumulative())
+	kernelContextSwitchesDesc = DescribeMeter(
+		"/kernel/context_switches",
+		"Number of context switches.",
+		Cumulative())
+	kernelForksDesc = DescribeMeter(
+		"/kernel/forks",
+		"Number of processes and threads created.",
+		Cumulative())
+	kernelProcsRunningDesc = DescribeMeter(
+		"/kernel/procs_running",
+		"Number of threads that are running or ready to run.")
+	kernelProcsBlockedDesc = DescribeMeter(
+		"/kernel/procs_blocked",
+		"Number of threads blocked waiting for I/O to complete.")
+)
+
+// cpuModes are the modes of the CPU time fields of /proc/stat, in order.
+var cpuModes = []string{"user", "nice", "system", "idle", "iowait", "irq", "softirq", "steal", "guest", "guest_nice"}
+
+// RegisterCPUStats registers meters of CPU time and kernel activity with o,
+// sampled from /proc/stat. If perCPU is set, the time of each CPU is also
+// sampled, labeled with its number. That is len(cpuModes) meters per CPU, so
+// consider leaving it off for machines with hundreds of CPUs. The CPUs are
+// those online at registration; CPUs that come online later are not sampled.
+// The file stays open for the life of the Origin.
+func RegisterCPUStats(o *Origin, perCPU bool) error {
+	return registerCPUStats(o, "/proc/stat", perCPU)
+}
+
+func registerCPUStats(o *Origin, path string, perCPU bool) error {
+	var cpus []string
+	if perCPU {
+		// Find the CPUs that are online.
+		cpuLines := NewBufferScanner(nil, []lineFunc{{
+			name: []byte("cpu"),
+			prefixed: func(suffix []byte, _ [][]byte) {
+				cpus = append(cpus, string(suffix))
+			},
+		}})
+		fs, err := NewFileScanner(path, cpuLines)
+		if err != nil {
+			return err
+		}
+		err = fs.Scan()
+		fs.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	var ms []Meter
+	total := make([]Meter, len(cpuModes))
+	for i, mode := range cpuModes {
+		total[i] = DefineCounter(cpuTimeDesc, Label{Key: "mode", Value: mode})
+		ms = append(ms, total[i])
+	}
+	byCPU := make(map[string][]Meter, len(cpus))
+	for _, cpu := range cpus {
+		byCPU[cpu] = make([]Meter, len(cpuModes))
+		for i, mode := range cpuModes {
+			byCPU[cpu][i] = DefineCounter(cpuTimeByCPUDesc,
+				Label{Key: "cpu", Value: cpu}, Label{Key: "mode", Value: mode})
+			ms = append(ms, byCPU[cpu][i])
+		}
+	}
+	intr := DefineCounter(kernelInterruptsDesc)
+	ctxt := DefineCounter(kernelContextSwitchesDesc)
+	forks := DefineCounter(kernelForksDesc)
+	running := DefineGauge(kernelProcsRunningDesc)
+	blocked := DefineGauge(kernelProcsBlockedDesc)
+	ms = append(ms, intr, ctxt, forks, running, blocked)
+
+	var now time.Time
+	// sampleModes samples the fields of a cpu line. Older kernels have
+	// fewer of them.
+	sampleModes := func(meters []Meter, fields [][]byte) {
+		for i, f := range fields[:min(len(fields), len(meters))] {
+			meters[i].SampleAt(now, naiveAtoi(f))
+		}
+	}
+	sampleFirst := func(m Meter) func([][]byte) {
+		return func(fields [][]byte) { m.SampleAt(now, naiveAtoi(fields[0])) }
+	}
+	bs := NewBufferScanner(nil, []lineFunc{
+		{name: []byte("cpu"), f: func(fields [][]byte) { sampleModes(total, fields) }},
+		{name: []byte("cpu"), prefixed: func(suffix []byte, fields [][]byte) {
+			// The conversion doesn't allocate.
+			if meters, ok := byCPU[string(suffix)]; ok {
+				sampleModes(meters, fields)
+			}
+		}},
+		{name: []byte("intr"), f: sampleFirst(intr), mask: fieldMask(0)},
+		{name: []byte("ctxt"), f: sampleFirst(ctxt)},
+		{name: []byte("processes"), f: sampleFirst(forks)},
+		{name: []byte("procs_running"), f: sampleFirst(running)},
+		{name: []byte("procs_blocked"), f: sampleFirst(blocked)},
+	})
+	fs, err := NewFileScanner(path, bs)
+	if err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		// If the file can't be read, the meters keep their old sample
+		// times, which shows that they are stale.
+		fs.Scan()
+	}, ms...)
+	return nil
+}
@@ -0,0 +1,176 @@
+package observability
+
+import (
+	"bufio"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PrometheusHandler is an http.Handler that serves the meters of one or more
+// Origins in the Prometheus text exposition format, for scraping. Meter names
+// are converted to Prometheus metric names by replacing the path separators
+// and any other disallowed characters with underscores, so /xfs/reads becomes
+// xfs_reads. Cumulative meters are counters, with the conventional _total
+// suffix, and other meters are gauges. With DeltaTemporality, which Prometheus
+// doesn't expect, cumulative meters are gauges of their increase since the
+// previous scrape. Origin identity and meter labels become metric labels. The
+// Origins are merged into one response unless the handler is configured with
+// ExportPerOrigin. Responses are compressed when the scraper accepts it; see
+// RegisterCompression.
+type PrometheusHandler struct {
+	cfg     exportConfig
+	origins []*Origin
+	limit   *scrapeLimiter
+}
+
+// NewPrometheusHandler returns a PrometheusHandler for the given origins.
+func NewPrometheusHandler(origins []*Origin, opts ...ExportOption) *PrometheusHandler {
+	cfg := newExportConfig(opts)
+	return &PrometheusHandler{
+		cfg:     cfg,
+		origins: origins,
+		limit:   newScrapeLimiter(&cfg, "prometheus"),
+	}
+}
+
+// prometheusContentType is the content type of the text exposition format.
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// prometheusName converts a meter name to a valid Prometheus metric name.
+func prometheusName(name string, counter bool) string {
+	b := make([]byte, 0, len(name)+len("_total"))
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+		case c >= '0' && c <= '9' && len(b) > 0:
+		default:
+			if len(b) == 0 {
+				// Leading separators are dropped rather
+				// than becoming underscores.
+				continue
+			}
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	if counter && !strings.HasSuffix(string(b), "_total") {
+		b = append(b, "_total"...)
+	}
+	return string(b)
+}
+
+// prometheusLabelName converts a label key to a valid Prometheus label name.
+func prometheusLabelName(key string) string {
+	b := []byte(key)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var prometheusHelpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func appendPrometheusLabels(b []byte, first bool, labels []Label) []byte {
+	for _, l := range labels {
+		if first {
+			b = append(b, '{')
+			first = false
+		} else {
+			b = append(b, ',')
+		}
+		b = append(b, prometheusLabelName(l.Key)...)
+		b = append(b, `="`...)
+		b = append(b, prometheusLabelEscaper.Replace(l.Value)...)
+		b = append(b, '"')
+	}
+	return b
+}
+
+// appendPrometheusSample appends one sample line.
+func appendPrometheusSample(b []byte, name string, origin []Label, s *Sample) []byte {
+	b = append(b, name...)
+	b = appendPrometheusLabels(b, true, origin)
+	b = appendPrometheusLabels(b, len(origin) == 0, s.Labels)
+	if len(origin)+len(s.Labels) > 0 {
+		b = append(b, '}')
+	}
+	b = append(b, ' ')
+	b = strconv.AppendUint(b, s.Value, 10)
+	return append(b, '\n')
+}
+
+// appendPrometheusFamily appends the HELP and TYPE lines that precede the
+// samples of a metric.
+func appendPrometheusFamily(b []byte, name string, md *MeterDescription, counter bool) []byte {
+	b = append(b, "# HELP "...)
+	b = append(b, name...)
+	b = append(b, ' ')
+	b = append(b, prometheusHelpEscaper.Replace(md.Explanation())...)
+	b = append(b, "\n# TYPE "...)
+	b = append(b, name...)
+	if counter {
+		b = append(b, " counter\n"...)
+	} else {
+		b = append(b, " gauge\n"...)
+	}
+	return b
+}
+
+// ServeHTTP writes the samples a chunk at a time, rather than collecting them
+// all in memory, so it can serve arbitrarily many meters. As a consequence,
+// when several Origins have the same meter, the samples of that metric are not
+// contiguous. The HELP and TYPE lines are written only before the first of
+// them, which Prometheus accepts.
+func (h *PrometheusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, finish, ok := h.limit.begin(w, r)
+	if !ok {
+		return
+	}
+	defer finish()
+	origins, ok := h.cfg.selectOrigins(h.origins, w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", prometheusContentType)
+	body, done := compressResponse(w, r)
+	defer done()
+	bw := bufio.NewWriter(body)
+	defer bw.Flush()
+	var line []byte
+	// names maps meter names to metric names, and records which families
+	// have been introduced.
+	names := make(map[string]string)
+	h.cfg.collect(origins, func(_ int, snap Snapshot) error {
+		// Give up on a scrape that has run out of time, or whose
+		// client has gone away, leaving the response truncated.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for i := range snap.Samples {
+			s := &snap.Samples[i]
+			if s.Time.IsZero() {
+				continue
+			}
+			md := &s.Description
+			name, ok := names[md.Name()]
+			if !ok {
+				counter := md.Cumulative() && h.cfg.temporality == CumulativeTemporality
+				name = prometheusName(md.Name(), counter)
+				names[md.Name()] = name
+				line = appendPrometheusFamily(line[:0], name, md, counter)
+				bw.Write(line)
+			}
+			line = appendPrometheusSample(line[:0], name, snap.Origin, s)
+			bw.Write(line)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,159 @@
+package observability
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// This file contains just enough of the protocol buffers wire format to encode
+// the messages we export, without taking a dependency on the protobuf runtime
+// and its reflection machinery. Every function appends to and returns its
+// argument, in the style of strconv.AppendInt, so the caller can reuse one
+// buffer for every export. There is a correspondingly small decoder for the
+// formats we read back.
+
+// Wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func varintLen(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
+func appendTag(b []byte, field int, wire int) []byte {
+	return appendVarint(b, uint64(field)<<3|uint64(wire))
+}
+
+// appendVarintField appends a varint field, omitting it if it has the default
+// value of zero.
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireVarint)
+	return appendVarint(b, v)
+}
+
+func appendBoolField(b []byte, field int, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = appendTag(b, field, wireVarint)
+	return append(b, 1)
+}
+
+func appendFixed64(b []byte, v uint64) []byte {
+	return append(b,
+		byte(v), byte(v>>8), byte(v>>16), byte(v>>24),
+		byte(v>>32), byte(v>>40), byte(v>>48), byte(v>>56))
+}
+
+func appendFixed64Field(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireFixed64)
+	return appendFixed64(b, v)
+}
+
+func appendStringField(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = appendTag(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// appendMessageField appends an embedded message field whose contents are
+// produced by f. The contents are encoded in place and then shifted to make
+// room for the length prefix, which avoids a temporary buffer per message.
+func appendMessageField(b []byte, field int, f func([]byte) []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	start := len(b)
+	b = f(b)
+	n := len(b) - start
+	sz := varintLen(uint64(n))
+	for i := 0; i < sz; i++ {
+		b = append(b, 0)
+	}
+	copy(b[start+sz:], b[start:start+n])
+	appendVarint(b[start:start], uint64(n))
+	return b
+}
+
+var errProtoTruncated = errors.New("observability: truncated protobuf")
+
+func consumeVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * i)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, -1
+}
+
+// protoField is a single decoded field. Varint and fixed values are in u;
+// length-delimited values are in b, which aliases the input.
+type protoField struct {
+	num  int
+	wire int
+	u    uint64
+	b    []byte
+}
+
+// nextProtoField decodes the field at the start of b and returns the rest of
+// the input.
+func nextProtoField(b []byte) (protoField, []byte, error) {
+	tag, n := consumeVarint(b)
+	if n < 0 {
+		return protoField{}, nil, errProtoTruncated
+	}
+	b = b[n:]
+	f := protoField{num: int(tag >> 3), wire: int(tag & 7)}
+	switch f.wire {
+	case wireVarint:
+		if f.u, n = consumeVarint(b); n < 0 {
+			return f, nil, errProtoTruncated
+		}
+	case wireFixed64:
+		if n = 8; len(b) < n {
+			return f, nil, errProtoTruncated
+		}
+		f.u = binary.LittleEndian.Uint64(b)
+	case wireFixed32:
+		if n = 4; len(b) < n {
+			return f, nil, errProtoTruncated
+		}
+		f.u = uint64(binary.LittleEndian.Uint32(b))
+	case wireBytes:
+		l, m := consumeVarint(b)
+		if m < 0 || uint64(len(b)-m) < l {
+			return f, nil, errProtoTruncated
+		}
+		f.b = b[m : m+int(l)]
+		n = m + int(l)
+	default:
+		return f, nil, errors.New("observability: unsupported protobuf wire type")
+	}
+	return f, b[n:], nil
+}
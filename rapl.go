@@ -0,0 +1,89 @@
+package observability
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var raplEnergyDesc = DescribeMeter(
+	"/power/rapl/energy",
+	"Energy consumed by each RAPL domain, such as a CPU package, its cores, "+
+		"or its DRAM, as estimated by the processor. Its rate is the power "+
+		"draw of the domain. The domains of a package overlap: package "+
+		"energy includes core energy.",
+	Cumulative(), Units("uJ"))
+
+// raplZone extends the energy counter of a RAPL zone, which wraps at its
+// maximum range, often only 32 bits of microjoules, to 64 bits.
+type raplZone struct {
+	max   uint64 // The range of the counter, after which it wraps to 0.
+	last  uint64 // The last value read.
+	total uint64 // The energy accumulated since the first read.
+	read  bool   // Whether the counter has been read.
+}
+
+// sample accumulates a value of the counter, and returns the energy
+// accumulated, counted from the first value. A value less than the previous
+// one is taken to have wrapped once, so the counter must be read at least once
+// per range, which takes minutes even for a busy package.
+func (z *raplZone) sample(v uint64) uint64 {
+	switch {
+	case !z.read:
+		z.total, z.read = v, true
+	case v >= z.last:
+		z.total += v - z.last
+	default:
+		z.total += z.max - z.last + v
+	}
+	z.last = v
+	return z.total
+}
+
+// RegisterRAPLStats registers meters of the energy consumed by each RAPL
+// domain with o, sampled from /sys/class/powercap, so that the power draw of
+// the machine can be tracked. The meters are labeled with the zone, such as
+// 0:1, and the name of its domain, such as package-0 or dram, and are those of
+// the zones present at registration. The energy counters of the kernel wrap,
+// so they must be sampled at least every few minutes to be accurate. Since
+// Linux 5.10, they can only be read by root. The files stay open for the life
+// of the Origin.
+func RegisterRAPLStats(o *Origin) error {
+	return registerRAPLStats(o, "/sys/class/powercap")
+}
+
+func registerRAPLStats(o *Origin, dir string) error {
+	zones, err := filepath.Glob(filepath.Join(dir, "intel-rapl:*"))
+	if err != nil {
+		return err
+	}
+	for _, zone := range zones {
+		name, err := readSysfsString(filepath.Join(zone, "name"))
+		if err != nil {
+			return err
+		}
+		r, err := OpenSysfsValue(filepath.Join(zone, "max_energy_range_uj"))
+		if err != nil {
+			return err
+		}
+		z := &raplZone{}
+		z.max, err = r.Uint()
+		r.Close()
+		if err != nil {
+			return err
+		}
+		v, err := OpenSysfsValue(filepath.Join(zone, "energy_uj"))
+		if err != nil {
+			return err
+		}
+		m := DefineCounter(raplEnergyDesc,
+			Label{Key: "zone", Value: strings.TrimPrefix(filepath.Base(zone), "intel-rapl:")},
+			Label{Key: "domain", Value: name})
+		o.RegisterFunction(func() {
+			if n, err := v.Uint(); err == nil {
+				m.SampleAt(time.Now(), z.sample(n))
+			}
+		}, m)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package observability
+
+import (
+	"bytes"
+	"io"
+)
+
+// RedisInfoScanner scans the response of a Redis server to the INFO command,
+// which is made of sections of "key:value" lines:
+//
+//	# Server
+//	redis_version:7.2.4
+//	uptime_in_seconds:1203
+//
+//	# Keyspace
+//	db0:keys=1532,expires=12,avg_ttl=0
+//
+// The lineFuncs are named by key, and may be in any order, as the keys of the
+// sections differ between versions of Redis. A plain value is passed as the
+// only field. A compound value, a comma-separated list of name=value pairs, is
+// passed as its values in order, so the fields of db0 above are 1532, 12, and
+// 0. Section headers are skipped, since the keys are unique across sections.
+// A prefixed lineFunc named "db" is called for every database, with its number
+// as the suffix.
+//
+// It embeds a BufferScanner in unordered mode, so the lineFunc options, such as
+// masks and field counts, and methods, such as Hits and SetStrict, work as
+// usual, and a MeterScanner can be built on it with NewRedisMeterScanner.
+type RedisInfoScanner struct {
+	*BufferScanner
+	// value is scratch space for rewriting compound values.
+	value []byte
+}
+
+// NewRedisInfoScanner creates a RedisInfoScanner from the given buffer and
+// lineFuncs. See NewBufferScanner for the requirements of the buffer.
+func NewRedisInfoScanner(lineBuf []byte, lineFuncs []lineFunc) *RedisInfoScanner {
+	return &RedisInfoScanner{BufferScanner: NewUnorderedBufferScanner(lineBuf, lineFuncs)}
+}
+
+// Scan reads all of the lines in the given byte buffer, calling the lineFuncs
+// for the keys that appear.
+func (rs *RedisInfoScanner) Scan(b []byte) {
+	rs.borrow()
+	rs.begin()
+	var line []byte
+	for len(b) > 0 {
+		line, b = nextLine(b)
+		rs.scanLine(line)
+	}
+	rs.giveBack(0)
+}
+
+// ScanReader is like Scan, but reads the response from r. A response read from
+// a connection is a RESP bulk string, which must be unwrapped first, since
+// ScanReader reads r to the end.
+func (rs *RedisInfoScanner) ScanReader(r io.Reader) error {
+	rs.borrow()
+	rs.begin()
+	l := rs.readLines(r)
+	for l.Scan() {
+		rs.scanLine(l.Bytes())
+	}
+	rs.giveBack(l.longest)
+	return l.Err()
+}
+
+func (rs *RedisInfoScanner) scanLine(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) == 0 || line[0] == '#' {
+		return
+	}
+	key, value, ok := bytes.Cut(line, []byte{':'})
+	if !ok {
+		return
+	}
+	// The conversion doesn't allocate.
+	i, ok := rs.index[string(key)]
+	var suffix []byte
+	for j := 0; !ok && j < len(rs.prefixes); j++ {
+		i = rs.prefixes[j]
+		suffix, ok = rs.lineFuncs[i].match(key)
+	}
+	if !ok {
+		return
+	}
+	if bytes.IndexByte(value, '=') >= 0 {
+		rs.value = rs.value[:0]
+		var part []byte
+		for len(value) > 0 {
+			part, value, _ = bytes.Cut(value, []byte{','})
+			if j := bytes.IndexByte(part, '='); j >= 0 {
+				part = part[j+1:]
+			}
+			rs.value = append(append(rs.value, part...), ' ')
+		}
+		value = rs.value
+	}
+	rs.callHit(i, suffix, value)
+}
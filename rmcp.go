@@ -0,0 +1,454 @@
+package observability
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// The fields of RMCP and IPMI v2.0 RMCP+ packets used, from chapter 13 of the
+// IPMI v2.0 specification.
+const (
+	rmcpVersion              = 0x06
+	rmcpNoAck                = 0xff
+	rmcpClassIPMI            = 0x07
+	rmcpAuthTypeRMCPPlus     = 0x06
+	rmcpPayloadIPMI          = 0x00
+	rmcpPayloadOpenSession   = 0x10
+	rmcpPayloadOpenSessionOK = 0x11
+	rmcpPayloadRAKP1         = 0x12
+	rmcpPayloadRAKP2         = 0x13
+	rmcpPayloadRAKP3         = 0x14
+	rmcpPayloadRAKP4         = 0x15
+	rmcpPayloadEncrypted     = 0x80
+	rmcpPayloadAuthenticated = 0x40
+	rmcpHeaderSize           = 4
+	rmcpSessionHeaderSize    = 12
+	// rmcpAuthCodeSize is the size of the HMAC-SHA1-96 integrity check.
+	rmcpAuthCodeSize = 12
+	// rmcpPrivilegeUser is the privilege requested, which suffices for
+	// reading sensors. RAKP message 1 adds rmcpNameOnlyLookup, so that
+	// the user is looked up by name alone.
+	rmcpPrivilegeUser  = 0x02
+	rmcpNameOnlyLookup = 0x10
+	// rmcpSoftwareID is the address of the remote console in IPMI
+	// messages.
+	rmcpSoftwareID = 0x81
+	// rmcpMaxKeySize is the size of the keys of RAKP-HMAC-SHA1, to which
+	// passwords are padded.
+	rmcpMaxKeySize  = 20
+	rmcpMaxUserSize = 16
+	// rmcpTimeout bounds the wait for each response of a BMC, after which
+	// the request is sent again, up to rmcpRetries times.
+	rmcpTimeout = time.Second
+	rmcpRetries = 3
+)
+
+// DefaultIPMIPort is the port of RMCP, at which BMCs are read over the LAN.
+const DefaultIPMIPort = "623"
+
+var (
+	errRMCPMalformed = errors.New("observability: malformed RMCP+ packet")
+	errRMCPTimeout   = errors.New("observability: RMCP+ request timed out")
+	errRMCPAuth      = errors.New("observability: RMCP+ authentication failed")
+)
+
+// rmcpAlgorithms are the authentication, integrity, and confidentiality
+// payloads of the Open Session Request, proposing RAKP-HMAC-SHA1,
+// HMAC-SHA1-96, and AES-CBC-128, cipher suite 3.
+var rmcpAlgorithms = []byte{
+	0x00, 0, 0, 8, 0x01, 0, 0, 0,
+	0x01, 0, 0, 8, 0x01, 0, 0, 0,
+	0x02, 0, 0, 8, 0x01, 0, 0, 0,
+}
+
+// appendRMCPPacket appends an RMCP+ packet carrying the payload to b. If k1 is
+// not nil, the packet is authenticated with it, and if block is not nil, the
+// payload is encrypted with it.
+func appendRMCPPacket(b []byte, typ byte, id, seq uint32, payload, k1 []byte, block cipher.Block) []byte {
+	b = append(b, rmcpVersion, 0, rmcpNoAck, rmcpClassIPMI)
+	start := len(b)
+	if block != nil {
+		typ |= rmcpPayloadEncrypted
+	}
+	if k1 != nil {
+		typ |= rmcpPayloadAuthenticated
+	}
+	b = append(b, rmcpAuthTypeRMCPPlus, typ)
+	b = binary.LittleEndian.AppendUint32(b, id)
+	b = binary.LittleEndian.AppendUint32(b, seq)
+	lenAt := len(b)
+	b = append(b, 0, 0)
+	if block != nil {
+		// The payload is prefixed with its IV, and padded with 1, 2,
+		// 3, and so on, followed by the length of the padding, to a
+		// multiple of the block size.
+		iv := len(b)
+		b = append(b, make([]byte, aes.BlockSize)...)
+		rand.Read(b[iv:])
+		data := len(b)
+		b = append(b, payload...)
+		pad := (aes.BlockSize - (len(payload)+1)%aes.BlockSize) % aes.BlockSize
+		for i := range pad {
+			b = append(b, byte(i+1))
+		}
+		b = append(b, byte(pad))
+		cipher.NewCBCEncrypter(block, b[iv:data]).CryptBlocks(b[data:], b[data:])
+	} else {
+		b = append(b, payload...)
+	}
+	binary.LittleEndian.PutUint16(b[lenAt:], uint16(len(b)-lenAt-2))
+	if k1 != nil {
+		// The packet is padded with 0xff to a multiple of 4 bytes,
+		// including the pad length and next header.
+		pad := (4 - (len(b)-start+2)%4) % 4
+		for range pad {
+			b = append(b, 0xff)
+		}
+		b = append(b, byte(pad), rmcpClassIPMI)
+		b = append(b, rmcpAuthCode(k1, b[start:])...)
+	}
+	return b
+}
+
+// rmcpAuthCode returns the HMAC-SHA1-96 integrity check of b.
+func rmcpAuthCode(k1, b []byte) []byte {
+	h := hmac.New(sha1.New, k1)
+	h.Write(b)
+	return h.Sum(nil)[:rmcpAuthCodeSize]
+}
+
+// parseRMCPPacket returns the payload type, session ID, and payload of an
+// RMCP+ packet. If k1 is not nil, the packet must be authenticated with it,
+// and if block is not nil, the payload must be encrypted with it, and is
+// decrypted in place.
+func parseRMCPPacket(b, k1 []byte, block cipher.Block) (byte, uint32, []byte, error) {
+	if len(b) < rmcpHeaderSize+rmcpSessionHeaderSize || b[0] != rmcpVersion || b[3] != rmcpClassIPMI ||
+		b[4] != rmcpAuthTypeRMCPPlus {
+		return 0, 0, nil, errRMCPMalformed
+	}
+	typ := b[5]
+	id := binary.LittleEndian.Uint32(b[6:])
+	n := int(binary.LittleEndian.Uint16(b[14:]))
+	payload := b[rmcpHeaderSize+rmcpSessionHeaderSize:]
+	if len(payload) < n {
+		return 0, 0, nil, errRMCPMalformed
+	}
+	if (k1 != nil) != (typ&rmcpPayloadAuthenticated != 0) || (block != nil) != (typ&rmcpPayloadEncrypted != 0) {
+		return 0, 0, nil, errRMCPAuth
+	}
+	if k1 != nil {
+		end := len(b) - rmcpAuthCodeSize
+		if end < rmcpHeaderSize+rmcpSessionHeaderSize+n+2 || !hmac.Equal(rmcpAuthCode(k1, b[rmcpHeaderSize:end]), b[end:]) {
+			return 0, 0, nil, errRMCPAuth
+		}
+	}
+	payload = payload[:n]
+	if block != nil {
+		if len(payload) < 2*aes.BlockSize || len(payload)%aes.BlockSize != 0 {
+			return 0, 0, nil, errRMCPMalformed
+		}
+		iv, data := payload[:aes.BlockSize], payload[aes.BlockSize:]
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, data)
+		pad := int(data[len(data)-1])
+		if pad >= aes.BlockSize {
+			return 0, 0, nil, errRMCPMalformed
+		}
+		payload = data[:len(data)-1-pad]
+	}
+	return typ &^ (rmcpPayloadEncrypted | rmcpPayloadAuthenticated), id, payload, nil
+}
+
+// ipmiChecksum returns the checksum of b, which makes the sum of b and it 0.
+func ipmiChecksum(b []byte) byte {
+	var sum byte
+	for _, c := range b {
+		sum += c
+	}
+	return -sum
+}
+
+// appendIPMIRequest appends an IPMI request message to the BMC to b.
+func appendIPMIRequest(b []byte, lun, netfn, cmd, seq uint8, data []byte) []byte {
+	start := len(b)
+	b = append(b, ipmiBMCAddress, netfn<<2|lun)
+	b = append(b, ipmiChecksum(b[start:]))
+	start = len(b)
+	b = append(b, rmcpSoftwareID, seq<<2, cmd)
+	b = append(b, data...)
+	return append(b, ipmiChecksum(b[start:]))
+}
+
+// rmcpSession is an RMCP+ session with a BMC, which is opened when the first
+// command is sent, and again whenever the BMC stops answering.
+type rmcpSession struct {
+	conn    net.Conn
+	user    []byte
+	kuid    [rmcpMaxKeySize]byte
+	timeout time.Duration
+	tag     byte
+	// The session IDs of the remote console and the BMC, and the keys of
+	// the session, once it is open.
+	consoleID uint32
+	id        uint32
+	k1        []byte
+	block     cipher.Block
+	seq       uint32
+	rqSeq     uint8
+	out       []byte
+	in        [1024]byte
+}
+
+// exchange sends a packet carrying the payload to the BMC, and returns the
+// payload of the first response for which match is true, sending the packet
+// again if none arrives in time.
+func (s *rmcpSession) exchange(typ byte, payload []byte, match func(typ byte, payload []byte) bool) ([]byte, error) {
+	var consoleID uint32
+	if s.k1 != nil {
+		consoleID = s.consoleID
+	}
+	for range rmcpRetries {
+		var seq uint32
+		if s.k1 != nil {
+			s.seq++
+			seq = s.seq
+		}
+		s.out = appendRMCPPacket(s.out[:0], typ, s.id, seq, payload, s.k1, s.block)
+		if _, err := s.conn.Write(s.out); err != nil {
+			return nil, err
+		}
+		s.conn.SetReadDeadline(time.Now().Add(s.timeout))
+		for {
+			n, err := s.conn.Read(s.in[:])
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			// Stale responses to requests sent again, and anything
+			// not from the session, are ignored.
+			rtyp, id, p, err := parseRMCPPacket(s.in[:n], s.k1, s.block)
+			if err == nil && id == consoleID && match(rtyp, p) {
+				return p, nil
+			}
+		}
+	}
+	return nil, errRMCPTimeout
+}
+
+// rmcpStatusError returns the error of a message of the session setup whose
+// status is not success.
+func rmcpStatusError(step string, status byte) error {
+	return fmt.Errorf("observability: RMCP+ %s failed with status %#02x", step, status)
+}
+
+// open opens a session with the BMC, authenticating with RAKP-HMAC-SHA1, and
+// deriving the keys of the session.
+func (s *rmcpSession) open() error {
+	s.id, s.k1, s.block, s.seq = 0, nil, nil, 0
+	var r [4 + 16]byte
+	rand.Read(r[:])
+	consoleID := binary.LittleEndian.Uint32(r[:]) | 1
+	rm := r[4:]
+	s.tag++
+	tag := s.tag
+	matcher := func(want byte, size int) func(byte, []byte) bool {
+		return func(typ byte, p []byte) bool {
+			// A message reporting an error may be short.
+			return typ == want && len(p) >= 2 && p[0] == tag && (p[1] != 0 || len(p) >= size)
+		}
+	}
+
+	req := append([]byte{tag, rmcpPrivilegeUser, 0, 0}, binary.LittleEndian.AppendUint32(nil, consoleID)...)
+	req = append(req, rmcpAlgorithms...)
+	p, err := s.exchange(rmcpPayloadOpenSession, req, matcher(rmcpPayloadOpenSessionOK, 12+len(rmcpAlgorithms)))
+	if err != nil {
+		return err
+	}
+	if p[1] != 0 {
+		return rmcpStatusError("open session", p[1])
+	}
+	if binary.LittleEndian.Uint32(p[4:]) != consoleID || !bytes.Equal(p[12:12+len(rmcpAlgorithms)], rmcpAlgorithms) {
+		return errRMCPMalformed
+	}
+	id := binary.LittleEndian.Uint32(p[8:])
+
+	// role is the requested privilege, and the user name, which are
+	// authenticated by each of the codes.
+	role := append([]byte{rmcpPrivilegeUser | rmcpNameOnlyLookup, byte(len(s.user))}, s.user...)
+	req = append([]byte{tag, 0, 0, 0}, binary.LittleEndian.AppendUint32(nil, id)...)
+	req = append(req, rm...)
+	req = append(req, role[0], 0, 0)
+	req = append(req, role[1:]...)
+	p, err = s.exchange(rmcpPayloadRAKP1, req, matcher(rmcpPayloadRAKP2, 8+16+16+sha1.Size))
+	if err != nil {
+		return err
+	}
+	if p[1] != 0 {
+		return rmcpStatusError("RAKP message 1", p[1])
+	}
+	if binary.LittleEndian.Uint32(p[4:]) != consoleID {
+		return errRMCPMalformed
+	}
+	rc, guid := p[8:24:24], p[24:40:40]
+	mac := func(key []byte, parts ...[]byte) []byte {
+		h := hmac.New(sha1.New, key)
+		for _, part := range parts {
+			h.Write(part)
+		}
+		return h.Sum(nil)
+	}
+	sidm := binary.LittleEndian.AppendUint32(nil, consoleID)
+	sidc := binary.LittleEndian.AppendUint32(nil, id)
+	if !hmac.Equal(p[40:40+sha1.Size], mac(s.kuid[:], sidm, sidc, rm, rc, guid, role)) {
+		return errRMCPAuth
+	}
+	// rc and guid are in the receive buffer, which the next exchange
+	// overwrites.
+	rc, guid = bytes.Clone(rc), bytes.Clone(guid)
+
+	req = append([]byte{tag, 0, 0, 0}, sidc...)
+	req = append(req, mac(s.kuid[:], rc, sidm, role)...)
+	p, err = s.exchange(rmcpPayloadRAKP3, req, matcher(rmcpPayloadRAKP4, 8+rmcpAuthCodeSize))
+	if err != nil {
+		return err
+	}
+	if p[1] != 0 {
+		return rmcpStatusError("RAKP message 3", p[1])
+	}
+	sik := mac(s.kuid[:], rm, rc, role)
+	if binary.LittleEndian.Uint32(p[4:]) != consoleID ||
+		!hmac.Equal(p[8:8+rmcpAuthCodeSize], mac(sik, rm, sidc, guid)[:rmcpAuthCodeSize]) {
+		return errRMCPAuth
+	}
+	block, err := aes.NewCipher(mac(sik, bytes.Repeat([]byte{2}, rmcpMaxKeySize))[:16])
+	if err != nil {
+		return err
+	}
+	s.consoleID, s.id = consoleID, id
+	s.k1, s.block = mac(sik, bytes.Repeat([]byte{1}, rmcpMaxKeySize)), block
+	return nil
+}
+
+// request sends an IPMI request to the BMC in the open session, and returns
+// the data of its response.
+func (s *rmcpSession) request(lun, netfn, cmd uint8, data []byte) ([]byte, error) {
+	s.rqSeq = (s.rqSeq + 1) & 0x3f
+	req := appendIPMIRequest(nil, lun, netfn, cmd, s.rqSeq, data)
+	p, err := s.exchange(rmcpPayloadIPMI, req, func(typ byte, p []byte) bool {
+		return typ == rmcpPayloadIPMI && len(p) >= 8 && p[1]>>2 == netfn|1 && p[4]>>2 == s.rqSeq && p[5] == cmd
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ipmiChecksum(p[:3]) != 0 || ipmiChecksum(p[3:]) != 0 {
+		return nil, errIPMIMalformed
+	}
+	if p[6] != ipmiCompletionOK {
+		return nil, ipmiCompletionError(p[6])
+	}
+	return p[7 : len(p)-1], nil
+}
+
+// command is an ipmiCommand that sends the request to the BMC in the session,
+// opening one first if needed.
+func (s *rmcpSession) command(lun, netfn, cmd uint8, data []byte) ([]byte, error) {
+	opened := s.k1 == nil
+	if opened {
+		if err := s.open(); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := s.request(lun, netfn, cmd, data)
+	if err == errRMCPTimeout && !opened {
+		// The BMC may have closed the session, such as after it was
+		// idle for too long, so the request is sent again in a new
+		// one.
+		if err = s.open(); err == nil {
+			resp, err = s.request(lun, netfn, cmd, data)
+		}
+	}
+	if err != nil {
+		s.k1, s.block = nil, nil
+	}
+	return resp, err
+}
+
+// RegisterRemoteIPMIStats registers the meters of RegisterIPMIStats with o, but
+// read from a remote BMC over the LAN with IPMI v2.0 RMCP+, like ipmitool -I
+// lanplus, rather than in band. The BMC is at addr, whose port is
+// DefaultIPMIPort unless it has one, and is read as the given user, which needs
+// only the User privilege. The session uses cipher suite 3: RAKP-HMAC-SHA1
+// authentication, HMAC-SHA1-96 integrity, and AES-CBC-128 confidentiality,
+// with no BMC key. It is opened again whenever the BMC stops answering, such as
+// after closing it for being idle. Since the meters describe the machine the
+// BMC manages, o should be an Origin of its own, identifying that machine; see
+// NewRemoteIPMIOrigins. The socket stays open for the life of the Origin.
+func RegisterRemoteIPMIStats(o *Origin, addr, user, password string) error {
+	return registerRemoteIPMIStats(o, addr, user, password, rmcpTimeout)
+}
+
+func registerRemoteIPMIStats(o *Origin, addr, user, password string, timeout time.Duration) error {
+	if len(user) > rmcpMaxUserSize || len(password) > rmcpMaxKeySize {
+		return errors.New("observability: IPMI user name or password is too long")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, DefaultIPMIPort)
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return err
+	}
+	s := &rmcpSession{conn: conn, user: []byte(user), timeout: timeout}
+	copy(s.kuid[:], password)
+	if err := registerIPMIStats(o, s.command); err != nil {
+		conn.Close()
+		return err
+	}
+	return nil
+}
+
+// IPMIHost is a BMC to be read over the LAN.
+type IPMIHost struct {
+	// Address is the host name or address of the BMC, with an optional
+	// port.
+	Address        string
+	User, Password string
+	// Identity identifies the machine the BMC manages, such as by its
+	// host name. If it is empty, the machine is identified by the label
+	// host with the Address.
+	Identity []Label
+}
+
+// NewRemoteIPMIOrigins returns an Origin for each of the hosts, with the meters
+// of RegisterRemoteIPMIStats, so that a single daemon can export the sensors of
+// many machines, each under the identity of its own machine, as described in
+// the package documentation. Hosts whose BMCs cannot be read are left out, and
+// their errors are returned, joined.
+func NewRemoteIPMIOrigins(hosts []IPMIHost) ([]*Origin, error) {
+	var origins []*Origin
+	var errs []error
+	for _, h := range hosts {
+		identity := h.Identity
+		if len(identity) == 0 {
+			identity = []Label{{Key: "host", Value: h.Address}}
+		}
+		o := NewOrigin(identity...)
+		if err := RegisterRemoteIPMIStats(o, h.Address, h.User, h.Password); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", h.Address, err))
+			continue
+		}
+		origins = append(origins, o)
+	}
+	return origins, errors.Join(errs...)
+}
@@ -0,0 +1,179 @@
+package observability
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeLANBMC serves the commands of a fakeBMC over RMCP+, with a single
+// session at a time.
+type fakeLANBMC struct {
+	pc             net.PacketConn
+	bmc            *fakeBMC
+	user, password string
+	// sessions is the number of sessions opened.
+	sessions  atomic.Int32
+	consoleID uint32
+	id        uint32
+	rm        []byte
+	role      []byte
+	sik       []byte
+	k1        []byte
+	block     cipher.Block
+	// drop makes the BMC forget the session, as when it times out.
+	drop chan struct{}
+}
+
+var (
+	fakeBMCRandom = bytes.Repeat([]byte{0xa5}, 16)
+	fakeBMCGUID   = bytes.Repeat([]byte{0x5a}, 16)
+)
+
+func fakeHMAC(key []byte, parts ...[]byte) []byte {
+	h := hmac.New(sha1.New, key)
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+func (b *fakeLANBMC) serve() {
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := b.pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		select {
+		case <-b.drop:
+			b.k1, b.block = nil, nil
+		default:
+		}
+		typ, _, p, err := parseRMCPPacket(buf[:n], nil, nil)
+		if err == errRMCPAuth {
+			typ, _, p, err = parseRMCPPacket(buf[:n], b.k1, b.block)
+		}
+		if err != nil {
+			// Packets of unknown sessions are dropped.
+			continue
+		}
+		kuid := make([]byte, rmcpMaxKeySize)
+		copy(kuid, b.password)
+		var resp []byte
+		var respTyp byte
+		switch typ {
+		case rmcpPayloadOpenSession:
+			b.consoleID = binary.LittleEndian.Uint32(p[4:])
+			b.id = 0x1000 + uint32(b.sessions.Add(1))
+			resp = append([]byte{p[0], 0, rmcpPrivilegeUser, 0}, p[4:8]...)
+			resp = binary.LittleEndian.AppendUint32(resp, b.id)
+			resp = append(resp, p[8:]...)
+			respTyp = rmcpPayloadOpenSessionOK
+		case rmcpPayloadRAKP1:
+			b.rm = bytes.Clone(p[8:24])
+			b.role = append([]byte{p[24]}, p[27:]...)
+			respTyp = rmcpPayloadRAKP2
+			if string(p[28:]) != b.user {
+				resp = []byte{p[0], 0x0d, 0, 0}
+				break
+			}
+			sidm := binary.LittleEndian.AppendUint32(nil, b.consoleID)
+			sidc := binary.LittleEndian.AppendUint32(nil, b.id)
+			resp = append([]byte{p[0], 0, 0, 0}, sidm...)
+			resp = append(resp, fakeBMCRandom...)
+			resp = append(resp, fakeBMCGUID...)
+			resp = append(resp, fakeHMAC(kuid, sidm, sidc, b.rm, fakeBMCRandom, fakeBMCGUID, b.role)...)
+		case rmcpPayloadRAKP3:
+			sidm := binary.LittleEndian.AppendUint32(nil, b.consoleID)
+			sidc := binary.LittleEndian.AppendUint32(nil, b.id)
+			respTyp = rmcpPayloadRAKP4
+			if !hmac.Equal(p[8:], fakeHMAC(kuid, fakeBMCRandom, sidm, b.role)) {
+				resp = []byte{p[0], 0x0f, 0, 0}
+				break
+			}
+			b.sik = fakeHMAC(kuid, b.rm, fakeBMCRandom, b.role)
+			resp = append([]byte{p[0], 0, 0, 0}, sidm...)
+			resp = append(resp, fakeHMAC(b.sik, b.rm, sidc, fakeBMCGUID)[:rmcpAuthCodeSize]...)
+		case rmcpPayloadIPMI:
+			// The session is established by the first message in
+			// it.
+			if b.k1 == nil {
+				continue
+			}
+			data, err := b.bmc.command(p[1]&3, p[1]>>2, p[5], p[6:len(p)-1])
+			cc := byte(ipmiCompletionOK)
+			if err != nil {
+				cc = byte(err.(ipmiCompletionError))
+			}
+			resp = []byte{rmcpSoftwareID, (p[1]>>2 | 1) << 2}
+			resp = append(resp, ipmiChecksum(resp))
+			resp = append(resp, ipmiBMCAddress, p[4], p[5], cc)
+			resp = append(resp, data...)
+			resp = append(resp, ipmiChecksum(resp[3:]))
+			respTyp = rmcpPayloadIPMI
+		}
+		var out []byte
+		if typ == rmcpPayloadIPMI {
+			out = appendRMCPPacket(nil, respTyp, b.consoleID, 1, resp, b.k1, b.block)
+		} else {
+			out = appendRMCPPacket(nil, respTyp, 0, 0, resp, nil, nil)
+		}
+		b.pc.WriteTo(out, addr)
+		if typ == rmcpPayloadRAKP3 && resp[1] == 0 {
+			b.k1 = fakeHMAC(b.sik, bytes.Repeat([]byte{1}, rmcpMaxKeySize))
+			b.block, _ = aes.NewCipher(fakeHMAC(b.sik, bytes.Repeat([]byte{2}, rmcpMaxKeySize))[:16])
+		}
+	}
+}
+
+func newFakeLANBMC(t *testing.T, bmc *fakeBMC) *fakeLANBMC {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	b := &fakeLANBMC{pc: pc, bmc: bmc, user: "monitor", password: "secret", drop: make(chan struct{}, 1)}
+	go b.serve()
+	return b
+}
+
+func TestRemoteIPMIStats(t *testing.T) {
+	b := newFakeLANBMC(t, &fakeBMC{
+		records: [][]byte{
+			ipmiFullSensorRecord(0, 1, 1, 1, 0, 0, 0, "Inlet Temp"),
+			ipmiCompactSensorRecord(1, ipmiBMCAddress, 2, ipmiSensorPowerSupply, "PS1 Status"),
+		},
+		readings: map[uint8][]byte{
+			1: {24, 0xc0},
+			2: {0, 0xc0, 0x01},
+		},
+	})
+	addr := b.pc.LocalAddr().String()
+	if err := registerRemoteIPMIStats(NewOrigin(), addr, b.user, "wrong", 50*time.Millisecond); err != errRMCPAuth {
+		t.Fatalf("wrong password: got %v", err)
+	}
+	o := NewOrigin()
+	if err := registerRemoteIPMIStats(o, addr, b.user, b.password, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]uint64{
+		"/ipmi/sensor/temperature{sensor=Inlet Temp}":  24000,
+		"/ipmi/power_supply/status{sensor=PS1 Status}": 1,
+	}
+	checkValues(t, sampleValues(o), want)
+	// A session closed by the BMC is opened again.
+	sessions := b.sessions.Load()
+	b.drop <- struct{}{}
+	checkValues(t, sampleValues(o), want)
+	if n := b.sessions.Load(); n != sessions+1 {
+		t.Errorf("%d sessions opened, want %d", n, sessions+1)
+	}
+}
@@ -0,0 +1,87 @@
+package observability
+
+import (
+	"bytes"
+)
+
+// rowFilter reports whether a row of fields should be passed to a RowScanner's
+// function.
+type rowFilter func(fields [][]byte) bool
+
+// fieldPrefix returns a rowFilter that accepts rows whose field i begins with
+// any of the prefixes, such as device names beginning with "sd" or "nvme".
+func fieldPrefix(i int, prefixes ...string) rowFilter {
+	return func(fields [][]byte) bool {
+		if i >= len(fields) {
+			return false
+		}
+		for _, p := range prefixes {
+			if bytes.HasPrefix(fields[i], []byte(p)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// fieldIn returns a rowFilter that accepts rows whose field i is any of the
+// values, such as the major device numbers of whole disks.
+func fieldIn(i int, values ...string) rowFilter {
+	return func(fields [][]byte) bool {
+		if i >= len(fields) {
+			return false
+		}
+		for _, v := range values {
+			if string(fields[i]) == v {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// minFields returns a rowFilter that accepts rows of at least n fields, so
+// that the function may index them without checking.
+func minFields(n int) rowFilter {
+	return func(fields [][]byte) bool {
+		return len(fields) >= n
+	}
+}
+
+// RowScanner scans files whose lines have no leading keyword, only positional
+// fields, such as /proc/diskstats, where each line begins with the major and
+// minor device numbers and the device name, and /proc/loadavg, which is a
+// single line.
+type RowScanner struct {
+	fieldSplitter
+	f       func(fields [][]byte)
+	filters []rowFilter
+	fields  [][]byte
+}
+
+// NewRowScanner creates a RowScanner that calls f with the fields of every
+// line that all of the filters accept. The fields point into temporary scratch
+// space, as with lineFuncs. Blank lines are ignored.
+func NewRowScanner(f func(fields [][]byte), filters ...rowFilter) *RowScanner {
+	return &RowScanner{f: f, filters: filters}
+}
+
+// Scan reads all of the lines in the given byte buffer, calling the function
+// for each accepted line.
+func (rs *RowScanner) Scan(b []byte) {
+	var line []byte
+lines:
+	for len(b) > 0 {
+		line, b = nextLine(b)
+		rs.fields = rs.split(line, rs.fields[:0])
+		if len(rs.fields) == 0 {
+			continue
+		}
+		for _, accept := range rs.filters {
+			if !accept(rs.fields) {
+				continue lines
+			}
+		}
+		rs.f(rs.fields)
+	}
+}
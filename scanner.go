@@ -3,6 +3,9 @@ package observability
 import (
 	"bufio"
 	"bytes"
+	"io"
+	"sync/atomic"
+	"time"
 )
 
 // lineFunc associates some name with a function. The function is run whenever
@@ -15,25 +18,89 @@ import (
 type lineFunc struct {
 	name []byte
 	f    func(fields [][]byte)
+	// mask, if not zero, selects the fields passed to the function: bit i
+	// selects field i, counting from zero after the name. Only the
+	// selected fields are split out of the line, which saves work on wide
+	// lines of which only a few fields are wanted. The function receives
+	// the selected fields in order, so its indices are into the
+	// selection. See fieldMask.
+	mask uint64
+	// nfields, if not zero, is the number of fields the function expects,
+	// counting only the selected ones if there is a mask. A line with any
+	// other number isn't passed to the function, but counted as an error,
+	// so that a change to the format of the source is reported rather than
+	// causing the function to panic or misread its fields.
+	nfields int
+	// prefixed, if not nil, is called instead of f, and makes name a
+	// prefix: the function is called for every line whose first field is
+	// name followed by a non-empty suffix, such as the "cpu0" and "cpu17"
+	// lines of /proc/stat for the prefix "cpu", and is passed the suffix,
+	// "0" or "17", as well as the fields. In ordered mode the lines must be
+	// consecutive, as they are in the kernel's files. The suffix points into
+	// the input, like the fields.
+	prefixed func(suffix []byte, fields [][]byte)
+}
+
+// fieldMask returns the lineFunc mask that selects the fields at the given
+// indices, which must be less than 64.
+func fieldMask(indices ...int) uint64 {
+	var m uint64
+	for _, i := range indices {
+		m |= 1 << i
+	}
+	return m
 }
 
 // BufferScanner encapsulates a reader, caller-provided buffer, lineFunc
 // callbacks, and scratch space for the fields.
 type BufferScanner struct {
-	lineReader *bytes.Reader
-	lineBuf    []byte
-	lineFuncs  []lineFunc
-	fields     [][]byte
+	fieldSplitter
+	lineBuf   []byte
+	lineFuncs []lineFunc
+	fields    [][]byte
+	// index maps names to lineFuncs in unordered mode, and is nil in the
+	// default, ordered mode. prefixes holds the indices of the prefixed
+	// lineFuncs, which can't be looked up by name.
+	index    map[string]int
+	prefixes []int
+	// hits records which lineFuncs were called by the last scan, and
+	// matched how many.
+	hits    []bool
+	matched int
+	// errors counts the problems found in the input.
+	errors atomic.Uint64
+	// strict makes Atoi validate its input, and hardened makes call recover
+	// from panics in the functions.
+	strict   bool
+	hardened bool
+	// The state of the ordered mode, which is kept between calls so that
+	// a scan can be resumed: next is the next lineFunc to look for, run is
+	// whether the lines of prefixed lineFunc next have begun, and found is
+	// the number of lineFuncs whose lines were found.
+	next  int
+	run   bool
+	found int
+	// budget, stopWhenMatched, consumed, and truncated support partial
+	// scans; see SetByteBudget.
+	budget          int
+	stopWhenMatched bool
+	consumed        int
+	truncated       bool
+	// pool, if not nil, lends the scratch space for each scan, which is
+	// held in scratch during the scan.
+	pool    *ScratchPool
+	scratch *scratch
 }
 
 // NewBufferScanner creates a BufferScanner from the given buffer and slice of
-// lineFuncs. For best performance the buffer should be capacious enough to
-// hold all of the input that can be expected on a single line.  Note that the
-// lineFuncs must be ordered in the same order that their names appear in the
-// input. If the file contains "alice 1\nbob 2\n" then the function for "alice"
-// must immediately precede the one for "bob". If they are reversed, only the
-// "bob" function would be called. It is acceptable to have input lines without
-// corresponding functions ("alice 123\ngeorge 456\nbob 42\n") but it's
+// lineFuncs. The buffer is only used by ScanReader, and must be capacious
+// enough to hold the longest line of the input; Scan splits the lines of its
+// input in place, and nil will do for a scanner that only uses Scan. Note that
+// the lineFuncs must be ordered in the same order that their names appear in
+// the input. If the file contains "alice 1\nbob 2\n" then the function for
+// "alice" must immediately precede the one for "bob". If they are reversed,
+// only the "bob" function would be called. It is acceptable to have input lines
+// without corresponding functions ("alice 123\ngeorge 456\nbob 42\n") but it's
 // unacceptable to have functions without corresponding input lines; every
 // function must have a corresponding line in the input.
 //
@@ -42,9 +109,30 @@ type BufferScanner struct {
 // say, memcached emits stats in an undefined order.
 func NewBufferScanner(lineBuf []byte, lineFuncs []lineFunc) *BufferScanner {
 	bs := &BufferScanner{
-		lineReader: bytes.NewReader(nil),
-		lineBuf:    lineBuf[:cap(lineBuf)],
-		lineFuncs:  lineFuncs,
+		lineBuf:   lineBuf[:cap(lineBuf)],
+		lineFuncs: lineFuncs,
+		hits:      make([]bool, len(lineFuncs)),
+	}
+	return bs
+}
+
+// NewUnorderedBufferScanner is like NewBufferScanner, except that the lineFuncs
+// may be in any order, and need not all have corresponding lines in the input.
+// Each line is looked up by its name, and the function for that name, if any,
+// is called, as many times as the name appears. This suits sources whose
+// order is undefined, such as memcached, and kernel files whose order has
+// changed between versions. It costs a map lookup per line, which makes it
+// slower than the ordered mode when most lines of the input are wanted. The
+// names of the lineFuncs must be distinct.
+func NewUnorderedBufferScanner(lineBuf []byte, lineFuncs []lineFunc) *BufferScanner {
+	bs := NewBufferScanner(lineBuf, lineFuncs)
+	bs.index = make(map[string]int, len(lineFuncs))
+	for i, f := range lineFuncs {
+		if f.prefixed != nil {
+			bs.prefixes = append(bs.prefixes, i)
+			continue
+		}
+		bs.index[string(f.name)] = i
 	}
 	return bs
 }
@@ -96,28 +184,499 @@ func asciiByteFields(s []byte, a [][]byte) [][]byte {
 	return a
 }
 
+// firstField returns the first space-separated field of s, and the rest of s
+// after it.
+func firstField(s []byte) (field, rest []byte) {
+	i := 0
+	for i < len(s) && asciiSpace[s[i]] != 0 {
+		i++
+	}
+	j := i
+	for j < len(s) && asciiSpace[s[j]] == 0 {
+		j++
+	}
+	return s[i:j:j], s[j:]
+}
+
+// asciiMaskedFields is like asciiByteFields, except that it only appends the
+// fields selected by mask, and stops after the last of them.
+func asciiMaskedFields(s []byte, mask uint64, a [][]byte) [][]byte {
+	var field []byte
+	for i := 0; mask != 0; i++ {
+		if field, s = firstField(s); len(field) == 0 {
+			break
+		}
+		if mask&1 != 0 {
+			a = append(a, field)
+		}
+		mask >>= 1
+	}
+	return a
+}
+
+// fieldSplitter splits lines into fields. The zero fieldSplitter splits them
+// at ASCII whitespace, like asciiByteFields, which suits most files.
+type fieldSplitter struct {
+	// delims, if not nil, is the table of bytes that separate fields,
+	// which replaces asciiSpace.
+	delims *[256]uint8
+	// parens makes a field that begins with "(" extend to the last ")" in
+	// the line, delimiters and all.
+	parens bool
+}
+
+// SetDelimiters adds the bytes of extra to the whitespace that separates
+// fields, for files that mix spaces with other delimiters, such as the colons
+// of "TCP: inuse 5 orphan 0" in /proc/net/sockstat, where the first field
+// then becomes "TCP". Consecutive delimiters are treated as one, as spaces
+// are.
+func (fs *fieldSplitter) SetDelimiters(extra string) {
+	delims := asciiSpace
+	for i := 0; i < len(extra); i++ {
+		delims[extra[i]] = 1
+	}
+	fs.delims = &delims
+}
+
+// SetParenthesized sets whether a field that begins with "(" extends to the
+// last ")" in the line, for the command names in /proc/<pid>/stat, as in
+// "1234 (tmux: server) S 1", which may contain spaces and parentheses of their
+// own. Such a field is passed without the outer parentheses.
+func (fs *fieldSplitter) SetParenthesized(parens bool) {
+	fs.parens = parens
+}
+
+// cutField returns the first field of s, and the rest of s after it.
+func (fs *fieldSplitter) cutField(s []byte) (field, rest []byte) {
+	if fs.delims == nil && !fs.parens {
+		return firstField(s)
+	}
+	delims := fs.delims
+	if delims == nil {
+		delims = &asciiSpace
+	}
+	i := 0
+	for i < len(s) && delims[s[i]] != 0 {
+		i++
+	}
+	if fs.parens && i < len(s) && s[i] == '(' {
+		if j := bytes.LastIndexByte(s[i:], ')'); j > 0 {
+			return s[i+1 : i+j : i+j], s[i+j+1:]
+		}
+	}
+	j := i
+	for j < len(s) && delims[s[j]] == 0 {
+		j++
+	}
+	return s[i:j:j], s[j:]
+}
+
+// split appends the fields of s to a.
+func (fs *fieldSplitter) split(s []byte, a [][]byte) [][]byte {
+	if fs.delims == nil && !fs.parens {
+		return asciiByteFields(s, a)
+	}
+	for {
+		var field []byte
+		if field, s = fs.cutField(s); len(field) == 0 && len(s) == 0 {
+			return a
+		}
+		a = append(a, field)
+	}
+}
+
+// splitMasked is like split, except that it only appends the fields selected
+// by mask, and stops after the last of them.
+func (fs *fieldSplitter) splitMasked(s []byte, mask uint64, a [][]byte) [][]byte {
+	if fs.delims == nil && !fs.parens {
+		return asciiMaskedFields(s, mask, a)
+	}
+	var field []byte
+	for ; mask != 0; mask >>= 1 {
+		if field, s = fs.cutField(s); len(field) == 0 && len(s) == 0 {
+			break
+		}
+		if mask&1 != 0 {
+			a = append(a, field)
+		}
+	}
+	return a
+}
+
+// nextLine returns the first line of b, without its newline, and the rest of
+// b after the newline.
+func nextLine(b []byte) (line, rest []byte) {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		return b[:i], b[i+1:]
+	}
+	return b, nil
+}
+
 // Fields returns a slice containing the space-separated ASCII things on the
-// line.
+// line, or those separated by the delimiters set with SetDelimiters.
 func (bs *BufferScanner) Fields(line []byte) [][]byte {
-	bs.fields = asciiByteFields(line, bs.fields[0:0])
+	bs.fields = bs.split(line, bs.fields[0:0])
 	return bs.fields
 }
 
 // Scan reads all of the lines in the given byte buffer, calling the
-// corresponding functions for the first field of each line.
+// corresponding functions for the first field of each line. See
+// NewBufferScanner and NewUnorderedBufferScanner for how lines are matched to
+// functions.
 func (bs *BufferScanner) Scan(b []byte) {
-	bs.lineReader.Reset(b)
-	scanner := bufio.NewScanner(bs.lineReader)
-	scanner.Buffer(bs.lineBuf, cap(bs.lineBuf))
-	for _, f := range bs.lineFuncs {
-		for scanner.Scan() {
-			fields := bs.Fields(scanner.Bytes())
-			if len(fields) > 1 {
-				if bytes.Equal(f.name, fields[0]) {
-					f.f(fields[1:])
+	bs.borrow()
+	bs.begin()
+	bs.scan(&lines{b: b})
+	bs.giveBack(0)
+}
+
+// ScanReader is like Scan, but reads the input from r as it goes, so it can
+// stream through inputs too large to hold in memory, such as /proc/slabinfo
+// or the smaps of a large process, using only the caller-provided buffer.
+// Every line must fit in the buffer. The ordered mode stops reading once the
+// last function has been called. It returns the error from reading r, or
+// bufio.ErrTooLong if a line doesn't fit.
+func (bs *BufferScanner) ScanReader(r io.Reader) error {
+	bs.begin()
+	return bs.scanReader(r)
+}
+
+// Resume continues a scan that stopped because of the byte budget, with the
+// rest of its input, such as b[Consumed():] of the input of the last call.
+// The hits of the scan accumulate, and in ordered mode it looks for the
+// functions that remain. Collectors can use it to spread the cost of a huge
+// file over several collection cycles.
+func (bs *BufferScanner) Resume(b []byte) {
+	bs.borrow()
+	bs.scan(&lines{b: b})
+	bs.giveBack(0)
+}
+
+// ResumeReader is Resume for ScanReader. r must begin where the last call
+// stopped, such as a file at the offset of the bytes consumed so far; the
+// reader of the last call can't be reused, because it has been read ahead.
+func (bs *BufferScanner) ResumeReader(r io.Reader) error {
+	return bs.scanReader(r)
+}
+
+func (bs *BufferScanner) scanReader(r io.Reader) error {
+	bs.borrow()
+	l := bs.readLines(r)
+	l.scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		l.consumed += advance
+		return advance, token, err
+	})
+	err := bs.scan(l)
+	bs.giveBack(l.longest)
+	return err
+}
+
+// readLines returns the lines of r, read into the line buffer, which may grow
+// if it is borrowed from a ScratchPool.
+func (bs *BufferScanner) readLines(r io.Reader) *lines {
+	l := &lines{scanner: bufio.NewScanner(r)}
+	if bs.pool != nil {
+		// The pool learns how long the lines are, so that it can
+		// size its buffers accordingly.
+		l.scanner.Buffer(bs.lineBuf, max(cap(bs.lineBuf), bufio.MaxScanTokenSize))
+	} else {
+		l.scanner.Buffer(bs.lineBuf, cap(bs.lineBuf))
+	}
+	return l
+}
+
+// SetByteBudget sets the number of bytes of input after which a scan stops,
+// at the end of the line that reaches the budget, so that the worst-case cost
+// of scanning a huge file can be bounded. Truncated then reports that the
+// scan stopped early, and it can be continued with Resume. Zero, the
+// default, means no budget.
+func (bs *BufferScanner) SetByteBudget(n int) {
+	bs.budget = n
+}
+
+// SetStopWhenMatched sets whether a scan in unordered mode stops as soon as
+// every lineFunc has been called, rather than reading to the end of the input,
+// in which case names that appear more than once are only passed the first
+// time. The ordered mode always stops after its last function.
+func (bs *BufferScanner) SetStopWhenMatched(stop bool) {
+	bs.stopWhenMatched = stop
+}
+
+// Consumed returns the number of bytes of input consumed by the last call to
+// scan or resume. When the scan stopped early, the input after them was not
+// examined.
+func (bs *BufferScanner) Consumed() int {
+	return bs.consumed
+}
+
+// Truncated reports whether the last call to scan or resume stopped because
+// of the byte budget, before the end of the input.
+func (bs *BufferScanner) Truncated() bool {
+	return bs.truncated
+}
+
+// lines yields the lines of the input of a scan, either in place from a byte
+// slice, which saves copying them, or from a bufio.Scanner, whose split
+// function counts the bytes consumed.
+type lines struct {
+	b        []byte
+	scanner  *bufio.Scanner
+	line     []byte
+	consumed int
+	// longest is the length of the longest line read by the scanner.
+	longest int
+}
+
+// Scan advances to the next line, which is then returned by Bytes.
+func (l *lines) Scan() bool {
+	if l.scanner != nil {
+		if !l.scanner.Scan() {
+			return false
+		}
+		l.longest = max(l.longest, len(l.scanner.Bytes()))
+		return true
+	}
+	if len(l.b) == 0 {
+		return false
+	}
+	n := len(l.b)
+	l.line, l.b = nextLine(l.b)
+	l.consumed += n - len(l.b)
+	return true
+}
+
+func (l *lines) Bytes() []byte {
+	if l.scanner != nil {
+		return l.scanner.Bytes()
+	}
+	return l.line
+}
+
+func (l *lines) Err() error {
+	if l.scanner != nil {
+		return l.scanner.Err()
+	}
+	return nil
+}
+
+// begin resets the state of a scan.
+func (bs *BufferScanner) begin() {
+	clear(bs.hits)
+	bs.matched = 0
+	bs.next, bs.run, bs.found = 0, false, 0
+}
+
+// more reports whether the scan should go on to the next line of l, and
+// records whether it stopped because of the budget.
+func (bs *BufferScanner) more(l *lines) bool {
+	bs.consumed = l.consumed
+	bs.truncated = bs.budget > 0 && l.consumed >= bs.budget
+	return !bs.truncated && l.Scan()
+}
+
+func (bs *BufferScanner) scan(scanner *lines) error {
+	if bs.index != nil {
+		for (!bs.stopWhenMatched || bs.matched < len(bs.lineFuncs)) && bs.more(scanner) {
+			name, rest := bs.cutField(scanner.Bytes())
+			// The conversion doesn't allocate.
+			if i, ok := bs.index[string(name)]; ok {
+				bs.callHit(i, nil, rest)
+				continue
+			}
+			for _, i := range bs.prefixes {
+				if suffix, ok := bs.lineFuncs[i].match(name); ok {
+					bs.callHit(i, suffix, rest)
 					break
 				}
 			}
 		}
+		bs.consumed = scanner.consumed
+		return scanner.Err()
+	}
+	for bs.next < len(bs.lineFuncs) && bs.more(scanner) {
+		name, rest := bs.cutField(scanner.Bytes())
+		for bs.next < len(bs.lineFuncs) {
+			i := bs.next
+			f := &bs.lineFuncs[i]
+			if f.prefixed == nil {
+				if bytes.Equal(f.name, name) {
+					// A line with the wrong number of fields
+					// is still found, so the next function can
+					// look for its own.
+					if ok, _ := bs.callHit(i, nil, rest); ok {
+						bs.found++
+						bs.next++
+					}
+				}
+				break
+			}
+			if suffix, ok := f.match(name); ok {
+				if ok, _ := bs.callHit(i, suffix, rest); ok && !bs.run {
+					bs.found++
+					bs.run = true
+				}
+				break
+			}
+			if !bs.run {
+				break
+			}
+			// The run of lines has ended, and this one may be for the
+			// next function.
+			bs.next++
+			bs.run = false
+		}
+	}
+	bs.consumed = scanner.consumed
+	if !bs.truncated && bs.found < len(bs.lineFuncs) {
+		// In ordered mode every function must have a line.
+		bs.errors.Add(1)
+	}
+	return scanner.Err()
+}
+
+// match reports whether name matches the prefixed lineFunc f, and returns its
+// suffix.
+func (f *lineFunc) match(name []byte) ([]byte, bool) {
+	suffix, ok := bytes.CutPrefix(name, f.name)
+	return suffix, ok && len(suffix) > 0
+}
+
+// callHit is call, and records the hit if the function was called.
+func (bs *BufferScanner) callHit(i int, suffix, rest []byte) (ok, called bool) {
+	ok, called = bs.call(i, suffix, rest)
+	if called {
+		bs.hit(i)
+	}
+	return ok, called
+}
+
+// call splits the fields of the rest of a line that matched lineFunc i, and
+// calls its function. ok is false if there are no fields, and called is also
+// false if there are not the expected number.
+func (bs *BufferScanner) call(i int, suffix, rest []byte) (ok, called bool) {
+	f := &bs.lineFuncs[i]
+	if f.mask != 0 {
+		bs.fields = bs.splitMasked(rest, f.mask, bs.fields[:0])
+	} else {
+		bs.fields = bs.split(rest, bs.fields[:0])
+	}
+	if len(bs.fields) == 0 {
+		return false, false
+	}
+	if f.nfields != 0 && len(bs.fields) != f.nfields {
+		bs.errors.Add(1)
+		return true, false
+	}
+	if bs.hardened {
+		return true, bs.callRecover(f, suffix)
+	}
+	f.invoke(suffix, bs.fields)
+	return true, true
+}
+
+func (f *lineFunc) invoke(suffix []byte, fields [][]byte) {
+	if f.prefixed != nil {
+		f.prefixed(suffix, fields)
+	} else {
+		f.f(fields)
+	}
+}
+
+// callRecover calls the function of f, and reports whether it returned rather
+// than panicking, in which case it counts an error.
+func (bs *BufferScanner) callRecover(f *lineFunc, suffix []byte) (called bool) {
+	defer func() {
+		if recover() != nil {
+			bs.errors.Add(1)
+			called = false
+		}
+	}()
+	f.invoke(suffix, bs.fields)
+	return true
+}
+
+func (bs *BufferScanner) hit(i int) {
+	if !bs.hits[i] {
+		bs.hits[i] = true
+		bs.matched++
+	}
+}
+
+// Hits reports, for each lineFunc in order, whether its function was called
+// by the last scan. A collector can use it to detect that a statistic it
+// expects has disappeared from the input, as happens when kernel versions
+// differ. In ordered mode, a missing line also causes the functions after it
+// to be missed. The slice is overwritten by the next scan.
+func (bs *BufferScanner) Hits() []bool {
+	return bs.hits
+}
+
+// Matched returns the number of lineFuncs whose functions were called by the
+// last scan.
+func (bs *BufferScanner) Matched() int {
+	return bs.matched
+}
+
+// Errors returns the number of problems found in the input. In ordered mode, a
+// scan in which any lineFunc had no corresponding line is an error, as is each
+// line with a different number of fields than its lineFunc expects, and each
+// malformed number found by Atoi in strict mode. It may be called concurrently
+// with scans.
+func (bs *BufferScanner) Errors() uint64 {
+	return bs.errors.Load()
+}
+
+var scanErrorsDesc = DescribeMeter(
+	"/observability/scanner/errors",
+	"Number of problems found by scans of their input, such as an "+
+		"expected line that was missing, or a malformed number. Errors "+
+		"usually mean that the format of the source has changed, and some "+
+		"of its meters are stale.",
+	Cumulative())
+
+// RegisterErrorMeter registers a counter of the scanner's errors with o,
+// labeled with source=name, so that format drift is visible wherever the
+// meters are exported.
+func (bs *BufferScanner) RegisterErrorMeter(o *Origin, name string) {
+	m := DefineCounter(scanErrorsDesc, Label{Key: "source", Value: name})
+	o.RegisterFunction(func() {
+		m.SampleAt(time.Now(), bs.errors.Load())
+	}, m)
+}
+
+// SetStrict sets whether the scanner is in strict mode, in which Atoi checks
+// that numbers are well formed rather than trusting the input. Strict mode
+// suits sources whose format isn't guaranteed, at a small cost per number.
+func (bs *BufferScanner) SetStrict(strict bool) {
+	bs.strict = strict
+}
+
+// SetHardened sets whether the scanner is in hardened mode, for sources whose
+// content can't be trusted, or varies too widely across kernels to anticipate.
+// Hardened mode implies strict mode, and also recovers from panics in the
+// functions, such as indexing past the fields of a truncated line, counting
+// them as errors and treating them as not called, so that a malformed input
+// can't bring down the process. The scanner itself never panics, whatever the
+// input: embedded NULs are ordinary bytes of a field, and a line too long for
+// ScanReader's buffer ends the scan with bufio.ErrTooLong. Hardened mode costs
+// a deferred function per call.
+func (bs *BufferScanner) SetHardened(hardened bool) {
+	bs.hardened = hardened
+	bs.strict = hardened
+}
+
+// Atoi converts a field to a uint64 for a lineFunc. In strict mode, if the
+// field isn't an unsigned decimal integer in range, it counts an error and
+// returns false, so the caller can leave its meter alone rather than export
+// nonsense. Otherwise it is naiveAtoi.
+func (bs *BufferScanner) Atoi(b []byte) (uint64, bool) {
+	if !bs.strict {
+		return naiveAtoi(b), true
+	}
+	v, ok := checkedAtoi(b)
+	if !ok {
+		bs.errors.Add(1)
 	}
+	return v, ok
 }
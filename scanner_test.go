@@ -1,8 +1,16 @@
 package observability
 
 import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"unsafe"
 )
@@ -117,6 +125,148 @@ func BenchmarkAtoiEvil(b *testing.B) {
 	}
 }
 
+var (
+	signedVal = []byte("-8475589")
+	hexVal    = []byte("0x7fa3c1e9")
+)
+
+func BenchmarkNaiveSigned(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		naiveAtoiSigned(signedVal)
+	}
+}
+
+func BenchmarkParseIntSigned(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		strconv.ParseInt(string(signedVal), 10, 64)
+	}
+}
+
+func BenchmarkNaiveHex(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		naiveAtoiHex(hexVal)
+	}
+}
+
+func BenchmarkParseUintHex(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		strconv.ParseUint(string(hexVal), 0, 64)
+	}
+}
+
+func TestNaiveAtoiVariants(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want int64
+	}{{"0", 0}, {"42", 42}, {"-1", -1}, {"-9223372036854775807", -9223372036854775807}} {
+		if got := naiveAtoiSigned([]byte(tc.in)); got != tc.want {
+			t.Errorf("naiveAtoiSigned(%q) = %d, want %d", tc.in, got, tc.want)
+		}
+	}
+	for _, tc := range []struct {
+		in   string
+		want uint64
+	}{{"0", 0}, {"0x1f", 31}, {"1F", 31}, {"0XFFFFFFFFFFFFFFFF", 1<<64 - 1}, {"7fa3c1e9", 0x7fa3c1e9}} {
+		if got := naiveAtoiHex([]byte(tc.in)); got != tc.want {
+			t.Errorf("naiveAtoiHex(%q) = %d, want %d", tc.in, got, tc.want)
+		}
+	}
+}
+
+func BenchmarkChecked(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		checkedAtoi(val)
+	}
+}
+
+func TestCheckedAtoi(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want uint64
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"8475589", 8475589, true},
+		{"18446744073709551615", 1<<64 - 1, true},
+		{"18446744073709551616", 0, false},
+		{"99999999999999999999", 0, false},
+		{"123456789012345678901", 0, false},
+		{"", 0, false},
+		{"12a", 0, false},
+		{"-1", 0, false},
+	} {
+		if got, ok := checkedAtoi([]byte(tc.in)); got != tc.want || ok != tc.ok {
+			t.Errorf("checkedAtoi(%q) = %d, %v, want %d, %v", tc.in, got, ok, tc.want, tc.ok)
+		}
+	}
+	bs := NewBufferScanner(nil, nil)
+	bs.SetStrict(true)
+	if _, ok := bs.Atoi([]byte("1x")); ok || bs.Errors() != 1 {
+		t.Errorf("strict Atoi accepted malformed input, errors %d", bs.Errors())
+	}
+}
+
+var floatVal = []byte("1.02")
+
+func BenchmarkNaiveAtof(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		naiveAtof(floatVal)
+	}
+}
+
+func BenchmarkParseFloat(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		strconv.ParseFloat(string(floatVal), 64)
+	}
+}
+
+func TestNaiveAtof(t *testing.T) {
+	for _, tc := range []struct {
+		in    string
+		micro int64
+	}{{"0", 0}, {"0.85", 850000}, {"1.02", 1020000}, {"-12.5", -12500000}, {"3.1415926", 3141592}, {"7", 7000000}} {
+		if got := naiveAtofMicro([]byte(tc.in)); got != tc.micro {
+			t.Errorf("naiveAtofMicro(%q) = %d, want %d", tc.in, got, tc.micro)
+		}
+		want, _ := strconv.ParseFloat(tc.in, 64)
+		if got := naiveAtof([]byte(tc.in)); got != want {
+			t.Errorf("naiveAtof(%q) = %v, want %v", tc.in, got, want)
+		}
+	}
+}
+
+// BenchmarkAtoiLength compares naiveAtoi with swarAtoi and longAtoi by the
+// number of digits, to show where the wider conversions start to pay off.
+func BenchmarkAtoiLength(b *testing.B) {
+	const digits = "18446744073709551615"
+	for _, n := range []int{4, 8, 12, 16, 20} {
+		v := []byte(digits[:n])
+		for _, f := range []struct {
+			name string
+			f    func([]byte) uint64
+		}{{"naive", naiveAtoi}, {"swar", swarAtoi}, {"long", longAtoi}} {
+			b.Run(fmt.Sprintf("%s/%d", f.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					f.f(v)
+				}
+			})
+		}
+	}
+}
+
+func TestSWARAtoi(t *testing.T) {
+	for _, in := range []string{"", "0", "7", "12345678", "123456789", "1000000000000000",
+		"9999999999999999", "98765432109876543", "18446744073709551615"} {
+		want := naiveAtoi([]byte(in))
+		if got := swarAtoi([]byte(in)); got != want {
+			t.Errorf("swarAtoi(%q) = %d, want %d", in, got, want)
+		}
+		if got := longAtoi([]byte(in)); got != want {
+			t.Errorf("longAtoi(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
 func TestScanner(t *testing.T) {
 	buf := make([]byte, 0, 512)
 	lf := []lineFunc{
@@ -133,6 +283,25 @@ func TestScanner(t *testing.T) {
 	bs.Scan(in)
 }
 
+func TestUnorderedScanner(t *testing.T) {
+	got := map[string]string{}
+	record := func(name string) lineFunc {
+		return lineFunc{
+			name: []byte(name),
+			f: func(fields [][]byte) {
+				got[name] += string(fields[0])
+			},
+		}
+	}
+	lf := []lineFunc{record("bar"), record("foo"), record("missing")}
+	bs := NewUnorderedBufferScanner(make([]byte, 0, 512), lf)
+	bs.Scan([]byte("foo 123\nbaz 1\nbar 456\nfoo 7\n"))
+	want := map[string]string{"foo": "1237", "bar": "456"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
 // BenchmarkScanner checks the time required to scan a trivial input with no
 // functions. This takes about 11ns.
 func BenchmarkScanner(b *testing.B) {
@@ -205,7 +374,993 @@ func BenchmarkScannerXfs(b *testing.B) {
 	}
 	in := []byte(xfsLiteral)
 	bs := NewBufferScanner(buf, lf)
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		bs.Scan(in)
 	}
 }
+
+// xfsLineFuncs returns lineFuncs for most of the lines of xfsLiteral, in
+// order, with f as every function.
+func xfsLineFuncs(f func([][]byte)) []lineFunc {
+	var lf []lineFunc
+	for _, name := range []string{
+		"extent_alloc", "blk_map", "dir", "trans", "ig", "log", "push_ail",
+		"xstrat", "rw", "attr", "icluster", "vnodes", "buf", "abtb2",
+		"abtc2", "bmbt2", "ibt2", "xpc",
+	} {
+		lf = append(lf, lineFunc{name: []byte(name), f: f})
+	}
+	return lf
+}
+
+// BenchmarkUnorderedScannerXfs is BenchmarkScannerXfs in unordered mode, to
+// show the cost of the lookups.
+func BenchmarkUnorderedScannerXfs(b *testing.B) {
+	buf := make([]byte, 0, 4096)
+	f := func(fields [][]byte) {
+		for _, field := range fields {
+			naiveAtoi(field)
+		}
+	}
+	in := []byte(xfsLiteral)
+	bs := NewUnorderedBufferScanner(buf, xfsLineFuncs(f))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bs.Scan(in)
+	}
+}
+
+var meminfoLiteral = `MemTotal:       32768000 kB
+MemFree:         1024 kB
+HugePages_Total:       7
+Hugepagesize:       2048 kB
+`
+
+func TestKeyValueScanner(t *testing.T) {
+	got := map[string]uint64{}
+	record := func(name string) valueFunc {
+		return valueFunc{name: []byte(name), f: func(v uint64) { got[name] = v }}
+	}
+	kvs := NewKeyValueScanner(make([]byte, 0, 512), []valueFunc{
+		record("HugePages_Total"), record("MemTotal"), record("MemFree"), record("Absent"),
+	})
+	kvs.Scan([]byte(meminfoLiteral))
+	want := map[string]uint64{"MemTotal": 32768000 << 10, "MemFree": 1 << 20, "HugePages_Total": 7}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+var netDevLiteral = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 2776770   26934    0    0    0     0          0         0  2776770   26934    0    0    0     0       0          0
+  eth0:12156458790 2751    0    0    0     0          0         0  1782404    2009    0    0    0     0       0          0
+`
+
+func TestTableScanner(t *testing.T) {
+	got := map[string][2]uint64{}
+	ts := NewTableScanner(2, func(key []byte, fields [][]byte) {
+		got[string(key)] = [2]uint64{naiveAtoi(fields[0]), naiveAtoi(fields[8])}
+	})
+	ts.Scan([]byte(netDevLiteral))
+	want := map[string][2]uint64{"lo": {2776770, 2776770}, "eth0": {12156458790, 1782404}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+var netSNMPLiteral = `Ip: Forwarding DefaultTTL InReceives
+Ip: 1 64 2776770
+Tcp: RtoAlgorithm RtoMin RtoMax MaxConn ActiveOpens
+Tcp: 1 200 120000 -1 4161
+Udp: InDatagrams NoPorts
+Udp: 4453 12
+`
+
+func TestPairedScanner(t *testing.T) {
+	got := map[string]string{}
+	record := func(section string, names ...string) sectionFunc {
+		return sectionFunc{name: []byte(section), f: func(p PairedFields) {
+			for _, n := range names {
+				v, ok := p.Get(n)
+				got[section+"."+n] = fmt.Sprintf("%s %v", v, ok)
+			}
+		}}
+	}
+	ps := NewPairedScanner([]sectionFunc{record("Tcp", "MaxConn", "ActiveOpens", "Gone"), record("Udp", "NoPorts")})
+	ps.Scan([]byte(netSNMPLiteral))
+	want := map[string]string{
+		"Tcp.MaxConn":     "-1 true",
+		"Tcp.ActiveOpens": "4161 true",
+		"Tcp.Gone":        " false",
+		"Udp.NoPorts":     "12 true",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+var diskstatsLiteral = `   7       0 loop0 52 0 2104 12 0 0 0 0 0 28 12 0 0 0 0
+   8       0 sda 187032 5428 11523534 58411 1061 1530 45904 1364 0 63424 60384 0 0 0 0
+   8       1 sda1 186884 5428 11515946 58382 1061 1530 45904 1364 0 63384 59746 0 0 0 0
+ 259       0 nvme0n1 24519 12 1391426 4271 58931 1200 4114714 39270 0 41296 45004 0 0 0 0
+`
+
+func TestRowScanner(t *testing.T) {
+	var got []string
+	rs := NewRowScanner(func(fields [][]byte) {
+		got = append(got, string(fields[2])+"="+string(fields[3]))
+	}, fieldIn(0, "8", "259"), fieldPrefix(2, "sd", "nvme"))
+	rs.Scan([]byte(diskstatsLiteral))
+	want := []string{"sda=187032", "sda1=186884", "nvme0n1=24519"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestGlobScanner(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) {
+		p := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("hwmon0/temp1_input", "41000\n")
+	write("hwmon0/temp2_input", "42000\n")
+	write("hwmon1/temp1_input", "43000\n")
+	write("hwmon1/name", "coretemp\n")
+	var got []string
+	gs := NewGlobScanner(filepath.Join(dir, "hwmon*", "temp*_input"), func(_ string, captures []string, contents []byte) {
+		got = append(got, strings.Join(captures, ",")+"="+string(contents))
+	})
+	defer gs.Close()
+	if err := gs.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"0,1=41000", "0,2=42000", "1,1=43000"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	os.RemoveAll(filepath.Join(dir, "hwmon0"))
+	got = nil
+	gs.Scan()
+	if want := []string{"1,1=43000"}; !reflect.DeepEqual(got, want) || len(gs.files) != 1 {
+		t.Errorf("after removal got %q with %d files open, want %q", got, len(gs.files), want)
+	}
+}
+
+func TestScanReader(t *testing.T) {
+	var reads, xpc uint64
+	lf := xfsLineFuncs(func([][]byte) {})
+	lf[8].f = func(fields [][]byte) { reads = naiveAtoi(fields[0]) }
+	lf[17].f = func(fields [][]byte) { xpc = naiveAtoi(fields[2]) }
+	// The buffer is much smaller than the input, but holds any line.
+	bs := NewBufferScanner(make([]byte, 0, 256), lf)
+	if err := bs.ScanReader(strings.NewReader(xfsLiteral)); err != nil {
+		t.Fatal(err)
+	}
+	if reads != 1344496242 || xpc != 18802600680845 {
+		t.Errorf("got reads %d, xpc %d", reads, xpc)
+	}
+	bs = NewBufferScanner(make([]byte, 0, 16), lf)
+	if err := bs.ScanReader(strings.NewReader(xfsLiteral)); err != bufio.ErrTooLong {
+		t.Errorf("got %v, want %v", err, bufio.ErrTooLong)
+	}
+}
+
+func TestFileScanner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xfs")
+	if err := os.WriteFile(path, []byte(xfsLiteral), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var xpc uint64
+	lf := xfsLineFuncs(func([][]byte) {})
+	lf[17].f = func(fields [][]byte) { xpc = naiveAtoi(fields[2]) }
+	fs, err := NewFileScanner(path, NewBufferScanner(make([]byte, 0, 256), lf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	// Start with a small buffer, to exercise growing it.
+	fs.buf = fs.buf[:64]
+	for range 2 {
+		xpc = 0
+		if err := fs.Scan(); err != nil {
+			t.Fatal(err)
+		}
+		if xpc != 18802600680845 {
+			t.Errorf("got xpc %d", xpc)
+		}
+	}
+}
+
+func TestScannerCoverage(t *testing.T) {
+	lf := xfsLineFuncs(func([][]byte) {})
+	// Expect a line that isn't in the input, before the last one.
+	lf = append(lf[:17], lineFunc{name: []byte("gone"), f: func([][]byte) {}}, lf[17])
+	bs := NewBufferScanner(make([]byte, 0, 256), lf)
+	o := NewOrigin()
+	bs.RegisterErrorMeter(o, "xfs")
+	bs.Scan([]byte(xfsLiteral))
+	if bs.Matched() != 17 || !bs.Hits()[16] || bs.Hits()[17] || bs.Hits()[18] {
+		t.Errorf("matched %d, hits %v", bs.Matched(), bs.Hits())
+	}
+	if s := o.Snapshot().Samples; len(s) != 1 || s[0].Value != 1 {
+		t.Errorf("got error meter %+v", s)
+	}
+}
+
+func TestFieldMask(t *testing.T) {
+	var got []string
+	lf := xfsLineFuncs(func([][]byte) {})
+	lf[13].mask = fieldMask(0, 14)
+	lf[13].f = func(fields [][]byte) {
+		for _, f := range fields {
+			got = append(got, string(f))
+		}
+	}
+	NewBufferScanner(make([]byte, 0, 256), lf).Scan([]byte(xfsLiteral))
+	if want := []string{"5079763", "184916757"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFieldCount(t *testing.T) {
+	called := 0
+	lf := xfsLineFuncs(func([][]byte) { called++ })
+	// rw has two fields, and abtb2 has fifteen.
+	lf[8].nfields = 3
+	lf[13].nfields = 15
+	bs := NewBufferScanner(make([]byte, 0, 256), lf)
+	bs.Scan([]byte(xfsLiteral))
+	if called != 17 || bs.Hits()[8] || !bs.Hits()[9] || bs.Errors() != 1 {
+		t.Errorf("called %d, hits %v, errors %d", called, bs.Hits(), bs.Errors())
+	}
+}
+
+const statLiteral = `cpu  10132153 290696 3084719 46828483 16683 0 25195 0 0 0
+cpu0 1393280 32966 572056 13343292 6130 0 17875 0 0 0
+cpu1 1335345 35453 424543 13356364 3536 0 3012 0 0 0
+intr 199292959 19 0 0 0 0 0 0 0 1 0 0 0 0 0 0 0
+ctxt 350851829
+softirq 40185543 1 8706380 0 2346712 0 0 10 8702437 0 20427003
+`
+
+func TestPrefixedLineFunc(t *testing.T) {
+	for _, unordered := range []bool{false, true} {
+		var got []string
+		lf := []lineFunc{
+			{name: []byte("cpu"), f: func(fields [][]byte) {
+				got = append(got, "all "+string(fields[0]))
+			}},
+			{name: []byte("cpu"), prefixed: func(suffix []byte, fields [][]byte) {
+				got = append(got, string(suffix)+" "+string(fields[0]))
+			}},
+			{name: []byte("intr"), f: func(fields [][]byte) {
+				got = append(got, "intr "+string(fields[0]))
+			}},
+		}
+		var bs *BufferScanner
+		if unordered {
+			bs = NewUnorderedBufferScanner(make([]byte, 0, 256), lf)
+		} else {
+			bs = NewBufferScanner(make([]byte, 0, 256), lf)
+		}
+		bs.Scan([]byte(statLiteral))
+		want := []string{"all 10132153", "0 1393280", "1 1335345", "intr 199292959"}
+		if !reflect.DeepEqual(got, want) || bs.Matched() != 3 || bs.Errors() != 0 {
+			t.Errorf("unordered %v: got %q, matched %d, errors %d", unordered, got, bs.Matched(), bs.Errors())
+		}
+	}
+}
+
+func TestMeterScanner(t *testing.T) {
+	writes := DefineCounter(xfsWriteCallsDesc)
+	reads := DefineCounter(xfsReadCallsDesc)
+	bytesWritten := DefineCounter(xfsXPCWriteBytesDesc)
+	s := NewMeterScanner(make([]byte, 0, 256), []fieldMeter{
+		{"rw", 1, reads},
+		{"xpc", 1, bytesWritten},
+		{"rw", 0, writes},
+	})
+	s.Scan([]byte(xfsLiteral))
+	var got []uint64
+	for _, m := range s.Meters() {
+		_, v := m.Value()
+		got = append(got, v)
+	}
+	if want := []uint64{2324555337, 20036891491898, 1344496242}; !reflect.DeepEqual(got, want) || s.Errors() != 0 {
+		t.Errorf("got %v, want %v, errors %d", got, want, s.Errors())
+	}
+}
+
+const memcachedLiteral = "STAT pid 2807\r\nSTAT uptime 1203\r\n" +
+	"STAT version 1.6.21\r\nSTAT rusage_user 0.508297\r\n" +
+	"STAT curr_connections 10\r\nEND\r\n"
+
+func TestMemcachedScanner(t *testing.T) {
+	got := map[string]uint64{}
+	var sfs []statFunc
+	for _, name := range []string{"curr_connections", "uptime", "rusage_user", "missing"} {
+		sfs = append(sfs, statFunc{
+			name:  []byte(name),
+			f:     func(v uint64) { got[name] = v },
+			micro: name == "rusage_user",
+		})
+	}
+	ms := NewMemcachedScanner(make([]byte, 0, 256), sfs)
+	ms.Scan([]byte(memcachedLiteral))
+	want := map[string]uint64{"curr_connections": 10, "uptime": 1203, "rusage_user": 508297}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	r := strings.NewReader(memcachedLiteral + "STAT uptime 1\r\n")
+	if err := ms.ScanReader(r); err != nil {
+		t.Error(err)
+	}
+	if err := ms.ScanReader(strings.NewReader("STAT uptime 5\r\n")); err == nil {
+		t.Error("truncated response wasn't reported")
+	}
+	if err := ms.ScanReader(strings.NewReader("SERVER_ERROR out of memory\r\n")); err == nil {
+		t.Error("server error wasn't reported")
+	}
+}
+
+const redisInfoLiteral = "# Server\r\nredis_version:7.2.4\r\nuptime_in_seconds:1203\r\n\r\n" +
+	"# Keyspace\r\ndb0:keys=1532,expires=12,avg_ttl=0\r\ndb3:keys=7,expires=0,avg_ttl=0\r\n"
+
+func TestRedisInfoScanner(t *testing.T) {
+	var got []string
+	rs := NewRedisInfoScanner(make([]byte, 0, 256), []lineFunc{
+		{name: []byte("db"), prefixed: func(suffix []byte, fields [][]byte) {
+			got = append(got, fmt.Sprintf("db %s %q", suffix, fields))
+		}},
+		{name: []byte("uptime_in_seconds"), f: func(fields [][]byte) {
+			got = append(got, fmt.Sprintf("uptime %q", fields))
+		}},
+	})
+	if err := rs.ScanReader(strings.NewReader(redisInfoLiteral)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`uptime ["1203"]`, `db 0 ["1532" "12" "0"]`, `db 3 ["7" "0" "0"]`}
+	if !reflect.DeepEqual(got, want) || rs.Matched() != 2 {
+		t.Errorf("got %q, matched %d", got, rs.Matched())
+	}
+
+	keys := DefineGauge(DescribeMeter("/test/redis/keys", "Keys in db0."))
+	s := NewRedisMeterScanner(make([]byte, 0, 256), []fieldMeter{{"db0", 0, keys}})
+	s.Scan([]byte(redisInfoLiteral))
+	if _, v := keys.Value(); v != 1532 {
+		t.Errorf("got %d keys, want 1532", v)
+	}
+}
+
+const nvmeLiteral = `{
+  "critical_warning" : 0,
+  "temperature" : 311,
+  "avail_spare" : 100,
+  "data_units_read" : 127463342,
+  "power_on_hours" : 2.1e4,
+  "model" : "Samsung \"EVO\"",
+  "sensors" : [ {"temp": 305}, {"temp": -4, "ok": true, "x": null} ],
+  "empty" : {}
+}`
+
+func TestJSONExtractor(t *testing.T) {
+	got := map[string]string{}
+	var pfs []pathFunc
+	for _, path := range []string{"temperature", "data_units_read", "power_on_hours", "sensors.1.temp", "model", "missing"} {
+		pfs = append(pfs, pathFunc{path: path, f: func(v []byte) { got[path] = string(v) }})
+	}
+	x := NewJSONExtractor(pfs)
+	if err := x.Extract([]byte(nvmeLiteral)); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"temperature": "311", "data_units_read": "127463342",
+		"power_on_hours": "2.1e4", "sensors.1.temp": "-4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, bad := range []string{`{"a":1`, `{"a" 1}`, `[1,]`, `{} x`, strings.Repeat("[", 100) + strings.Repeat("]", 100)} {
+		if err := x.Extract([]byte(bad)); err == nil {
+			t.Errorf("Extract(%q) succeeded", bad)
+		}
+	}
+	b := []byte(nvmeLiteral)
+	var sum uint64
+	x = NewJSONExtractor([]pathFunc{{"sensors.0.temp", func(v []byte) { sum += naiveAtoi(v) }}})
+	if n := testing.AllocsPerRun(10, func() { x.Scan(b) }); n != 0 || x.Errors() != 0 {
+		t.Errorf("got %v allocations, %d errors", n, x.Errors())
+	}
+}
+
+func TestScanDoesNotAllocate(t *testing.T) {
+	var sum uint64
+	bs := NewBufferScanner(nil, xfsLineFuncs(func(fields [][]byte) {
+		sum += naiveAtoi(fields[0])
+	}))
+	in := []byte(xfsLiteral)
+	if n := testing.AllocsPerRun(10, func() { bs.Scan(in) }); n != 0 {
+		t.Errorf("Scan allocated %v times", n)
+	}
+}
+
+const mountstatsLiteral = `device proc mounted on /proc with fstype proc
+device server:/export mounted on /mnt with fstype nfs4 statvers=1.1
+	opts:	rw,vers=4.1,rsize=1048576,wsize=1048576
+	age:	93421
+
+	bytes:	1218 0 0 0 1218 0 1 0
+rootfs is not a device
+	age:	1
+device server:/home mounted on /home with fstype nfs4 statvers=1.1
+	age:	7
+`
+
+func TestStanzaScanner(t *testing.T) {
+	var got []string
+	NewStanzaScanner("device", func(header, fields [][]byte) {
+		if string(fields[0]) == "age:" {
+			got = append(got, string(header[4])+" "+string(fields[1]))
+		}
+	}).Scan([]byte(mountstatsLiteral))
+	if want := []string{"/mnt 93421", "/home 7"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDelimiters(t *testing.T) {
+	var got []string
+	bs := NewBufferScanner(nil, []lineFunc{
+		{name: []byte("TCP"), f: func(fields [][]byte) { got = append(got, fmt.Sprintf("%q", fields)) }},
+		{name: []byte("UDP"), f: func(fields [][]byte) { got = append(got, fmt.Sprintf("%q", fields)) }, mask: fieldMask(1)},
+	})
+	bs.SetDelimiters(":")
+	bs.Scan([]byte("sockets: used 221\nTCP: inuse 5 orphan 0\nUDP: inuse 3 mem 2\n"))
+	if want := []string{`["inuse" "5" "orphan" "0"]`, `["3"]`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = got[:0]
+	rs := NewRowScanner(func(fields [][]byte) { got = append(got, fmt.Sprintf("%q", fields)) })
+	rs.SetParenthesized(true)
+	rs.Scan([]byte("1234 (tmux: server (1)) S 1\n5 () R 2\n"))
+	if want := []string{`["1234" "tmux: server (1)" "S" "1"]`, `["5" "" "R" "2"]`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPartialScan(t *testing.T) {
+	in := []byte(xfsLiteral)
+	for _, reader := range []bool{false, true} {
+		bs := NewBufferScanner(make([]byte, 0, 256), xfsLineFuncs(func([][]byte) {}))
+		bs.SetByteBudget(200)
+		total, scans := 0, 0
+		for ; scans == 0 || bs.Truncated(); scans++ {
+			if reader {
+				r := bytes.NewReader(in[total:])
+				if scans == 0 {
+					bs.ScanReader(r)
+				} else {
+					bs.ResumeReader(r)
+				}
+			} else if scans == 0 {
+				bs.Scan(in)
+			} else {
+				bs.Resume(in[total:])
+			}
+			if bs.Consumed() > 200+80 {
+				t.Errorf("consumed %d bytes with a budget of 200", bs.Consumed())
+			}
+			total += bs.Consumed()
+		}
+		if scans < 2 || bs.Matched() != 18 || bs.Errors() != 0 || total > len(in) {
+			t.Errorf("reader %v: %d scans, matched %d, errors %d, consumed %d of %d",
+				reader, scans, bs.Matched(), bs.Errors(), total, len(in))
+		}
+	}
+
+	calls := 0
+	bs := NewUnorderedBufferScanner(nil, []lineFunc{{name: []byte("foo"), f: func([][]byte) { calls++ }}})
+	bs.SetStopWhenMatched(true)
+	bs.Scan([]byte("bar 1\nfoo 2\nfoo 3\n"))
+	if calls != 1 || bs.Consumed() != 12 || bs.Truncated() {
+		t.Errorf("%d calls, consumed %d", calls, bs.Consumed())
+	}
+}
+
+func TestHardened(t *testing.T) {
+	var sum uint64
+	bs := NewBufferScanner(nil, xfsLineFuncs(func(fields [][]byte) {
+		sum += naiveAtoi(fields[2])
+	}))
+	bs.SetHardened(true)
+	bs.Scan([]byte(xfsLiteral))
+	// xstrat and rw have two fields, so their function panics.
+	if bs.Hits()[7] || bs.Hits()[8] || !bs.Hits()[9] || bs.Errors() != 2 {
+		t.Errorf("hits %v, errors %d", bs.Hits(), bs.Errors())
+	}
+}
+
+// FuzzScan checks that hardened scanners survive any input, with functions
+// that trust their fields as much as collectors usually do.
+func FuzzScan(f *testing.F) {
+	for _, s := range []string{xfsLiteral, statLiteral, "rw 1\x00 2\n", "cpu", "\n\n(", "TCP: (a b) 3"} {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, in []byte) {
+		var sum uint64
+		lf := func(fields [][]byte) {
+			v, _ := strconv.ParseUint(string(fields[0]), 10, 64)
+			sum += naiveAtoi(fields[1]) + v
+		}
+		funcs := append(xfsLineFuncs(lf), lineFunc{name: []byte("cpu"), prefixed: func(_ []byte, fields [][]byte) {
+			lf(fields)
+		}, mask: fieldMask(1, 3)})
+		for _, bs := range []*BufferScanner{
+			NewBufferScanner(make([]byte, 0, 64), funcs),
+			NewUnorderedBufferScanner(make([]byte, 0, 64), funcs),
+		} {
+			bs.SetHardened(true)
+			bs.SetDelimiters(":")
+			bs.SetParenthesized(true)
+			bs.Scan(in)
+			bs.ScanReader(bytes.NewReader(in))
+			for _, field := range bs.Fields(in) {
+				if len(field) == 0 && !bytes.Contains(in, []byte("()")) {
+					t.Errorf("empty field in %q", in)
+				}
+			}
+		}
+	})
+}
+
+// FuzzAtoi checks the atoi family against strconv.
+func FuzzAtoi(f *testing.F) {
+	for _, s := range []string{"0", "8475589", "18446744073709551615", "18446744073709551616", "-1", "1.5", "0x1f", ""} {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, in []byte) {
+		want, err := strconv.ParseUint(string(in), 10, 64)
+		if got, ok := checkedAtoi(in); len(in) <= 20 && (ok != (err == nil) || ok && got != want) {
+			t.Errorf("checkedAtoi(%q) = %d, %v, strconv %d, %v", in, got, ok, want, err)
+		}
+		if err == nil {
+			if got := swarAtoi(in); got != want {
+				t.Errorf("swarAtoi(%q) = %d, want %d", in, got, want)
+			}
+			if got := longAtoi(in); got != want {
+				t.Errorf("longAtoi(%q) = %d, want %d", in, got, want)
+			}
+		}
+		// The rest must merely not panic.
+		naiveAtoi(in)
+		naiveAtoiSigned(in)
+		naiveAtoiHex(in)
+		naiveAtof(in)
+		naiveAtofMicro(in)
+	})
+}
+
+// FuzzJSONExtractor checks that the extractor survives any input.
+func FuzzJSONExtractor(f *testing.F) {
+	f.Add([]byte(nvmeLiteral))
+	f.Add([]byte(`[[[`))
+	f.Fuzz(func(t *testing.T, in []byte) {
+		NewJSONExtractor([]pathFunc{{"sensors.0.temp", func([]byte) {}}}).Extract(in)
+	})
+}
+
+const csvLiteral = "device,model,reads,writes\r\n" +
+	"sda,\"Samsung SSD 870, 1TB\",1043,2210\r\n" +
+	"\r\n" +
+	"sdb,\"The \"\"Fast\"\" One\nrev 2\",7,8\r\n" +
+	"sdc,,9,10\r\n"
+
+func TestCSVScanner(t *testing.T) {
+	var got []string
+	f := func(fields [][]byte) { got = append(got, fmt.Sprintf("%q", fields)) }
+	lf := []lineFunc{{name: []byte("sdb"), f: f}, {name: []byte("sda"), f: f}, {name: []byte("sdc"), f: f}}
+	cs := NewCSVScanner(',', []string{"writes", "model"}, lf)
+	cs.Scan([]byte(csvLiteral))
+	want := []string{`["2210" "Samsung SSD 870, 1TB"]`, `["8" "The \"Fast\" One\nrev 2"]`, `["10" ""]`}
+	if !reflect.DeepEqual(got, want) || cs.Errors() != 0 {
+		t.Errorf("got %q, want %q, errors %d", got, want, cs.Errors())
+	}
+
+	got = got[:0]
+	NewCSVScanner(';', nil, lf).Scan([]byte("sda;1;2\nsdz;3\nsdc;\"x\";"))
+	if want := []string{`["1" "2"]`, `["x" ""]`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	cs = NewCSVScanner(',', nil, []lineFunc{{name: []byte("sda"), f: func([][]byte) {}}})
+	in := []byte(csvLiteral)
+	if n := testing.AllocsPerRun(10, func() { cs.Scan(in) }); n != 0 {
+		t.Errorf("Scan allocated %v times", n)
+	}
+	cs.Scan([]byte("sda,\"unterminated\n"))
+	if cs.Errors() != 1 {
+		t.Errorf("got %d errors, want 1", cs.Errors())
+	}
+}
+
+func TestScratchPool(t *testing.T) {
+	var pool ScratchPool
+	long := "rw " + strings.Repeat("1 ", 3000) + "\n"
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var sum uint64
+			bs := NewUnorderedBufferScanner(nil, xfsLineFuncs(func(fields [][]byte) {
+				sum += naiveAtoi(fields[0])
+			}))
+			bs.SetScratchPool(&pool)
+			for range 100 {
+				bs.Scan([]byte(xfsLiteral))
+				if err := bs.ScanReader(strings.NewReader(long)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if pool.lineSize.Load() < int64(len(long)) || pool.numFields.Load() < 3000 {
+		t.Errorf("pool learned line size %d, %d fields", pool.lineSize.Load(), pool.numFields.Load())
+	}
+}
+
+// BenchmarkScannerXfsPooled is BenchmarkScannerXfs with scratch borrowed from
+// a ScratchPool, which shouldn't allocate either.
+func BenchmarkScannerXfsPooled(b *testing.B) {
+	var pool ScratchPool
+	bs := NewBufferScanner(nil, xfsLineFuncs(func(fields [][]byte) {
+		for _, field := range fields {
+			naiveAtoi(field)
+		}
+	}))
+	bs.SetScratchPool(&pool)
+	in := []byte(xfsLiteral)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bs.Scan(in)
+	}
+}
+
+// BenchmarkScannerXfsMasked is BenchmarkScannerXfs with only the first two
+// fields of each line selected.
+func BenchmarkScannerXfsMasked(b *testing.B) {
+	f := func(fields [][]byte) {
+		for _, field := range fields {
+			naiveAtoi(field)
+		}
+	}
+	lf := xfsLineFuncs(f)
+	for i := range lf {
+		lf[i].mask = fieldMask(0, 1)
+	}
+	in := []byte(xfsLiteral)
+	bs := NewBufferScanner(make([]byte, 0, 4096), lf)
+	for i := 0; i < b.N; i++ {
+		bs.Scan(in)
+	}
+}
+
+// bondingParser is the procParsers parser of the files of /proc/net/bonding.
+func bondingParser() func([]byte) (int, uint64) {
+	calls := 0
+	bs := &bondingScanner{f: func(slave, key, value []byte) {
+		if string(key) == "Link Failure Count" {
+			naiveAtoi(value)
+			calls++
+		}
+	}}
+	return func(b []byte) (int, uint64) { bs.Scan(b); return calls, 0 }
+}
+
+// procParsers are the parse paths of the collectors for the files of the
+// fixture corpus in testdata/proc, which holds captures of /proc, laid out as
+// in /proc, in a directory per kernel version. Each makes a parser, which
+// returns the number of functions it called so far, and the errors found.
+var procParsers = map[string]func() func([]byte) (int, uint64){
+	"fs/xfs/stat": func() func([]byte) (int, uint64) {
+		calls := 0
+		bs := NewBufferScanner(nil, xfsLineFuncs(func(fields [][]byte) {
+			for _, f := range fields {
+				naiveAtoi(f)
+			}
+			calls++
+		}))
+		bs.SetStrict(true)
+		return func(b []byte) (int, uint64) { bs.Scan(b); return calls, bs.Errors() }
+	},
+	"meminfo": func() func([]byte) (int, uint64) {
+		calls := 0
+		var vfs []valueFunc
+		for _, name := range []string{"MemTotal", "MemFree", "Buffers", "Cached", "Dirty", "HugePages_Total"} {
+			vfs = append(vfs, valueFunc{name: []byte(name), f: func(uint64) { calls++ }})
+		}
+		kvs := NewKeyValueScanner(nil, vfs)
+		return func(b []byte) (int, uint64) { kvs.Scan(b); return calls, kvs.bs.Errors() }
+	},
+	"vmstat": func() func([]byte) (int, uint64) {
+		calls := 0
+		var lf []lineFunc
+		for _, name := range []string{"pgfault", "pgmajfault", "pswpin", "pswpout", "oom_kill"} {
+			lf = append(lf, lineFunc{name: []byte(name), f: func([][]byte) { calls++ }, nfields: 1})
+		}
+		bs := NewUnorderedBufferScanner(nil, lf)
+		return func(b []byte) (int, uint64) { bs.Scan(b); return calls, bs.Errors() }
+	},
+	"schedstat": func() func([]byte) (int, uint64) {
+		calls := 0
+		bs := NewUnorderedBufferScanner(nil, []lineFunc{{
+			name:     []byte("cpu"),
+			prefixed: func([]byte, [][]byte) { calls++ },
+		}})
+		return func(b []byte) (int, uint64) { bs.Scan(b); return calls, bs.Errors() }
+	},
+	"stat": func() func([]byte) (int, uint64) {
+		calls := 0
+		f := func([][]byte) { calls++ }
+		bs := NewBufferScanner(nil, []lineFunc{
+			{name: []byte("cpu"), f: f},
+			{name: []byte("cpu"), prefixed: func(_ []byte, fields [][]byte) { f(fields) }},
+			{name: []byte("ctxt"), f: f, nfields: 1},
+			{name: []byte("procs_running"), f: f, nfields: 1},
+		})
+		return func(b []byte) (int, uint64) { bs.Scan(b); return calls, bs.Errors() }
+	},
+	"loadavg": func() func([]byte) (int, uint64) {
+		calls := 0
+		rs := NewRowScanner(func(fields [][]byte) {
+			naiveAtofMicro(fields[0])
+			calls++
+		})
+		return func(b []byte) (int, uint64) { rs.Scan(b); return calls, 0 }
+	},
+	"net/bonding/bond0": bondingParser,
+	"net/bonding/bond1": bondingParser,
+	"net/ip_vs": func() func([]byte) (int, uint64) {
+		calls := 0
+		rs := NewRowScanner(func(fields [][]byte) {
+			if _, backend := ipvsLine(fields); backend {
+				naiveAtoi(fields[ipvsBackendActive])
+				calls++
+			}
+		}, minFields(2))
+		return func(b []byte) (int, uint64) { rs.Scan(b); return calls, 0 }
+	},
+	"net/ip_vs_stats": func() func([]byte) (int, uint64) {
+		calls := 0
+		rs := NewRowScanner(func(fields [][]byte) {
+			naiveAtoiHex(fields[4])
+			calls++
+		}, minFields(5))
+		return func(b []byte) (int, uint64) { rs.Scan(b); return calls, 0 }
+	},
+	"net/stat/nf_conntrack": func() func([]byte) (int, uint64) {
+		calls := 0
+		rs := NewRowScanner(func(fields [][]byte) {
+			naiveAtoiHex(fields[10])
+			calls++
+		}, minFields(11), func(fields [][]byte) bool { return string(fields[0]) != "entries" })
+		return func(b []byte) (int, uint64) { rs.Scan(b); return calls, 0 }
+	},
+	"self/io": func() func([]byte) (int, uint64) {
+		calls := 0
+		var vfs []valueFunc
+		for _, v := range processIOValues {
+			vfs = append(vfs, valueFunc{name: []byte(v.name), f: func(uint64) { calls++ }})
+		}
+		kvs := NewKeyValueScanner(nil, vfs)
+		return func(b []byte) (int, uint64) { kvs.Scan(b); return calls, kvs.bs.Errors() }
+	},
+	"self/mountstats": func() func([]byte) (int, uint64) {
+		calls := 0
+		s := &mountstatsScanner{f: func(_, _, _ []byte, fields [][]byte) {
+			naiveAtoi(fields[mountstatsExecute])
+			calls++
+		}}
+		return func(b []byte) (int, uint64) { s.Scan(b); return calls, 0 }
+	},
+	"self/limits": func() func([]byte) (int, uint64) {
+		calls := 0
+		rs := NewRowScanner(func(fields [][]byte) {
+			naiveAtoi(fields[processLimitsSoft])
+			calls++
+		}, minFields(processLimitsHard+1), fieldIn(1, "open"), fieldIn(2, "files"))
+		return func(b []byte) (int, uint64) { rs.Scan(b); return calls, 0 }
+	},
+	"self/smaps_rollup": func() func([]byte) (int, uint64) {
+		calls := 0
+		var vfs []valueFunc
+		for _, v := range smapsRollupValues {
+			vfs = append(vfs, valueFunc{name: []byte(v.name), f: func(uint64) { calls++ }})
+		}
+		kvs := NewKeyValueScanner(nil, vfs)
+		return func(b []byte) (int, uint64) { kvs.Scan(b); return calls, kvs.bs.Errors() }
+	},
+	"self/stat": func() func([]byte) (int, uint64) {
+		calls := 0
+		rs := NewRowScanner(func(fields [][]byte) {
+			naiveAtoi(fields[processStatResident])
+			calls++
+		}, minFields(processStatResident+1))
+		rs.SetParenthesized(true)
+		return func(b []byte) (int, uint64) { rs.Scan(b); return calls, 0 }
+	},
+	"buddyinfo": func() func([]byte) (int, uint64) {
+		calls := 0
+		rs := NewRowScanner(func(fields [][]byte) {
+			naiveAtoi(fields[4])
+			calls++
+		}, fieldIn(0, "Node"))
+		rs.SetDelimiters(",")
+		return func(b []byte) (int, uint64) { rs.Scan(b); return calls, 0 }
+	},
+	"zoneinfo": func() func([]byte) (int, uint64) {
+		calls := 0
+		ss := NewStanzaScanner("Node", func(_, fields [][]byte) {
+			if string(fields[0]) == "min" {
+				calls++
+			}
+		})
+		return func(b []byte) (int, uint64) { ss.Scan(b); return calls, 0 }
+	},
+	"slabinfo": func() func([]byte) (int, uint64) {
+		calls := 0
+		rs := NewRowScanner(func(fields [][]byte) {
+			naiveAtoi(fields[slabNumSlabs])
+			calls++
+		}, minFields(slabFields))
+		return func(b []byte) (int, uint64) { rs.Scan(b); return calls, 0 }
+	},
+	"diskstats": func() func([]byte) (int, uint64) {
+		calls := 0
+		rs := NewRowScanner(func(fields [][]byte) {
+			naiveAtoi(fields[3])
+			calls++
+		})
+		return func(b []byte) (int, uint64) { rs.Scan(b); return calls, 0 }
+	},
+	"drbd": func() func([]byte) (int, uint64) {
+		calls := 0
+		s := &drbdScanner{f: func(_, key, value []byte) {
+			if string(key) == "oos" {
+				naiveAtoi(value)
+				calls++
+			}
+		}}
+		return func(b []byte) (int, uint64) { s.Scan(b); return calls, 0 }
+	},
+	"net/dev": func() func([]byte) (int, uint64) {
+		calls := 0
+		ts := NewTableScanner(2, func(_ []byte, fields [][]byte) {
+			naiveAtoi(fields[0])
+			calls++
+		})
+		return func(b []byte) (int, uint64) { ts.Scan(b); return calls, 0 }
+	},
+	"net/wireless": func() func([]byte) (int, uint64) {
+		calls := 0
+		ts := NewTableScanner(2, func(_ []byte, fields [][]byte) {
+			wirelessQuality(fields[wirelessLevel])
+			naiveAtoi(fields[wirelessMissedBeacons])
+			calls++
+		})
+		return func(b []byte) (int, uint64) { ts.Scan(b); return calls, 0 }
+	},
+	"net/snmp": func() func([]byte) (int, uint64) {
+		calls := 0
+		ps := NewPairedScanner([]sectionFunc{{name: []byte("Tcp"), f: func(p PairedFields) {
+			if _, ok := p.Get("ActiveOpens"); ok {
+				calls++
+			}
+		}}})
+		return func(b []byte) (int, uint64) { ps.Scan(b); return calls, 0 }
+	},
+	"net/netstat": func() func([]byte) (int, uint64) {
+		calls := 0
+		ps := NewPairedScanner([]sectionFunc{{name: []byte("TcpExt"), f: func(p PairedFields) {
+			if _, ok := p.Get("ListenDrops"); ok {
+				calls++
+			}
+		}}})
+		return func(b []byte) (int, uint64) { ps.Scan(b); return calls, 0 }
+	},
+	"net/softnet_stat": func() func([]byte) (int, uint64) {
+		calls := 0
+		rs := NewRowScanner(func(fields [][]byte) {
+			naiveAtoiHex(fields[0])
+			calls++
+		})
+		return func(b []byte) (int, uint64) { rs.Scan(b); return calls, 0 }
+	},
+	"net/rpc/nfs": func() func([]byte) (int, uint64) {
+		calls := 0
+		bs := NewUnorderedBufferScanner(nil, []lineFunc{{
+			name:     []byte("proc"),
+			prefixed: func([]byte, [][]byte) { calls++ },
+		}})
+		return func(b []byte) (int, uint64) { bs.Scan(b); return calls, bs.Errors() }
+	},
+	"net/rpc/nfsd": func() func([]byte) (int, uint64) {
+		calls := 0
+		bs := NewUnorderedBufferScanner(nil, []lineFunc{
+			{name: []byte("rc"), f: func([][]byte) { calls++ }, nfields: 3},
+			{name: []byte("io"), f: func([][]byte) { calls++ }, nfields: 2},
+		})
+		return func(b []byte) (int, uint64) { bs.Scan(b); return calls, bs.Errors() }
+	},
+	"net/sockstat": func() func([]byte) (int, uint64) {
+		calls := 0
+		f := func([][]byte) { calls++ }
+		bs := NewBufferScanner(nil, []lineFunc{
+			{name: []byte("TCP"), f: f, mask: fieldMask(1, 3)},
+			{name: []byte("UDP"), f: f, mask: fieldMask(1)},
+		})
+		bs.SetDelimiters(":")
+		return func(b []byte) (int, uint64) { bs.Scan(b); return calls, bs.Errors() }
+	},
+}
+
+// procFixtures returns the paths of the files of the fixture corpus that
+// have parsers, relative to testdata/proc.
+func procFixtures(tb testing.TB) []string {
+	var paths []string
+	kernels, err := os.ReadDir(filepath.Join("testdata", "proc"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, k := range kernels {
+		for file := range procParsers {
+			path := filepath.Join(k.Name(), file)
+			if _, err := os.Stat(filepath.Join("testdata", "proc", path)); err == nil {
+				paths = append(paths, path)
+			}
+		}
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// TestProcFixtures checks that every parser understands every capture of its
+// file.
+func TestProcFixtures(t *testing.T) {
+	for _, path := range procFixtures(t) {
+		b, err := os.ReadFile(filepath.Join("testdata", "proc", path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := strings.SplitN(path, string(filepath.Separator), 2)[1]
+		if calls, errs := procParsers[file]()(b); calls == 0 || errs != 0 {
+			t.Errorf("%s: %d calls, %d errors", path, calls, errs)
+		}
+	}
+}
+
+// BenchmarkProcFixtures runs every parser against every capture of its file.
+func BenchmarkProcFixtures(b *testing.B) {
+	for _, path := range procFixtures(b) {
+		in, err := os.ReadFile(filepath.Join("testdata", "proc", path))
+		if err != nil {
+			b.Fatal(err)
+		}
+		file := strings.SplitN(path, string(filepath.Separator), 2)[1]
+		b.Run(path, func(b *testing.B) {
+			parse := procParsers[file]()
+			b.ReportAllocs()
+			b.SetBytes(int64(len(in)))
+			for i := 0; i < b.N; i++ {
+				parse(in)
+			}
+		})
+	}
+}
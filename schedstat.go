@@ -0,0 +1,91 @@
+package observability
+
+import (
+	"time"
+)
+
+var (
+	cpuRunTimeDesc = DescribeMeter(
+		"/cpu/run_time",
+		"Time spent running tasks by each CPU.",
+		Cumulative(), Units("ns"))
+	cpuRunDelayDesc = DescribeMeter(
+		"/cpu/run_delay",
+		"Time spent by tasks waiting on the run queue of each CPU, summed "+
+			"over the tasks. Unlike utilization, it measures contention: "+
+			"divided by the time elapsed, it is the average number of "+
+			"tasks waiting to run.",
+		Cumulative(), Units("ns"))
+	cpuTimeslicesDesc = DescribeMeter(
+		"/cpu/timeslices",
+		"Number of timeslices run by each CPU. It can be used in "+
+			"conjunction with `/cpu/run_delay` to calculate the average "+
+			"wait for each timeslice.",
+		Cumulative())
+)
+
+// RegisterSchedStats registers meters of the scheduling latency of each CPU
+// with o, sampled from /proc/schedstat and labeled with the CPU number. The
+// file only exists if the kernel was built with CONFIG_SCHEDSTATS, and on
+// recent kernels it is only updated while the kernel.sched_schedstats sysctl
+// is set. The CPUs are those online at registration. The file stays open for
+// the life of the Origin.
+func RegisterSchedStats(o *Origin) error {
+	return registerSchedStats(o, "/proc/schedstat")
+}
+
+func registerSchedStats(o *Origin, path string) error {
+	// The last three fields of each cpu line are the time spent running,
+	// the time spent waiting, and the number of timeslices. The fields
+	// before them have changed between versions of the file.
+	const nfields = 9
+	var ms []Meter
+	cpus := make(map[string][]Meter)
+	discover := NewUnorderedBufferScanner(nil, []lineFunc{{
+		name:    []byte("cpu"),
+		nfields: nfields,
+		prefixed: func(suffix []byte, _ [][]byte) {
+			label := Label{Key: "cpu", Value: string(suffix)}
+			meters := []Meter{
+				DefineCounter(cpuRunTimeDesc, label),
+				DefineCounter(cpuRunDelayDesc, label),
+				DefineCounter(cpuTimeslicesDesc, label),
+			}
+			cpus[string(suffix)] = meters
+			ms = append(ms, meters...)
+		},
+	}})
+	fs, err := NewFileScanner(path, discover)
+	if err != nil {
+		return err
+	}
+	err = fs.Scan()
+	fs.Close()
+	if err != nil {
+		return err
+	}
+
+	var now time.Time
+	bs := NewUnorderedBufferScanner(nil, []lineFunc{{
+		name:    []byte("cpu"),
+		nfields: nfields,
+		prefixed: func(suffix []byte, fields [][]byte) {
+			// The conversion doesn't allocate.
+			meters, ok := cpus[string(suffix)]
+			if !ok {
+				return
+			}
+			for i, m := range meters {
+				m.SampleAt(now, naiveAtoi(fields[nfields-3+i]))
+			}
+		},
+	}})
+	if fs, err = NewFileScanner(path, bs); err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		fs.Scan()
+	}, ms...)
+	return nil
+}
@@ -0,0 +1,115 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// Exporter is a destination for snapshots, for sinks that this package doesn't
+// provide, such as Kafka or a proprietary RPC service. An implementation only
+// has to deliver the samples; a Scheduler takes care of when to collect them,
+// which meters to include, and their temporality.
+//
+// Export is called with the samples of one Origin at a time. An Origin with
+// more samples than the Scheduler's chunk size is passed in several calls, each
+// with the Origin's identity; see ExportChunkSize. The samples are only valid
+// during the call, and must not be modified. If the Exporter also implements
+// io.Closer, the Scheduler closes it when it is removed or the Scheduler stops
+// running.
+type Exporter interface {
+	Export(Snapshot) error
+}
+
+// Scheduler periodically collects the meters of one or more Origins and passes
+// them to every Exporter added to it. The ExportOptions of the Scheduler, such
+// as ExportInterval, ExportAllow, and ExportTemporality, apply to all of its
+// Exporters; use separate Schedulers for Exporters that need different ones.
+type Scheduler struct {
+	cfg     exportConfig
+	origins []*Origin
+
+	// mu protects exporters, and serializes pushes.
+	mu        sync.Mutex
+	exporters []Exporter
+}
+
+// NewScheduler returns a Scheduler for the given origins, with no Exporters.
+func NewScheduler(origins []*Origin, opts ...ExportOption) *Scheduler {
+	return &Scheduler{
+		cfg:     newExportConfig(opts),
+		origins: origins,
+	}
+}
+
+// AddExporter adds e to the Exporters that receive snapshots, starting with the
+// next push.
+func (s *Scheduler) AddExporter(e Exporter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exporters = append(s.exporters, e)
+}
+
+// RemoveExporter removes e from the Exporters that receive snapshots, and
+// closes it if it is an io.Closer. e is found by comparing it with ==, so an
+// Exporter that is to be removed must be of a comparable type, such as a
+// pointer. One that isn't, such as a struct holding a slice, is never found.
+func (s *Scheduler) RemoveExporter(e Exporter) error {
+	s.mu.Lock()
+	i := slices.IndexFunc(s.exporters, func(x Exporter) bool {
+		// Comparing values of the same type that isn't comparable
+		// panics.
+		return reflect.TypeOf(x) == reflect.TypeOf(e) && reflect.ValueOf(e).Comparable() && x == e
+	})
+	if i < 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	s.exporters = slices.Delete(s.exporters, i, i+1)
+	s.mu.Unlock()
+	if c, ok := e.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Push collects the meters of every Origin once, and passes them to every
+// Exporter. An Exporter that fails doesn't stop the others from receiving the
+// samples; Push returns all of the errors joined together.
+func (s *Scheduler) Push(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	err := s.cfg.collect(s.origins, func(_ int, snap Snapshot) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, e := range s.exporters {
+			if err := e.Export(snap); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return nil
+	})
+	return errors.Join(append(errs, err)...)
+}
+
+// Run pushes periodically until the context is done, and then closes the
+// Exporters that are io.Closers. Failed pushes are reported to the function
+// set with ExportErrors, and do not stop the loop.
+func (s *Scheduler) Run(ctx context.Context) error {
+	err := runPeriodically(ctx, s.cfg, s.Push)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.exporters {
+		if c, ok := e.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				s.cfg.errorf(err)
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	scrapeInFlightDesc = DescribeMeter(
+		"/observability/scrapes/in_flight",
+		"Number of scrapes being served by the handler, including the one "+
+			"reading this value.")
+	scrapeRejectedDesc = DescribeMeter(
+		"/observability/scrapes/rejected",
+		"Number of scrapes rejected with 503 because the handler was already "+
+			"serving as many as ExportMaxScrapes allows.",
+		Cumulative())
+)
+
+// ExportMaxScrapes returns an ExportOption that limits a scrape handler to
+// serving n requests at once, so that a misconfigured fleet of scrapers can't
+// exhaust the agent's memory and CPU. Further requests are rejected at once
+// with 503 Service Unavailable, rather than queued. By default there is no
+// limit.
+func ExportMaxScrapes(n int) ExportOption {
+	return exportFunctor(func(c exportConfig) exportConfig {
+		c.maxScrapes = n
+		return c
+	})
+}
+
+// ExportScrapeMeters returns an ExportOption that makes a scrape handler
+// register meters of its own health with o: the number of scrapes in flight,
+// and the number rejected by ExportMaxScrapes. The meters are labeled with the
+// kind of handler, such as handler=prometheus. o may be one of the Origins the
+// handler serves.
+func ExportScrapeMeters(o *Origin) ExportOption {
+	return exportFunctor(func(c exportConfig) exportConfig {
+		c.scrapeOrigin = o
+		return c
+	})
+}
+
+// scrapeLimiter admits scrapes to a handler, and bounds the time each spends
+// serializing its response by the export timeout.
+type scrapeLimiter struct {
+	// sem has a slot for each scrape in flight, or is nil if they are
+	// unlimited.
+	sem      chan struct{}
+	timeout  time.Duration
+	inFlight atomic.Int64
+	rejected atomic.Uint64
+}
+
+func newScrapeLimiter(c *exportConfig, handler string) *scrapeLimiter {
+	l := &scrapeLimiter{timeout: c.timeout}
+	if c.maxScrapes > 0 {
+		l.sem = make(chan struct{}, c.maxScrapes)
+	}
+	if c.scrapeOrigin != nil {
+		label := Label{Key: "handler", Value: handler}
+		inFlight := DefineGauge(scrapeInFlightDesc, label)
+		rejected := DefineCounter(scrapeRejectedDesc, label)
+		c.scrapeOrigin.RegisterFunction(func() {
+			now := time.Now()
+			inFlight.SampleAt(now, uint64(l.inFlight.Load()))
+			rejected.SampleAt(now, l.rejected.Load())
+		}, inFlight, rejected)
+	}
+	return l
+}
+
+// begin admits a scrape, returning a context that expires at its deadline,
+// and a function to call when it is done. If the scrape isn't admitted, begin
+// answers it and returns false.
+func (l *scrapeLimiter) begin(w http.ResponseWriter, r *http.Request) (context.Context, func(), bool) {
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		default:
+			l.rejected.Add(1)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many concurrent scrapes", http.StatusServiceUnavailable)
+			return nil, nil, false
+		}
+	}
+	l.inFlight.Add(1)
+	deadline := time.Now().Add(l.timeout)
+	// Also bound the writes, in case the scraper stops reading. Not every
+	// ResponseWriter supports deadlines; the context suffices for those.
+	http.NewResponseController(w).SetWriteDeadline(deadline)
+	ctx, cancel := context.WithDeadline(r.Context(), deadline)
+	return ctx, func() {
+		cancel()
+		l.inFlight.Add(-1)
+		if l.sem != nil {
+			<-l.sem
+		}
+	}, true
+}
@@ -0,0 +1,87 @@
+package observability
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ScratchPool holds line buffers and field scratch space for scanners to
+// borrow for the duration of each scan, rather than each keeping its own. When
+// many collectors run in parallel, it bounds the scratch memory by the number
+// of scans in progress rather than the number of scanners, without allocating
+// per scan. New scratch is sized from the longest line and most fields observed
+// so far, so that it rarely has to grow. The zero ScratchPool is ready to use.
+type ScratchPool struct {
+	pool sync.Pool
+	// lineSize and numFields are the observed maxima.
+	lineSize  atomic.Int64
+	numFields atomic.Int64
+}
+
+type scratch struct {
+	lineBuf []byte
+	fields  [][]byte
+}
+
+// defaultLineSize is the size of the first line buffers of a pool, which
+// holds the lines of almost all /proc files.
+const defaultLineSize = 4096
+
+func (p *ScratchPool) get() *scratch {
+	if s, ok := p.pool.Get().(*scratch); ok {
+		return s
+	}
+	return &scratch{
+		lineBuf: make([]byte, 0, max(p.lineSize.Load(), defaultLineSize)),
+		fields:  make([][]byte, 0, p.numFields.Load()),
+	}
+}
+
+// put returns s to the pool, after recording its sizes, and the longest line
+// that was read with it, which may not have fit.
+func (p *ScratchPool) put(s *scratch, longest int) {
+	if longest > cap(s.lineBuf) {
+		s.lineBuf = make([]byte, 0, 2*longest)
+	}
+	clear(s.fields[:cap(s.fields)])
+	s.fields = s.fields[:0]
+	raise(&p.lineSize, int64(cap(s.lineBuf)))
+	raise(&p.numFields, int64(cap(s.fields)))
+	p.pool.Put(s)
+}
+
+// raise sets m to v if v is greater.
+func raise(m *atomic.Int64, v int64) {
+	for old := m.Load(); v > old && !m.CompareAndSwap(old, v); old = m.Load() {
+	}
+}
+
+// SetScratchPool makes the scanner borrow its line buffer and field scratch
+// from p for each scan, instead of keeping its own. The buffer given to the
+// constructor is then unused, and may be nil. The fields passed to the
+// functions, and those returned by Fields, are only valid during the scan.
+// Like other changes to a scanner, this must not be done during a scan.
+func (bs *BufferScanner) SetScratchPool(p *ScratchPool) {
+	bs.pool = p
+}
+
+// borrow takes the scratch space for a scan from the pool, if there is one.
+func (bs *BufferScanner) borrow() {
+	if bs.pool == nil {
+		return
+	}
+	bs.scratch = bs.pool.get()
+	bs.lineBuf = bs.scratch.lineBuf[:cap(bs.scratch.lineBuf)]
+	bs.fields = bs.scratch.fields
+}
+
+// giveBack returns the scratch space borrowed for a scan, in which lines of
+// up to longest bytes were read.
+func (bs *BufferScanner) giveBack(longest int) {
+	if bs.scratch == nil {
+		return
+	}
+	bs.scratch.fields = bs.fields
+	bs.pool.put(bs.scratch, longest)
+	bs.scratch, bs.lineBuf, bs.fields = nil, nil, nil
+}
@@ -0,0 +1,93 @@
+package observability
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	selfCPUTimeDesc = DescribeMeter(
+		"/self/cpu_time",
+		"CPU time consumed by this process, the monitoring agent, in each "+
+			"mode, user or system, in hundredths of a second (USER_HZ "+
+			"jiffies).",
+		Cumulative(), Units("cs"))
+	selfResidentDesc = DescribeMeter(
+		"/self/resident",
+		"Resident memory of this process, the monitoring agent.",
+		Units("By"))
+	selfOpenFDsDesc = DescribeMeter(
+		"/self/fds/open",
+		"Number of file descriptors this process, the monitoring agent, "+
+			"has open, most of them files held open by collectors.")
+	selfReadCharsDesc = DescribeMeter(
+		"/self/read_chars",
+		"Bytes read by this process, the monitoring agent, from files, "+
+			"mostly those of /proc and /sys, and sockets.",
+		Cumulative(), Units("By"))
+	selfCollectionTimeDesc = DescribeMeter(
+		"/self/collection_time",
+		"Time spent by this process, the monitoring agent, in the "+
+			"functions that sample meters, during the collections of all of "+
+			"its Origins, not counting exporting the samples.",
+		Cumulative(), Units("ns"))
+	selfCollectionsDesc = DescribeMeter(
+		"/self/collections",
+		"Number of collections of the Origins of this process, the "+
+			"monitoring agent. `/self/collection_time` divided by it is "+
+			"the cost of each.",
+		Cumulative())
+)
+
+// RegisterSelfStats registers meters of the resources used by this process
+// with o, so that the cost of monitoring is itself monitored: its CPU time and
+// resident memory, from /proc/self/stat, its open file descriptors, the bytes
+// it has read, from /proc/self/io, and the time spent collecting its Origins.
+// The files stay open for the life of the Origin.
+func RegisterSelfStats(o *Origin) error {
+	return registerSelfStats(o, "/proc/self")
+}
+
+func registerSelfStats(o *Origin, dir string) error {
+	pageSize := uint64(os.Getpagesize())
+	var (
+		user            = DefineCounter(selfCPUTimeDesc, Label{Key: "mode", Value: "user"})
+		system          = DefineCounter(selfCPUTimeDesc, Label{Key: "mode", Value: "system"})
+		resident        = DefineGauge(selfResidentDesc)
+		open            = DefineGauge(selfOpenFDsDesc)
+		readChars       = DefineCounter(selfReadCharsDesc)
+		collectionTime  = DefineCounter(selfCollectionTimeDesc)
+		collectionCount = DefineCounter(selfCollectionsDesc)
+	)
+	var now time.Time
+	rs := NewRowScanner(func(fields [][]byte) {
+		user.SampleAt(now, naiveAtoi(fields[processStatUserTime]))
+		system.SampleAt(now, naiveAtoi(fields[processStatSystemTime]))
+		resident.SampleAt(now, naiveAtoi(fields[processStatResident])*pageSize)
+	}, minFields(processStatResident+1))
+	rs.SetParenthesized(true)
+	stat, err := NewFileScanner(filepath.Join(dir, "stat"), rs)
+	if err != nil {
+		return err
+	}
+	ioStats, err := NewFileScanner(filepath.Join(dir, "io"), NewKeyValueScanner(nil, []valueFunc{
+		{name: []byte("rchar"), f: func(n uint64) { readChars.SampleAt(now, n) }},
+	}))
+	if err != nil {
+		stat.Close()
+		return err
+	}
+	fdDir := filepath.Join(dir, "fd")
+	o.RegisterFunction(func() {
+		now = time.Now()
+		stat.Scan()
+		ioStats.Scan()
+		if n, err := countDirEntries(fdDir); err == nil {
+			open.SampleAt(now, n)
+		}
+		collectionTime.SampleAt(now, uint64(collectTime.Load()))
+		collectionCount.SampleAt(now, collections.Load())
+	}, user, system, resident, open, readChars, collectionTime, collectionCount)
+	return nil
+}
@@ -0,0 +1,209 @@
+package observability
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"strings"
+)
+
+// The shared memory segment written by SharedMemoryExporter is a file laid out
+// as follows, with all integers little-endian, so that a sidecar or a tool
+// reading a crash dump can find the latest values without any RPC. Offsets are
+// in bytes.
+//
+//	Header, 64 bytes:
+//	 0  magic       "OBSVSHM\x00"
+//	 8  version     uint32, currently 1
+//	12  record size uint32, currently 32
+//	16  sequence    uint64, odd while the segment is being written
+//	24  updated     int64, Unix nanoseconds of the last write
+//	32  count       uint32, number of records
+//	36  used        uint32, bytes of the file in use
+//	40  reserved
+//
+//	Records, count times record size bytes, starting at offset 64:
+//	 0  value       uint64
+//	 8  time        int64, Unix nanoseconds when sampled
+//	16  reset       int64, Unix nanoseconds when last reset
+//	24  key offset  uint32, from the start of the file
+//	28  key length  uint16
+//	30  flags       uint16, bit 0 set for cumulative meters
+//
+// The key of a record is the origin identity, the meter name, and the meter
+// labels, separated by NUL bytes. Each set of labels is key=value pairs
+// separated by \x01 bytes. Keys follow the records.
+//
+// The sequence number works as a seqlock: a reader copies the segment, and
+// retries if the sequence number was odd or changed in the meantime. Readers
+// must not assume the file size is constant, since it grows when the records
+// no longer fit. Later versions may add fields to the reserved space and the
+// end of records, but won't move existing fields.
+
+const (
+	shmMagic      = "OBSVSHM\x00"
+	shmVersion    = 1
+	shmHeaderSize = 64
+	shmRecordSize = 32
+
+	shmSeqOffset = 16
+)
+
+var errShmMalformed = errors.New("observability: malformed shared memory segment")
+
+// appendShmSegment appends a segment with the contents of snaps, with the
+// sequence number zero, and returns it.
+func appendShmSegment(b []byte, snaps []Snapshot, updated uint64) []byte {
+	var count int
+	for _, snap := range snaps {
+		for _, s := range snap.Samples {
+			if !s.Time.IsZero() {
+				count++
+			}
+		}
+	}
+	start := len(b)
+	b = append(b, shmMagic...)
+	b = binary.LittleEndian.AppendUint32(b, shmVersion)
+	b = binary.LittleEndian.AppendUint32(b, shmRecordSize)
+	b = binary.LittleEndian.AppendUint64(b, 0)
+	b = binary.LittleEndian.AppendUint64(b, updated)
+	b = binary.LittleEndian.AppendUint32(b, uint32(count))
+	b = binary.LittleEndian.AppendUint32(b, 0) // used, filled in below
+	b = append(b, make([]byte, shmHeaderSize-40+count*shmRecordSize)...)
+
+	rec := start + shmHeaderSize
+	for _, snap := range snaps {
+		origin := shmLabels(snap.Origin)
+		for _, s := range snap.Samples {
+			if s.Time.IsZero() {
+				continue
+			}
+			key := len(b)
+			b = append(b, origin...)
+			b = append(b, 0)
+			b = append(b, s.Description.Name()...)
+			b = append(b, 0)
+			b = append(b, shmLabels(s.Labels)...)
+			if len(b)-key > 0xffff {
+				// Too long to describe; leave the key empty.
+				b = b[:key]
+			}
+			r := b[rec : rec+shmRecordSize]
+			binary.LittleEndian.PutUint64(r[0:], s.Value)
+			binary.LittleEndian.PutUint64(r[8:], unixNano(s.Time))
+			binary.LittleEndian.PutUint64(r[16:], unixNano(s.Reset))
+			binary.LittleEndian.PutUint32(r[24:], uint32(key-start))
+			binary.LittleEndian.PutUint16(r[28:], uint16(len(b)-key))
+			if s.Description.Cumulative() {
+				binary.LittleEndian.PutUint16(r[30:], 1)
+			}
+			rec += shmRecordSize
+		}
+	}
+	binary.LittleEndian.PutUint32(b[start+36:], uint32(len(b)-start))
+	return b
+}
+
+func shmLabels(labels []Label) string {
+	var sb strings.Builder
+	for i, l := range labels {
+		if i > 0 {
+			sb.WriteByte(1)
+		}
+		sb.WriteString(l.Key)
+		sb.WriteByte('=')
+		sb.WriteString(l.Value)
+	}
+	return sb.String()
+}
+
+func parseShmLabels(s string) []Label {
+	if s == "" {
+		return nil
+	}
+	var labels []Label
+	for _, kv := range strings.Split(s, "\x01") {
+		k, v, _ := strings.Cut(kv, "=")
+		labels = append(labels, Label{Key: k, Value: v})
+	}
+	return labels
+}
+
+// ReadSharedMemory reads the segment at path written by a
+// SharedMemoryExporter, possibly in another process, and returns its contents
+// as one Snapshot per Origin. The descriptions have only the name and
+// cumulative flag of each meter.
+func ReadSharedMemory(path string) ([]Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var seq [8]byte
+	for tries := 0; ; tries++ {
+		if tries == 100 {
+			return nil, errors.New("observability: shared memory segment is changing too fast to read")
+		}
+		if _, err := f.ReadAt(seq[:], shmSeqOffset); err != nil {
+			return nil, err
+		}
+		if seq[0]&1 != 0 {
+			continue
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, fi.Size())
+		if _, err := f.ReadAt(b, 0); err != nil {
+			continue
+		}
+		if !bytes.Equal(b[shmSeqOffset:shmSeqOffset+8], seq[:]) {
+			continue
+		}
+		return parseShmSegment(b)
+	}
+}
+
+func parseShmSegment(b []byte) ([]Snapshot, error) {
+	if len(b) < shmHeaderSize || string(b[:8]) != shmMagic || binary.LittleEndian.Uint32(b[8:]) != shmVersion {
+		return nil, errShmMalformed
+	}
+	size := int(binary.LittleEndian.Uint32(b[12:]))
+	count := int(binary.LittleEndian.Uint32(b[32:]))
+	if size < shmRecordSize || count > (len(b)-shmHeaderSize)/size {
+		return nil, errShmMalformed
+	}
+	var snaps []Snapshot
+	var origin string
+	for i := 0; i < count; i++ {
+		r := b[shmHeaderSize+i*size:]
+		off := int(binary.LittleEndian.Uint32(r[24:]))
+		n := int(binary.LittleEndian.Uint16(r[28:]))
+		if off+n > len(b) {
+			return nil, errShmMalformed
+		}
+		fields := strings.SplitN(string(b[off:off+n]), "\x00", 3)
+		for len(fields) < 3 {
+			fields = append(fields, "")
+		}
+		if len(snaps) == 0 || fields[0] != origin {
+			origin = fields[0]
+			snaps = append(snaps, Snapshot{Origin: parseShmLabels(origin)})
+		}
+		snap := &snaps[len(snaps)-1]
+		snap.Samples = append(snap.Samples, Sample{
+			Description: MeterDescription{
+				name:       fields[1],
+				cumulative: binary.LittleEndian.Uint16(r[30:])&1 != 0,
+			},
+			Labels: parseShmLabels(fields[2]),
+			Time:   fromUnixNano(binary.LittleEndian.Uint64(r[8:])),
+			Reset:  fromUnixNano(binary.LittleEndian.Uint64(r[16:])),
+			Value:  binary.LittleEndian.Uint64(r[0:]),
+		})
+	}
+	return snaps, nil
+}
@@ -0,0 +1,122 @@
+//go:build linux || darwin || freebsd
+
+package observability
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// SharedMemoryExporter maintains a memory-mapped file holding the latest values
+// of the meters of one or more Origins, in the spirit of Varnish's shared
+// memory statistics. Other processes can read it at any time without any RPC,
+// with ReadSharedMemory or directly; the layout is documented in shm.go. As
+// the mapping is shared with the file, the last values survive a crash of the
+// exporting process.
+type SharedMemoryExporter struct {
+	cfg     exportConfig
+	origins []*Origin
+
+	// mu protects everything below.
+	mu    sync.Mutex
+	f     *os.File
+	mem   []byte
+	buf   []byte
+	snaps []Snapshot
+}
+
+// NewSharedMemoryExporter returns an exporter that writes the segment at path,
+// creating it with permissions 0644 if it doesn't exist, and replacing its
+// contents if it does. Put it on a tmpfs, such as /dev/shm, to keep the
+// writes off disk.
+func NewSharedMemoryExporter(path string, origins []*Origin, opts ...ExportOption) (*SharedMemoryExporter, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	e := &SharedMemoryExporter{
+		cfg:     newExportConfig(opts),
+		origins: origins,
+		f:       f,
+	}
+	// Start with an empty segment, so readers never see a stale one.
+	if err := e.write(nil); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// Push takes a snapshot of every Origin and writes it to the segment.
+func (e *SharedMemoryExporter) Push(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// The segment is written at once, so that readers see a consistent
+	// view; the chunks are copied out of the Origins' buffers.
+	e.snaps = e.snaps[:0]
+	e.cfg.collect(e.origins, func(_ int, snap Snapshot) error {
+		if len(snap.Samples) > 0 {
+			snap.Samples = append([]Sample(nil), snap.Samples...)
+			e.snaps = append(e.snaps, snap)
+		}
+		return nil
+	})
+	return e.write(e.snaps)
+}
+
+func (e *SharedMemoryExporter) write(snaps []Snapshot) error {
+	e.buf = appendShmSegment(e.buf[:0], snaps, uint64(time.Now().UnixNano()))
+	if len(e.buf) > len(e.mem) {
+		// Grow the file geometrically, and map it again. The file
+		// never shrinks, so readers with an older, smaller mapping
+		// see a truncated but valid segment until they remap.
+		size := 4096
+		for size < len(e.buf) {
+			size *= 2
+		}
+		if err := e.f.Truncate(int64(size)); err != nil {
+			return err
+		}
+		mem, err := syscall.Mmap(int(e.f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+		if err != nil {
+			return err
+		}
+		if e.mem != nil {
+			syscall.Munmap(e.mem)
+		}
+		e.mem = mem
+	}
+	// The mapping is page-aligned, so the sequence number is aligned.
+	seq := (*uint64)(unsafe.Pointer(&e.mem[shmSeqOffset]))
+	// The sequence number is already odd if a previous process crashed
+	// mid-write.
+	s := atomic.LoadUint64(seq) | 1
+	atomic.StoreUint64(seq, s)
+	copy(e.mem[:shmSeqOffset], e.buf[:shmSeqOffset])
+	copy(e.mem[shmSeqOffset+8:], e.buf[shmSeqOffset+8:])
+	atomic.StoreUint64(seq, s+1)
+	return nil
+}
+
+// Run pushes periodically until the context is done. Failed pushes are
+// reported to the function set with ExportErrors, and do not stop the loop.
+func (e *SharedMemoryExporter) Run(ctx context.Context) error {
+	return runPeriodically(ctx, e.cfg, e.Push)
+}
+
+// Close unmaps the segment and closes the file, which remains with the last
+// values written.
+func (e *SharedMemoryExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.mem != nil {
+		syscall.Munmap(e.mem)
+		e.mem = nil
+	}
+	return e.f.Close()
+}
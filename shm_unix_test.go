@@ -0,0 +1,37 @@
+//go:build linux || darwin || freebsd
+
+package observability
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestSharedMemoryExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.shm")
+	e, err := NewSharedMemoryExporter(path, []*Origin{newTestOrigin()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	if snaps, err := ReadSharedMemory(path); err != nil || len(snaps) != 0 {
+		t.Fatalf("before push got %+v, %v", snaps, err)
+	}
+	for range 2 {
+		if err := e.Push(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snaps, err := ReadSharedMemory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 1 || len(snaps[0].Origin) != 1 || snaps[0].Origin[0] != (Label{"host.name", "alice"}) || len(snaps[0].Samples) != 1 {
+		t.Fatalf("got %+v", snaps)
+	}
+	s := snaps[0].Samples[0]
+	if s.Description.Name() != "/test/reads" || !s.Description.Cumulative() || s.Value != 42 || s.Time.IsZero() {
+		t.Errorf("got sample %+v", s)
+	}
+}
@@ -0,0 +1,120 @@
+package observability
+
+import (
+	"cmp"
+	"os"
+	"slices"
+	"time"
+)
+
+var (
+	slabActiveObjectsDesc = DescribeMeter(
+		"/memory/slab/active_objects",
+		"Number of objects in use in each slab cache.")
+	slabObjectsDesc = DescribeMeter(
+		"/memory/slab/objects",
+		"Number of objects allocated in each slab cache, in use or not.")
+	slabObjectSizeDesc = DescribeMeter(
+		"/memory/slab/object_size",
+		"Size of the objects of each slab cache, including padding.",
+		Units("By"))
+	slabSizeDesc = DescribeMeter(
+		"/memory/slab/size",
+		"Memory held by the slabs of each slab cache. It can be used in "+
+			"conjunction with `/memory/slab/active_objects` to find caches, "+
+			"such as dentry and inode caches, that hold much more memory "+
+			"than their objects need.",
+		Units("By"))
+)
+
+// The indices of the fields of the lines of /proc/slabinfo, version 2.1,
+// which are like
+//
+//	dentry 89061 89061 192 21 1 : tunables 0 0 0 : slabdata 4241 4241 0
+const (
+	slabActiveObjs   = 1
+	slabNumObjs      = 2
+	slabObjSize      = 3
+	slabPagesPerSlab = 5
+	slabNumSlabs     = 14
+	slabFields       = 16
+)
+
+// RegisterSlabStats registers meters of slab caches with o, sampled from
+// /proc/slabinfo and labeled with the cache name. The file has hundreds of
+// caches, so the meters are limited to the named caches, or if there are none,
+// to the n caches holding the most memory at registration. The file is
+// normally only readable by root, so this fails otherwise. The file stays open
+// for the life of the Origin.
+func RegisterSlabStats(o *Origin, caches []string, n int) error {
+	return registerSlabStats(o, "/proc/slabinfo", caches, n)
+}
+
+func registerSlabStats(o *Origin, path string, caches []string, n int) error {
+	pageSize := uint64(os.Getpagesize())
+	slabSize := func(fields [][]byte) uint64 {
+		return naiveAtoi(fields[slabNumSlabs]) * naiveAtoi(fields[slabPagesPerSlab]) * pageSize
+	}
+	// isCache rejects the comment naming the fields.
+	isCache := func(fields [][]byte) bool {
+		return fields[0][0] != '#'
+	}
+	if len(caches) == 0 {
+		type cache struct {
+			name string
+			size uint64
+		}
+		var all []cache
+		rs := NewRowScanner(func(fields [][]byte) {
+			all = append(all, cache{string(fields[0]), slabSize(fields)})
+		}, minFields(slabFields), isCache)
+		fs, err := NewFileScanner(path, rs)
+		if err != nil {
+			return err
+		}
+		err = fs.Scan()
+		fs.Close()
+		if err != nil {
+			return err
+		}
+		slices.SortStableFunc(all, func(a, b cache) int { return cmp.Compare(b.size, a.size) })
+		for _, c := range all[:min(n, len(all))] {
+			caches = append(caches, c.name)
+		}
+	}
+
+	var ms []Meter
+	byName := make(map[string][]Meter, len(caches))
+	for _, c := range caches {
+		label := Label{Key: "cache", Value: c}
+		meters := []Meter{
+			DefineGauge(slabActiveObjectsDesc, label),
+			DefineGauge(slabObjectsDesc, label),
+			DefineGauge(slabObjectSizeDesc, label),
+			DefineGauge(slabSizeDesc, label),
+		}
+		byName[c] = meters
+		ms = append(ms, meters...)
+	}
+	var now time.Time
+	rs := NewRowScanner(func(fields [][]byte) {
+		// The conversion doesn't allocate.
+		meters, ok := byName[string(fields[0])]
+		if !ok {
+			return
+		}
+		meters[0].SampleAt(now, naiveAtoi(fields[slabActiveObjs]))
+		meters[1].SampleAt(now, naiveAtoi(fields[slabNumObjs]))
+		meters[2].SampleAt(now, naiveAtoi(fields[slabObjSize]))
+		meters[3].SampleAt(now, slabSize(fields))
+	}, minFields(slabFields), isCache)
+	fs, err := NewFileScanner(path, rs)
+	if err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		fs.Scan()
+	}, ms...)
+	return nil
+}
@@ -0,0 +1,101 @@
+package observability
+
+import (
+	"io"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var (
+	processPSSDesc = DescribeMeter(
+		"/process/memory/pss",
+		"Proportional set size of the process: its resident memory, with "+
+			"each page shared with other processes divided among them. "+
+			"Unlike RSS, the PSS of all processes adds up to the memory "+
+			"they use.",
+		Units("By"))
+	processRSSDesc = DescribeMeter(
+		"/process/memory/rss",
+		"Resident memory of the process mapped in its address space, which "+
+			"counts shared pages in full.",
+		Units("By"))
+	processSharedCleanDesc = DescribeMeter(
+		"/process/memory/shared_clean",
+		"Resident memory of the process shared with other processes, and "+
+			"unmodified, so that it can be reclaimed without I/O.",
+		Units("By"))
+	processSharedDirtyDesc = DescribeMeter(
+		"/process/memory/shared_dirty",
+		"Resident memory of the process shared with other processes, and "+
+			"modified.",
+		Units("By"))
+	processPrivateCleanDesc = DescribeMeter(
+		"/process/memory/private_clean",
+		"Resident memory of the process mapped by it alone, and unmodified.",
+		Units("By"))
+	processPrivateDirtyDesc = DescribeMeter(
+		"/process/memory/private_dirty",
+		"Resident memory of the process mapped by it alone, and modified, "+
+			"such as its heap. It is the memory that would be freed if the "+
+			"process exited.",
+		Units("By"))
+	processSwapDesc = DescribeMeter(
+		"/process/memory/swap",
+		"Anonymous memory of the process that has been swapped out.",
+		Units("By"))
+	processLockedDesc = DescribeMeter(
+		"/process/memory/locked",
+		"Memory of the process that is locked in RAM, such as with "+
+			"mlock(2).",
+		Units("By"))
+)
+
+// smapsRollupValues are the keys of /proc/<pid>/smaps_rollup that are
+// sampled, and the descriptions of their meters.
+var smapsRollupValues = []struct {
+	name string
+	desc MeterDescription
+}{
+	{"Pss", processPSSDesc},
+	{"Rss", processRSSDesc},
+	{"Shared_Clean", processSharedCleanDesc},
+	{"Shared_Dirty", processSharedDirtyDesc},
+	{"Private_Clean", processPrivateCleanDesc},
+	{"Private_Dirty", processPrivateDirtyDesc},
+	{"Swap", processSwapDesc},
+	{"Locked", processLockedDesc},
+}
+
+// RegisterProcessMemoryStats registers meters of the memory of the process
+// with the given PID with o, sampled from /proc/<pid>/smaps_rollup, which
+// accounts for the memory it shares with other processes. The meters are
+// unlabeled, as those of RegisterProcessStats. The kernel walks the page
+// tables of the process to produce the file, which takes milliseconds for
+// processes of many gigabytes, and contends with their page faults. Reading
+// it requires the permission to ptrace the process. The file, added in Linux
+// 4.14, stays open for the life of the Origin.
+func RegisterProcessMemoryStats(o *Origin, pid int) error {
+	_, err := registerProcessMemoryStats(o, filepath.Join("/proc", strconv.Itoa(pid), "smaps_rollup"))
+	return err
+}
+
+func registerProcessMemoryStats(o *Origin, path string) (io.Closer, error) {
+	var now time.Time
+	var ms []Meter
+	var vfs []valueFunc
+	for _, v := range smapsRollupValues {
+		m := DefineGauge(v.desc)
+		vfs = append(vfs, valueFunc{name: []byte(v.name), f: func(n uint64) { m.SampleAt(now, n) }})
+		ms = append(ms, m)
+	}
+	fs, err := NewFileScanner(path, NewKeyValueScanner(nil, vfs))
+	if err != nil {
+		return nil, err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		fs.Scan()
+	}, ms...)
+	return fs, nil
+}
@@ -0,0 +1,273 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	smartReallocatedSectorsDesc = DescribeMeter(
+		"/smart/reallocated_sectors",
+		"Number of sectors of each ATA drive that have been remapped to "+
+			"spares after failing, attribute 5. A growing count predicts "+
+			"failure.",
+		Cumulative())
+	smartReportedUncorrectableDesc = DescribeMeter(
+		"/smart/reported_uncorrectable",
+		"Number of errors that each ATA drive could not correct with ECC, "+
+			"attribute 187.",
+		Cumulative())
+	smartPendingSectorsDesc = DescribeMeter(
+		"/smart/pending_sectors",
+		"Number of unreadable sectors of each ATA drive waiting to be "+
+			"remapped when next written, attribute 197.")
+	smartOfflineUncorrectableDesc = DescribeMeter(
+		"/smart/offline_uncorrectable",
+		"Number of sectors of each ATA drive found unreadable by offline "+
+			"scans, attribute 198.")
+	smartCRCErrorsDesc = DescribeMeter(
+		"/smart/crc_errors",
+		"Number of transfers to each ATA drive corrupted on the cable, "+
+			"attribute 199. A growing count suggests a bad cable or "+
+			"backplane rather than a bad drive.",
+		Cumulative())
+	smartPowerOnHoursDesc = DescribeMeter(
+		"/smart/power_on_hours",
+		"Time each drive has been powered on.",
+		Cumulative(), Units("h"))
+	smartTemperatureDesc = DescribeMeter(
+		"/smart/temperature",
+		"Temperature of each drive.",
+		Units("Cel"))
+	smartGrownDefectsDesc = DescribeMeter(
+		"/smart/grown_defects",
+		"Number of defects of each SCSI drive found since manufacture, the "+
+			"grown defect list.",
+		Cumulative())
+	smartUncorrectedReadErrorsDesc = DescribeMeter(
+		"/smart/uncorrected_read_errors",
+		"Number of reads of each SCSI drive that failed despite retries "+
+			"and ECC.",
+		Cumulative())
+	smartUncorrectedWriteErrorsDesc = DescribeMeter(
+		"/smart/uncorrected_write_errors",
+		"Number of writes to each SCSI drive that failed despite retries "+
+			"and ECC.",
+		Cumulative())
+)
+
+// smartValues are the values of the output of smartctl --json that are
+// sampled, by path.
+var smartValues = []struct {
+	path string
+	desc MeterDescription
+}{
+	{"power_on_time.hours", smartPowerOnHoursDesc},
+	{"temperature.current", smartTemperatureDesc},
+	{"scsi_grown_defect_list", smartGrownDefectsDesc},
+	{"scsi_error_counter_log.read.total_uncorrected_errors", smartUncorrectedReadErrorsDesc},
+	{"scsi_error_counter_log.write.total_uncorrected_errors", smartUncorrectedWriteErrorsDesc},
+}
+
+// smartAttributes are the ATA SMART attributes whose raw values are sampled,
+// by ID.
+var smartAttributes = []struct {
+	id   uint64
+	desc MeterDescription
+}{
+	{5, smartReallocatedSectorsDesc},
+	{187, smartReportedUncorrectableDesc},
+	{197, smartPendingSectorsDesc},
+	{198, smartOfflineUncorrectableDesc},
+	{199, smartCRCErrorsDesc},
+}
+
+// smartMaxAttributes bounds the number of entries of the ATA attribute table,
+// which has at most 30.
+const smartMaxAttributes = 30
+
+// DefaultSMARTInterval is the interval at which RegisterSMARTStats runs
+// smartctl by default. SMART attributes change slowly, and reading them costs
+// each drive commands that compete with its I/O.
+const DefaultSMARTInterval = 30 * time.Minute
+
+// smartTimeout bounds each run of smartctl.
+const smartTimeout = 30 * time.Second
+
+// smartRunner runs smartctl --json for a device, and returns its output.
+type smartRunner func(ctx context.Context, device string) ([]byte, error)
+
+// smartDevice holds the values read from the output of smartctl for a
+// device, by the extractor. Each is sampled if it was present.
+type smartDevice struct {
+	x      *JSONExtractor
+	values []uint64
+	has    []bool
+	// The ID and raw value of each entry of the ATA attribute table.
+	ids    [smartMaxAttributes]uint64
+	raws   [smartMaxAttributes]uint64
+	hasRaw [smartMaxAttributes]bool
+}
+
+func newSMARTDevice() *smartDevice {
+	d := &smartDevice{
+		values: make([]uint64, len(smartValues)),
+		has:    make([]bool, len(smartValues)),
+	}
+	var pfs []pathFunc
+	for i, v := range smartValues {
+		pfs = append(pfs, pathFunc{path: v.path, f: func(number []byte) {
+			d.values[i], d.has[i] = naiveAtoi(number), true
+		}})
+	}
+	for i := range smartMaxAttributes {
+		prefix := "ata_smart_attributes.table." + strconv.Itoa(i)
+		pfs = append(pfs,
+			pathFunc{path: prefix + ".id", f: func(number []byte) { d.ids[i] = naiveAtoi(number) }},
+			pathFunc{path: prefix + ".raw.value", f: func(number []byte) {
+				d.raws[i], d.hasRaw[i] = naiveAtoi(number), true
+			}})
+	}
+	d.x = NewJSONExtractor(pfs)
+	return d
+}
+
+// read extracts the values from the output of smartctl.
+func (d *smartDevice) read(b []byte) error {
+	clear(d.has)
+	clear(d.hasRaw[:])
+	return d.x.Extract(b)
+}
+
+// attribute returns the raw value of the ATA attribute with the given ID, and
+// whether there is one.
+func (d *smartDevice) attribute(id uint64) (uint64, bool) {
+	for i := range d.ids {
+		if d.hasRaw[i] && d.ids[i] == id {
+			return d.raws[i], true
+		}
+	}
+	return 0, false
+}
+
+// runSmartctl runs smartctl --json --all for a device. smartctl exits with a
+// bitmask whose low bits report that the device could not be read at all; the
+// others report problems found on it, whose output is still complete.
+func runSmartctl(ctx context.Context, device string) ([]byte, error) {
+	out, err := exec.CommandContext(ctx, "smartctl", "--json", "--all", "--nocheck=standby", device).Output()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode()&0x3 == 0 && len(out) > 0 {
+		err = nil
+	}
+	return out, err
+}
+
+// RegisterSMARTStats registers meters of the SMART attributes of SATA and SAS
+// drives with o, such as reallocated and pending sectors, CRC errors,
+// power-on hours, and temperature, read from the output of smartctl --json,
+// which must be installed, and usually requires root. The devices are the
+// named ones, such as /dev/sda, or if there are none, those found by smartctl
+// --scan. The meters are labeled with the device, and are those of the values
+// present at registration, which differ between ATA and SCSI drives. smartctl
+// is run for each device at most once per interval, or DefaultSMARTInterval if
+// it is not positive, and never wakes drives in standby; in between, the
+// meters keep their samples.
+func RegisterSMARTStats(o *Origin, devices []string, interval time.Duration) error {
+	if len(devices) == 0 {
+		out, err := exec.Command("smartctl", "--scan", "--json").Output()
+		if err != nil {
+			return err
+		}
+		var scan struct {
+			Devices []struct {
+				Name string `json:"name"`
+			} `json:"devices"`
+		}
+		if err := json.Unmarshal(out, &scan); err != nil {
+			return err
+		}
+		for _, d := range scan.Devices {
+			devices = append(devices, d.Name)
+		}
+	}
+	if interval <= 0 {
+		interval = DefaultSMARTInterval
+	}
+	return registerSMARTStats(o, devices, interval, runSmartctl)
+}
+
+func registerSMARTStats(o *Origin, devices []string, interval time.Duration, run smartRunner) error {
+	for _, device := range devices {
+		ctx, cancel := context.WithTimeout(context.Background(), smartTimeout)
+		out, err := run(ctx, device)
+		cancel()
+		if err != nil {
+			return err
+		}
+		d := newSMARTDevice()
+		if err := d.read(out); err != nil {
+			return err
+		}
+		// Define the meters of the values present, and the functions that
+		// sample them.
+		label := Label{Key: "device", Value: device}
+		var ms []Meter
+		var samplers []func(time.Time)
+		define := func(desc MeterDescription, value func() (uint64, bool)) {
+			var m Meter
+			if desc.Cumulative() {
+				m = DefineCounter(desc, label)
+			} else {
+				m = DefineGauge(desc, label)
+			}
+			ms = append(ms, m)
+			samplers = append(samplers, func(now time.Time) {
+				if v, ok := value(); ok {
+					m.SampleAt(now, v)
+				}
+			})
+		}
+		for i, v := range smartValues {
+			if d.has[i] {
+				define(v.desc, func() (uint64, bool) { return d.values[i], d.has[i] })
+			}
+		}
+		for _, a := range smartAttributes {
+			if _, ok := d.attribute(a.id); ok {
+				define(a.desc, func() (uint64, bool) { return d.attribute(a.id) })
+			}
+		}
+
+		var mu sync.Mutex
+		var last time.Time
+		sample := func(now time.Time) {
+			for _, s := range samplers {
+				s(now)
+			}
+			last = now
+		}
+		sample(time.Now())
+		o.RegisterFunction(func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if time.Since(last) < interval {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), smartTimeout)
+			defer cancel()
+			out, err := run(ctx, device)
+			if err != nil || d.read(out) != nil {
+				// The meters keep their old sample times, which
+				// shows that they are stale.
+				return
+			}
+			sample(time.Now())
+		}, ms...)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package observability
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Sample is the value of a single Meter at a point in time.
+type Sample struct {
+	Description MeterDescription
+	// Labels distinguish this sample from others with the same
+	// description.
+	Labels []Label
+	// Time is when the value was sampled. It is zero if the meter has
+	// never been sampled.
+	Time time.Time
+	// Reset is when the meter was defined or last reset. Cumulative
+	// meters count from this time.
+	Reset time.Time
+	Value uint64
+}
+
+// Snapshot is a consistent view of all the Meters registered with an Origin.
+type Snapshot struct {
+	// Origin is the identity of the Origin from which the samples came.
+	Origin  []Label
+	Samples []Sample
+}
+
+// collectTime is the time spent in the registered functions of all Origins,
+// and collections the number of calls to Collect, for RegisterSelfStats.
+var (
+	collectTime atomic.Int64
+	collections atomic.Uint64
+)
+
+// Snapshot calls every registered function and returns the resulting values
+// of all the meters registered with the Origin.
+func (o *Origin) Snapshot() Snapshot {
+	var s Snapshot
+	o.Collect(0, func(chunk Snapshot) error {
+		s = chunk
+		return nil
+	})
+	return s
+}
+
+// Collect calls every registered function and passes the resulting values of
+// the meters registered with the Origin to f, in chunks of at most n samples,
+// so the memory needed to export an Origin with very many meters is bounded.
+// If n is not positive, all samples are passed in one chunk. f is called at
+// least once, with an empty chunk if the Origin has no meters. The chunk's
+// samples are overwritten after f returns, so f must not retain them. If f
+// returns an error, collection stops and Collect returns it.
+//
+// The functions are called with the Origin locked, and the samples of each
+// are taken together, but f is called with it unlocked, so that a slow f,
+// such as one writing to the network, doesn't hold up other collections of
+// the Origin. Another collection may call the functions between chunks, so
+// only a single chunk is a consistent view.
+func (o *Origin) Collect(n int, f func(Snapshot) error) error {
+	o.mu.Lock()
+	size := n
+	if n <= 0 {
+		n, size = math.MaxInt, 0
+		for _, r := range o.regs {
+			size += len(r.ms)
+		}
+	}
+	o.mu.Unlock()
+	var spent time.Duration
+	defer func() {
+		collectTime.Add(int64(spent))
+		collections.Add(1)
+	}()
+	// samples holds those taken and not yet passed to f. It is filled up
+	// to a chunk, plus the rest of the samples of the last function called.
+	samples := make([]Sample, 0, size)
+	next := 0
+	for {
+		o.mu.Lock()
+		for len(samples) < n && next < len(o.regs) {
+			r := o.regs[next]
+			next++
+			start := time.Now()
+			r.f()
+			spent += time.Since(start)
+			for _, m := range r.ms {
+				t, v := m.Value()
+				samples = append(samples, Sample{
+					Description: m.Description(),
+					Labels:      m.Labels(),
+					Time:        t,
+					Reset:       m.ResetTime(),
+					Value:       v,
+				})
+			}
+		}
+		done := next == len(o.regs)
+		o.mu.Unlock()
+		for len(samples) >= n || done {
+			k := min(n, len(samples))
+			if err := f(Snapshot{Origin: o.identity, Samples: samples[:k]}); err != nil {
+				return err
+			}
+			samples = samples[:copy(samples, samples[k:])]
+			if done && len(samples) == 0 {
+				return nil
+			}
+		}
+	}
+}
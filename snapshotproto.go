@@ -0,0 +1,305 @@
+package observability
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// SnapshotWriter writes Snapshots to a stream in the compact binary format
+// defined by snapshot.proto, so they can be stored, shipped, and replayed with
+// SnapshotReader. Descriptions are written with their symbolized call sites,
+// so nothing is lost when they are read by another program.
+type SnapshotWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewSnapshotWriter returns a SnapshotWriter that writes to w.
+func NewSnapshotWriter(w io.Writer) *SnapshotWriter {
+	return &SnapshotWriter{w: w}
+}
+
+// Write writes one Snapshot.
+func (sw *SnapshotWriter) Write(snap Snapshot) error {
+	// Reserve room for the largest possible length prefix, and shift
+	// the message down afterwards.
+	const maxPrefix = 10
+	b := append(sw.buf[:0], make([]byte, maxPrefix)...)
+	b = appendSnapshotProto(b, &snap)
+	n := len(b) - maxPrefix
+	start := maxPrefix - varintLen(uint64(n))
+	appendVarint(b[start:start], uint64(n))
+	sw.buf = b
+	_, err := sw.w.Write(b[start:])
+	return err
+}
+
+func appendLabelsProto(b []byte, field int, labels []Label) []byte {
+	for _, l := range labels {
+		b = appendMessageField(b, field, func(b []byte) []byte {
+			b = appendStringField(b, 1, l.Key)
+			return appendStringField(b, 2, l.Value)
+		})
+	}
+	return b
+}
+
+func appendDescriptionProto(b []byte, md *MeterDescription) []byte {
+	b = appendStringField(b, 1, md.name)
+	b = appendStringField(b, 2, md.explanation)
+	b = appendBoolField(b, 3, md.cumulative)
+	b = appendStringField(b, 4, md.units)
+	for _, f := range md.Frames() {
+		b = appendMessageField(b, 5, func(b []byte) []byte {
+			b = appendStringField(b, 1, f.Function)
+			b = appendStringField(b, 2, f.File)
+			return appendVarintField(b, 3, uint64(f.Line))
+		})
+	}
+	return b
+}
+
+// unixNano is like t.UnixNano, except that the zero Time is zero.
+func unixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+func fromUnixNano(ns uint64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ns))
+}
+
+func appendSnapshotProto(b []byte, snap *Snapshot) []byte {
+	b = appendLabelsProto(b, 1, snap.Origin)
+	// Descriptions are identified by name, which is unique within an
+	// Origin.
+	index := make(map[string]uint64)
+	for i := range snap.Samples {
+		md := &snap.Samples[i].Description
+		if _, ok := index[md.name]; ok {
+			continue
+		}
+		index[md.name] = uint64(len(index))
+		b = appendMessageField(b, 2, func(b []byte) []byte {
+			return appendDescriptionProto(b, md)
+		})
+	}
+	for i := range snap.Samples {
+		s := &snap.Samples[i]
+		b = appendMessageField(b, 3, func(b []byte) []byte {
+			b = appendVarintField(b, 1, index[s.Description.name])
+			b = appendLabelsProto(b, 2, s.Labels)
+			b = appendFixed64Field(b, 3, unixNano(s.Time))
+			b = appendFixed64Field(b, 4, unixNano(s.Reset))
+			return appendVarintField(b, 5, s.Value)
+		})
+	}
+	return b
+}
+
+// SnapshotReader reads Snapshots written by a SnapshotWriter. The descriptions
+// of the samples it returns have no program counters, but they retain the
+// symbolized frames, which are available from MeterDescription.Frames.
+type SnapshotReader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewSnapshotReader returns a SnapshotReader that reads from r.
+func NewSnapshotReader(r io.Reader) *SnapshotReader {
+	return &SnapshotReader{r: bufio.NewReader(r)}
+}
+
+// maxSnapshotSize bounds the allocation for a single message, so a corrupt
+// length prefix doesn't exhaust memory.
+const maxSnapshotSize = 1 << 30
+
+// Read reads the next Snapshot. It returns io.EOF at the end of the stream.
+func (sr *SnapshotReader) Read() (Snapshot, error) {
+	n, err := binaryReadUvarint(sr.r)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if n > maxSnapshotSize {
+		return Snapshot{}, fmt.Errorf("observability: snapshot of %d bytes is too large", n)
+	}
+	if uint64(cap(sr.buf)) < n {
+		sr.buf = make([]byte, n)
+	}
+	sr.buf = sr.buf[:n]
+	if _, err := io.ReadFull(sr.r, sr.buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Snapshot{}, err
+	}
+	return parseSnapshotProto(sr.buf)
+}
+
+// binaryReadUvarint is binary.ReadUvarint, except that a stream ending in the
+// middle of the varint is an unexpected EOF rather than a clean one.
+func binaryReadUvarint(r io.ByteReader) (uint64, error) {
+	var v uint64
+	for i := 0; i < 10; i++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF && i > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		v |= uint64(c&0x7f) << (7 * i)
+		if c < 0x80 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("observability: varint overflow")
+}
+
+func parseLabelProto(b []byte) (Label, error) {
+	var l Label
+	for len(b) > 0 {
+		f, rest, err := nextProtoField(b)
+		if err != nil {
+			return l, err
+		}
+		switch f.num {
+		case 1:
+			l.Key = string(f.b)
+		case 2:
+			l.Value = string(f.b)
+		}
+		b = rest
+	}
+	return l, nil
+}
+
+func parseFrameProto(b []byte) (runtime.Frame, error) {
+	var fr runtime.Frame
+	for len(b) > 0 {
+		f, rest, err := nextProtoField(b)
+		if err != nil {
+			return fr, err
+		}
+		switch f.num {
+		case 1:
+			fr.Function = string(f.b)
+		case 2:
+			fr.File = string(f.b)
+		case 3:
+			fr.Line = int(f.u)
+		}
+		b = rest
+	}
+	return fr, nil
+}
+
+func parseDescriptionProto(b []byte) (MeterDescription, error) {
+	var md MeterDescription
+	for len(b) > 0 {
+		f, rest, err := nextProtoField(b)
+		if err != nil {
+			return md, err
+		}
+		switch f.num {
+		case 1:
+			md.name = string(f.b)
+		case 2:
+			md.explanation = string(f.b)
+		case 3:
+			md.cumulative = f.u != 0
+		case 4:
+			md.units = string(f.b)
+		case 5:
+			fr, err := parseFrameProto(f.b)
+			if err != nil {
+				return md, err
+			}
+			md.frames = append(md.frames, fr)
+		}
+		b = rest
+	}
+	return md, nil
+}
+
+func parseSampleProto(b []byte, descs []MeterDescription) (Sample, error) {
+	var s Sample
+	var desc uint64
+	for len(b) > 0 {
+		f, rest, err := nextProtoField(b)
+		if err != nil {
+			return s, err
+		}
+		switch f.num {
+		case 1:
+			desc = f.u
+		case 2:
+			l, err := parseLabelProto(f.b)
+			if err != nil {
+				return s, err
+			}
+			s.Labels = append(s.Labels, l)
+		case 3:
+			s.Time = fromUnixNano(f.u)
+		case 4:
+			s.Reset = fromUnixNano(f.u)
+		case 5:
+			s.Value = f.u
+		}
+		b = rest
+	}
+	if desc >= uint64(len(descs)) {
+		return s, fmt.Errorf("observability: description index %d out of range", desc)
+	}
+	s.Description = descs[desc]
+	return s, nil
+}
+
+func parseSnapshotProto(b []byte) (Snapshot, error) {
+	var snap Snapshot
+	var descs []MeterDescription
+	// Descriptions precede samples when written by SnapshotWriter, but
+	// the format doesn't require it, so samples are parsed second.
+	var samples [][]byte
+	for len(b) > 0 {
+		f, rest, err := nextProtoField(b)
+		if err != nil {
+			return snap, err
+		}
+		switch f.num {
+		case 1:
+			l, err := parseLabelProto(f.b)
+			if err != nil {
+				return snap, err
+			}
+			snap.Origin = append(snap.Origin, l)
+		case 2:
+			md, err := parseDescriptionProto(f.b)
+			if err != nil {
+				return snap, err
+			}
+			descs = append(descs, md)
+		case 3:
+			samples = append(samples, f.b)
+		}
+		b = rest
+	}
+	snap.Samples = make([]Sample, len(samples))
+	for i, sb := range samples {
+		s, err := parseSampleProto(sb, descs)
+		if err != nil {
+			return snap, err
+		}
+		snap.Samples[i] = s
+	}
+	return snap, nil
+}
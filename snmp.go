@@ -0,0 +1,554 @@
+package observability
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SNMPAgent is a standalone SNMPv2c responder that serves the meters of one or
+// more Origins under a private enterprise subtree, so that legacy network
+// management systems can poll the same data the other exporters serve. It
+// answers Get, GetNext, and GetBulk requests; the subtree is read-only.
+//
+// The meters form a conceptual table, meterTable, at enterprise.1, with rows
+// enterprise.1.1.column.index. The columns are
+//
+//	1 meterName         OCTET STRING  /xfs/reads
+//	2 meterOrigin       OCTET STRING  Origin identity as k=v;k=v
+//	3 meterLabels       OCTET STRING  meter labels as k=v,k=v
+//	4 meterExplanation  OCTET STRING
+//	5 meterUnits        OCTET STRING
+//	6 meterType         INTEGER       gauge(1), counter(2)
+//	7 meterValue        Counter64
+//
+// The index is a length-prefixed string of the origin identity, name, and
+// labels, so a meter keeps its row as long as it exists, however other meters
+// come and go. Meters whose index would exceed the SNMP limit on OID length
+// are omitted, as are meters that have never been sampled.
+//
+// A walk of the table takes many requests, so the table is rebuilt at most
+// once per second, and every request within that second sees the same view.
+type SNMPAgent struct {
+	cfg       exportConfig
+	origins   []*Origin
+	community []byte
+	// prefix is the OID of meterEntry, enterprise.1.1.
+	prefix []uint32
+
+	// mu protects the cached table.
+	mu      sync.Mutex
+	vars    []snmpVar
+	builtAt time.Time
+}
+
+// NewSNMPAgent returns an SNMPAgent that serves the meters under the given
+// enterprise OID, in dotted form, such as "1.3.6.1.4.1.32473". Requests must
+// carry the community set with SNMPCommunity, which is "public" by default.
+func NewSNMPAgent(enterprise string, origins []*Origin, opts ...ExportOption) (*SNMPAgent, error) {
+	root, err := parseOID(enterprise)
+	if err != nil {
+		return nil, err
+	}
+	cfg := newExportConfig(opts)
+	if cfg.maxPacket == 0 {
+		cfg.maxPacket = 1472
+	}
+	return &SNMPAgent{
+		cfg:       cfg,
+		origins:   origins,
+		community: []byte(cfg.community),
+		prefix:    append(root, 1, 1),
+	}, nil
+}
+
+// SNMPCommunity returns an ExportOption that sets the community string an
+// SNMPAgent requires of requests. Requests with any other community are
+// ignored, as the protocol prescribes.
+func SNMPCommunity(s string) ExportOption {
+	return exportFunctor(func(c exportConfig) exportConfig {
+		c.community = s
+		return c
+	})
+}
+
+// Serve answers the requests that arrive on pc, which is typically from
+// net.ListenPacket("udp", ":161"). It returns when reading from pc fails, such
+// as when pc is closed.
+func (a *SNMPAgent) Serve(pc net.PacketConn) error {
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		if resp := a.respond(buf[:n]); resp != nil {
+			if _, err := pc.WriteTo(resp, addr); err != nil {
+				a.cfg.errorf(err)
+			}
+		}
+	}
+}
+
+func parseOID(s string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("observability: invalid OID %q", s)
+	}
+	oid := make([]uint32, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("observability: invalid OID %q", s)
+		}
+		oid[i] = uint32(v)
+	}
+	if oid[0] > 2 || oid[0] < 2 && oid[1] >= 40 {
+		return nil, fmt.Errorf("observability: invalid OID %q", s)
+	}
+	return oid, nil
+}
+
+// BER tags, from X.690 and the SNMPv2 SMI.
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berNull        = 0x05
+	berOID         = 0x06
+	berSequence    = 0x30
+	berCounter64   = 0x46
+
+	snmpNoSuchObject   = 0x80
+	snmpNoSuchInstance = 0x81
+	snmpEndOfMibView   = 0x82
+
+	snmpGetRequest     = 0xa0
+	snmpGetNextRequest = 0xa1
+	snmpResponse       = 0xa2
+	snmpSetRequest     = 0xa3
+	snmpGetBulkRequest = 0xa5
+)
+
+// Error statuses from RFC 3416.
+const (
+	snmpTooBig      = 1
+	snmpNotWritable = 17
+)
+
+// snmpVersion2c is the version field of SNMPv2c messages.
+const snmpVersion2c = 1
+
+// snmpMaxOIDLen is the maximum number of sub-identifiers in an OID.
+const snmpMaxOIDLen = 128
+
+// Like protobuf.go, the BER functions append to and return their argument.
+
+func berLengthLen(n int) int {
+	l := 1
+	for ; n >= 0x80; n >>= 8 {
+		l++
+	}
+	return l
+}
+
+func appendBERLength(b []byte, n int) []byte {
+	if n < 0x80 {
+		return append(b, byte(n))
+	}
+	l := berLengthLen(n) - 1
+	b = append(b, 0x80|byte(l))
+	for i := l - 1; i >= 0; i-- {
+		b = append(b, byte(n>>(8*i)))
+	}
+	return b
+}
+
+// appendBER appends a constructed value whose contents are produced by f,
+// shifting them to make room for the length like appendMessageField.
+func appendBER(b []byte, tag byte, f func([]byte) []byte) []byte {
+	b = append(b, tag)
+	start := len(b)
+	b = f(b)
+	n := len(b) - start
+	sz := berLengthLen(n)
+	for i := 0; i < sz; i++ {
+		b = append(b, 0)
+	}
+	copy(b[start+sz:], b[start:start+n])
+	appendBERLength(b[start:start], n)
+	return b
+}
+
+func appendBERInt(b []byte, tag byte, v int64) []byte {
+	n := 1
+	for ; n < 8; n++ {
+		if w := v >> (8*n - 1); w == 0 || w == -1 {
+			break
+		}
+	}
+	b = append(b, tag, byte(n))
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*i)))
+	}
+	return b
+}
+
+func appendBERUint(b []byte, tag byte, v uint64) []byte {
+	// Unsigned values need a leading zero byte when the high bit is set.
+	n := 1
+	for n < 9 && v>>(8*n-1) != 0 {
+		n++
+	}
+	b = append(b, tag, byte(n))
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*i)))
+	}
+	return b
+}
+
+func appendBERString(b []byte, tag byte, s string) []byte {
+	b = append(b, tag)
+	b = appendBERLength(b, len(s))
+	return append(b, s...)
+}
+
+func appendBEROID(b []byte, oid []uint32) []byte {
+	return appendBER(b, berOID, func(b []byte) []byte {
+		b = appendBase128(b, oid[0]*40+oid[1])
+		for _, v := range oid[2:] {
+			b = appendBase128(b, v)
+		}
+		return b
+	})
+}
+
+func appendBase128(b []byte, v uint32) []byte {
+	n := 1
+	for w := v >> 7; w != 0; w >>= 7 {
+		n++
+	}
+	for i := n - 1; i > 0; i-- {
+		b = append(b, byte(v>>(7*i))|0x80)
+	}
+	return append(b, byte(v)&0x7f)
+}
+
+var errBERMalformed = errors.New("observability: malformed BER")
+
+// nextBER decodes the element at the start of b, returning its tag, its
+// contents, which alias b, and the rest of the input. Only the definite
+// length form is supported, as SNMP requires.
+func nextBER(b []byte) (byte, []byte, []byte, error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errBERMalformed
+	}
+	tag, l := b[0], int(b[1])
+	b = b[2:]
+	if l >= 0x80 {
+		k := l & 0x7f
+		if k == 0 || k > 3 || len(b) < k {
+			return 0, nil, nil, errBERMalformed
+		}
+		l = 0
+		for _, c := range b[:k] {
+			l = l<<8 | int(c)
+		}
+		b = b[k:]
+	}
+	if len(b) < l {
+		return 0, nil, nil, errBERMalformed
+	}
+	return tag, b[:l], b[l:], nil
+}
+
+func parseBERInt(b []byte) (int64, error) {
+	if len(b) == 0 || len(b) > 8 {
+		return 0, errBERMalformed
+	}
+	v := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		v = v<<8 | int64(c)
+	}
+	return v, nil
+}
+
+func parseBEROID(b []byte) ([]uint32, error) {
+	var oid []uint32
+	var v uint64
+	for i, c := range b {
+		v = v<<7 | uint64(c&0x7f)
+		if v > 1<<32-1 {
+			return nil, errBERMalformed
+		}
+		if c&0x80 != 0 {
+			if i == len(b)-1 {
+				return nil, errBERMalformed
+			}
+			continue
+		}
+		if oid == nil {
+			first := min(v/40, 2)
+			oid = append(oid, uint32(first), uint32(v-40*first))
+		} else {
+			oid = append(oid, uint32(v))
+		}
+		v = 0
+	}
+	if len(oid) < 2 || len(oid) > snmpMaxOIDLen {
+		return nil, errBERMalformed
+	}
+	return oid, nil
+}
+
+// snmpVar is one object in the table, with its value already encoded.
+type snmpVar struct {
+	oid []uint32
+	val []byte
+}
+
+// table returns the table of objects, sorted by OID, rebuilding it if it is
+// stale.
+func (a *SNMPAgent) table() []snmpVar {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.vars != nil && time.Since(a.builtAt) < time.Second {
+		return a.vars
+	}
+	type row struct {
+		index  []uint32
+		origin string
+		s      Sample
+	}
+	var rows []row
+	// The index follows the column and starts with its length.
+	maxIndex := snmpMaxOIDLen - len(a.prefix) - 2
+	a.cfg.collect(a.origins, func(_ int, snap Snapshot) error {
+		origin := csvLabels(snap.Origin, ";")
+		for _, s := range snap.Samples {
+			if s.Time.IsZero() {
+				continue
+			}
+			key := origin + " " + s.Description.Name() + "{" + csvLabels(s.Labels, ",") + "}"
+			if len(key) > maxIndex {
+				continue
+			}
+			index := make([]uint32, 0, len(key)+1)
+			index = append(index, uint32(len(key)))
+			for i := 0; i < len(key); i++ {
+				index = append(index, uint32(key[i]))
+			}
+			rows = append(rows, row{index: index, origin: origin, s: s})
+		}
+		return nil
+	})
+	slices.SortStableFunc(rows, func(x, y row) int { return slices.Compare(x.index, y.index) })
+	rows = slices.CompactFunc(rows, func(x, y row) bool { return slices.Equal(x.index, y.index) })
+
+	vars := make([]snmpVar, 0, 7*len(rows))
+	for col := uint32(1); col <= 7; col++ {
+		for _, r := range rows {
+			oid := make([]uint32, 0, len(a.prefix)+1+len(r.index))
+			oid = append(oid, a.prefix...)
+			oid = append(oid, col)
+			oid = append(oid, r.index...)
+			md := &r.s.Description
+			var val []byte
+			switch col {
+			case 1:
+				val = appendBERString(nil, berOctetString, md.Name())
+			case 2:
+				val = appendBERString(nil, berOctetString, r.origin)
+			case 3:
+				val = appendBERString(nil, berOctetString, csvLabels(r.s.Labels, ","))
+			case 4:
+				val = appendBERString(nil, berOctetString, md.Explanation())
+			case 5:
+				val = appendBERString(nil, berOctetString, md.Units())
+			case 6:
+				typ := int64(1)
+				if md.Cumulative() {
+					typ = 2
+				}
+				val = appendBERInt(nil, berInteger, typ)
+			case 7:
+				val = appendBERUint(nil, berCounter64, r.s.Value)
+			}
+			vars = append(vars, snmpVar{oid: oid, val: val})
+		}
+	}
+	a.vars, a.builtAt = vars, time.Now()
+	return vars
+}
+
+// get returns the object with the given OID, or an exception.
+func (a *SNMPAgent) get(vars []snmpVar, oid []uint32) snmpVar {
+	i := sort.Search(len(vars), func(i int) bool { return slices.Compare(vars[i].oid, oid) >= 0 })
+	if i < len(vars) && slices.Equal(vars[i].oid, oid) {
+		return vars[i]
+	}
+	// Objects are the columns; instances are their rows.
+	exc := byte(snmpNoSuchObject)
+	if col := len(a.prefix); len(oid) > col+1 && slices.Equal(oid[:col], a.prefix) && oid[col] >= 1 && oid[col] <= 7 {
+		exc = snmpNoSuchInstance
+	}
+	return snmpVar{oid: oid, val: []byte{exc, 0}}
+}
+
+// next returns the first object after the given OID, or endOfMibView.
+func (a *SNMPAgent) next(vars []snmpVar, oid []uint32) snmpVar {
+	i := sort.Search(len(vars), func(i int) bool { return slices.Compare(vars[i].oid, oid) > 0 })
+	if i < len(vars) {
+		return vars[i]
+	}
+	return snmpVar{oid: oid, val: []byte{snmpEndOfMibView, 0}}
+}
+
+// respond returns the response to a request, or nil if the request should be
+// dropped.
+func (a *SNMPAgent) respond(req []byte) []byte {
+	tag, msg, _, err := nextBER(req)
+	if err != nil || tag != berSequence {
+		return nil
+	}
+	tag, body, msg, err := nextBER(msg)
+	if err != nil || tag != berInteger {
+		return nil
+	}
+	if v, err := parseBERInt(body); err != nil || v != snmpVersion2c {
+		return nil
+	}
+	tag, community, msg, err := nextBER(msg)
+	if err != nil || tag != berOctetString || subtle.ConstantTimeCompare(community, a.community) != 1 {
+		return nil
+	}
+	pduType, pdu, _, err := nextBER(msg)
+	if err != nil {
+		return nil
+	}
+	var fields [3]int64
+	for i := range fields {
+		tag, body, pdu, err = nextBER(pdu)
+		if err != nil || tag != berInteger {
+			return nil
+		}
+		if fields[i], err = parseBERInt(body); err != nil {
+			return nil
+		}
+	}
+	tag, list, _, err := nextBER(pdu)
+	if err != nil || tag != berSequence {
+		return nil
+	}
+	var oids [][]uint32
+	for len(list) > 0 {
+		var vb []byte
+		if tag, vb, list, err = nextBER(list); err != nil || tag != berSequence {
+			return nil
+		}
+		if tag, body, _, err = nextBER(vb); err != nil || tag != berOID {
+			return nil
+		}
+		oid, err := parseBEROID(body)
+		if err != nil {
+			return nil
+		}
+		oids = append(oids, oid)
+	}
+
+	var status, index int64
+	var out []snmpVar
+	switch pduType {
+	case snmpGetRequest, snmpGetNextRequest:
+		vars := a.table()
+		for _, oid := range oids {
+			if pduType == snmpGetRequest {
+				out = append(out, a.get(vars, oid))
+			} else {
+				out = append(out, a.next(vars, oid))
+			}
+		}
+	case snmpGetBulkRequest:
+		out = a.bulk(oids, int(fields[1]), int(fields[2]), len(community))
+	case snmpSetRequest:
+		status, index = snmpNotWritable, 1
+		for _, oid := range oids {
+			out = append(out, snmpVar{oid: oid, val: []byte{berNull, 0}})
+		}
+	default:
+		return nil
+	}
+	resp := appendSNMPResponse(nil, community, fields[0], status, index, out)
+	if len(resp) > a.cfg.maxPacket {
+		resp = appendSNMPResponse(resp[:0], community, fields[0], snmpTooBig, 0, nil)
+	}
+	return resp
+}
+
+// bulk answers a GetBulk request. Repetitions that would not fit in the
+// response are dropped, as RFC 3416 allows.
+func (a *SNMPAgent) bulk(oids [][]uint32, nonRepeaters, maxRepetitions, communityLen int) []snmpVar {
+	vars := a.table()
+	nonRepeaters = min(max(nonRepeaters, 0), len(oids))
+	// Leave room for the message and PDU headers.
+	room := a.cfg.maxPacket - communityLen - 32
+	var out []snmpVar
+	add := func(v snmpVar) bool {
+		room -= 4 + 5*len(v.oid) + len(v.val)
+		if room < 0 && len(out) > 0 {
+			return false
+		}
+		out = append(out, v)
+		return true
+	}
+	for _, oid := range oids[:nonRepeaters] {
+		if !add(a.next(vars, oid)) {
+			return out
+		}
+	}
+	last := slices.Clone(oids[nonRepeaters:])
+	for r := 0; r < maxRepetitions && len(last) > 0; r++ {
+		done := true
+		for i, oid := range last {
+			v := a.next(vars, oid)
+			if !add(v) {
+				return out
+			}
+			last[i] = v.oid
+			if v.val[0] != snmpEndOfMibView {
+				done = false
+			}
+		}
+		if done {
+			break
+		}
+	}
+	return out
+}
+
+func appendSNMPResponse(b []byte, community []byte, requestID, status, index int64, vars []snmpVar) []byte {
+	return appendBER(b, berSequence, func(b []byte) []byte {
+		b = appendBERInt(b, berInteger, snmpVersion2c)
+		b = appendBERString(b, berOctetString, string(community))
+		return appendBER(b, snmpResponse, func(b []byte) []byte {
+			b = appendBERInt(b, berInteger, requestID)
+			b = appendBERInt(b, berInteger, status)
+			b = appendBERInt(b, berInteger, index)
+			return appendBER(b, berSequence, func(b []byte) []byte {
+				for _, v := range vars {
+					b = appendBER(b, berSequence, func(b []byte) []byte {
+						b = appendBEROID(b, v.oid)
+						return append(b, v.val...)
+					})
+				}
+				return b
+			})
+		})
+	})
+}
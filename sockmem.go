@@ -0,0 +1,133 @@
+package observability
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	socketMemoryDesc = DescribeMeter(
+		"/net/socket/memory",
+		"Memory allocated to the buffers of the sockets of each protocol, "+
+			"tcp or udp.",
+		Units("By"))
+	socketMemoryLimitDesc = DescribeMeter(
+		"/net/socket/memory_limit",
+		"Thresholds of `/net/socket/memory` for each protocol, from the "+
+			"tcp_mem and udp_mem sysctls: below low, the kernel doesn't "+
+			"limit the buffers of sockets; above pressure, it shrinks them; "+
+			"above high, allocations fail, and TCP drops packets and "+
+			"connections.",
+		Units("By"))
+	socketMemoryUtilizationDesc = DescribeMeter(
+		"/net/socket/memory_utilization",
+		"`/net/socket/memory` of each protocol as a percentage of each of "+
+			"its thresholds, pressure and high, rounded down.",
+		Units("%"))
+)
+
+// socketMemoryThresholds are the fields of the tcp_mem and udp_mem sysctls,
+// in order.
+var socketMemoryThresholds = []string{"low", "pressure", "high"}
+
+// socketMemory holds the meters of the memory of a protocol, and the values
+// read in a scan, in pages.
+type socketMemory struct {
+	usage       Meter
+	limits      []Meter
+	utilization [2]Meter // Of the pressure and high thresholds.
+	pages       uint64
+	limitPages  []uint64
+}
+
+func newSocketMemory(proto string) *socketMemory {
+	label := Label{Key: "protocol", Value: proto}
+	m := &socketMemory{
+		usage:      DefineGauge(socketMemoryDesc, label),
+		limitPages: make([]uint64, len(socketMemoryThresholds)),
+	}
+	for _, t := range socketMemoryThresholds {
+		m.limits = append(m.limits, DefineGauge(socketMemoryLimitDesc, label, Label{Key: "threshold", Value: t}))
+	}
+	m.utilization[0] = DefineGauge(socketMemoryUtilizationDesc, label, Label{Key: "threshold", Value: "pressure"})
+	m.utilization[1] = DefineGauge(socketMemoryUtilizationDesc, label, Label{Key: "threshold", Value: "high"})
+	return m
+}
+
+func (m *socketMemory) meters() []Meter {
+	return append(append([]Meter{m.usage}, m.limits...), m.utilization[:]...)
+}
+
+// sample samples the meters from the values read, given the page size.
+func (m *socketMemory) sample(now time.Time, pageSize uint64) {
+	m.usage.SampleAt(now, m.pages*pageSize)
+	for i, l := range m.limits {
+		l.SampleAt(now, m.limitPages[i]*pageSize)
+	}
+	for i, limit := range m.limitPages[1:] {
+		if limit > 0 {
+			m.utilization[i].SampleAt(now, m.pages*100/limit)
+		}
+	}
+}
+
+// RegisterSocketMemoryStats registers meters of the memory of TCP and UDP
+// sockets with o: the memory in use, from /proc/net/sockstat; its
+// thresholds, from the tcp_mem and udp_mem sysctls; and the utilization of
+// the pressure and high thresholds, which predicts the buffer shrinking and
+// dropped connections that crossing them causes. The meters are labeled with
+// the protocol, and those of thresholds also with the threshold. The files
+// stay open for the life of the Origin.
+func RegisterSocketMemoryStats(o *Origin) error {
+	return registerSocketMemoryStats(o, "/proc/net/sockstat", "/proc/sys/net/ipv4")
+}
+
+func registerSocketMemoryStats(o *Origin, sockstat, sysctlDir string) error {
+	tcp, udp := newSocketMemory("tcp"), newSocketMemory("udp")
+	// The mem field is the tenth after "TCP:", and the fourth after
+	// "UDP:".
+	bs := NewUnorderedBufferScanner(nil, []lineFunc{
+		{name: []byte("TCP"), mask: fieldMask(9), nfields: 1, f: func(fields [][]byte) { tcp.pages = naiveAtoi(fields[0]) }},
+		{name: []byte("UDP"), mask: fieldMask(3), nfields: 1, f: func(fields [][]byte) { udp.pages = naiveAtoi(fields[0]) }},
+	})
+	bs.SetDelimiters(":")
+	stat, err := NewFileScanner(sockstat, bs)
+	if err != nil {
+		return err
+	}
+	var files []*FileScanner
+	for _, s := range []struct {
+		name string
+		m    *socketMemory
+	}{{"tcp_mem", tcp}, {"udp_mem", udp}} {
+		fs, err := NewFileScanner(filepath.Join(sysctlDir, s.name), NewRowScanner(func(fields [][]byte) {
+			for i := range s.m.limitPages {
+				s.m.limitPages[i] = naiveAtoi(fields[i])
+			}
+		}, minFields(len(socketMemoryThresholds))))
+		if err != nil {
+			stat.Close()
+			for _, f := range files {
+				f.Close()
+			}
+			return err
+		}
+		files = append(files, fs)
+	}
+	pageSize := uint64(os.Getpagesize())
+	o.RegisterFunction(func() {
+		if stat.Scan() != nil {
+			return
+		}
+		for _, f := range files {
+			if f.Scan() != nil {
+				return
+			}
+		}
+		now := time.Now()
+		tcp.sample(now, pageSize)
+		udp.sample(now, pageSize)
+	}, append(tcp.meters(), udp.meters()...)...)
+	return nil
+}
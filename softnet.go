@@ -0,0 +1,105 @@
+package observability
+
+import (
+	"strconv"
+	"time"
+)
+
+var (
+	softnetProcessedDesc = DescribeMeter(
+		"/net/softnet/processed",
+		"Number of packets processed by the network receive softirq of each "+
+			"CPU.",
+		Cumulative())
+	softnetDroppedDesc = DescribeMeter(
+		"/net/softnet/dropped",
+		"Number of packets dropped because the input queue of each CPU was "+
+			"full. The queue length is net.core.netdev_max_backlog.",
+		Cumulative())
+	softnetTimeSqueezesDesc = DescribeMeter(
+		"/net/softnet/time_squeezes",
+		"Number of times the network receive softirq of each CPU ran out of "+
+			"budget or time with packets still to process. The budget is "+
+			"net.core.netdev_budget.",
+		Cumulative())
+	softnetFlowLimitDesc = DescribeMeter(
+		"/net/softnet/flow_limited",
+		"Number of packets dropped by the flow limit of each CPU, which "+
+			"keeps large flows from filling its input queue.",
+		Cumulative())
+)
+
+// softnetFields are the indices of the fields of /proc/net/softnet_stat that
+// are sampled, in the order of the meters of each CPU.
+var softnetFields = [...]int{0, 1, 2, 10}
+
+// softnetCPUField is the index of the field holding the CPU number, added in
+// Linux 5.10. Before, the lines of the online CPUs appear in order, without
+// their numbers.
+const softnetCPUField = 12
+
+// RegisterSoftnetStats registers meters of the network receive processing of
+// each CPU with o, sampled from /proc/net/softnet_stat and labeled with the
+// CPU number. Drops and time squeezes there reveal a receive backlog that no
+// other file shows. The CPUs are those online at registration. The file stays
+// open for the life of the Origin.
+func RegisterSoftnetStats(o *Origin) error {
+	return registerSoftnetStats(o, "/proc/net/softnet_stat")
+}
+
+func registerSoftnetStats(o *Origin, path string) error {
+	var ms []Meter
+	cpus := make(map[uint64][]Meter)
+	// row is the index of the line, which is the label of the CPU on kernels
+	// before 5.10.
+	row := 0
+	cpuNumber := func(fields [][]byte) uint64 {
+		if len(fields) > softnetCPUField {
+			return naiveAtoiHex(fields[softnetCPUField])
+		}
+		return uint64(row)
+	}
+	rs := NewRowScanner(func(fields [][]byte) {
+		cpu := cpuNumber(fields)
+		row++
+		label := Label{Key: "cpu", Value: strconv.FormatUint(cpu, 10)}
+		meters := []Meter{
+			DefineCounter(softnetProcessedDesc, label),
+			DefineCounter(softnetDroppedDesc, label),
+			DefineCounter(softnetTimeSqueezesDesc, label),
+			DefineCounter(softnetFlowLimitDesc, label),
+		}
+		cpus[cpu] = meters
+		ms = append(ms, meters...)
+	}, minFields(softnetFields[len(softnetFields)-1]+1))
+	fs, err := NewFileScanner(path, rs)
+	if err != nil {
+		return err
+	}
+	err = fs.Scan()
+	fs.Close()
+	if err != nil {
+		return err
+	}
+
+	var now time.Time
+	rs = NewRowScanner(func(fields [][]byte) {
+		meters, ok := cpus[cpuNumber(fields)]
+		row++
+		if !ok {
+			return
+		}
+		for i, j := range softnetFields {
+			meters[i].SampleAt(now, naiveAtoiHex(fields[j]))
+		}
+	}, minFields(softnetFields[len(softnetFields)-1]+1))
+	if fs, err = NewFileScanner(path, rs); err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		row = 0
+		fs.Scan()
+	}, ms...)
+	return nil
+}
@@ -0,0 +1,59 @@
+package observability
+
+// StanzaScanner scans files that group lines into stanzas, each of which
+// begins with an unindented line followed by indented lines that belong to it,
+// such as /proc/self/mountstats:
+//
+//	device server:/export mounted on /mnt with fstype nfs4 statvers=1.1
+//		opts:	rw,vers=4.1,rsize=1048576,wsize=1048576
+//		age:	93421
+//		bytes:	1218 0 0 0 1218 0 1 0
+//	device proc mounted on /proc with fstype proc
+//
+// A single function is called for every indented line of a stanza, with the
+// fields of the line that began it, so that per-mount or per-device meters can
+// be keyed by them.
+type StanzaScanner struct {
+	start  []byte
+	f      func(header, fields [][]byte)
+	header [][]byte
+	fields [][]byte
+}
+
+// NewStanzaScanner creates a StanzaScanner whose stanzas begin with the
+// unindented lines whose first field is start, such as "device", or with any
+// unindented line if start is empty. Other unindented lines end the stanza
+// before them, and are ignored. f is called with the fields of the line that
+// began the stanza, including its first field, and those of each indented
+// line. Both point into the input, which f must copy if it retains them. Blank
+// lines are ignored.
+func NewStanzaScanner(start string, f func(header, fields [][]byte)) *StanzaScanner {
+	return &StanzaScanner{start: []byte(start), f: f}
+}
+
+// Scan reads all of the lines in the given byte buffer, calling the function
+// for each indented line of each stanza.
+func (ss *StanzaScanner) Scan(b []byte) {
+	var line []byte
+	ss.header = ss.header[:0]
+	for len(b) > 0 {
+		line, b = nextLine(b)
+		if len(line) == 0 {
+			continue
+		}
+		if asciiSpace[line[0]] == 0 {
+			ss.header = asciiByteFields(line, ss.header[:0])
+			if len(ss.start) > 0 && string(ss.header[0]) != string(ss.start) {
+				ss.header = ss.header[:0]
+			}
+			continue
+		}
+		if len(ss.header) == 0 {
+			continue
+		}
+		ss.fields = asciiByteFields(line, ss.fields[:0])
+		if len(ss.fields) > 0 {
+			ss.f(ss.header, ss.fields)
+		}
+	}
+}
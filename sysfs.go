@@ -0,0 +1,104 @@
+package observability
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// SysfsValue reads a file that holds a single value, which is the shape of
+// most files in /sys. The file is opened once, and each read is a single
+// pread(2) into a fixed buffer, so reading it every second costs one system
+// call and no allocation.
+type SysfsValue struct {
+	f   *os.File
+	buf [256]byte
+}
+
+// OpenSysfsValue opens the file at path for reading with a SysfsValue.
+func OpenSysfsValue(path string) (*SysfsValue, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &SysfsValue{f: f}, nil
+}
+
+// Bytes rereads the file, and returns its contents without surrounding
+// whitespace. The result is overwritten by the next read.
+func (v *SysfsValue) Bytes() ([]byte, error) {
+	// Reading sysfs attributes from offset zero regenerates them.
+	n, err := v.f.ReadAt(v.buf[:], 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if n == len(v.buf) {
+		return nil, fmt.Errorf("observability: %s holds more than a single value", v.f.Name())
+	}
+	return bytes.TrimSpace(v.buf[:n]), nil
+}
+
+// String rereads the file, and returns its contents without surrounding
+// whitespace.
+func (v *SysfsValue) String() (string, error) {
+	b, err := v.Bytes()
+	return string(b), err
+}
+
+var errSysfsNotUint = errors.New("observability: sysfs value is not an unsigned integer")
+
+// Uint rereads the file, and returns its contents as an unsigned decimal
+// integer.
+func (v *SysfsValue) Uint() (uint64, error) {
+	b, err := v.Bytes()
+	if err != nil {
+		return 0, err
+	}
+	if len(b) == 0 || len(b) > 19 {
+		// Longer numbers might overflow.
+		return 0, errSysfsNotUint
+	}
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, errSysfsNotUint
+		}
+	}
+	return naiveAtoi(b), nil
+}
+
+// Close closes the file.
+func (v *SysfsValue) Close() error {
+	return v.f.Close()
+}
+
+// readSysfsString returns the value of the file at path, which holds a single
+// value, such as the type of a device.
+func readSysfsString(path string) (string, error) {
+	v, err := OpenSysfsValue(path)
+	if err != nil {
+		return "", err
+	}
+	defer v.Close()
+	return v.String()
+}
+
+// RegisterSysfsMeter opens the file at path, and registers a function with o
+// that samples m from it, as an unsigned integer. If the file can't be read
+// or doesn't hold an integer when the function is called, m isn't sampled, so
+// its sample time shows how stale it is. The file stays open for the life of
+// the Origin.
+func RegisterSysfsMeter(o *Origin, path string, m Meter) error {
+	v, err := OpenSysfsValue(path)
+	if err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		if n, err := v.Uint(); err == nil {
+			m.SampleAt(time.Now(), n)
+		}
+	}, m)
+	return nil
+}
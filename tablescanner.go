@@ -0,0 +1,61 @@
+package observability
+
+import (
+	"bytes"
+)
+
+// TableScanner scans files that are tables with a header, followed by one row
+// per line, each keyed by its first field, such as /proc/net/dev:
+//
+//	Inter-|   Receive                            |  Transmit
+//	 face |bytes    packets errs drop fifo frame compressed multicast|bytes ...
+//	    lo: 2776770   26934    0    0    0     0          0         0  2776770 ...
+//	  eth0: 1215645    2751    0    0    0     0          0         0  1782404 ...
+//
+// Because the keys, such as interface names, are not known in advance, a
+// single function is called for every row, which suits per-device meters.
+type TableScanner struct {
+	header int
+	f      func(key []byte, fields [][]byte)
+	fields [][]byte
+}
+
+// NewTableScanner creates a TableScanner that skips the given number of header
+// lines, and calls f for each of the following rows with the first field as
+// the key, and the rest of the fields. A colon that terminates the key is
+// removed, including when it isn't followed by a space, as happens in
+// /proc/net/dev when a counter is wide enough. Like the fields, the key points
+// into the input, which f must copy if it retains it. Blank lines are
+// ignored.
+func NewTableScanner(header int, f func(key []byte, fields [][]byte)) *TableScanner {
+	return &TableScanner{header: header, f: f}
+}
+
+// Scan reads all of the lines in the given byte buffer, calling the function
+// for each row.
+func (ts *TableScanner) Scan(b []byte) {
+	var line []byte
+	for i := 0; i < ts.header && len(b) > 0; i++ {
+		_, b = nextLine(b)
+	}
+	for len(b) > 0 {
+		line, b = nextLine(b)
+		ts.fields = asciiByteFields(line, ts.fields[:0])
+		if len(ts.fields) == 0 {
+			continue
+		}
+		key, fields := ts.fields[0], ts.fields[1:]
+		if i := bytes.IndexByte(key, ':'); i >= 0 {
+			if i+1 < len(key) {
+				// The key and the first value are glued
+				// together; make room to split them.
+				ts.fields = append(ts.fields, nil)
+				fields = ts.fields[1:]
+				copy(fields[1:], fields)
+				fields[0] = key[i+1:]
+			}
+			key = key[:i]
+		}
+		ts.f(key, fields)
+	}
+}
@@ -0,0 +1,109 @@
+package observability
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+var processDelayDesc = DescribeMeter(
+	"/process/delay",
+	"Time that the threads of the process have spent waiting for each "+
+		"resource, by resource: cpu, runnable but waiting for a CPU; "+
+		"block_io, for synchronous block I/O; swap_in, for pages to be "+
+		"swapped in; and memory_reclaim, reclaiming memory to allocate "+
+		"it. Its rate is the number of threads waiting on average. Only "+
+		"cpu is counted unless delay accounting is enabled, with the "+
+		"kernel.task_delayacct sysctl or the delayacct boot parameter.",
+	Cumulative(), Units("ns"))
+
+// The taskstats generic netlink family, and the offsets of the delays in
+// struct taskstats, which is versioned and only grows.
+const (
+	taskstatsCmdGet       = 1
+	taskstatsCmdAttrTGID  = 2
+	taskstatsTypeStats    = 3
+	taskstatsTypeAggrTGID = 5
+	taskstatsCPUDelay     = 24
+	taskstatsBlockIODelay = 40
+	taskstatsSwapInDelay  = 56
+	taskstatsReclaimDelay = 320
+	taskstatsMinSize      = taskstatsReclaimDelay + 8
+)
+
+// taskstatsDelays are the labels of /process/delay, and the offsets of the
+// delays in struct taskstats.
+var taskstatsDelays = []struct {
+	resource string
+	offset   int
+}{
+	{"cpu", taskstatsCPUDelay},
+	{"block_io", taskstatsBlockIODelay},
+	{"swap_in", taskstatsSwapInDelay},
+	{"memory_reclaim", taskstatsReclaimDelay},
+}
+
+// RegisterTaskDelayStats registers meters of the delays of the process with
+// the given PID with o, read from the taskstats netlink interface: the time
+// its threads, live and exited, have waited for a CPU, block I/O, swapping,
+// and memory reclaim, which attributes its latency to its causes. The meters
+// are labeled with the resource. As with RegisterProcessStats, each process
+// needs an Origin of its own. Requesting the statistics of a process needs
+// CAP_NET_ADMIN. A netlink socket stays open for the life of the Origin.
+func RegisterTaskDelayStats(o *Origin, pid int) error {
+	c, err := DialNetlink(netlinkGeneric)
+	if err != nil {
+		return err
+	}
+	family, err := c.genericFamily("TASKSTATS")
+	if err != nil {
+		c.Close()
+		return err
+	}
+	req := appendGenlHeader(nil, taskstatsCmdGet, 1)
+	req = appendNetlinkAttr(req, taskstatsCmdAttrTGID, binary.NativeEndian.AppendUint32(nil, uint32(pid)))
+	// Check that the process can be queried, so that the lack of
+	// CAP_NET_ADMIN or an exited process is reported now.
+	if err := c.Execute(family, 0, req, func(netlinkMessage) error { return nil }); err != nil {
+		c.Close()
+		return err
+	}
+	meters := make([]Meter, len(taskstatsDelays))
+	for i, d := range taskstatsDelays {
+		meters[i] = DefineCounter(processDelayDesc, Label{Key: "resource", Value: d.resource})
+	}
+	o.RegisterFunction(func() {
+		c.Execute(family, 0, req, func(m netlinkMessage) error {
+			stats := taskstatsStats(m.Payload)
+			if len(stats) < taskstatsMinSize {
+				return errNetlinkMalformed
+			}
+			now := time.Now()
+			for i, d := range taskstatsDelays {
+				meters[i].SampleAt(now, binary.NativeEndian.Uint64(stats[d.offset:]))
+			}
+			return nil
+		})
+	}, meters...)
+	return nil
+}
+
+// taskstatsStats returns the struct taskstats of the process in the payload
+// of a response to TASKSTATS_CMD_GET for a TGID, or nil.
+func taskstatsStats(payload []byte) []byte {
+	if len(payload) < genlHdrLen {
+		return nil
+	}
+	var stats []byte
+	rangeNetlinkAttrs(payload[genlHdrLen:], func(a netlinkAttr) error {
+		if a.Type != taskstatsTypeAggrTGID {
+			return nil
+		}
+		return rangeNetlinkAttrs(a.Value, func(a netlinkAttr) error {
+			if a.Type == taskstatsTypeStats {
+				stats = a.Value
+			}
+			return nil
+		})
+	})
+	return stats
+}
@@ -0,0 +1,39 @@
+package observability
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestTaskDelayStats(t *testing.T) {
+	// The second field of schedstat is the run delay of the main thread,
+	// which is part of that of the process.
+	b, err := os.ReadFile("/proc/self/schedstat")
+	if err != nil {
+		t.Skip(err)
+	}
+	runDelay := naiveAtoi(bytes.Fields(b)[1])
+	o := NewOrigin()
+	err = RegisterTaskDelayStats(o, os.Getpid())
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.ENOENT) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := sampleValues(o)
+	if len(got) != len(taskstatsDelays) {
+		t.Errorf("got %v", got)
+	}
+	if cpu := got["/process/delay{resource=cpu}"]; cpu < runDelay {
+		t.Errorf("cpu delay %d is less than the run delay %d of the main thread", cpu, runDelay)
+	}
+	for _, s := range o.Snapshot().Samples {
+		if s.Time.IsZero() {
+			t.Errorf("%s%v not sampled", s.Description.Name(), s.Labels)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package observability
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Temporality is how an exporter reports the values of cumulative meters.
+// Different backends want different temporality: Prometheus expects totals,
+// while StatsD and many OTLP backends expect deltas. Gauges are unaffected.
+type Temporality int
+
+const (
+	// CumulativeTemporality reports the total accumulated since the meter
+	// was defined or last reset.
+	CumulativeTemporality Temporality = iota
+	// DeltaTemporality reports the increase since the previous export by
+	// the same exporter. The Reset time of each sample is the start of
+	// the interval over which the increase was measured. A meter's first
+	// export establishes the baseline and reports nothing.
+	DeltaTemporality
+)
+
+// ExportTemporality returns an ExportOption that sets the temporality with
+// which an exporter reports cumulative meters. Exporters default to
+// CumulativeTemporality, except for those whose protocol only has deltas, such
+// as DogStatsD.
+func ExportTemporality(t Temporality) ExportOption {
+	return exportFunctor(func(c exportConfig) exportConfig {
+		c.temporality = t
+		return c
+	})
+}
+
+// deltaTracker converts the values of cumulative meters into the increase
+// since the previous export, for exporters configured with DeltaTemporality.
+type deltaTracker struct {
+	mu   sync.Mutex
+	last map[string]deltaState
+	gen  uint64
+}
+
+type deltaState struct {
+	// t is when the value was sampled, and the start of the next
+	// interval.
+	t     time.Time
+	reset time.Time
+	v     uint64
+	gen   uint64
+}
+
+// seriesKey returns a string that identifies the series of a sample across
+// snapshots.
+func seriesKey(origin []Label, s *Sample) string {
+	var sb strings.Builder
+	for _, l := range origin {
+		sb.WriteString(l.Key)
+		sb.WriteByte(0)
+		sb.WriteString(l.Value)
+		sb.WriteByte(0)
+	}
+	sb.WriteByte(1)
+	sb.WriteString(s.Description.Name())
+	for _, l := range s.Labels {
+		sb.WriteByte(0)
+		sb.WriteString(l.Key)
+		sb.WriteByte(0)
+		sb.WriteString(l.Value)
+	}
+	return sb.String()
+}
+
+// begin starts an export pass, which must be ended by calling end. Passes
+// are serialized, so concurrent exports through the same exporter don't see
+// each other's intervals.
+func (d *deltaTracker) begin() {
+	d.mu.Lock()
+	if d.last == nil {
+		d.last = make(map[string]deltaState)
+	}
+	d.gen++
+}
+
+// end ends an export pass. Series not seen in the pass are forgotten, so the
+// tracker doesn't grow without bound as meters come and go.
+func (d *deltaTracker) end() {
+	for k, st := range d.last {
+		if st.gen != d.gen {
+			delete(d.last, k)
+		}
+	}
+	d.mu.Unlock()
+}
+
+// convert replaces the values of the cumulative samples with their increase
+// since the previous pass, in place. Samples of series seen for the first
+// time are removed, as they have no previous value. If a meter was reset in
+// the meantime, the delta is its whole value, which accumulated since the
+// reset.
+func (d *deltaTracker) convert(snap Snapshot) Snapshot {
+	kept := snap.Samples[:0]
+	for _, s := range snap.Samples {
+		if !s.Description.Cumulative() {
+			kept = append(kept, s)
+			continue
+		}
+		if s.Time.IsZero() {
+			continue
+		}
+		k := seriesKey(snap.Origin, &s)
+		prev, seen := d.last[k]
+		d.last[k] = deltaState{t: s.Time, reset: s.Reset, v: s.Value, gen: d.gen}
+		switch {
+		case !seen:
+			continue
+		case !prev.reset.Equal(s.Reset) || s.Value < prev.v:
+			// s.Reset is already the start of the interval.
+		default:
+			s.Value -= prev.v
+			s.Reset = prev.t
+		}
+		kept = append(kept, s)
+	}
+	snap.Samples = kept
+	return snap
+}
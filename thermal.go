@@ -0,0 +1,100 @@
+package observability
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+var (
+	thermalZoneTemperatureDesc = DescribeMeter(
+		"/thermal/zone/temperature",
+		"Temperature of each thermal zone, such as a CPU package. Negative "+
+			"temperatures are not sampled.",
+		Units("mCel"))
+	thermalZoneTripPointDesc = DescribeMeter(
+		"/thermal/zone/trip_point",
+		"Temperature of each trip point of each thermal zone, at which the "+
+			"kernel acts: passive trip points throttle the CPUs, active "+
+			"ones start fans, and critical ones shut the machine down. A "+
+			"zone near a passive trip point is likely to be throttled.",
+		Units("mCel"))
+	thermalCoolingStateDesc = DescribeMeter(
+		"/thermal/cooling_device/state",
+		"Current state of each cooling device, from 0, inactive, to "+
+			"`/thermal/cooling_device/max_state`. For processors, a "+
+			"nonzero state means their frequency is throttled.")
+	thermalCoolingMaxStateDesc = DescribeMeter(
+		"/thermal/cooling_device/max_state",
+		"Maximum state of each cooling device.")
+)
+
+// RegisterThermalStats registers meters of the thermal zones and cooling
+// devices in /sys/class/thermal with o, so that thermally throttled machines
+// can be identified. The meters of zones are labeled with the zone number and
+// its type, such as x86_pkg_temp, and those of trip points also with the trip
+// point number and its type; the meters of cooling devices are labeled with
+// the device number and its type, such as Processor. The zones and devices are
+// those present at registration. The files stay open for the life of the
+// Origin.
+func RegisterThermalStats(o *Origin) error {
+	return registerThermalStats(o, "/sys/class/thermal")
+}
+
+func registerThermalStats(o *Origin, dir string) error {
+	zones, err := filepath.Glob(filepath.Join(dir, "thermal_zone*"))
+	if err != nil {
+		return err
+	}
+	for _, zone := range zones {
+		typ, err := readSysfsString(filepath.Join(zone, "type"))
+		if err != nil {
+			return err
+		}
+		labels := []Label{
+			{Key: "zone", Value: strings.TrimPrefix(filepath.Base(zone), "thermal_zone")},
+			{Key: "type", Value: typ},
+		}
+		m := DefineGauge(thermalZoneTemperatureDesc, labels...)
+		if err := RegisterSysfsMeter(o, filepath.Join(zone, "temp"), m); err != nil {
+			return err
+		}
+		trips, err := filepath.Glob(filepath.Join(zone, "trip_point_*_temp"))
+		if err != nil {
+			return err
+		}
+		for _, trip := range trips {
+			n := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(trip), "trip_point_"), "_temp")
+			tripType, err := readSysfsString(filepath.Join(zone, "trip_point_"+n+"_type"))
+			if err != nil {
+				return err
+			}
+			m := DefineGauge(thermalZoneTripPointDesc, append(labels[:len(labels):len(labels)],
+				Label{Key: "trip_point", Value: n}, Label{Key: "trip_type", Value: tripType})...)
+			if err := RegisterSysfsMeter(o, trip, m); err != nil {
+				return err
+			}
+		}
+	}
+
+	devices, err := filepath.Glob(filepath.Join(dir, "cooling_device*"))
+	if err != nil {
+		return err
+	}
+	for _, device := range devices {
+		typ, err := readSysfsString(filepath.Join(device, "type"))
+		if err != nil {
+			return err
+		}
+		labels := []Label{
+			{Key: "device", Value: strings.TrimPrefix(filepath.Base(device), "cooling_device")},
+			{Key: "type", Value: typ},
+		}
+		if err := RegisterSysfsMeter(o, filepath.Join(device, "cur_state"), DefineGauge(thermalCoolingStateDesc, labels...)); err != nil {
+			return err
+		}
+		if err := RegisterSysfsMeter(o, filepath.Join(device, "max_state"), DefineGauge(thermalCoolingMaxStateDesc, labels...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
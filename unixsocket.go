@@ -0,0 +1,68 @@
+package observability
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// ListenUnix returns a listener on a unix domain socket at path, with the given
+// permissions, for serving the HTTP handlers on hosts where agents must not
+// open network ports. A stale socket left at path by a previous process is
+// replaced, but any other kind of file is an error.
+//
+// The socket is created under a temporary name and renamed into place after
+// its permissions are set, so there is no window in which it is reachable with
+// the default permissions. Closing the listener removes the socket.
+func ListenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("observability: %s exists and is not a socket", path)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	tmp := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.%d", filepath.Base(path), os.Getpid()))
+	os.Remove(tmp)
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	l.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, perm); err != nil {
+		l.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		l.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+	return &unixListener{UnixListener: l, path: path}, nil
+}
+
+// unixListener removes its socket when closed.
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	os.Remove(l.path)
+	return err
+}
+
+// ServeUnix serves h on a unix domain socket at path with the given
+// permissions. Like http.ListenAndServe, it always returns a non-nil error.
+func ServeUnix(path string, perm os.FileMode, h http.Handler) error {
+	l, err := ListenUnix(path, perm)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return http.Serve(l, h)
+}
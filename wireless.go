@@ -0,0 +1,121 @@
+package observability
+
+import (
+	"bytes"
+	"time"
+)
+
+var (
+	wirelessLinkQualityDesc = DescribeMeter(
+		"/net/wireless/link_quality",
+		"Quality of the link of each wireless interface, in units of its "+
+			"driver, often out of 70 or 100.")
+	wirelessSignalLevelDesc = DescribeMeter(
+		"/net/wireless/signal_level",
+		"Signal level received by each wireless interface, negated, so a "+
+			"level of -52 dBm is 52; higher values are weaker signals. It "+
+			"is not sampled unless the driver reports a negative level in "+
+			"dBm.",
+		Units("dBm"))
+	wirelessDiscardedDesc = DescribeMeter(
+		"/net/wireless/discarded",
+		"Number of packets discarded by each wireless interface, by "+
+			"reason: nwid, for another network ID; crypt, failing to "+
+			"decrypt; frag, failing to reassemble; retry, exceeding the "+
+			"retries to transmit; or misc, for other reasons. Rising "+
+			"retries are a congested or marginal link.",
+		Cumulative())
+	wirelessMissedBeaconsDesc = DescribeMeter(
+		"/net/wireless/missed_beacons",
+		"Number of beacons missed by each wireless interface. Missing "+
+			"beacons precedes losing the access point.",
+		Cumulative())
+)
+
+// The fields of /proc/net/wireless after the interface name.
+const (
+	wirelessLink          = 1
+	wirelessLevel         = 2
+	wirelessDiscarded     = 4 // The first of the discarded packets.
+	wirelessMissedBeacons = 9
+)
+
+// wirelessDiscardReasons are the columns of discarded packets in
+// /proc/net/wireless, in order.
+var wirelessDiscardReasons = []string{"nwid", "crypt", "frag", "retry", "misc"}
+
+// wirelessMeters are the meters of a wireless interface.
+type wirelessMeters struct {
+	link, level, beacons Meter
+	discarded            []Meter
+}
+
+// wirelessQuality returns a quality value of /proc/net/wireless, which is
+// followed by a period if it was updated since it was last read.
+func wirelessQuality(b []byte) int64 {
+	return naiveAtoiSigned(bytes.TrimSuffix(b, []byte(".")))
+}
+
+// RegisterWirelessStats registers meters of the quality of the links of
+// wireless interfaces with o, sampled from /proc/net/wireless: their link
+// quality, signal level, discarded packets, and missed beacons. The meters
+// are labeled with the interface name, and the discarded packets also with
+// the reason. The interfaces are those present at registration. The file is
+// that of the Wireless Extensions, which cfg80211 drivers provide unless
+// CONFIG_CFG80211_WEXT is disabled. The file stays open for the life of the
+// Origin.
+func RegisterWirelessStats(o *Origin) error {
+	return registerWirelessStats(o, "/proc/net/wireless")
+}
+
+func registerWirelessStats(o *Origin, path string) error {
+	ifaces := map[string]*wirelessMeters{}
+	var ms []Meter
+	var now time.Time
+	registered := false
+	fs, err := NewFileScanner(path, NewTableScanner(2, func(key []byte, fields [][]byte) {
+		if len(fields) <= wirelessMissedBeacons {
+			return
+		}
+		w, ok := ifaces[string(key)]
+		if !ok {
+			if registered {
+				// The interface appeared after registration.
+				return
+			}
+			label := Label{Key: "iface", Value: string(key)}
+			w = &wirelessMeters{
+				link:    DefineGauge(wirelessLinkQualityDesc, label),
+				level:   DefineGauge(wirelessSignalLevelDesc, label),
+				beacons: DefineCounter(wirelessMissedBeaconsDesc, label),
+			}
+			for _, r := range wirelessDiscardReasons {
+				w.discarded = append(w.discarded, DefineCounter(wirelessDiscardedDesc, label, Label{Key: "reason", Value: r}))
+			}
+			ifaces[string(key)] = w
+			ms = append(append(ms, w.link, w.level, w.beacons), w.discarded...)
+			return
+		}
+		w.link.SampleAt(now, uint64(max(wirelessQuality(fields[wirelessLink]), 0)))
+		if level := wirelessQuality(fields[wirelessLevel]); level < 0 {
+			w.level.SampleAt(now, uint64(-level))
+		}
+		for i, m := range w.discarded {
+			m.SampleAt(now, naiveAtoi(fields[wirelessDiscarded+i]))
+		}
+		w.beacons.SampleAt(now, naiveAtoi(fields[wirelessMissedBeacons]))
+	}))
+	if err != nil {
+		return err
+	}
+	if err := fs.Scan(); err != nil {
+		fs.Close()
+		return err
+	}
+	registered = true
+	o.RegisterFunction(func() {
+		now = time.Now()
+		fs.Scan()
+	}, ms...)
+	return nil
+}
@@ -1,6 +1,8 @@
 package observability
 
-import ()
+import (
+	"time"
+)
 
 var (
 	// The names of these variables are consistent with the linux kernel
@@ -42,4 +44,493 @@ var (
 			"`/xfs/writes` to calculate the average size of the "+
 			"write operations to files in XFS filesystems.",
 		Cumulative())
+	xfsExtentFreexDesc = DescribeMeter(
+		"/xfs/extent/extents_freed",
+		"Number of extents freed over all XFS filesystems.",
+		Cumulative())
+	xfsExtentFreebDesc = DescribeMeter(
+		"/xfs/extent/blocks_freed",
+		"Number of blocks freed over all XFS filesystems.",
+		Cumulative())
+	xfsBlkMaprDesc = DescribeMeter(
+		"/xfs/block_map/reads",
+		"Number of block map operations for reads, which translate file "+
+			"offsets to disk blocks.",
+		Cumulative())
+	xfsBlkMapwDesc = DescribeMeter(
+		"/xfs/block_map/writes",
+		"Number of block map operations for writes, which may allocate "+
+			"blocks.",
+		Cumulative())
+	xfsBlkUnmapDesc = DescribeMeter(
+		"/xfs/block_map/unmaps",
+		"Number of block unmap operations, which free blocks of files "+
+			"being truncated or removed.",
+		Cumulative())
+	xfsDirLookupDesc = DescribeMeter(
+		"/xfs/dir/lookups",
+		"Number of lookups of names in XFS directories. Lookups that hit "+
+			"the dentry cache don't reach XFS.",
+		Cumulative())
+	xfsDirRemoveDesc = DescribeMeter(
+		"/xfs/dir/removed",
+		"Number of times an existing directory entry was removed in XFS "+
+			"filesystems.",
+		Cumulative())
+	xfsDirGetdentsDesc = DescribeMeter(
+		"/xfs/dir/getdents",
+		"Number of times the getdents operation was performed on XFS "+
+			"directories, as by readdir.",
+		Cumulative())
+	xfsTransSyncDesc = DescribeMeter(
+		"/xfs/transactions/sync",
+		"Number of meta-data transactions which waited to be committed to "+
+			"the on-disk log before allowing the process performing the "+
+			"transaction to continue. These transactions are slower and "+
+			"more expensive than asynchronous ones.",
+		Cumulative())
+	xfsTransAsyncDesc = DescribeMeter(
+		"/xfs/transactions/async",
+		"Number of meta-data transactions which did not wait to be "+
+			"committed to the on-disk log.",
+		Cumulative())
+	xfsTransEmptyDesc = DescribeMeter(
+		"/xfs/transactions/empty",
+		"Number of meta-data transactions which did not actually change "+
+			"anything, which are cancelled rather than committed.",
+		Cumulative())
+	xfsIgAttemptsDesc = DescribeMeter(
+		"/xfs/inode/lookups",
+		"Number of times the operating system looked for an XFS inode in "+
+			"the inode cache, whether it was found or not.",
+		Cumulative())
+	xfsIgFoundDesc = DescribeMeter(
+		"/xfs/inode/found",
+		"Number of times the operating system looked for an XFS inode in "+
+			"the inode cache and found it.",
+		Cumulative())
+	xfsIgFrecycleDesc = DescribeMeter(
+		"/xfs/inode/recycled",
+		"Number of times the operating system found an XFS inode in the "+
+			"inode cache that was being recycled, and had to wait for it.",
+		Cumulative())
+	xfsIgMissedDesc = DescribeMeter(
+		"/xfs/inode/missed",
+		"Number of times the operating system looked for an XFS inode in "+
+			"the inode cache and did not find it, and so read it from disk.",
+		Cumulative())
+	xfsIgDupDesc = DescribeMeter(
+		"/xfs/inode/duplicates",
+		"Number of times the operating system read an XFS inode from disk "+
+			"only to find that another process had put it in the cache "+
+			"meanwhile.",
+		Cumulative())
+	xfsIgReclaimsDesc = DescribeMeter(
+		"/xfs/inode/reclaims",
+		"Number of times the operating system reclaimed an XFS inode from "+
+			"the inode cache to free memory for another purpose.",
+		Cumulative())
+	xfsIgAttrchgDesc = DescribeMeter(
+		"/xfs/inode/attribute_changes",
+		"Number of times the operating system explicitly changed the "+
+			"attributes of an XFS inode, such as its ownership or times.",
+		Cumulative())
+	xfsLogWritesDesc = DescribeMeter(
+		"/xfs/log/writes",
+		"Number of log buffer writes going to the physical log partitions "+
+			"of XFS filesystems.",
+		Cumulative())
+	xfsLogBlocksDesc = DescribeMeter(
+		"/xfs/log/blocks_written",
+		"Number of 512-byte blocks written to the physical log partitions "+
+			"of XFS filesystems. It can be used in conjunction with "+
+			"`/xfs/log/writes` to calculate the average size of log writes.",
+		Cumulative())
+	xfsLogNoiclogsDesc = DescribeMeter(
+		"/xfs/log/noiclogs",
+		"Number of times a transaction had to wait because all of the "+
+			"in-core log buffers of its XFS filesystem were in use. A high "+
+			"rate suggests increasing the logbufs mount option.",
+		Cumulative())
+	xfsLogForceDesc = DescribeMeter(
+		"/xfs/log/forces",
+		"Number of times the in-core log of an XFS filesystem was forced "+
+			"to disk, as by fsync.",
+		Cumulative())
+	xfsLogForceSleepDesc = DescribeMeter(
+		"/xfs/log/force_sleeps",
+		"Number of times a process slept waiting for a log force to "+
+			"complete.",
+		Cumulative())
+	xfsTryLogspaceDesc = DescribeMeter(
+		"/xfs/tail_push/logspace_attempts",
+		"Number of times a transaction tried to reserve space in the log "+
+			"of an XFS filesystem.",
+		Cumulative())
+	xfsSleepLogspaceDesc = DescribeMeter(
+		"/xfs/tail_push/logspace_sleeps",
+		"Number of times a transaction slept waiting for space in the log "+
+			"of an XFS filesystem, until the tail of the log was pushed "+
+			"forward by writing back the items it holds.",
+		Cumulative())
+	xfsPushAilDesc = DescribeMeter(
+		"/xfs/tail_push/pushes",
+		"Number of times the tail of the log of an XFS filesystem was "+
+			"pushed, by writing back items of the active item list (AIL).",
+		Cumulative())
+	xfsPushAilSuccessDesc = DescribeMeter(
+		"/xfs/tail_push/success",
+		"Number of log items successfully written back by tail pushes.",
+		Cumulative())
+	xfsPushAilPushbufDesc = DescribeMeter(
+		"/xfs/tail_push/pushbuf",
+		"Number of log items written back by tail pushes as part of a "+
+			"buffer.",
+		Cumulative())
+	xfsPushAilPinnedDesc = DescribeMeter(
+		"/xfs/tail_push/pinned",
+		"Number of log items that tail pushes could not write back because "+
+			"they were pinned in memory by an uncommitted transaction, "+
+			"which forces the log.",
+		Cumulative())
+	xfsPushAilLockedDesc = DescribeMeter(
+		"/xfs/tail_push/locked",
+		"Number of log items that tail pushes could not write back because "+
+			"they were locked.",
+		Cumulative())
+	xfsPushAilFlushingDesc = DescribeMeter(
+		"/xfs/tail_push/flushing",
+		"Number of log items that tail pushes skipped because they were "+
+			"already being written back.",
+		Cumulative())
+	xfsPushAilRestartsDesc = DescribeMeter(
+		"/xfs/tail_push/restarts",
+		"Number of times a tail push restarted its scan of the active item "+
+			"list.",
+		Cumulative())
+	xfsPushAilFlushDesc = DescribeMeter(
+		"/xfs/tail_push/flushes",
+		"Number of times a tail push waited for the log items it had "+
+			"written back to reach disk.",
+		Cumulative())
+	xfsXstratQuickDesc = DescribeMeter(
+		"/xfs/allocation/contiguous",
+		"Number of buffers flushed by delayed allocation that were "+
+			"allocated a single contiguous extent.",
+		Cumulative())
+	xfsXstratSplitDesc = DescribeMeter(
+		"/xfs/allocation/split",
+		"Number of buffers flushed by delayed allocation that were split "+
+			"into more than one extent, for lack of contiguous free space.",
+		Cumulative())
+	xfsAttrGetDesc = DescribeMeter(
+		"/xfs/attr/gets",
+		"Number of extended attributes read from XFS inodes.",
+		Cumulative())
+	xfsAttrSetDesc = DescribeMeter(
+		"/xfs/attr/sets",
+		"Number of extended attributes set on XFS inodes.",
+		Cumulative())
+	xfsAttrRemoveDesc = DescribeMeter(
+		"/xfs/attr/removes",
+		"Number of extended attributes removed from XFS inodes.",
+		Cumulative())
+	xfsAttrListDesc = DescribeMeter(
+		"/xfs/attr/lists",
+		"Number of times the extended attributes of XFS inodes were "+
+			"listed.",
+		Cumulative())
+	xfsIflushCountDesc = DescribeMeter(
+		"/xfs/inode_flush/flushes",
+		"Number of times the inode flush routine was called, to write XFS "+
+			"inodes back to disk.",
+		Cumulative())
+	xfsIclusterFlushcntDesc = DescribeMeter(
+		"/xfs/inode_flush/cluster_flushes",
+		"Number of times inode flushes also wrote back other dirty inodes "+
+			"of the same inode cluster.",
+		Cumulative())
+	xfsIclusterFlushinodeDesc = DescribeMeter(
+		"/xfs/inode_flush/clustered_inodes",
+		"Number of dirty inodes written back along with others of their "+
+			"inode cluster.",
+		Cumulative())
+	xfsVnActiveDesc = DescribeMeter(
+		"/xfs/vnodes/active",
+		"Number of XFS inodes in use by the operating system, rather than "+
+			"on its free lists.")
+	xfsVnAllocDesc = DescribeMeter(
+		"/xfs/vnodes/allocated",
+		"Number of times the operating system allocated an inode for XFS.",
+		Cumulative())
+	xfsVnGetDesc = DescribeMeter(
+		"/xfs/vnodes/gets",
+		"Number of times the operating system looked up an inode of XFS.",
+		Cumulative())
+	xfsVnHoldDesc = DescribeMeter(
+		"/xfs/vnodes/holds",
+		"Number of times a reference was taken to an inode of XFS.",
+		Cumulative())
+	xfsVnReleDesc = DescribeMeter(
+		"/xfs/vnodes/releases",
+		"Number of times a reference to an inode of XFS was dropped.",
+		Cumulative())
+	xfsVnReclaimDesc = DescribeMeter(
+		"/xfs/vnodes/reclaims",
+		"Number of times the operating system reclaimed an inode of XFS.",
+		Cumulative())
+	xfsVnRemoveDesc = DescribeMeter(
+		"/xfs/vnodes/removes",
+		"Number of times an inode of XFS was removed from memory after its "+
+			"last link and reference were dropped.",
+		Cumulative())
+	xfsVnFreeDesc = DescribeMeter(
+		"/xfs/vnodes/freed",
+		"Number of times the operating system freed an inode of XFS.",
+		Cumulative())
+	xfsBufGetDesc = DescribeMeter(
+		"/xfs/buffer/gets",
+		"Number of requests for XFS meta-data buffers.",
+		Cumulative())
+	xfsBufCreateDesc = DescribeMeter(
+		"/xfs/buffer/created",
+		"Number of XFS meta-data buffers created because they were not in "+
+			"the buffer cache.",
+		Cumulative())
+	xfsBufGetLockedDesc = DescribeMeter(
+		"/xfs/buffer/locked",
+		"Number of requests for XFS meta-data buffers found in the buffer "+
+			"cache and locked without waiting.",
+		Cumulative())
+	xfsBufGetLockedWaitedDesc = DescribeMeter(
+		"/xfs/buffer/locked_waited",
+		"Number of requests for XFS meta-data buffers found in the buffer "+
+			"cache that waited for the buffer to be unlocked.",
+		Cumulative())
+	xfsBufBusyLockedDesc = DescribeMeter(
+		"/xfs/buffer/busy",
+		"Number of non-blocking requests for XFS meta-data buffers that "+
+			"failed because the buffer was locked.",
+		Cumulative())
+	xfsBufMissLockedDesc = DescribeMeter(
+		"/xfs/buffer/miss_locked",
+		"Number of requests for XFS meta-data buffers that found the buffer "+
+			"stale after waiting for it.",
+		Cumulative())
+	xfsBufPageRetriesDesc = DescribeMeter(
+		"/xfs/buffer/page_retries",
+		"Number of times memory for XFS meta-data buffer pages had to be "+
+			"retried, because none was free.",
+		Cumulative())
+	xfsBufPageFoundDesc = DescribeMeter(
+		"/xfs/buffer/pages_found",
+		"Number of XFS meta-data buffer pages found in the page cache.",
+		Cumulative())
+	xfsBufGetReadDesc = DescribeMeter(
+		"/xfs/buffer/reads",
+		"Number of XFS meta-data buffers read from disk.",
+		Cumulative())
+	xfsBtreeLookupDesc = DescribeMeter(
+		"/xfs/btree/lookups",
+		"Number of lookups in each type of XFS btree.",
+		Cumulative())
+	xfsBtreeCompareDesc = DescribeMeter(
+		"/xfs/btree/compares",
+		"Number of key comparisons made by lookups in each type of XFS "+
+			"btree.",
+		Cumulative())
+	xfsBtreeInsrecDesc = DescribeMeter(
+		"/xfs/btree/inserts",
+		"Number of records inserted into each type of XFS btree.",
+		Cumulative())
+	xfsBtreeDelrecDesc = DescribeMeter(
+		"/xfs/btree/deletes",
+		"Number of records deleted from each type of XFS btree.",
+		Cumulative())
+	xfsBtreeNewrootDesc = DescribeMeter(
+		"/xfs/btree/new_roots",
+		"Number of times each type of XFS btree grew a level.",
+		Cumulative())
+	xfsBtreeKillrootDesc = DescribeMeter(
+		"/xfs/btree/killed_roots",
+		"Number of times each type of XFS btree shrank a level.",
+		Cumulative())
+	xfsBtreeIncrementDesc = DescribeMeter(
+		"/xfs/btree/increments",
+		"Number of times cursors moved to the next record of each type of "+
+			"XFS btree.",
+		Cumulative())
+	xfsBtreeDecrementDesc = DescribeMeter(
+		"/xfs/btree/decrements",
+		"Number of times cursors moved to the previous record of each type "+
+			"of XFS btree.",
+		Cumulative())
+	xfsBtreeLshiftDesc = DescribeMeter(
+		"/xfs/btree/left_shifts",
+		"Number of times records were shifted to the left sibling of a "+
+			"block of each type of XFS btree.",
+		Cumulative())
+	xfsBtreeRshiftDesc = DescribeMeter(
+		"/xfs/btree/right_shifts",
+		"Number of times records were shifted to the right sibling of a "+
+			"block of each type of XFS btree.",
+		Cumulative())
+	xfsBtreeSplitDesc = DescribeMeter(
+		"/xfs/btree/splits",
+		"Number of block splits in each type of XFS btree.",
+		Cumulative())
+	xfsBtreeJoinDesc = DescribeMeter(
+		"/xfs/btree/joins",
+		"Number of block joins in each type of XFS btree.",
+		Cumulative())
+	xfsBtreeAllocDesc = DescribeMeter(
+		"/xfs/btree/blocks_allocated",
+		"Number of blocks allocated to each type of XFS btree.",
+		Cumulative())
+	xfsBtreeFreeDesc = DescribeMeter(
+		"/xfs/btree/blocks_freed",
+		"Number of blocks freed from each type of XFS btree.",
+		Cumulative())
+	xfsBtreeMovesDesc = DescribeMeter(
+		"/xfs/btree/moves",
+		"Number of records moved within the blocks of each type of XFS "+
+			"btree.",
+		Cumulative())
+	xfsQmDqreclaimsDesc = DescribeMeter(
+		"/xfs/quota/reclaims",
+		"Number of XFS dquots reclaimed from the dquot cache.",
+		Cumulative())
+	xfsQmDqreclaimMissesDesc = DescribeMeter(
+		"/xfs/quota/reclaim_misses",
+		"Number of times an attempt to reclaim an XFS dquot failed.",
+		Cumulative())
+	xfsQmDquotDupsDesc = DescribeMeter(
+		"/xfs/quota/duplicates",
+		"Number of XFS dquots read from disk only to find that another "+
+			"process had put them in the cache meanwhile.",
+		Cumulative())
+	xfsQmDqcachemissesDesc = DescribeMeter(
+		"/xfs/quota/cache_misses",
+		"Number of lookups of XFS dquots that were not in the dquot cache.",
+		Cumulative())
+	xfsQmDqcachehitsDesc = DescribeMeter(
+		"/xfs/quota/cache_hits",
+		"Number of lookups of XFS dquots that were found in the dquot "+
+			"cache.",
+		Cumulative())
+	xfsQmDqwantsDesc = DescribeMeter(
+		"/xfs/quota/wants",
+		"Number of XFS dquots reclaimed from the free list to satisfy a "+
+			"lookup.",
+		Cumulative())
+	xfsQmDquotDesc = DescribeMeter(
+		"/xfs/quota/dquots",
+		"Number of XFS dquots in memory.")
+	xfsQmDquotUnusedDesc = DescribeMeter(
+		"/xfs/quota/unused",
+		"Number of XFS dquots in memory that are not in use, on the free "+
+			"list.")
+	xfsXPCXstratBytesDesc = DescribeMeter(
+		"/xfs/bytes_flushed",
+		"Number of bytes of file data flushed to XFS filesystems by delayed "+
+			"allocation.",
+		Cumulative())
 )
+
+// xfsLines are the lines of /proc/fs/xfs/stat that are sampled, and the
+// descriptions of their fields, in order. Meters of cumulative descriptions
+// are counters, and the rest gauges. Trailing fields without descriptions are
+// ignored, as are lines that aren't listed, which kernels add and remove.
+var xfsLines = []struct {
+	name  string
+	descs []MeterDescription
+}{
+	{"extent_alloc", []MeterDescription{xfsExtentAllocxDesc, xfsExtentAllocbDesc,
+		xfsExtentFreexDesc, xfsExtentFreebDesc}},
+	{"blk_map", []MeterDescription{xfsBlkMaprDesc, xfsBlkMapwDesc, xfsBlkUnmapDesc}},
+	{"dir", []MeterDescription{xfsDirLookupDesc, xfsDirCreateDesc, xfsDirRemoveDesc,
+		xfsDirGetdentsDesc}},
+	{"trans", []MeterDescription{xfsTransSyncDesc, xfsTransAsyncDesc, xfsTransEmptyDesc}},
+	{"ig", []MeterDescription{xfsIgAttemptsDesc, xfsIgFoundDesc, xfsIgFrecycleDesc,
+		xfsIgMissedDesc, xfsIgDupDesc, xfsIgReclaimsDesc, xfsIgAttrchgDesc}},
+	{"log", []MeterDescription{xfsLogWritesDesc, xfsLogBlocksDesc, xfsLogNoiclogsDesc,
+		xfsLogForceDesc, xfsLogForceSleepDesc}},
+	{"push_ail", []MeterDescription{xfsTryLogspaceDesc, xfsSleepLogspaceDesc,
+		xfsPushAilDesc, xfsPushAilSuccessDesc, xfsPushAilPushbufDesc,
+		xfsPushAilPinnedDesc, xfsPushAilLockedDesc, xfsPushAilFlushingDesc,
+		xfsPushAilRestartsDesc, xfsPushAilFlushDesc}},
+	{"xstrat", []MeterDescription{xfsXstratQuickDesc, xfsXstratSplitDesc}},
+	{"rw", []MeterDescription{xfsWriteCallsDesc, xfsReadCallsDesc}},
+	{"attr", []MeterDescription{xfsAttrGetDesc, xfsAttrSetDesc, xfsAttrRemoveDesc,
+		xfsAttrListDesc}},
+	{"icluster", []MeterDescription{xfsIflushCountDesc, xfsIclusterFlushcntDesc,
+		xfsIclusterFlushinodeDesc}},
+	{"vnodes", []MeterDescription{xfsVnActiveDesc, xfsVnAllocDesc, xfsVnGetDesc,
+		xfsVnHoldDesc, xfsVnReleDesc, xfsVnReclaimDesc, xfsVnRemoveDesc, xfsVnFreeDesc}},
+	{"buf", []MeterDescription{xfsBufGetDesc, xfsBufCreateDesc, xfsBufGetLockedDesc,
+		xfsBufGetLockedWaitedDesc, xfsBufBusyLockedDesc, xfsBufMissLockedDesc,
+		xfsBufPageRetriesDesc, xfsBufPageFoundDesc, xfsBufGetReadDesc}},
+	{"qm", []MeterDescription{xfsQmDqreclaimsDesc, xfsQmDqreclaimMissesDesc,
+		xfsQmDquotDupsDesc, xfsQmDqcachemissesDesc, xfsQmDqcachehitsDesc,
+		xfsQmDqwantsDesc, xfsQmDquotDesc, xfsQmDquotUnusedDesc}},
+	{"xpc", []MeterDescription{xfsXPCXstratBytesDesc, xfsXPCWriteBytesDesc,
+		xfsXPCReadBytesDesc}},
+}
+
+// xfsBtreeDescs describe the fields of the lines of the btrees of the second
+// version of the on-disk format, which all have the same fields. Their meters
+// are labeled with the name of the line.
+var xfsBtreeDescs = []MeterDescription{xfsBtreeLookupDesc, xfsBtreeCompareDesc,
+	xfsBtreeInsrecDesc, xfsBtreeDelrecDesc, xfsBtreeNewrootDesc,
+	xfsBtreeKillrootDesc, xfsBtreeIncrementDesc, xfsBtreeDecrementDesc,
+	xfsBtreeLshiftDesc, xfsBtreeRshiftDesc, xfsBtreeSplitDesc,
+	xfsBtreeJoinDesc, xfsBtreeAllocDesc, xfsBtreeFreeDesc, xfsBtreeMovesDesc}
+
+// xfsBtrees are the lines of those btrees: the free space btrees by block
+// and by count, the block map, inode, free inode, reverse map, and reference
+// count btrees.
+var xfsBtrees = []string{"abtb2", "abtc2", "bmbt2", "ibt2", "fibt2", "rmapbt", "refcntbt"}
+
+// RegisterXFSStats registers the meters of XFS with o, sampled from
+// /proc/fs/xfs/stat, which sums the statistics of all XFS filesystems. The
+// file stays open for the life of the Origin.
+func RegisterXFSStats(o *Origin) error {
+	return registerXFSStats(o, "/proc/fs/xfs/stat")
+}
+
+func registerXFSStats(o *Origin, path string) error {
+	var now time.Time
+	var ms []Meter
+	define := func(descs []MeterDescription, labels ...Label) func([][]byte) {
+		meters := make([]Meter, len(descs))
+		for i, d := range descs {
+			if d.Cumulative() {
+				meters[i] = DefineCounter(d, labels...)
+			} else {
+				meters[i] = DefineGauge(d, labels...)
+			}
+		}
+		ms = append(ms, meters...)
+		return func(fields [][]byte) {
+			for i, m := range meters[:min(len(meters), len(fields))] {
+				m.SampleAt(now, naiveAtoi(fields[i]))
+			}
+		}
+	}
+	var lfs []lineFunc
+	for _, l := range xfsLines {
+		lfs = append(lfs, lineFunc{name: []byte(l.name), f: define(l.descs)})
+	}
+	for _, b := range xfsBtrees {
+		lfs = append(lfs, lineFunc{name: []byte(b), f: define(xfsBtreeDescs, Label{Key: "btree", Value: b})})
+	}
+	fs, err := NewFileScanner(path, NewUnorderedBufferScanner(nil, lfs))
+	if err != nil {
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		fs.Scan()
+	}, ms...)
+	return nil
+}
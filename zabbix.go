@@ -0,0 +1,200 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ZabbixExporter pushes the meters of one or more Origins to a Zabbix server or
+// proxy with the sender protocol, as zabbix_sender does. Each meter becomes
+// the value of an item, which must be configured on the server with type
+// Zabbix trapper. Values the server rejects, usually because there is no such
+// item, are reported as an error from Push.
+//
+// The item key is the meter name with the path separators replaced by dots,
+// and the values of the meter labels as parameters, so /disk/reads with the
+// label device=sda is disk.reads[sda]. The item's host is the host.name
+// identity label of the Origin, or the local host name if the Origin has none.
+type ZabbixExporter struct {
+	cfg      exportConfig
+	origins  []*Origin
+	addr     string
+	hostname string
+
+	// mu protects buf, which is reused across pushes.
+	mu  sync.Mutex
+	buf []byte
+}
+
+// NewZabbixExporter returns an exporter that sends to the Zabbix server or
+// proxy at addr, which is host:port; the conventional port is 10051.
+func NewZabbixExporter(addr string, origins []*Origin, opts ...ExportOption) *ZabbixExporter {
+	hostname, _ := os.Hostname()
+	return &ZabbixExporter{
+		cfg:      newExportConfig(opts),
+		origins:  origins,
+		addr:     addr,
+		hostname: hostname,
+	}
+}
+
+// zabbixMagic begins every message, followed by the flags and the length.
+const zabbixMagic = "ZBXD\x01"
+
+type zabbixItem struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock"`
+	NS    int    `json:"ns"`
+}
+
+type zabbixRequest struct {
+	Request string       `json:"request"`
+	Data    []zabbixItem `json:"data"`
+}
+
+type zabbixResponse struct {
+	Response string `json:"response"`
+	Info     string `json:"info"`
+}
+
+// zabbixKey converts a meter name and labels to an item key.
+func zabbixKey(name string, labels []Label) string {
+	var sb strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '-', c == '.':
+		case c == '/' && sb.Len() == 0:
+			continue
+		default:
+			c = '.'
+		}
+		sb.WriteByte(c)
+	}
+	for i, l := range labels {
+		if i == 0 {
+			sb.WriteByte('[')
+		} else {
+			sb.WriteByte(',')
+		}
+		// Parameters with special characters must be quoted, and
+		// quoted parameters can only escape quotes.
+		if strings.ContainsAny(l.Value, `,]" `) || strings.HasPrefix(l.Value, "[") {
+			sb.WriteByte('"')
+			sb.WriteString(strings.ReplaceAll(l.Value, `"`, `\"`))
+			sb.WriteByte('"')
+		} else {
+			sb.WriteString(l.Value)
+		}
+	}
+	if len(labels) > 0 {
+		sb.WriteByte(']')
+	}
+	return sb.String()
+}
+
+// Push takes a snapshot of every Origin and sends it. Large Origins are sent in
+// several requests; see ExportChunkSize.
+func (e *ZabbixExporter) Push(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var req zabbixRequest
+	return e.cfg.collect(e.origins, func(_ int, snap Snapshot) error {
+		host := e.hostname
+		for _, l := range snap.Origin {
+			if l.Key == "host.name" {
+				host = l.Value
+			}
+		}
+		req = zabbixRequest{Request: "sender data", Data: req.Data[:0]}
+		for _, s := range snap.Samples {
+			if s.Time.IsZero() {
+				continue
+			}
+			req.Data = append(req.Data, zabbixItem{
+				Host:  host,
+				Key:   zabbixKey(s.Description.Name(), s.Labels),
+				Value: strconv.FormatUint(s.Value, 10),
+				Clock: s.Time.Unix(),
+				NS:    s.Time.Nanosecond(),
+			})
+		}
+		if len(req.Data) == 0 {
+			return nil
+		}
+		return e.send(ctx, &req)
+	})
+}
+
+func (e *ZabbixExporter) send(ctx context.Context, req *zabbixRequest) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	e.buf = append(e.buf[:0], zabbixMagic...)
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, uint64(len(body)))
+	e.buf = append(e.buf, body...)
+
+	// The server closes the connection after responding, so there is a
+	// connection per request.
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", e.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(e.buf); err != nil {
+		return err
+	}
+	var header [len(zabbixMagic) + 8]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(header[:], []byte("ZBXD")) {
+		return errors.New("observability: malformed zabbix response")
+	}
+	n := binary.LittleEndian.Uint32(header[len(zabbixMagic):])
+	if n > 1<<20 {
+		return errors.New("observability: zabbix response too large")
+	}
+	e.buf = append(e.buf[:0], make([]byte, n)...)
+	if _, err := io.ReadFull(conn, e.buf); err != nil {
+		return err
+	}
+	var resp zabbixResponse
+	if err := json.Unmarshal(e.buf, &resp); err != nil {
+		return fmt.Errorf("observability: malformed zabbix response: %v", err)
+	}
+	if resp.Response != "success" {
+		return fmt.Errorf("observability: zabbix: %s %s", resp.Response, resp.Info)
+	}
+	// The info looks like "processed: 1; failed: 0; total: 1; seconds
+	// spent: 0.000055".
+	var processed, failed, total int
+	fmt.Sscanf(resp.Info, "processed: %d; failed: %d; total: %d", &processed, &failed, &total)
+	if failed > 0 {
+		return fmt.Errorf("observability: zabbix rejected %d of %d items; are they configured as trapper items?", failed, total)
+	}
+	return nil
+}
+
+// Run pushes periodically until the context is done. Failed pushes are
+// reported to the function set with ExportErrors, and do not stop the loop.
+func (e *ZabbixExporter) Run(ctx context.Context) error {
+	return runPeriodically(ctx, e.cfg, e.Push)
+}
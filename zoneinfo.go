@@ -0,0 +1,153 @@
+package observability
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+)
+
+var (
+	zoneFreePagesDesc = DescribeMeter(
+		"/memory/zone/free_pages",
+		"Number of free pages in each memory zone.")
+	zoneMinWatermarkDesc = DescribeMeter(
+		"/memory/zone/min_watermark",
+		"Number of free pages below which allocations in each memory zone "+
+			"must reclaim memory directly, and only atomic ones succeed. "+
+			"Its distance from `/memory/zone/free_pages` is the headroom "+
+			"before allocations stall.")
+	zoneLowWatermarkDesc = DescribeMeter(
+		"/memory/zone/low_watermark",
+		"Number of free pages below which kswapd is woken to reclaim memory "+
+			"in each memory zone.")
+	zoneHighWatermarkDesc = DescribeMeter(
+		"/memory/zone/high_watermark",
+		"Number of free pages at which kswapd stops reclaiming memory in each "+
+			"memory zone.")
+	zoneFreeBlocksDesc = DescribeMeter(
+		"/memory/zone/free_blocks",
+		"Number of free blocks of 2^order contiguous pages in each memory "+
+			"zone. When the blocks of higher orders run out, allocations of "+
+			"them fail or must compact memory, however many pages are free.")
+)
+
+// zoneMeters are the meters of a memory zone.
+type zoneMeters struct {
+	node, zone           string
+	free, min, low, high Meter
+	// blocks are the free blocks of each order.
+	blocks []Meter
+}
+
+// RegisterMemoryZoneStats registers meters of the free memory of each zone of
+// each NUMA node with o, to track the fragmentation that leads to failures of
+// allocations of contiguous pages. The free blocks of each order are sampled
+// from /proc/buddyinfo, and the free pages and watermarks from /proc/zoneinfo;
+// the meters are labeled with the node, the zone, and for blocks, the order.
+// The zones are those with memory at registration. The files stay open for the
+// life of the Origin.
+func RegisterMemoryZoneStats(o *Origin) error {
+	return registerMemoryZoneStats(o, "/proc/buddyinfo", "/proc/zoneinfo")
+}
+
+func registerMemoryZoneStats(o *Origin, buddyinfo, zoneinfo string) error {
+	// The lines of /proc/buddyinfo are like "Node 0, zone DMA32 2 2 ...",
+	// with the number of free blocks of each order from zero.
+	var zones []*zoneMeters
+	var ms []Meter
+	rs := NewRowScanner(func(fields [][]byte) {
+		node, zone := string(fields[1]), string(fields[3])
+		labels := []Label{{Key: "node", Value: node}, {Key: "zone", Value: zone}}
+		z := &zoneMeters{
+			node: node,
+			zone: zone,
+			free: DefineGauge(zoneFreePagesDesc, labels...),
+			min:  DefineGauge(zoneMinWatermarkDesc, labels...),
+			low:  DefineGauge(zoneLowWatermarkDesc, labels...),
+			high: DefineGauge(zoneHighWatermarkDesc, labels...),
+		}
+		ms = append(ms, z.free, z.min, z.low, z.high)
+		for order := range fields[4:] {
+			m := DefineGauge(zoneFreeBlocksDesc, append(labels,
+				Label{Key: "order", Value: strconv.Itoa(order)})...)
+			z.blocks = append(z.blocks, m)
+			ms = append(ms, m)
+		}
+		zones = append(zones, z)
+	}, fieldIn(0, "Node"), minFields(4))
+	rs.SetDelimiters(",")
+	fs, err := NewFileScanner(buddyinfo, rs)
+	if err != nil {
+		return err
+	}
+	err = fs.Scan()
+	fs.Close()
+	if err != nil {
+		return err
+	}
+
+	// find returns the meters of a zone, or nil.
+	find := func(node, zone []byte) *zoneMeters {
+		for _, z := range zones {
+			if string(node) == z.node && string(zone) == z.zone {
+				return z
+			}
+		}
+		return nil
+	}
+	var now time.Time
+	rs = NewRowScanner(func(fields [][]byte) {
+		z := find(fields[1], fields[3])
+		if z == nil {
+			return
+		}
+		for i, m := range z.blocks[:min(len(z.blocks), len(fields)-4)] {
+			m.SampleAt(now, naiveAtoi(fields[4+i]))
+		}
+	}, fieldIn(0, "Node"), minFields(4))
+	rs.SetDelimiters(",")
+	buddy, err := NewFileScanner(buddyinfo, rs)
+	if err != nil {
+		return err
+	}
+	// The stanzas of /proc/zoneinfo begin with lines like
+	// "Node 0, zone DMA32", and hold "pages free 774334", "min 9563", and
+	// so on. The first of each node also holds the statistics of the node.
+	ss := NewStanzaScanner("Node", func(header, fields [][]byte) {
+		if len(header) < 4 || len(fields) < 2 {
+			return
+		}
+		z := find(bytes.TrimSuffix(header[1], []byte(",")), header[3])
+		if z == nil {
+			return
+		}
+		var m Meter
+		switch string(fields[0]) {
+		case "pages":
+			if len(fields) == 3 && string(fields[1]) == "free" {
+				z.free.SampleAt(now, naiveAtoi(fields[2]))
+			}
+			return
+		case "min":
+			m = z.min
+		case "low":
+			m = z.low
+		case "high":
+			m = z.high
+		default:
+			return
+		}
+		m.SampleAt(now, naiveAtoi(fields[1]))
+	})
+	zone, err := NewFileScanner(zoneinfo, ss)
+	if err != nil {
+		buddy.Close()
+		return err
+	}
+	o.RegisterFunction(func() {
+		now = time.Now()
+		buddy.Scan()
+		zone.Scan()
+	}, ms...)
+	return nil
+}